@@ -1,7 +1,10 @@
 package main
 
 import (
-	"log/slog"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,23 +15,51 @@ import (
 )
 
 func main() {
-	var conf *config.Config
-	var log *slog.Logger
+	conf, opts, err := config.Load(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "cannot load config:", err)
+		os.Exit(1)
+	}
+
+	if opts.PrintConfig {
+		if err := conf.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot print config:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	conf = config.MustLoad()
-	log = logs.InitLog(conf.Env)
+	settings := config.NewSettings(conf.Runtime)
+	log := logs.InitLog(conf.Env, settings.Level())
+	log.Info("configuration successfully loaded", "file", opts.ConfigPath)
 
-	application := app.New(conf, log)
+	application, err := app.New(conf, log, settings)
+	if err != nil {
+		log.Error("cannot create the application", "error", err)
+		os.Exit(1)
+	}
 
-	go func() {
-		application.MustStart()
-	}()
+	// the config is read again with the same arguments, so the flags keep overriding the file on a reload
+	watcher := config.NewWatcher(log, conf, opts.ConfigPath, func() (*config.Config, error) {
+		next, _, err := config.Load(os.Args[1:])
+		return next, err
+	}, settings)
+	watcher.Start()
 
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runErr := application.Run(ctx)
+
+	if err := watcher.Stop(); err != nil {
+		log.Error("failed to stop the config watcher", "error", err)
+	}
 
-	<-done
-	if err := application.Stop(); err != nil {
-		log.Error("an error occurred when stopping the application", "error", err)
+	if runErr != nil {
+		log.Error("the application stopped with an error", "error", runErr)
+		os.Exit(1)
 	}
 }
@@ -1,76 +1,252 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/EvansTrein/iqProgers/internal/config"
+	walletgrpc "github.com/EvansTrein/iqProgers/internal/grpc"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/outbox"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
 	"github.com/EvansTrein/iqProgers/internal/server"
 	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/storages/memory"
 	"github.com/EvansTrein/iqProgers/internal/storages/postgres"
+	"github.com/EvansTrein/iqProgers/internal/storages/sqlite"
+	"github.com/EvansTrein/iqProgers/internal/tracing"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// storage is what the application needs from a storage driver
+type storage interface {
+	storages.StoreWallet
+	storages.StoreSchedule
+	storages.StoreWebhook
+	storages.StoreOutbox
+	storages.StoreAccount
+	storages.StoreHealth
+	Close() error
+}
+
+// poolStorage is a storage with a connection pool whose state is exported in the metrics
+type poolStorage interface {
+	Stat() *pgxpool.Stat
+}
+
+// readinessDrainDelay is the time between /readyz starting to return 503 and the HTTP server stopping,
+// so the load balancer notices it and stops sending new requests
+const readinessDrainDelay = time.Second * 2
+
 type App struct {
-	server *server.HttpServer
-	log    *slog.Logger
-	conf   *config.Config
-	db     *postgres.PostgresDB
-	wallet *services.Wallet
+	server    *server.HttpServer
+	log       *slog.Logger
+	conf      *config.Config
+	db        storage
+	wallet    *services.Wallet
+	scheduler *services.Scheduler
+	webhooks  *services.Webhooks
+	relay     *outbox.Relay
+	// grpc is nil if GRPC_PORT is not set
+	grpc *walletgrpc.Server
+	// drainDelay is readinessDrainDelay, the tests make it shorter
+	drainDelay time.Duration
+	// shutdownTracing flushes the spans that are not exported yet
+	shutdownTracing func(ctx context.Context) error
 }
 
-func New(conf *config.Config, log *slog.Logger) *App {
+// New creates the application, settings are the runtime settings of conf, they are replaced on a config reload
+func New(conf *config.Config, log *slog.Logger, settings *config.Settings) (*App, error) {
 	log.Debug("application: creation is started")
 
-	httpServer := server.New(log, &conf.HTTPServer)
+	var db storage
+	switch conf.StorageDriver {
+	case config.StorageDriverMemory:
+		db = memory.New(log)
+	case config.StorageDriverSQLite:
+		lite, err := sqlite.New(conf.StoragePath, &conf.Storage, log)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open the SQLite storage: %w", err)
+		}
+		db = lite
+	default:
+		pg, err := postgres.New(conf.StoragePath, &conf.Storage, log)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to Postgres: %w", err)
+		}
+		db = pg
+	}
 
-	db, err := postgres.New(conf.StoragePath, log)
+	app, err := newApp(conf, log, settings, db)
 	if err != nil {
-		panic(err)
+		db.Close()
+		return nil, err
 	}
 
-	wallet := services.New(log, db)
+	return app, nil
+}
 
-	httpServer.InitRouters(wallet)
+// newApp creates the application over an open storage, the tests pass their own storage here
+func newApp(conf *config.Config, log *slog.Logger, settings *config.Settings, db storage) (*App, error) {
+	exporter, err := tracing.NewExporter(context.Background(), &conf.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the tracing exporter: %w", err)
+	}
 
-	return &App{
-		server: httpServer,
-		log:  log,
-		conf: conf,
-		db:   db,
-		wallet: wallet,
+	limiter, err := ratelimit.New(conf.HTTPServer.RateLimit.Backend)
+	if err != nil {
+		return nil, err
 	}
+
+	shutdownTracing := tracing.Setup(conf.Tracing.ServiceName, exporter)
+
+	appMetrics := metrics.New()
+	if pool, ok := db.(poolStorage); ok {
+		appMetrics.RegisterPool(pool.Stat)
+	}
+	httpServer := server.New(log, &conf.HTTPServer, settings, appMetrics)
+
+	webhooks := services.NewWebhooks(log, db, &conf.Webhooks)
+	broker := services.NewBroker(log)
+	wallet := services.New(log, db, appMetrics, settings, broker)
+	scheduler := services.NewScheduler(log, db, wallet, settings)
+
+	httpServer.InitRouters(wallet, scheduler, broker, limiter)
+	httpServer.InitHealthRouters(db)
+	httpServer.InitAdminRouters(webhooks)
+
+	var grpcServer *walletgrpc.Server
+	if conf.GRPC.Enabled() {
+		grpcServer = walletgrpc.New(log, &conf.GRPC, settings, limiter, &conf.HTTPServer.RateLimit)
+		grpcServer.Register(wallet, services.NewAccounts(log, db), broker)
+	}
+
+	var publisher outbox.Publisher = webhooks
+	if conf.Outbox.Publisher == config.OutboxPublisherLog {
+		publisher = outbox.NewLogPublisher(log)
+	}
+	relay := outbox.NewRelay(log, db, publisher, &conf.Outbox)
+
+	return &App{
+		server:     httpServer,
+		grpc:       grpcServer,
+		log:        log,
+		conf:       conf,
+		db:         db,
+		wallet:     wallet,
+		scheduler:  scheduler,
+		webhooks:   webhooks,
+		relay:      relay,
+		drainDelay: readinessDrainDelay,
+
+		shutdownTracing: shutdownTracing,
+	}, nil
 }
 
-func (a *App) MustStart() {
+// Run starts the application and stops it when ctx is done, e.g. on SIGTERM. If the HTTP or the gRPC server cannot
+// start or fails, the application is stopped as well and the error is returned.
+func (a *App) Run(ctx context.Context) error {
 	a.log.Debug("application: started")
 
-	a.log.Info("application: successfully started", "port", a.conf.HTTPServer.Port)
-	if err := a.server.Start(); err != nil {
-		panic(err)
+	a.scheduler.Start()
+	a.webhooks.Start()
+	a.relay.Start()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- a.server.Start()
+	}()
+	if a.grpc != nil {
+		go func() {
+			serverErr <- a.grpc.Start()
+		}()
+	}
+
+	a.log.Info("application: successfully started", "port", a.conf.HTTPServer.Port, "grpc port", a.conf.GRPC.Port)
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		a.log.Info("application: stop signal received")
+	case runErr = <-serverErr:
+		a.log.Error("application: server failed", "error", runErr)
 	}
+
+	return errors.Join(runErr, a.Stop())
 }
 
+// Stop shuts the application down in order: the HTTP and the gRPC servers stop accepting new requests and wait for
+// the requests in progress, the scheduler finishes its run, the Wallet waits for all calls in progress, the outbox relay and the webhook
+// deliveries stop, and only then the storage is closed, so no operation is cut in the middle. The events that are not
+// published yet stay in the outbox until the next start. A failed step does not stop the next ones, except the storage:
+// it is not closed while the Wallet calls are still running. The HTTP server and the Wallet share one deadline of
+// HTTP_SHUTDOWN_TIMEOUT, so together they never wait longer than that.
 func (a *App) Stop() error {
 	a.log.Debug("application: stop started")
 
-	if err := a.server.Stop(); err != nil {
-		a.log.Error("failed to stop HTTP server")
-		return err
+	a.server.SetShuttingDown()
+	// a server that never started listening, e.g. on a busy port, has no load balancer traffic to drain
+	if a.server.Listening() {
+		time.Sleep(a.drainDelay)
 	}
 
-	if err := a.db.Close(); err != nil {
-		a.log.Error("failed to close the database connection")
-		return err
+	ctx, cancel := context.WithTimeout(context.Background(), a.conf.HTTPServer.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+
+	if err := a.server.Stop(ctx); err != nil {
+		a.log.Error("failed to stop HTTP server", "error", err)
+		errs = append(errs, err)
 	}
 
-	if err := a.wallet.Stop(); err != nil {
-		a.log.Error("failed to stop the Wallet service")
-		return err
+	if a.grpc != nil {
+		if err := a.grpc.Stop(); err != nil {
+			a.log.Error("failed to stop gRPC server", "error", err)
+			errs = append(errs, err)
+		}
 	}
 
-	a.server = nil
-	a.wallet = nil
-	a.db = nil
+	if err := a.scheduler.Stop(); err != nil {
+		a.log.Error("failed to stop the Scheduler service", "error", err)
+		errs = append(errs, err)
+	}
+
+	walletErr := a.wallet.Stop(ctx)
+	if walletErr != nil {
+		a.log.Error("failed to stop the Wallet service, the database connection is left open", "error", walletErr)
+		errs = append(errs, walletErr)
+	}
+
+	if err := a.relay.Stop(); err != nil {
+		a.log.Error("failed to stop the outbox Relay", "error", err)
+		errs = append(errs, err)
+	}
+
+	if err := a.webhooks.Stop(); err != nil {
+		a.log.Error("failed to stop the Webhooks service", "error", err)
+		errs = append(errs, err)
+	}
+
+	if walletErr == nil {
+		if err := a.db.Close(); err != nil {
+			a.log.Error("failed to close the database connection", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if err := a.shutdownTracing(ctx); err != nil {
+		a.log.Error("failed to flush the spans", "error", err)
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
 
 	a.log.Info("application: stop successful")
 	return nil
-}
\ No newline at end of file
+}
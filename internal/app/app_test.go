@@ -0,0 +1,316 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages/memory"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+
+	os.Exit(m.Run())
+}
+
+// slowStorage is the in-memory storage whose transfers wait for release, it records the order of the events
+type slowStorage struct {
+	*memory.MemoryDB
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+
+	mu     sync.Mutex
+	events []string
+}
+
+func newSlowStorage() *slowStorage {
+	return &slowStorage{
+		MemoryDB: memory.New(logs.NewDiscardLogger()),
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+}
+
+func (s *slowStorage) Transfer(ctx context.Context, data *models.Transaction) error {
+	s.once.Do(func() { close(s.entered) })
+	<-s.release
+
+	err := s.MemoryDB.Transfer(ctx, data)
+	s.record("transfer finished")
+	return err
+}
+
+func (s *slowStorage) Close() error {
+	s.record("storage closed")
+	return s.MemoryDB.Close()
+}
+
+func (s *slowStorage) record(event string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *slowStorage) recorded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.events...)
+}
+
+// freePort returns a port nobody listens on right now
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	conf := &config.Config{Env: "local", StorageDriver: config.StorageDriverMemory}
+	conf.Address = "127.0.0.1"
+	conf.Port = freePort(t)
+	conf.HandlerTimeout = time.Second * 5
+	conf.ShutdownTimeout = time.Second * 5
+	conf.MaxBodyBytes = 1 << 20
+	conf.RateLimit.Backend = "memory"
+	conf.Tracing.Exporter = config.TracingExporterNone
+	conf.Webhooks = config.Webhooks{
+		Interval:     time.Second * 5,
+		Timeout:      time.Second * 5,
+		MaxAttempts:  8,
+		BackoffStart: time.Second * 10,
+		BackoffMax:   time.Hour,
+	}
+	conf.Outbox = config.Outbox{
+		Publisher: config.OutboxPublisherWebhook,
+		Interval:  time.Millisecond * 50,
+		BatchSize: 100,
+	}
+
+	return conf
+}
+
+// startApp runs the application until SIGTERM, the error of Run is sent to the returned channel
+func startApp(t *testing.T, conf *config.Config, db storage) (string, <-chan error) {
+	t.Helper()
+
+	log := logs.NewDiscardLogger()
+	application, err := newApp(conf, log, config.NewSettings(config.Runtime{}), db)
+	require.NoError(t, err)
+	application.drainDelay = 0
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	t.Cleanup(stop)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- application.Run(ctx)
+	}()
+
+	url := "http://" + conf.Address + ":" + conf.Port
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(url + "/healthz")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second*5, time.Millisecond*20)
+
+	return url, runErr
+}
+
+func post(url, key, body string) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// createUsers makes the deposits to the users 1 and 2, so a transfer between them gets to the storage
+func createUsers(t *testing.T, url string) {
+	t.Helper()
+
+	deposits := map[string]string{
+		"42dd3893-9baf-43ac-8c2b-32231f486b87": `{"id": 1, "amount": 100}`,
+		"3f1c2b4a-6d5e-4f70-8a9b-0c1d2e3f4a5b": `{"id": 2, "amount": 1}`,
+	}
+	for key, body := range deposits {
+		status, err := post(url+"/deposit", key, body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, status)
+	}
+}
+
+// TestRun_SIGTERMDuringTransfer sends SIGTERM while a transfer is in the storage: the transfer must finish
+// and get its response, and the storage must be closed only after it
+func TestRun_SIGTERMDuringTransfer(t *testing.T) {
+	db := newSlowStorage()
+	url, runErr := startApp(t, testConfig(t), db)
+
+	createUsers(t, url)
+
+	transferStatus := make(chan int, 1)
+	go func() {
+		status, err := post(url+"/transfer", "5a4a3c1e-8f0b-4d2e-9c55-0b7f6e0f9a11", `{"sender_id": 1, "receiver_id": 2, "amount": 40}`)
+		assert.NoError(t, err)
+		transferStatus <- status
+	}()
+
+	<-db.entered
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+
+	select {
+	case err := <-runErr:
+		t.Fatalf("the application stopped before the transfer finished: %v", err)
+	case <-time.After(time.Millisecond * 200):
+	}
+
+	// the server does not accept new connections anymore
+	_, err := http.Get(url + "/healthz")
+	assert.Error(t, err)
+
+	close(db.release)
+
+	assert.Equal(t, http.StatusOK, <-transferStatus)
+	assert.NoError(t, <-runErr)
+	assert.Equal(t, []string{"transfer finished", "storage closed"}, db.recorded())
+}
+
+// TestRun_ShutdownTimeout leaves the storage open if the transfer does not finish in HTTP_SHUTDOWN_TIMEOUT
+func TestRun_ShutdownTimeout(t *testing.T) {
+	conf := testConfig(t)
+	conf.ShutdownTimeout = time.Millisecond * 100
+
+	db := newSlowStorage()
+	url, runErr := startApp(t, conf, db)
+	t.Cleanup(func() { close(db.release) })
+
+	createUsers(t, url)
+	go post(url+"/transfer", "5a4a3c1e-8f0b-4d2e-9c55-0b7f6e0f9a11", `{"sender_id": 1, "receiver_id": 2, "amount": 40}`)
+
+	<-db.entered
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	stopped := time.Now()
+
+	err := <-runErr
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	// the HTTP server and the Wallet wait under one deadline, not one after another
+	assert.Less(t, time.Since(stopped), conf.ShutdownTimeout*2)
+	assert.Empty(t, db.recorded(), "the storage must stay open while the transfer is running")
+}
+
+func TestRun_ServerFails(t *testing.T) {
+	conf := testConfig(t)
+
+	l, err := net.Listen("tcp", conf.Address+":"+conf.Port)
+	require.NoError(t, err)
+	defer l.Close()
+
+	application, err := newApp(conf, logs.NewDiscardLogger(), config.NewSettings(config.Runtime{}), newSlowStorage())
+	require.NoError(t, err)
+	// the server never listened, so Run must not wait for the drain
+	application.drainDelay = time.Minute
+
+	start := time.Now()
+	err = application.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "address already in use")
+	assert.Less(t, time.Since(start), time.Second*10)
+}
+
+// TestRun_Webhooks subscribes a local receiver to the events of the user 1 by the admin API and waits for the event
+// of the deposit to the user, which goes from the outbox through the relay to the webhook deliveries
+func TestRun_Webhooks(t *testing.T) {
+	events := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		events <- r
+		bodies <- body
+	}))
+	t.Cleanup(receiver.Close)
+
+	conf := testConfig(t)
+	conf.AdminToken = "admin-secret"
+	url, runErr := startApp(t, conf, newSlowStorage())
+
+	secret := "0123456789abcdef0123456789abcdef"
+	req, err := http.NewRequest(http.MethodPost, url+"/admin/webhooks",
+		strings.NewReader(`{"user_id": 1, "url": "`+receiver.URL+`", "secret": "`+secret+`"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+conf.AdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	createUsers(t, url)
+
+	select {
+	case r := <-events:
+		body := <-bodies
+		assert.Equal(t, services.EventDepositCompleted, r.Header.Get(services.HeaderWebhookEvent))
+
+		signature := r.Header.Get(services.HeaderWebhookSignature)
+		timestamp, v1, ok := strings.Cut(strings.TrimPrefix(signature, "t="), ",v1=")
+		require.True(t, ok, signature)
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, services.Signature(secret, unix, body), v1)
+
+		var event models.Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, uint(1), event.Data.UserID)
+		assert.Equal(t, float64(100), event.Data.Amount)
+	case <-time.After(time.Second * 5):
+		t.Fatal("the event is not delivered")
+	}
+
+	// the deposit to the user 2 is not sent to the subscription of the user 1
+	select {
+	case r := <-events:
+		t.Fatalf("unexpected event %s", r.Header.Get(services.HeaderWebhookID))
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	assert.NoError(t, <-runErr)
+}
@@ -1,39 +1,419 @@
 package config
 
 import (
-	"flag"
-	"log"
-	"os"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
 
-	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
 )
 
+// Storage drivers that can be selected with STORAGE_DRIVER
+const (
+	StorageDriverPostgres = "postgres"
+	StorageDriverSQLite   = "sqlite"
+	StorageDriverMemory   = "memory"
+)
+
+// Tracing exporters that can be selected with TRACING_EXPORTER
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+// Publishers of the outbox events that can be selected with OUTBOX_PUBLISHER
+const (
+	OutboxPublisherWebhook = "webhook"
+	OutboxPublisherLog     = "log"
+)
+
+// Routes whose handler timeout and rate limit can be changed with HTTP_HANDLER_TIMEOUTS and HTTP_RATE_LIMIT_ROUTES.
+// RouteEvents is a stream without a handler timeout, only its rate limit can be changed.
+const (
+	RouteDeposit       = "deposit"
+	RouteTransfer      = "transfer"
+	RouteTransferBatch = "transfer_batch"
+	RouteOperations    = "operations"
+	RouteSchedules     = "schedules"
+	RouteEvents        = "events"
+)
+
+var routes = []string{RouteDeposit, RouteTransfer, RouteTransferBatch, RouteOperations, RouteSchedules, RouteEvents}
+
+// Keys of a client that can be selected with HTTP_RATE_LIMIT_KEY_BY
+const (
+	RateLimitKeyAPIKey = "api_key"
+	RateLimitKeyUser   = "user"
+	RateLimitKeyIP     = "ip"
+)
+
+var rateLimitKeys = []string{RateLimitKeyAPIKey, RateLimitKeyUser, RateLimitKeyIP}
+
 type Config struct {
-	Env         string `env:"ENV" env-required:"true"`
-	StoragePath string `env:"STORAGE_PATH" env-required:"true"`
-	HTTPServer  `env-prefix:"HTTP_"`
+	Env           string `env:"ENV" yaml:"env" toml:"env"`
+	StorageDriver string `env:"STORAGE_DRIVER" env-default:"postgres" yaml:"storage_driver" toml:"storage_driver"`
+	StoragePath   string `env:"STORAGE_PATH" yaml:"storage_path" toml:"storage_path"`
+	Storage       `env-prefix:"STORAGE_" yaml:"storage" toml:"storage"`
+	HTTPServer    `env-prefix:"HTTP_" yaml:"http" toml:"http"`
+	Tracing       `env-prefix:"TRACING_" yaml:"tracing" toml:"tracing"`
+	Webhooks      `env-prefix:"WEBHOOK_" yaml:"webhooks" toml:"webhooks"`
+	Outbox        `env-prefix:"OUTBOX_" yaml:"outbox" toml:"outbox"`
+	Runtime       `yaml:"runtime" toml:"runtime"`
+
+	// GRPC is not embedded, its fields have the same names as the ones of HTTPServer
+	GRPC GRPC `env-prefix:"GRPC_" yaml:"grpc" toml:"grpc"`
 }
 
+// HTTPServer configures the HTTP server. HandlerTimeout is the time a handler has to get the result from the service,
+// HandlerTimeouts overrides it for separate routes, e.g. HTTP_HANDLER_TIMEOUTS=transfer_batch:30s,deposit:3s.
+// WriteTimeout must be longer than any handler timeout, otherwise the response of a slow handler is cut off.
+// AdminToken is the bearer token of the /admin routes, they are not registered if it is empty. The client IP is taken
+// from X-Forwarded-For only if the request comes from one of TrustedProxies (IPs or CIDRs), by default from none.
 type HTTPServer struct {
-	Address string `env:"ADDRESS"`
-	Port    string `env:"API_PORT"`
+	Address           string                   `env:"ADDRESS" yaml:"address" toml:"address"`
+	Port              string                   `env:"API_PORT" yaml:"port" toml:"port"`
+	ReadTimeout       time.Duration            `env:"READ_TIMEOUT" env-default:"10s" yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration            `env:"READ_HEADER_TIMEOUT" env-default:"5s" yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration            `env:"WRITE_TIMEOUT" env-default:"15s" yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration            `env:"IDLE_TIMEOUT" env-default:"60s" yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration            `env:"SHUTDOWN_TIMEOUT" env-default:"10s" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	MaxHeaderBytes    int                      `env:"MAX_HEADER_BYTES" env-default:"1048576" yaml:"max_header_bytes" toml:"max_header_bytes"`
+	MaxBodyBytes      int64                    `env:"MAX_BODY_BYTES" env-default:"1048576" yaml:"max_body_bytes" toml:"max_body_bytes"`
+	HandlerTimeout    time.Duration            `env:"HANDLER_TIMEOUT" env-default:"5s" yaml:"handler_timeout" toml:"handler_timeout"`
+	HandlerTimeouts   map[string]time.Duration `env:"HANDLER_TIMEOUTS" yaml:"handler_timeouts" toml:"handler_timeouts"`
+	AdminToken        string                   `env:"ADMIN_TOKEN" yaml:"admin_token" toml:"admin_token"`
+	TrustedProxies    []string                 `env:"TRUSTED_PROXIES" yaml:"trusted_proxies,omitempty" toml:"trusted_proxies"`
+	RateLimit         RateLimit                `env-prefix:"RATE_LIMIT_" yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// HandlerTimeoutFor returns the handler timeout of the route
+func (c *HTTPServer) HandlerTimeoutFor(route string) time.Duration {
+	if timeout, ok := c.HandlerTimeouts[route]; ok {
+		return timeout
+	}
+
+	return c.HandlerTimeout
+}
+
+// GRPC configures the gRPC server, it is not started if Port is empty. A call waits for the result of the service
+// no longer than HandlerTimeout, a shorter deadline of the client is kept. Stop waits for the calls in progress
+// no longer than ShutdownTimeout, the WatchOperations streams are closed at once.
+type GRPC struct {
+	Address         string        `env:"ADDRESS" yaml:"address" toml:"address"`
+	Port            string        `env:"PORT" yaml:"port" toml:"port"`
+	HandlerTimeout  time.Duration `env:"HANDLER_TIMEOUT" env-default:"5s" yaml:"handler_timeout" toml:"handler_timeout"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" env-default:"10s" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// Enabled reports whether the gRPC server is started
+func (c *GRPC) Enabled() bool {
+	return c.Port != ""
+}
+
+func (c *GRPC) validate() []error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	var errs []error
+
+	if c.HandlerTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("GRPC_HANDLER_TIMEOUT must be greater than 0, got %s", c.HandlerTimeout))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("GRPC_SHUTDOWN_TIMEOUT must be greater than 0, got %s", c.ShutdownTimeout))
+	}
+
+	return errs
+}
+
+// RateLimit configures the token bucket limiter of the API. A quota is <requests>/<period>, e.g. 20/1s. Default is the
+// quota of every route, Routes overrides it per route (HTTP_RATE_LIMIT_ROUTES=transfer:5/1s,transfer_batch:1/1s),
+// an empty quota means no limit. KeyBy is the order in which the client is identified: the X-API-Key header,
+// the user of the operation, the IP, the first one found in the request is used. Only the keys of APIKeys are
+// accepted, any other X-API-Key is ignored. The user is taken from the request, so the bucket of the IP is charged
+// together with the bucket of the user, a client cannot get around the quota by changing the user in its requests.
+type RateLimit struct {
+	Backend string            `env:"BACKEND" env-default:"memory" yaml:"backend" toml:"backend"`
+	Default string            `env:"DEFAULT" yaml:"default" toml:"default"`
+	Routes  map[string]string `env:"ROUTES" yaml:"routes,omitempty" toml:"routes"`
+	KeyBy   []string          `env:"KEY_BY" env-default:"user,ip" yaml:"key_by" toml:"key_by"`
+	APIKeys []string          `env:"API_KEYS" yaml:"api_keys,omitempty" toml:"api_keys"`
+}
+
+// KnownAPIKey reports whether key is one of APIKeys
+func (c *RateLimit) KnownAPIKey(key string) bool {
+	return key != "" && slices.Contains(c.APIKeys, key)
 }
 
-func MustLoad() *Config {
-	var cfg Config
-	var filePath string
+// QuotaFor returns the quota of the route, an empty string means no limit
+func (c *RateLimit) QuotaFor(route string) string {
+	if quota, ok := c.Routes[route]; ok {
+		return quota
+	}
+
+	return c.Default
+}
+
+func (c *RateLimit) validate() []error {
+	var errs []error
+
+	if c.Backend != ratelimit.BackendMemory {
+		errs = append(errs, fmt.Errorf("HTTP_RATE_LIMIT_BACKEND: unknown rate limit backend %q", c.Backend))
+	}
+
+	if c.Default != "" {
+		if _, err := ratelimit.ParseQuota(c.Default); err != nil {
+			errs = append(errs, fmt.Errorf("HTTP_RATE_LIMIT_DEFAULT: %w", err))
+		}
+	}
+
+	for route, quota := range c.Routes {
+		if !slices.Contains(routes, route) {
+			errs = append(errs, fmt.Errorf("HTTP_RATE_LIMIT_ROUTES: unknown route %q, known routes: %v", route, routes))
+			continue
+		}
+		if quota == "" {
+			continue
+		}
+		if _, err := ratelimit.ParseQuota(quota); err != nil {
+			errs = append(errs, fmt.Errorf("HTTP_RATE_LIMIT_ROUTES: route %q: %w", route, err))
+		}
+	}
+
+	for _, key := range c.KeyBy {
+		if !slices.Contains(rateLimitKeys, key) {
+			errs = append(errs, fmt.Errorf("HTTP_RATE_LIMIT_KEY_BY: unknown key %q, known keys: %v", key, rateLimitKeys))
+		}
+	}
+
+	if len(c.KeyBy) == 0 {
+		errs = append(errs, errors.New("HTTP_RATE_LIMIT_KEY_BY must not be empty"))
+	}
+
+	if slices.Contains(c.KeyBy, RateLimitKeyAPIKey) && len(c.APIKeys) == 0 {
+		errs = append(errs, errors.New("HTTP_RATE_LIMIT_KEY_BY: api_key needs the accepted keys in HTTP_RATE_LIMIT_API_KEYS"))
+	}
+
+	return errs
+}
+
+// Storage configures the connection pool. Zero MaxConns keeps the default of the driver, zero StatementTimeout
+// means no limit (Postgres only, SQLite queries are limited by the handler timeouts).
+type Storage struct {
+	MaxConns         int32         `env:"MAX_CONNS" env-default:"10" yaml:"max_conns" toml:"max_conns"`
+	MinConns         int32         `env:"MIN_CONNS" env-default:"0" yaml:"min_conns" toml:"min_conns"`
+	ConnMaxLifetime  time.Duration `env:"CONN_MAX_LIFETIME" env-default:"1h" yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime  time.Duration `env:"CONN_MAX_IDLE_TIME" env-default:"30m" yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	StatementTimeout time.Duration `env:"STATEMENT_TIMEOUT" env-default:"0s" yaml:"statement_timeout" toml:"statement_timeout"`
+}
+
+// Tracing configures OpenTelemetry. OTLPEndpoint is host:port of the collector (OTLP over HTTP), if it is empty
+// the OTEL_EXPORTER_OTLP_* environment variables or the default localhost:4318 are used.
+type Tracing struct {
+	Exporter     string `env:"EXPORTER" env-default:"none" yaml:"exporter" toml:"exporter"`
+	OTLPEndpoint string `env:"OTLP_ENDPOINT" yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	ServiceName  string `env:"SERVICE_NAME" env-default:"wallet" yaml:"service_name" toml:"service_name"`
+}
+
+// Webhooks configures the delivery of the webhook events. The deliveries that are due are sent every Interval,
+// a request waits for the answer no longer than Timeout. A failed delivery is retried after BackoffStart, the delay
+// doubles with every attempt up to BackoffMax, after MaxAttempts attempts the delivery is dead and is not sent again.
+type Webhooks struct {
+	Interval     time.Duration `env:"INTERVAL" env-default:"5s" yaml:"interval" toml:"interval"`
+	Timeout      time.Duration `env:"TIMEOUT" env-default:"5s" yaml:"timeout" toml:"timeout"`
+	MaxAttempts  int           `env:"MAX_ATTEMPTS" env-default:"8" yaml:"max_attempts" toml:"max_attempts"`
+	BackoffStart time.Duration `env:"BACKOFF_START" env-default:"10s" yaml:"backoff_start" toml:"backoff_start"`
+	BackoffMax   time.Duration `env:"BACKOFF_MAX" env-default:"1h" yaml:"backoff_max" toml:"backoff_max"`
+}
 
-	flag.StringVar(&filePath, "config", "", "path to config file")
-	flag.Parse()
+func (c *Webhooks) validate() []error {
+	var errs []error
+
+	positive := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"WEBHOOK_INTERVAL", c.Interval},
+		{"WEBHOOK_TIMEOUT", c.Timeout},
+		{"WEBHOOK_BACKOFF_START", c.BackoffStart},
+		{"WEBHOOK_BACKOFF_MAX", c.BackoffMax},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than 0, got %s", p.name, p.value))
+		}
+	}
+
+	if c.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be greater than 0, got %d", c.MaxAttempts))
+	}
+
+	if c.BackoffStart > c.BackoffMax {
+		errs = append(errs, fmt.Errorf("WEBHOOK_BACKOFF_START (%s) must not be longer than WEBHOOK_BACKOFF_MAX (%s)", c.BackoffStart, c.BackoffMax))
+	}
+
+	return errs
+}
+
+// Outbox configures the relay of the events from the outbox table. Every Interval up to BatchSize unpublished events
+// are passed to the Publisher, a full batch is followed by the next one at once. The webhook publisher sends the events
+// to the webhook subscriptions, the log publisher only writes them to the log.
+type Outbox struct {
+	Publisher string        `env:"PUBLISHER" env-default:"webhook" yaml:"publisher" toml:"publisher"`
+	Interval  time.Duration `env:"INTERVAL" env-default:"1s" yaml:"interval" toml:"interval"`
+	BatchSize int           `env:"BATCH_SIZE" env-default:"100" yaml:"batch_size" toml:"batch_size"`
+}
+
+func (c *Outbox) validate() []error {
+	var errs []error
+
+	switch c.Publisher {
+	case OutboxPublisherWebhook, OutboxPublisherLog:
+	default:
+		errs = append(errs, fmt.Errorf("OUTBOX_PUBLISHER: unknown outbox publisher %q", c.Publisher))
+	}
+
+	if c.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("OUTBOX_INTERVAL must be greater than 0, got %s", c.Interval))
+	}
+
+	if c.BatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("OUTBOX_BATCH_SIZE must be greater than 0, got %d", c.BatchSize))
+	}
+
+	return errs
+}
+
+// Validate checks the values of the config, all problems are returned at once, one per line
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Env == "" {
+		errs = append(errs, errors.New("ENV is required"))
+	}
+
+	switch c.StorageDriver {
+	case StorageDriverPostgres, StorageDriverSQLite:
+		if c.StoragePath == "" {
+			errs = append(errs, fmt.Errorf("STORAGE_PATH is required for the %s storage driver", c.StorageDriver))
+		}
+	case StorageDriverMemory:
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_DRIVER: unknown storage driver %q", c.StorageDriver))
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER: unknown tracing exporter %q", c.Tracing.Exporter))
+	}
+
+	errs = append(errs, c.HTTPServer.validate()...)
+	errs = append(errs, c.GRPC.validate()...)
+	if c.GRPC.Enabled() && c.GRPC.Port == c.HTTPServer.Port && c.GRPC.Address == c.HTTPServer.Address {
+		errs = append(errs, fmt.Errorf("GRPC_PORT must differ from HTTP_API_PORT, both are %s", c.GRPC.Port))
+	}
+	errs = append(errs, c.Storage.validate()...)
+	errs = append(errs, c.Webhooks.validate()...)
+	errs = append(errs, c.Outbox.validate()...)
+	errs = append(errs, c.Runtime.validate()...)
+
+	return errors.Join(errs...)
+}
+
+func (c *HTTPServer) validate() []error {
+	var errs []error
+
+	positive := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"HTTP_READ_TIMEOUT", c.ReadTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", c.ReadHeaderTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.IdleTimeout},
+		{"HTTP_SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"HTTP_HANDLER_TIMEOUT", c.HandlerTimeout},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than 0, got %s", p.name, p.value))
+		}
+	}
+
+	if c.MaxHeaderBytes <= 0 {
+		errs = append(errs, fmt.Errorf("HTTP_MAX_HEADER_BYTES must be greater than 0, got %d", c.MaxHeaderBytes))
+	}
+
+	if c.MaxBodyBytes <= 0 {
+		errs = append(errs, fmt.Errorf("HTTP_MAX_BODY_BYTES must be greater than 0, got %d", c.MaxBodyBytes))
+	}
+
+	for route, timeout := range c.HandlerTimeouts {
+		if !slices.Contains(routes, route) {
+			errs = append(errs, fmt.Errorf("HTTP_HANDLER_TIMEOUTS: unknown route %q, known routes: %v", route, routes))
+			continue
+		}
+		if route == RouteEvents {
+			errs = append(errs, fmt.Errorf("HTTP_HANDLER_TIMEOUTS: route %q is a stream, it has no handler timeout", route))
+			continue
+		}
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("HTTP_HANDLER_TIMEOUTS: timeout of %q must be greater than 0, got %s", route, timeout))
+		}
+	}
+
+	for _, route := range routes {
+		if route == RouteEvents {
+			continue
+		}
+		if timeout := c.HandlerTimeoutFor(route); c.WriteTimeout > 0 && timeout >= c.WriteTimeout {
+			errs = append(errs, fmt.Errorf("HTTP_WRITE_TIMEOUT (%s) must be longer than the handler timeout of %q (%s)", c.WriteTimeout, route, timeout))
+		}
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("HTTP_TRUSTED_PROXIES: %q is neither an IP nor a CIDR", proxy))
+		}
+	}
+
+	errs = append(errs, c.RateLimit.validate()...)
+
+	return errs
+}
+
+func (c *Storage) validate() []error {
+	var errs []error
+
+	if c.MaxConns < 0 {
+		errs = append(errs, fmt.Errorf("STORAGE_MAX_CONNS must not be negative, got %d", c.MaxConns))
+	}
+
+	if c.MinConns < 0 {
+		errs = append(errs, fmt.Errorf("STORAGE_MIN_CONNS must not be negative, got %d", c.MinConns))
+	}
+
+	if c.MaxConns > 0 && c.MinConns > c.MaxConns {
+		errs = append(errs, fmt.Errorf("STORAGE_MIN_CONNS (%d) must not be greater than STORAGE_MAX_CONNS (%d)", c.MinConns, c.MaxConns))
+	}
+
+	if c.ConnMaxLifetime < 0 {
+		errs = append(errs, fmt.Errorf("STORAGE_CONN_MAX_LIFETIME must not be negative, got %s", c.ConnMaxLifetime))
+	}
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		log.Fatalf("env file does not exist: %s", filePath)
+	if c.ConnMaxIdleTime < 0 {
+		errs = append(errs, fmt.Errorf("STORAGE_CONN_MAX_IDLE_TIME must not be negative, got %s", c.ConnMaxIdleTime))
 	}
 
-	if err := cleanenv.ReadConfig(filePath, &cfg); err != nil {
-		log.Fatalf("cannot read config: %s", err)
+	if c.StatementTimeout < 0 {
+		errs = append(errs, fmt.Errorf("STORAGE_STATEMENT_TIMEOUT must not be negative, got %s", c.StatementTimeout))
 	}
 
-	log.Println("configuration file successfully loaded")
-	return &cfg
+	return errs
 }
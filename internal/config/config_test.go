@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEnv reads the config from an .env file with the given content. cleanenv exports the variables of the file
+// to the environment of the process, t.Setenv makes sure they are removed after the test.
+func readEnv(t *testing.T, content string) *Config {
+	t.Helper()
+
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		t.Setenv(key, value)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.env")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	var cfg Config
+	require.NoError(t, cleanenv.ReadConfig(path, &cfg))
+
+	return &cfg
+}
+
+func TestConfig_Defaults(t *testing.T) {
+	cfg := readEnv(t, "ENV=local\nSTORAGE_DRIVER=memory\n")
+
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, 5*time.Second, cfg.HandlerTimeoutFor(RouteDeposit))
+	assert.Equal(t, 10*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, int64(1<<20), cfg.MaxBodyBytes)
+	assert.Equal(t, int32(10), cfg.MaxConns)
+	assert.Equal(t, time.Hour, cfg.ConnMaxLifetime)
+	assert.Equal(t, ratelimit.BackendMemory, cfg.RateLimit.Backend)
+	assert.Equal(t, []string{RateLimitKeyUser, RateLimitKeyIP}, cfg.RateLimit.KeyBy)
+	assert.Empty(t, cfg.RateLimit.QuotaFor(RouteDeposit), "no limit by default")
+	assert.Equal(t, 5*time.Second, cfg.Webhooks.Interval)
+	assert.Equal(t, 8, cfg.Webhooks.MaxAttempts)
+	assert.Equal(t, time.Hour, cfg.Webhooks.BackoffMax)
+	assert.Equal(t, OutboxPublisherWebhook, cfg.Outbox.Publisher)
+	assert.Equal(t, time.Second, cfg.Outbox.Interval)
+	assert.Equal(t, 100, cfg.Outbox.BatchSize)
+	assert.False(t, cfg.GRPC.Enabled(), "the gRPC server is started only with GRPC_PORT")
+	assert.Equal(t, 5*time.Second, cfg.GRPC.HandlerTimeout)
+}
+
+func TestConfig_RateLimit(t *testing.T) {
+	cfg := readEnv(t, "ENV=local\nSTORAGE_DRIVER=memory\nHTTP_RATE_LIMIT_DEFAULT=20/1s\nHTTP_RATE_LIMIT_ROUTES=transfer_batch:1/1s,operations:,events:2/1m\n")
+
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, "1/1s", cfg.RateLimit.QuotaFor(RouteTransferBatch))
+	assert.Equal(t, "2/1m", cfg.RateLimit.QuotaFor(RouteEvents))
+	assert.Equal(t, "20/1s", cfg.RateLimit.QuotaFor(RouteDeposit))
+	assert.Empty(t, cfg.RateLimit.QuotaFor(RouteOperations), "an empty quota turns the limit off")
+
+	t.Run("API keys", func(t *testing.T) {
+		cfg := readEnv(t, "ENV=local\nSTORAGE_DRIVER=memory\nHTTP_RATE_LIMIT_KEY_BY=api_key,ip\nHTTP_RATE_LIMIT_API_KEYS=key-a,key-b\n")
+
+		require.NoError(t, cfg.Validate())
+		assert.True(t, cfg.RateLimit.KnownAPIKey("key-b"))
+		assert.False(t, cfg.RateLimit.KnownAPIKey("key-c"))
+		assert.False(t, cfg.RateLimit.KnownAPIKey(""))
+	})
+
+	t.Run("api_key without API keys", func(t *testing.T) {
+		cfg := readEnv(t, "ENV=local\nSTORAGE_DRIVER=memory\nHTTP_RATE_LIMIT_KEY_BY=api_key,ip\n")
+
+		assert.ErrorContains(t, cfg.Validate(), "HTTP_RATE_LIMIT_API_KEYS")
+	})
+}
+
+func TestConfig_HandlerTimeouts(t *testing.T) {
+	cfg := readEnv(t, "ENV=local\nSTORAGE_DRIVER=memory\nHTTP_WRITE_TIMEOUT=40s\nHTTP_HANDLER_TIMEOUTS=transfer_batch:30s,deposit:3s\n")
+
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, 30*time.Second, cfg.HandlerTimeoutFor(RouteTransferBatch))
+	assert.Equal(t, 3*time.Second, cfg.HandlerTimeoutFor(RouteDeposit))
+	assert.Equal(t, 5*time.Second, cfg.HandlerTimeoutFor(RouteTransfer))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		wantErr string
+	}{
+		{
+			name:    "unknown storage driver",
+			env:     "STORAGE_DRIVER=mysql\n",
+			wantErr: `STORAGE_DRIVER: unknown storage driver "mysql"`,
+		},
+		{
+			name:    "no storage path",
+			env:     "STORAGE_DRIVER=postgres\n",
+			wantErr: "STORAGE_PATH is required for the postgres storage driver",
+		},
+		{
+			name:    "zero timeout",
+			env:     "STORAGE_DRIVER=memory\nHTTP_READ_TIMEOUT=0s\n",
+			wantErr: "HTTP_READ_TIMEOUT must be greater than 0, got 0s",
+		},
+		{
+			name:    "unknown route",
+			env:     "STORAGE_DRIVER=memory\nHTTP_HANDLER_TIMEOUTS=withdraw:1s\n",
+			wantErr: `HTTP_HANDLER_TIMEOUTS: unknown route "withdraw"`,
+		},
+		{
+			name:    "handler timeout of the event stream",
+			env:     "STORAGE_DRIVER=memory\nHTTP_HANDLER_TIMEOUTS=events:1s\n",
+			wantErr: `HTTP_HANDLER_TIMEOUTS: route "events" is a stream, it has no handler timeout`,
+		},
+		{
+			name:    "handler timeout longer than write timeout",
+			env:     "STORAGE_DRIVER=memory\nHTTP_HANDLER_TIMEOUTS=transfer_batch:30s\n",
+			wantErr: `HTTP_WRITE_TIMEOUT (15s) must be longer than the handler timeout of "transfer_batch" (30s)`,
+		},
+		{
+			name:    "min conns greater than max conns",
+			env:     "STORAGE_DRIVER=memory\nSTORAGE_MAX_CONNS=5\nSTORAGE_MIN_CONNS=6\n",
+			wantErr: "STORAGE_MIN_CONNS (6) must not be greater than STORAGE_MAX_CONNS (5)",
+		},
+		{
+			name:    "negative statement timeout",
+			env:     "STORAGE_DRIVER=memory\nSTORAGE_STATEMENT_TIMEOUT=-1s\n",
+			wantErr: "STORAGE_STATEMENT_TIMEOUT must not be negative, got -1s",
+		},
+		{
+			name:    "body limit",
+			env:     "STORAGE_DRIVER=memory\nHTTP_MAX_BODY_BYTES=0\n",
+			wantErr: "HTTP_MAX_BODY_BYTES must be greater than 0, got 0",
+		},
+		{
+			name:    "invalid rate limit quota",
+			env:     "STORAGE_DRIVER=memory\nHTTP_RATE_LIMIT_ROUTES=transfer:5\n",
+			wantErr: `HTTP_RATE_LIMIT_ROUTES: route "transfer": invalid quota "5"`,
+		},
+		{
+			name:    "rate limit of unknown route",
+			env:     "STORAGE_DRIVER=memory\nHTTP_RATE_LIMIT_ROUTES=withdraw:5/1s\n",
+			wantErr: `HTTP_RATE_LIMIT_ROUTES: unknown route "withdraw"`,
+		},
+		{
+			name:    "unknown rate limit key",
+			env:     "STORAGE_DRIVER=memory\nHTTP_RATE_LIMIT_KEY_BY=session,ip\n",
+			wantErr: `HTTP_RATE_LIMIT_KEY_BY: unknown key "session"`,
+		},
+		{
+			name:    "unknown rate limit backend",
+			env:     "STORAGE_DRIVER=memory\nHTTP_RATE_LIMIT_BACKEND=redis\n",
+			wantErr: `HTTP_RATE_LIMIT_BACKEND: unknown rate limit backend "redis"`,
+		},
+		{
+			name:    "invalid trusted proxy",
+			env:     "STORAGE_DRIVER=memory\nHTTP_TRUSTED_PROXIES=10.0.0.0/33\n",
+			wantErr: `HTTP_TRUSTED_PROXIES: "10.0.0.0/33" is neither an IP nor a CIDR`,
+		},
+		{
+			name:    "no webhook attempts",
+			env:     "STORAGE_DRIVER=memory\nWEBHOOK_MAX_ATTEMPTS=0\n",
+			wantErr: "WEBHOOK_MAX_ATTEMPTS must be greater than 0, got 0",
+		},
+		{
+			name:    "webhook backoff start longer than max",
+			env:     "STORAGE_DRIVER=memory\nWEBHOOK_BACKOFF_START=2h\n",
+			wantErr: "WEBHOOK_BACKOFF_START (2h0m0s) must not be longer than WEBHOOK_BACKOFF_MAX (1h0m0s)",
+		},
+		{
+			name:    "unknown outbox publisher",
+			env:     "STORAGE_DRIVER=memory\nOUTBOX_PUBLISHER=kafka\n",
+			wantErr: `OUTBOX_PUBLISHER: unknown outbox publisher "kafka"`,
+		},
+		{
+			name:    "no outbox batch",
+			env:     "STORAGE_DRIVER=memory\nOUTBOX_BATCH_SIZE=0\n",
+			wantErr: "OUTBOX_BATCH_SIZE must be greater than 0, got 0",
+		},
+		{
+			name:    "gRPC on the HTTP port",
+			env:     "STORAGE_DRIVER=memory\nHTTP_API_PORT=8080\nGRPC_PORT=8080\n",
+			wantErr: "GRPC_PORT must differ from HTTP_API_PORT, both are 8080",
+		},
+		{
+			name:    "no gRPC handler timeout",
+			env:     "STORAGE_DRIVER=memory\nGRPC_PORT=50051\nGRPC_HANDLER_TIMEOUT=0s\n",
+			wantErr: "GRPC_HANDLER_TIMEOUT must be greater than 0, got 0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := readEnv(t, "ENV=local\n"+tt.env)
+
+			err := cfg.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
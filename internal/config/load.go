@@ -0,0 +1,199 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the secrets in the output of Print
+const redacted = "xxxxx"
+
+// Options are the command line flags that control the loading itself and are not part of the config
+type Options struct {
+	// ConfigPath is the optional config file, the -config flag or CONFIG_PATH
+	ConfigPath string
+	// PrintConfig asks to print the effective config and exit
+	PrintConfig bool
+}
+
+// flagFields are the config values that can be overridden with a command line flag
+var flagFields = []struct {
+	name  string
+	usage string
+	field func(c *Config) *string
+}{
+	{"env", "application launch environment, overrides ENV", func(c *Config) *string { return &c.Env }},
+	{"storage-driver", "postgres, sqlite or memory, overrides STORAGE_DRIVER", func(c *Config) *string { return &c.StorageDriver }},
+	{"storage-path", "database URL or SQLite file, overrides STORAGE_PATH", func(c *Config) *string { return &c.StoragePath }},
+	{"http-address", "host of the API, overrides HTTP_ADDRESS", func(c *Config) *string { return &c.Address }},
+	{"http-port", "port of the API, overrides HTTP_API_PORT", func(c *Config) *string { return &c.Port }},
+	{"grpc-port", "port of the gRPC API, overrides GRPC_PORT", func(c *Config) *string { return &c.GRPC.Port }},
+	{"tracing-exporter", "none, stdout or otlp, overrides TRACING_EXPORTER", func(c *Config) *string { return &c.Tracing.Exporter }},
+}
+
+// Load builds the config in layers, every next one overrides the previous: the defaults, the optional file
+// (.env, .yaml/.yml or .toml), the environment variables and the command line flags. args are the arguments
+// without the program name. Without a file the config is read from the environment only, as container
+// platforms pass it. The config is validated, all problems are returned in one error.
+func Load(args []string) (*Config, *Options, error) {
+	var cfg Config
+	var opts Options
+
+	fs := flag.NewFlagSet("wallet", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigPath, "config", os.Getenv("CONFIG_PATH"), "path to the config file (.env, .yaml or .toml), CONFIG_PATH by default")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective config with the secrets redacted and exit")
+	for _, f := range flagFields {
+		fs.String(f.name, "", f.usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if err := readFile(opts.ConfigPath, &cfg); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("cannot read environment variables: %w", err)
+	}
+
+	// only the flags that were passed override the values, the others keep the value of the previous layers
+	fs.Visit(func(set *flag.Flag) {
+		for _, f := range flagFields {
+			if f.name == set.Name {
+				*f.field(&cfg) = set.Value.String()
+			}
+		}
+	})
+
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = defaultLogLevel(cfg.Env)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	return &cfg, &opts, nil
+}
+
+// readFile reads the config file, an empty path means there is no file. cleanenv exports the variables of an .env
+// file to the environment overwriting the ones already set, so .env files are exported by exportEnvFile, which
+// keeps them: the environment must win over the file.
+func readFile(path string, cfg *Config) error {
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open config file: %w", err)
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".env":
+		err = exportEnvFile(path)
+	case ".yaml", ".yml":
+		err = cleanenv.ParseYAML(f, cfg)
+	case ".toml":
+		err = cleanenv.ParseTOML(f, cfg)
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q, use .env, .yaml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// fileEnv are the variables exported from an .env file by the last read. The next read (a reload) replaces them
+// with the new values of the file, the real environment variables are never overwritten.
+var (
+	fileEnvMu sync.Mutex
+	fileEnv   = map[string]string{}
+)
+
+func exportEnvFile(path string) error {
+	vars, err := godotenv.Read(path)
+	if err != nil {
+		return err
+	}
+
+	fileEnvMu.Lock()
+	defer fileEnvMu.Unlock()
+
+	for key, value := range fileEnv {
+		if _, ok := vars[key]; !ok && os.Getenv(key) == value {
+			os.Unsetenv(key)
+		}
+	}
+
+	exported := make(map[string]string, len(vars))
+	for key, value := range vars {
+		if current, ok := os.LookupEnv(key); ok {
+			if prev, fromFile := fileEnv[key]; !fromFile || prev != current {
+				continue
+			}
+		}
+
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+		exported[key] = value
+	}
+	fileEnv = exported
+
+	return nil
+}
+
+// Print writes the config as YAML, the format Load reads, with the passwords in STORAGE_PATH, the admin token
+// and the API keys redacted
+func (c *Config) Print(w io.Writer) error {
+	out := *c
+	out.StoragePath = redactPassword(c.StoragePath)
+	if out.AdminToken != "" {
+		out.AdminToken = redacted
+	}
+	if len(c.RateLimit.APIKeys) > 0 {
+		out.RateLimit.APIKeys = make([]string, len(c.RateLimit.APIKeys))
+		for i := range out.RateLimit.APIKeys {
+			out.RateLimit.APIKeys[i] = redacted
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&out); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// passwordParam matches the password in the query of a URL and in a key=value connection string
+var passwordParam = regexp.MustCompile(`(?i)(password=)[^&\s]+`)
+
+func redactPassword(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			dsn = u.String()
+		}
+	}
+
+	return passwordParam.ReplaceAllString(dsn, "${1}"+redacted)
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// Log levels that can be selected with LOG_LEVEL
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// Runtime are the settings that can be changed without a restart, see Watcher. LogLevel is debug for the local
+// and dev environments and info for the others if it is not set. DepositLimit and TransferLimit are the largest
+// amount of one operation of a user, zero means no limit. Maintenance turns off the API, the health checks and
+// the metrics keep working. ReadOnly stops the money movement, the history stays readable.
+type Runtime struct {
+	LogLevel      string  `env:"LOG_LEVEL" yaml:"log_level" toml:"log_level"`
+	DepositLimit  float64 `env:"DEPOSIT_LIMIT" env-default:"0" yaml:"deposit_limit" toml:"deposit_limit"`
+	TransferLimit float64 `env:"TRANSFER_LIMIT" env-default:"0" yaml:"transfer_limit" toml:"transfer_limit"`
+	Maintenance   bool    `env:"MAINTENANCE" env-default:"false" yaml:"maintenance" toml:"maintenance"`
+	ReadOnly      bool    `env:"READ_ONLY" env-default:"false" yaml:"read_only" toml:"read_only"`
+}
+
+// Level returns the slog level of LogLevel, an unknown level is info
+func (r *Runtime) Level() slog.Level {
+	switch r.LogLevel {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func defaultLogLevel(env string) string {
+	switch env {
+	case "local", "dev":
+		return LogLevelDebug
+	default:
+		return LogLevelInfo
+	}
+}
+
+func (r *Runtime) validate() []error {
+	var errs []error
+
+	switch r.LogLevel {
+	case "", LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: unknown log level %q", r.LogLevel))
+	}
+
+	if r.DepositLimit < 0 {
+		errs = append(errs, fmt.Errorf("DEPOSIT_LIMIT must not be negative, got %v", r.DepositLimit))
+	}
+
+	if r.TransferLimit < 0 {
+		errs = append(errs, fmt.Errorf("TRANSFER_LIMIT must not be negative, got %v", r.TransferLimit))
+	}
+
+	return errs
+}
+
+// change is a setting whose value was changed by a reload
+type change struct {
+	name     string
+	old, new any
+}
+
+// diff returns the settings that differ in next, they are named by their environment variables
+func (r *Runtime) diff(next *Runtime) []change {
+	var changes []change
+
+	oldValue, newValue := reflect.ValueOf(*r), reflect.ValueOf(*next)
+	for i := range oldValue.NumField() {
+		if o, n := oldValue.Field(i).Interface(), newValue.Field(i).Interface(); o != n {
+			name, _, _ := strings.Cut(oldValue.Type().Field(i).Tag.Get("env"), ",")
+			changes = append(changes, change{name: name, old: o, new: n})
+		}
+	}
+
+	return changes
+}
+
+// Settings holds the current snapshot of the runtime settings. The Wallet and the middleware read it on every
+// request, the Watcher replaces it as a whole, so a reader never sees half of a reload. The level of the logger
+// follows LogLevel of the snapshot. The read-only mode can also be turned on by the admin API, apart from the config.
+type Settings struct {
+	current       atomic.Pointer[Runtime]
+	level         slog.LevelVar
+	adminReadOnly atomic.Bool
+}
+
+func NewSettings(r Runtime) *Settings {
+	var s Settings
+	s.Store(r)
+
+	return &s
+}
+
+// Runtime returns the current snapshot, it must not be changed
+func (s *Settings) Runtime() *Runtime {
+	return s.current.Load()
+}
+
+// Store replaces the snapshot and returns the previous one
+func (s *Settings) Store(r Runtime) *Runtime {
+	old := s.current.Swap(&r)
+	s.level.Set(r.Level())
+
+	return old
+}
+
+// Level is the level for the handlers of the logger, it changes with the settings
+func (s *Settings) Level() slog.Leveler {
+	return &s.level
+}
+
+// ReadOnly reports whether the money movement is stopped, by the config or by the admin API
+func (s *Settings) ReadOnly() bool {
+	return s.Runtime().ReadOnly || s.adminReadOnly.Load()
+}
+
+// SetReadOnly turns the read-only mode of the admin API on or off. It does not change READ_ONLY of the config,
+// the mode turned on by the config stays on until the config is changed.
+func (s *Settings) SetReadOnly(on bool) {
+	s.adminReadOnly.Store(on)
+}
+
+// AdminReadOnly reports whether the read-only mode is turned on by the admin API
+func (s *Settings) AdminReadOnly() bool {
+	return s.adminReadOnly.Load()
+}
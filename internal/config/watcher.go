@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// watchInterval is how often the Watcher checks the config file for changes
+const watchInterval = time.Second * 2
+
+// Watcher reloads the config on SIGHUP and when the config file changes, and stores the new runtime settings.
+// The config is loaded the same way as at startup, so the environment and the flags still override the file.
+// An invalid config is rejected and the old settings are kept. Only Runtime is applied, the other values need
+// a restart, a change of them is logged as a warning.
+type Watcher struct {
+	log      *slog.Logger
+	path     string
+	load     func() (*Config, error)
+	settings *Settings
+
+	mu      sync.Mutex
+	current *Config
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWatcher creates the Watcher of the config file at path, an empty path means the config is reloaded on SIGHUP
+// only. conf is the config the application was started with, load reads the config again.
+func NewWatcher(log *slog.Logger, conf *Config, path string, load func() (*Config, error), settings *Settings) *Watcher {
+	w := &Watcher{
+		log:      log,
+		path:     path,
+		load:     load,
+		settings: settings,
+		current:  conf,
+	}
+	w.modTime, w.size = w.stat()
+
+	return w
+}
+
+func (w *Watcher) Start() {
+	w.log.Debug("config watcher: started", "file", w.path)
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer close(w.done)
+		defer signal.Stop(hup)
+
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-hup:
+				w.log.Info("config watcher: SIGHUP received")
+				w.Reload()
+			case <-ticker.C:
+				if w.changed() {
+					w.log.Info("config watcher: config file changed", "file", w.path)
+					w.Reload()
+				}
+			}
+		}
+	}()
+}
+
+func (w *Watcher) Stop() error {
+	if w.stop == nil {
+		return errors.New("config watcher is not started")
+	}
+
+	close(w.stop)
+	<-w.done
+	w.stop = nil
+
+	w.log.Info("config watcher: stop successful")
+	return nil
+}
+
+// Reload loads the config and stores its runtime settings. The changed settings are logged one by one.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	next, err := w.load()
+	if err != nil {
+		w.log.Error("config watcher: reload rejected, the current settings are kept", "error", err)
+		return err
+	}
+
+	changes := w.current.Runtime.diff(&next.Runtime)
+	for _, c := range changes {
+		w.log.Info("config watcher: setting changed", "setting", c.name, "old", c.old, "new", c.new)
+	}
+
+	prev, cur := *w.current, *next
+	prev.Runtime, cur.Runtime = Runtime{}, Runtime{}
+	if !reflect.DeepEqual(prev, cur) {
+		w.log.Warn("config watcher: settings other than the runtime ones changed, they are applied after a restart")
+	}
+
+	w.settings.Store(next.Runtime)
+	w.current = next
+
+	w.log.Info("config watcher: reload successful", "changed", len(changes))
+	return nil
+}
+
+// changed reports whether the config file was modified since the last check
+func (w *Watcher) changed() bool {
+	if w.path == "" {
+		return false
+	}
+
+	modTime, size := w.stat()
+	if modTime.Equal(w.modTime) && size == w.size {
+		return false
+	}
+	w.modTime, w.size = modTime, size
+
+	return true
+}
+
+func (w *Watcher) stat() (time.Time, int64) {
+	if w.path == "" {
+		return time.Time{}, 0
+	}
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+
+	return info.ModTime(), info.Size()
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestWatcher creates the Watcher of a YAML file with the given content, the logs are written to the returned buffer
+func newTestWatcher(t *testing.T, content string) (*Watcher, *Settings, string, *bytes.Buffer) {
+	t.Helper()
+
+	unsetEnv(t, "CONFIG_PATH", "ENV", "STORAGE_DRIVER", "LOG_LEVEL", "DEPOSIT_LIMIT", "TRANSFER_LIMIT", "MAINTENANCE")
+
+	path := writeFile(t, "config.yaml", content)
+	load := func() (*Config, error) {
+		cfg, _, err := Load([]string{"-config", path})
+		return cfg, err
+	}
+
+	conf, err := load()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	settings := NewSettings(conf.Runtime)
+
+	return NewWatcher(log, conf, path, load, settings), settings, path, &buf
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	w, settings, path, logs := newTestWatcher(t, "env: prod\nstorage_driver: memory\n")
+
+	before := settings.Runtime()
+	assert.Equal(t, LogLevelInfo, before.LogLevel)
+	assert.Equal(t, slog.LevelInfo, settings.Level().Level())
+
+	require.NoError(t, os.WriteFile(path, []byte("env: prod\nstorage_driver: memory\nruntime:\n  log_level: debug\n  transfer_limit: 100\n  maintenance: true\n"), 0o600))
+	require.NoError(t, w.Reload())
+
+	after := settings.Runtime()
+	assert.Equal(t, Runtime{LogLevel: LogLevelDebug, TransferLimit: 100, Maintenance: true}, *after)
+	assert.Equal(t, slog.LevelDebug, settings.Level().Level())
+	assert.Equal(t, Runtime{LogLevel: LogLevelInfo}, *before, "the old snapshot must not change")
+
+	assert.Contains(t, logs.String(), "setting=LOG_LEVEL old=info new=debug")
+	assert.Contains(t, logs.String(), "setting=TRANSFER_LIMIT old=0 new=100")
+	assert.Contains(t, logs.String(), "setting=MAINTENANCE old=false new=true")
+	assert.NotContains(t, logs.String(), "DEPOSIT_LIMIT")
+
+	t.Run("invalid config keeps the settings", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("env: prod\nstorage_driver: memory\nruntime:\n  transfer_limit: -1\n"), 0o600))
+
+		err := w.Reload()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "TRANSFER_LIMIT must not be negative")
+		assert.Same(t, after, settings.Runtime())
+		assert.Contains(t, logs.String(), "reload rejected")
+	})
+
+	t.Run("restart required", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("env: prod\nstorage_driver: memory\nhttp:\n  port: \"9000\"\n"), 0o600))
+
+		require.NoError(t, w.Reload())
+		assert.Contains(t, logs.String(), "applied after a restart")
+	})
+}
+
+func TestWatcher_Triggers(t *testing.T) {
+	w, settings, path, _ := newTestWatcher(t, "env: prod\nstorage_driver: memory\n")
+
+	w.Start()
+	t.Cleanup(func() { w.Stop() })
+
+	t.Run("file change", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("env: prod\nstorage_driver: memory\nruntime:\n  deposit_limit: 500\n"), 0o600))
+
+		assert.Eventually(t, func() bool {
+			return settings.Runtime().DepositLimit == 500
+		}, watchInterval*3, time.Millisecond*50)
+	})
+
+	t.Run("SIGHUP", func(t *testing.T) {
+		// the same size and modification time, so only the signal makes the watcher read the file
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, []byte("env: prod\nstorage_driver: memory\nruntime:\n  deposit_limit: 600\n"), 0o600))
+		require.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+		assert.Eventually(t, func() bool {
+			return settings.Runtime().DepositLimit == 600
+		}, time.Second, time.Millisecond*10)
+	})
+}
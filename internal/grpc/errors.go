@@ -0,0 +1,96 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the domain of the google.rpc.ErrorInfo details of the errors, their reasons are the codes of the HTTP API
+const errorDomain = "wallet"
+
+// apiError is how an error is presented to the client
+type apiError struct {
+	code    codes.Code
+	reason  string
+	message string
+}
+
+var (
+	errInternal    = apiError{codes.Internal, transport.Internal.Code, transport.Internal.Message}
+	errMaintenance = apiError{codes.Unavailable, transport.CodeMaintenance, "service is under maintenance, retry later"}
+	errShutdown    = apiError{codes.Unavailable, transport.CodeUnavailable, "server is shutting down, reconnect with last_event_id"}
+	errSlowClient  = apiError{codes.Unavailable, transport.CodeUnavailable, "stream is closed, the client is too slow, reconnect with last_event_id"}
+	errRateLimited = apiError{codes.ResourceExhausted, transport.CodeRateLimited, "too many requests, retry later"}
+)
+
+// lookupError returns the gRPC error for err from the table shared with the HTTP API, or the internal error
+func lookupError(err error) apiError {
+	e := transport.LookupError(err)
+	return apiError{grpcCode(e.Status), e.Code, e.Message}
+}
+
+// grpcCode derives the gRPC code from the HTTP status of the shared table, so the two APIs report an error the same way
+func grpcCode(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusPaymentRequired, http.StatusUnprocessableEntity:
+		return codes.FailedPrecondition
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case transport.StatusClientClosedRequest:
+		return codes.Canceled
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
+
+// errorResponse returns the status for an error returned by a service. Only the code and the message from
+// the error table are sent, the text of the error itself stays in the log.
+func errorResponse(ctx context.Context, log *slog.Logger, err error) error {
+	apiErr := lookupError(err)
+
+	switch apiErr.code {
+	case codes.Internal, codes.Unavailable:
+		log.ErrorContext(ctx, "request failed", "code", apiErr.reason, "error", err)
+	default:
+		log.WarnContext(ctx, "request failed", "code", apiErr.reason, "error", err)
+	}
+
+	return apiErr.status(nil)
+}
+
+// paramsErrorResponse returns the InvalidArgument status for a request that did not pass the validation,
+// the reason of the failure is sent in the metadata of the details
+func paramsErrorResponse(ctx context.Context, log *slog.Logger, reason, message string) error {
+	log.WarnContext(ctx, "invalid request", "reason", message)
+	return apiError{codes.InvalidArgument, reason, "invalid data in request"}.status(map[string]string{"reason": message})
+}
+
+// status makes the gRPC status with the ErrorInfo detail, metadata is optional
+func (e apiError) status(metadata map[string]string) error {
+	st := status.New(e.code, e.message)
+
+	withInfo, err := st.WithDetails(&errdetails.ErrorInfo{Reason: e.reason, Domain: errorDomain, Metadata: metadata})
+	if err != nil {
+		return st.Err()
+	}
+
+	return withInfo.Err()
+}
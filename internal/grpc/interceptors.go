@@ -0,0 +1,89 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/google/uuid"
+	grpcgo "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDKey is the metadata key of the request ID, the same as the X-Request-ID header of the HTTP API
+const requestIDKey = "x-request-id"
+
+// serverStream is a ServerStream with the context changed by the interceptors
+type serverStream struct {
+	grpcgo.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// limitedStream checks the rate limit of a streaming call on its first message, the user is known only from it
+type limitedStream struct {
+	grpcgo.ServerStream
+	limits  *rateLimiter
+	method  string
+	checked bool
+}
+
+func (s *limitedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if !s.checked {
+		s.checked = true
+		return s.limits.allow(s.Context(), s.method, m)
+	}
+
+	return nil
+}
+
+// unaryInterceptor rejects the calls in the maintenance mode and over the rate limit and gives every call a request ID,
+// as the middlewares of the HTTP server do
+func (s *Server) unaryInterceptor(ctx context.Context, req any, info *grpcgo.UnaryServerInfo, handler grpcgo.UnaryHandler) (any, error) {
+	ctx = withRequestID(ctx)
+	_ = grpcgo.SetHeader(ctx, metadata.Pairs(requestIDKey, logs.RequestID(ctx)))
+
+	if s.settings.Runtime().Maintenance {
+		return nil, errMaintenance.status(nil)
+	}
+
+	if err := s.limits.allow(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// streamInterceptor is unaryInterceptor of the streaming calls
+func (s *Server) streamInterceptor(srv any, ss grpcgo.ServerStream, info *grpcgo.StreamServerInfo, handler grpcgo.StreamHandler) error {
+	ctx := withRequestID(ss.Context())
+	_ = ss.SetHeader(metadata.Pairs(requestIDKey, logs.RequestID(ctx)))
+
+	if s.settings.Runtime().Maintenance {
+		return errMaintenance.status(nil)
+	}
+
+	stream := &serverStream{ServerStream: ss, ctx: ctx}
+	return handler(srv, &limitedStream{ServerStream: stream, limits: s.limits, method: info.FullMethod})
+}
+
+// withRequestID puts the request ID from the metadata, or a generated UUID, into the context
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDKey); len(values) > 0 {
+		id = values[0]
+	}
+
+	if !transport.ValidRequestID(id) {
+		id = uuid.NewString()
+	}
+
+	return logs.WithRequestID(ctx, id)
+}
@@ -0,0 +1,144 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/EvansTrein/iqProgers/pkg/walletpb"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// apiKeyKey is the metadata key of the API key, the same as the X-API-Key header of the HTTP API
+const apiKeyKey = "x-api-key"
+
+// methodRoutes gives every method the rate limit route of the HTTP request that does the same, so a client has
+// one quota for both APIs. GetBalance has no HTTP request, it reads the user as GetOperations does.
+var methodRoutes = map[string]string{
+	walletpb.Wallet_Deposit_FullMethodName:         config.RouteDeposit,
+	walletpb.Wallet_Transfer_FullMethodName:        config.RouteTransfer,
+	walletpb.Wallet_GetOperations_FullMethodName:   config.RouteOperations,
+	walletpb.Wallet_GetBalance_FullMethodName:      config.RouteOperations,
+	walletpb.Wallet_WatchOperations_FullMethodName: config.RouteEvents,
+}
+
+// userRequest and senderRequest are the requests that name the user of the call, the generated messages have these getters
+type userRequest interface {
+	GetUserId() uint64
+}
+
+type senderRequest interface {
+	GetSenderId() uint64
+}
+
+// rateLimiter applies the quotas of HTTP_RATE_LIMIT_* to the calls, with the same buckets as the HTTP requests
+type rateLimiter struct {
+	log     *slog.Logger
+	limiter ratelimit.Limiter
+	// quotas are the quotas of the routes, a route without a quota is not limited
+	quotas map[string]ratelimit.Quota
+	conf   *config.RateLimit
+}
+
+func newRateLimiter(log *slog.Logger, limiter ratelimit.Limiter, conf *config.RateLimit) *rateLimiter {
+	quotas := make(map[string]ratelimit.Quota)
+	for _, route := range methodRoutes {
+		// the quotas are checked when the config is loaded, an empty quota is the only error left here
+		if quota, err := ratelimit.ParseQuota(conf.QuotaFor(route)); err == nil {
+			quotas[route] = quota
+		}
+	}
+
+	return &rateLimiter{
+		log:     log,
+		limiter: limiter,
+		quotas:  quotas,
+		conf:    conf,
+	}
+}
+
+// allow returns the RESOURCE_EXHAUSTED status if the call of method with req is over the quota of its route.
+// If the limiter fails, the call is let through: the limiter protects the service, it must not stop it.
+func (l *rateLimiter) allow(ctx context.Context, method string, req any) error {
+	route := methodRoutes[method]
+	quota, ok := l.quotas[route]
+	if !ok {
+		return nil
+	}
+
+	clients := l.clientKeys(ctx, req)
+	keys := make([]string, len(clients))
+	for i, client := range clients {
+		keys[i] = route + "|" + client
+	}
+
+	res, key, err := ratelimit.AllowAll(ctx, l.limiter, keys, quota)
+	if err != nil {
+		l.log.ErrorContext(ctx, "rate limiter failed, the call is let through", "route", route, "error", err)
+		return nil
+	}
+
+	if !res.Allowed {
+		retryAfter := strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds())))
+		l.log.WarnContext(ctx, "rate limit exceeded", "route", route, "client", strings.TrimPrefix(key, route+"|"), "quota", quota.String())
+		return errRateLimited.status(map[string]string{"retry_after": retryAfter})
+	}
+
+	return nil
+}
+
+// clientKeys identifies the client the same way as the HTTP API does, by the first of keyBy found in the call.
+// Only the listed API keys are accepted, the bucket of the IP is charged together with the bucket of the user.
+func (l *rateLimiter) clientKeys(ctx context.Context, req any) []string {
+	ip := config.RateLimitKeyIP + ":" + peerIP(ctx)
+
+	for _, by := range l.conf.KeyBy {
+		switch by {
+		case config.RateLimitKeyAPIKey:
+			if values := metadata.ValueFromIncomingContext(ctx, apiKeyKey); len(values) > 0 && l.conf.KnownAPIKey(values[0]) {
+				return []string{by + ":" + values[0]}
+			}
+		case config.RateLimitKeyUser:
+			if id := requestUser(req); id != 0 {
+				return []string{ip, by + ":" + strconv.FormatUint(id, 10)}
+			}
+		case config.RateLimitKeyIP:
+			return []string{ip}
+		}
+	}
+
+	return []string{ip}
+}
+
+// requestUser returns the user of the operation: the sender of a transfer, the user of the other calls, or 0
+func requestUser(req any) uint64 {
+	switch r := req.(type) {
+	case senderRequest:
+		return r.GetSenderId()
+	case userRequest:
+		return r.GetUserId()
+	default:
+		return 0
+	}
+}
+
+// peerIP returns the IP of the client, or the whole address if it has no port
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
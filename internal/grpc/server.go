@@ -0,0 +1,110 @@
+// Package grpc serves the gRPC API of the wallet (api/wallet/v1/wallet.proto). The calls go to the same services
+// as the requests of the HTTP API, this package only converts the messages and maps the errors.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/EvansTrein/iqProgers/pkg/walletpb"
+	grpcgo "google.golang.org/grpc"
+)
+
+// runtimeSettings gives the current runtime settings, they can change on a config reload
+type runtimeSettings interface {
+	Runtime() *config.Runtime
+}
+
+type Server struct {
+	server   *grpcgo.Server
+	log      *slog.Logger
+	conf     *config.GRPC
+	settings runtimeSettings
+	limits   *rateLimiter
+	// streams is canceled when the server stops, GracefulStop does not wait for the endless WatchOperations streams
+	streams       context.Context
+	cancelStreams context.CancelFunc
+}
+
+// New creates the server, the calls share the quotas of rateLimit and the limiter with the HTTP API
+func New(log *slog.Logger, conf *config.GRPC, settings runtimeSettings, limiter ratelimit.Limiter, rateLimit *config.RateLimit) *Server {
+	s := &Server{
+		log:      log,
+		conf:     conf,
+		settings: settings,
+		limits:   newRateLimiter(log, limiter, rateLimit),
+	}
+	s.streams, s.cancelStreams = context.WithCancel(context.Background())
+	s.server = grpcgo.NewServer(
+		grpcgo.UnaryInterceptor(s.unaryInterceptor),
+		grpcgo.StreamInterceptor(s.streamInterceptor),
+	)
+
+	return s
+}
+
+// Register registers the Wallet service of the API
+func (s *Server) Register(wallet walletService, accounts accountsService, events eventsService) {
+	walletpb.RegisterWalletServer(s.server, &walletServer{
+		log:      s.log,
+		wallet:   wallet,
+		accounts: accounts,
+		events:   events,
+		timeout:  s.conf.HandlerTimeout,
+		streams:  s.streams.Done(),
+	})
+}
+
+// Start serves the calls until Stop is called, an error is returned only if the server could not start or failed
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.conf.Address+":"+s.conf.Port)
+	if err != nil {
+		return fmt.Errorf("gRPC server: %w", err)
+	}
+
+	return s.Serve(lis)
+}
+
+// Serve serves the calls on lis until Stop is called, the tests pass their own listener here
+func (s *Server) Serve(lis net.Listener) error {
+	s.log.Info("gRPC server: successfully started", "Address", lis.Addr().String())
+	if err := s.server.Serve(lis); err != nil && !errors.Is(err, grpcgo.ErrServerStopped) {
+		return fmt.Errorf("gRPC server: %w", err)
+	}
+
+	return nil
+}
+
+// Stop stops accepting the connections and waits for the calls in progress no longer than GRPC_SHUTDOWN_TIMEOUT,
+// then the calls left are cut. The WatchOperations streams are closed at once, the clients reconnect with last_event_id.
+func (s *Server) Stop() error {
+	s.log.Debug("gRPC server: stop started")
+
+	s.cancelStreams()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(s.conf.ShutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.server.Stop()
+		s.log.Error("gRPC server: calls in progress are cut, the shutdown timeout is over")
+		return errors.New("gRPC server: shutdown timeout is over")
+	}
+
+	s.log.Info("gRPC server: stop successful")
+	return nil
+}
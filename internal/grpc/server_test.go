@@ -0,0 +1,315 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/storages/memory"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/EvansTrein/iqProgers/pkg/walletpb"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	grpcgo "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const idempotencyKeyTest = "42dd3893-9baf-43ac-8c2b-32231f486b87"
+
+// testServer is the gRPC server over the real services and the in-memory storage, served on an in-process listener
+type testServer struct {
+	server   *Server
+	client   walletpb.WalletClient
+	settings *config.Settings
+	broker   *services.Broker
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	return newTestServerWith(t, &config.RateLimit{})
+}
+
+// newTestServerWith is newTestServer with the quotas of rateLimit
+func newTestServerWith(t *testing.T, rateLimit *config.RateLimit) *testServer {
+	t.Helper()
+
+	log := logs.NewDiscardLogger()
+	db := memory.New(log)
+	settings := config.NewSettings(config.Runtime{})
+	broker := services.NewBroker(log)
+
+	grpcConf := &config.GRPC{HandlerTimeout: time.Second * 5, ShutdownTimeout: time.Second * 5}
+	s := New(log, grpcConf, settings, ratelimit.NewMemory(), rateLimit)
+	s.Register(services.New(log, db, metrics.New(), settings, broker), services.NewAccounts(log, db), broker)
+
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(func() { s.server.Stop() })
+
+	conn, err := grpcgo.NewClient("passthrough:///bufnet",
+		grpcgo.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpcgo.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &testServer{server: s, client: walletpb.NewWalletClient(conn), settings: settings, broker: broker}
+}
+
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), idempotencyKeyKey, key)
+}
+
+// assertStatus checks the code of the error and the reason of its ErrorInfo
+func assertStatus(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+
+	st, ok := status.FromError(err)
+	require.True(t, ok, "not a gRPC status: %v", err)
+	assert.Equal(t, code, st.Code(), st.Message())
+
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	assert.Equal(t, reason, info.Reason)
+	assert.Equal(t, errorDomain, info.Domain)
+}
+
+func TestWallet_Deposit(t *testing.T) {
+	ts := newTestServer(t)
+
+	var header metadata.MD
+	resp, err := ts.client.Deposit(withKey(idempotencyKeyTest), &walletpb.DepositRequest{UserId: 2, Amount: 100.5}, grpcgo.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, "deposit", resp.Operation.TypeOperation)
+	assert.Equal(t, 100.5, resp.Operation.Amount)
+	assert.True(t, resp.Operation.Success)
+	assert.NotEmpty(t, header.Get(requestIDKey), "every call gets a request ID")
+
+	again, err := ts.client.Deposit(withKey(idempotencyKeyTest), &walletpb.DepositRequest{UserId: 2, Amount: 100.5})
+	require.NoError(t, err)
+	assert.Equal(t, resp.Operation.TransactionId, again.Operation.TransactionId, "the repeated call returns the saved operation")
+
+	balance, err := ts.client.GetBalance(context.Background(), &walletpb.GetBalanceRequest{UserId: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 100.5, balance.Balance, "the money is moved once")
+	assert.Equal(t, "Leonard", balance.Name)
+
+	t.Run("invalid requests", func(t *testing.T) {
+		_, err := ts.client.Deposit(context.Background(), &walletpb.DepositRequest{UserId: 2, Amount: 10})
+		assertStatus(t, err, codes.InvalidArgument, transport.CodeInvalidIdempotencyKey)
+
+		_, err = ts.client.Deposit(withKey("not-a-uuid"), &walletpb.DepositRequest{UserId: 2, Amount: 10})
+		assertStatus(t, err, codes.InvalidArgument, transport.CodeInvalidIdempotencyKey)
+
+		_, err = ts.client.Deposit(withKey(idempotencyKeyTest), &walletpb.DepositRequest{UserId: 2, Amount: -1})
+		assertStatus(t, err, codes.InvalidArgument, transport.CodeInvalidBody)
+
+		_, err = ts.client.Deposit(withKey("5a4a3c1e-8f0b-4d2e-9c55-0b7f6e0f9a11"), &walletpb.DepositRequest{UserId: 1 << 30, Amount: 10})
+		assertStatus(t, err, codes.NotFound, "USER_NOT_FOUND")
+	})
+}
+
+func TestWallet_Transfer(t *testing.T) {
+	ts := newTestServer(t)
+
+	_, err := ts.client.Deposit(withKey(idempotencyKeyTest), &walletpb.DepositRequest{UserId: 1, Amount: 100})
+	require.NoError(t, err)
+
+	resp, err := ts.client.Transfer(withKey("9d7e1f7e-2b0c-4a55-8f43-1c2d3e4f5a6b"), &walletpb.TransferRequest{SenderId: 1, ReceiverId: 2, Amount: 40})
+	require.NoError(t, err)
+	assert.Equal(t, "transfer", resp.Operation.TypeOperation)
+	assert.Equal(t, "Sheldon", resp.Operation.GetSender())
+	assert.Equal(t, "Leonard", resp.Operation.GetReceiver())
+
+	_, err = ts.client.Transfer(withKey("5a4a3c1e-8f0b-4d2e-9c55-0b7f6e0f9a11"), &walletpb.TransferRequest{SenderId: 1, ReceiverId: 2, Amount: 1000})
+	assertStatus(t, err, codes.FailedPrecondition, "INSUFFICIENT_FUNDS")
+
+	_, err = ts.client.Transfer(withKey("0b7f6e0f-9a11-4d2e-9c55-5a4a3c1e8f0b"), &walletpb.TransferRequest{SenderId: 1, ReceiverId: 1, Amount: 1})
+	assertStatus(t, err, codes.InvalidArgument, "SELF_TRANSFER")
+
+	ops, err := ts.client.GetOperations(context.Background(), &walletpb.GetOperationsRequest{UserId: 1, Limit: 10})
+	require.NoError(t, err)
+	require.NotEmpty(t, ops.Operations)
+
+	_, err = ts.client.GetOperations(context.Background(), &walletpb.GetOperationsRequest{UserId: 1})
+	assertStatus(t, err, codes.InvalidArgument, transport.CodeInvalidParams)
+
+	_, err = ts.client.GetBalance(context.Background(), &walletpb.GetBalanceRequest{UserId: 1 << 30})
+	assertStatus(t, err, codes.NotFound, "USER_NOT_FOUND")
+}
+
+func TestWallet_WatchOperations(t *testing.T) {
+	ts := newTestServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := ts.client.WatchOperations(ctx, &walletpb.WatchOperationsRequest{UserId: 2})
+	require.NoError(t, err)
+	// the server subscribes after the call is received, the deposits below must not go before it
+	require.Eventually(t, func() bool { return ts.broker.Watched(2) }, time.Second*5, time.Millisecond*10)
+
+	_, err = ts.client.Deposit(withKey(idempotencyKeyTest), &walletpb.DepositRequest{UserId: 2, Amount: 10})
+	require.NoError(t, err)
+	_, err = ts.client.Deposit(withKey("9d7e1f7e-2b0c-4a55-8f43-1c2d3e4f5a6b"), &walletpb.DepositRequest{UserId: 2, Amount: 20})
+	require.NoError(t, err)
+
+	first, err := stream.Recv()
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.Id)
+	assert.Equal(t, 10.0, first.Operation.Amount)
+
+	second, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, second.Operation.Amount)
+
+	t.Run("resumed with last_event_id", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resumed, err := ts.client.WatchOperations(ctx, &walletpb.WatchOperationsRequest{UserId: 2, LastEventId: first.Id})
+		require.NoError(t, err)
+
+		event, err := resumed.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, second.Id, event.Id)
+	})
+
+	t.Run("unknown last_event_id", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resumed, err := ts.client.WatchOperations(ctx, &walletpb.WatchOperationsRequest{UserId: 2, LastEventId: "unknown-1"})
+		require.NoError(t, err)
+
+		event, err := resumed.Recv()
+		require.NoError(t, err)
+		assert.True(t, event.Reload)
+		assert.Empty(t, event.Id)
+	})
+
+	t.Run("closed on stop", func(t *testing.T) {
+		require.NoError(t, ts.server.Stop())
+
+		_, err := stream.Recv()
+		assertStatus(t, err, codes.Unavailable, transport.CodeUnavailable)
+	})
+}
+
+func TestMaintenance(t *testing.T) {
+	ts := newTestServer(t)
+	ts.settings.Store(config.Runtime{Maintenance: true})
+
+	_, err := ts.client.GetBalance(context.Background(), &walletpb.GetBalanceRequest{UserId: 1})
+	assertStatus(t, err, codes.Unavailable, transport.CodeMaintenance)
+
+	stream, err := ts.client.WatchOperations(context.Background(), &walletpb.WatchOperationsRequest{UserId: 1})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assertStatus(t, err, codes.Unavailable, transport.CodeMaintenance)
+
+	ts.settings.Store(config.Runtime{ReadOnly: true})
+	_, err = ts.client.Deposit(withKey(idempotencyKeyTest), &walletpb.DepositRequest{UserId: 1, Amount: 10})
+	assertStatus(t, err, codes.Unavailable, "READ_ONLY")
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := newTestServerWith(t, &config.RateLimit{
+		Routes:  map[string]string{config.RouteTransfer: "1/1m", config.RouteEvents: "1/1m"},
+		KeyBy:   []string{config.RateLimitKeyAPIKey, config.RateLimitKeyUser, config.RateLimitKeyIP},
+		APIKeys: []string{"service-a", "service-b"},
+	})
+
+	_, err := ts.client.Deposit(withKey(idempotencyKeyTest), &walletpb.DepositRequest{UserId: 1, Amount: 100})
+	require.NoError(t, err)
+	_, err = ts.client.Deposit(withKey("7c1d2e3f-4a5b-4c6d-8e7f-9a0b1c2d3e4f"), &walletpb.DepositRequest{UserId: 3, Amount: 100})
+	require.NoError(t, err)
+
+	// transfer makes a transfer of sender with a new Idempotency-Key and the API key, if it is not empty
+	transfer := func(sender uint64, apiKey string) error {
+		ctx := withKey(uuid.NewString())
+		if apiKey != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, apiKeyKey, apiKey)
+		}
+		_, err := ts.client.Transfer(ctx, &walletpb.TransferRequest{SenderId: sender, ReceiverId: 2, Amount: 1})
+		return err
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		require.NoError(t, transfer(1, ""))
+
+		err := transfer(1, "")
+		assertStatus(t, err, codes.ResourceExhausted, transport.CodeRateLimited)
+		info := status.Convert(err).Details()[0].(*errdetails.ErrorInfo)
+		assert.NotEmpty(t, info.Metadata["retry_after"])
+
+		// the calls come from one peer, the user is taken from the request, so the bucket of the IP is charged too
+		assertStatus(t, transfer(3, ""), codes.ResourceExhausted, transport.CodeRateLimited)
+		assertStatus(t, transfer(3, "unknown-key"), codes.ResourceExhausted, transport.CodeRateLimited)
+
+		// a listed API key has its own bucket
+		require.NoError(t, transfer(3, "service-a"))
+		assertStatus(t, transfer(3, "service-a"), codes.ResourceExhausted, transport.CodeRateLimited)
+		require.NoError(t, transfer(3, "service-b"))
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first, err := ts.client.WatchOperations(ctx, &walletpb.WatchOperationsRequest{UserId: 2})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return ts.broker.Watched(2) }, time.Second*5, time.Millisecond*10)
+
+		second, err := ts.client.WatchOperations(ctx, &walletpb.WatchOperationsRequest{UserId: 4})
+		require.NoError(t, err)
+		_, err = second.Recv()
+		assertStatus(t, err, codes.ResourceExhausted, transport.CodeRateLimited)
+
+		cancel()
+		_, err = first.Recv()
+		assert.Equal(t, codes.Canceled, status.Code(err))
+	})
+}
+
+// TestLookupError checks that the gRPC errors come from the table of the HTTP API: the same reason and message,
+// the code derived from the HTTP status
+func TestLookupError(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   codes.Code
+		reason string
+	}{
+		{services.ErrReceiverNotFound, codes.FailedPrecondition, transport.CodeReceiverNotFound},
+		{services.ErrSenderNotFound, codes.NotFound, transport.CodeSenderNotFound},
+		{services.ErrSelfTransfer, codes.InvalidArgument, transport.CodeSelfTransfer},
+		{storages.ErrRetryable, codes.Unavailable, transport.CodeUnavailable},
+		{context.Canceled, codes.Canceled, transport.CodeCanceled},
+		{errors.New("unknown"), codes.Internal, transport.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			got := lookupError(tt.err)
+			assert.Equal(t, tt.code, got.code)
+			assert.Equal(t, tt.reason, got.reason)
+			assert.Equal(t, transport.LookupError(tt.err).Message, got.message)
+		})
+	}
+}
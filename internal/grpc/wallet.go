@@ -0,0 +1,252 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/walletpb"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// idempotencyKeyKey is the metadata key of the Idempotency-Key, the metadata keys are lowercase
+const idempotencyKeyKey = "idempotency-key"
+
+// walletService is the part of the Wallet service used by the gRPC API
+type walletService interface {
+	Deposit(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error)
+	Transfer(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error)
+	UserOperations(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error)
+}
+
+type accountsService interface {
+	Balance(ctx context.Context, userID uint) (*models.User, error)
+}
+
+type eventsService interface {
+	Subscribe(userID uint, lastEventID string) (*services.Subscription, []*services.OperationEvent, bool)
+}
+
+// walletServer implements walletpb.WalletServer over the services
+type walletServer struct {
+	walletpb.UnimplementedWalletServer
+
+	log      *slog.Logger
+	wallet   walletService
+	accounts accountsService
+	events   eventsService
+	timeout  time.Duration
+	streams  <-chan struct{}
+}
+
+func (s *walletServer) Deposit(ctx context.Context, req *walletpb.DepositRequest) (*walletpb.OperationResponse, error) {
+	log := s.log.With(slog.String("operation", "gRPC Deposit: call"))
+	log.DebugContext(ctx, "request received")
+
+	if req.GetUserId() == 0 {
+		return nil, paramsErrorResponse(ctx, log, transport.CodeInvalidBody, "user_id is required")
+	}
+	if req.GetAmount() <= 0 {
+		return nil, paramsErrorResponse(ctx, log, transport.CodeInvalidBody, "amount must be greater than 0")
+	}
+
+	key, err := idempotencyKey(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	result, err := s.wallet.Deposit(timeoutCtx, &models.DepositRequest{
+		IdempotencyKey: key,
+		UserID:         uint(req.GetUserId()),
+		Amount:         req.GetAmount(),
+	})
+	if err != nil {
+		return nil, errorResponse(ctx, log, err)
+	}
+
+	log.InfoContext(ctx, "deposit successfully")
+	return &walletpb.OperationResponse{Message: result.Message, Operation: toOperation(result.Operation)}, nil
+}
+
+func (s *walletServer) Transfer(ctx context.Context, req *walletpb.TransferRequest) (*walletpb.OperationResponse, error) {
+	log := s.log.With(slog.String("operation", "gRPC Transfer: call"))
+	log.DebugContext(ctx, "request received")
+
+	if req.GetSenderId() == 0 || req.GetReceiverId() == 0 {
+		return nil, paramsErrorResponse(ctx, log, transport.CodeInvalidBody, "sender_id and receiver_id are required")
+	}
+	if req.GetAmount() <= 0 {
+		return nil, paramsErrorResponse(ctx, log, transport.CodeInvalidBody, "amount must be greater than 0")
+	}
+
+	key, err := idempotencyKey(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	result, err := s.wallet.Transfer(timeoutCtx, &models.TransferRequest{
+		IdempotencyKey: key,
+		SenderID:       uint(req.GetSenderId()),
+		ReceiverID:     uint(req.GetReceiverId()),
+		Amount:         req.GetAmount(),
+	})
+	if err != nil {
+		return nil, errorResponse(ctx, log, err)
+	}
+
+	log.InfoContext(ctx, "transfer successfully")
+	return &walletpb.OperationResponse{Message: result.Message, Operation: toOperation(result.Operation)}, nil
+}
+
+func (s *walletServer) GetOperations(ctx context.Context, req *walletpb.GetOperationsRequest) (*walletpb.GetOperationsResponse, error) {
+	log := s.log.With(slog.String("operation", "gRPC GetOperations: call"))
+	log.DebugContext(ctx, "request received")
+
+	if req.GetUserId() == 0 {
+		return nil, paramsErrorResponse(ctx, log, transport.CodeInvalidParams, "user_id is required")
+	}
+	if req.GetLimit() <= 0 {
+		return nil, paramsErrorResponse(ctx, log, transport.CodeInvalidParams, "limit must be greater than 0")
+	}
+	if req.GetOffset() < 0 {
+		return nil, paramsErrorResponse(ctx, log, transport.CodeInvalidParams, "offset must not be negative")
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	result, err := s.wallet.UserOperations(timeoutCtx, &models.UserOperationsRequest{
+		UserID: uint(req.GetUserId()),
+		Offset: int(req.GetOffset()),
+		Limit:  int(req.GetLimit()),
+	})
+	if err != nil {
+		return nil, errorResponse(ctx, log, err)
+	}
+
+	resp := &walletpb.GetOperationsResponse{
+		Message:    result.Message,
+		Operations: make([]*walletpb.Operation, 0, len(result.Operation)),
+	}
+	for _, operation := range result.Operation {
+		resp.Operations = append(resp.Operations, toOperation(operation))
+	}
+
+	log.InfoContext(ctx, "operations successfully")
+	return resp, nil
+}
+
+func (s *walletServer) GetBalance(ctx context.Context, req *walletpb.GetBalanceRequest) (*walletpb.GetBalanceResponse, error) {
+	log := s.log.With(slog.String("operation", "gRPC GetBalance: call"))
+	log.DebugContext(ctx, "request received")
+
+	if req.GetUserId() == 0 {
+		return nil, paramsErrorResponse(ctx, log, transport.CodeInvalidParams, "user_id is required")
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	user, err := s.accounts.Balance(timeoutCtx, uint(req.GetUserId()))
+	if err != nil {
+		return nil, errorResponse(ctx, log, err)
+	}
+
+	log.InfoContext(ctx, "balance successfully")
+	return &walletpb.GetBalanceResponse{UserId: uint64(user.ID), Name: user.Name, Balance: user.Balance}, nil
+}
+
+// WatchOperations works the same way as the SSE stream GET /users/:id/events: the missed operations are sent first,
+// then the new ones as they are committed. The stream has no handler timeout, it ends when the client cancels it,
+// the server stops or the client falls too far behind.
+func (s *walletServer) WatchOperations(req *walletpb.WatchOperationsRequest, stream walletpb.Wallet_WatchOperationsServer) error {
+	ctx := stream.Context()
+	log := s.log.With(slog.String("operation", "gRPC WatchOperations: call"))
+	log.DebugContext(ctx, "request received")
+
+	if req.GetUserId() == 0 {
+		return paramsErrorResponse(ctx, log, transport.CodeInvalidParams, "user_id is required")
+	}
+	userID := uint(req.GetUserId())
+
+	sub, missed, complete := s.events.Subscribe(userID, req.GetLastEventId())
+	defer sub.Close()
+
+	if !complete {
+		log.InfoContext(ctx, "missed operations are not known, the client must reload them", "user id", userID)
+		if err := stream.Send(&walletpb.OperationEvent{Reload: true}); err != nil {
+			return err
+		}
+	}
+	for _, event := range missed {
+		if err := stream.Send(toEvent(event)); err != nil {
+			return err
+		}
+	}
+
+	log.InfoContext(ctx, "stream started", "user id", userID, "missed", len(missed))
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				log.WarnContext(ctx, "stream is closed, the client is too slow")
+				return errSlowClient.status(nil)
+			}
+			if err := stream.Send(toEvent(event)); err != nil {
+				log.DebugContext(ctx, "failed to send to the stream", "error", err)
+				return err
+			}
+		case <-ctx.Done():
+			log.InfoContext(ctx, "client disconnected")
+			return nil
+		case <-s.streams:
+			log.InfoContext(ctx, "stream is closed, the server shuts down")
+			return errShutdown.status(nil)
+		}
+	}
+}
+
+// idempotencyKey returns the Idempotency-Key from the metadata, or the status to return if it is missing or not a UUID
+func idempotencyKey(ctx context.Context, log *slog.Logger) (string, error) {
+	values := metadata.ValueFromIncomingContext(ctx, idempotencyKeyKey)
+	if len(values) == 0 || values[0] == "" {
+		return "", paramsErrorResponse(ctx, log, transport.CodeInvalidIdempotencyKey, "metadata idempotency-key is missing")
+	}
+
+	if !transport.ValidIdempotencyKey(values[0]) {
+		return "", paramsErrorResponse(ctx, log, transport.CodeInvalidIdempotencyKey, "metadata idempotency-key does not match the UUID format")
+	}
+
+	return values[0], nil
+}
+
+func toOperation(data *models.Transaction) *walletpb.Operation {
+	if data == nil {
+		return nil
+	}
+
+	return &walletpb.Operation{
+		TransactionId: uint64(data.ID),
+		Success:       data.Success,
+		Sender:        data.SenderName,
+		Receiver:      data.ReceiverName,
+		TypeOperation: data.TypeOperation,
+		Amount:        data.Amount,
+		Date:          timestamppb.New(data.Date),
+	}
+}
+
+func toEvent(event *services.OperationEvent) *walletpb.OperationEvent {
+	return &walletpb.OperationEvent{Id: event.ID, Operation: toOperation(event.Operation)}
+}
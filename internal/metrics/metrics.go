@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "wallet"
+
+// Kinds of the domain errors counted by DomainError
+const (
+	ErrorInsufficientFunds = "insufficient_funds"
+	ErrorUserNotFound      = "user_not_found"
+	ErrorIdempotentReplay  = "idempotent_replay"
+)
+
+// Metrics keeps all series of the application in its own registry, so every instance (e.g. in tests) starts from zero
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	depositAmount   prometheus.Counter
+	transferAmount  prometheus.Counter
+	domainErrors    *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		depositAmount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "deposit_amount_cents_total",
+			Help:      "Sum of successful deposits in cents.",
+		}),
+		transferAmount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfer_amount_cents_total",
+			Help:      "Sum of successful transfers in cents, including the items of batch transfers.",
+		}),
+		domainErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "domain_errors_total",
+			Help:      "Number of domain errors and idempotent replays by kind.",
+		}, []string{"kind"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.depositAmount,
+		m.transferAmount,
+		m.domainErrors,
+	)
+
+	// the series are created in advance, so they are scraped as 0 and not missing until the first error
+	for _, kind := range []string{ErrorInsufficientFunds, ErrorUserNotFound, ErrorIdempotentReplay} {
+		m.domainErrors.WithLabelValues(kind)
+	}
+
+	return m
+}
+
+// Handler returns the HTTP handler of the /metrics endpoint
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest counts the HTTP request and its duration
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.requestDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+func (m *Metrics) DepositAmount(cents int64) {
+	m.depositAmount.Add(float64(cents))
+}
+
+func (m *Metrics) TransferAmount(cents int64) {
+	m.transferAmount.Add(float64(cents))
+}
+
+func (m *Metrics) DomainError(kind string) {
+	m.domainErrors.WithLabelValues(kind).Inc()
+}
+
+// RegisterPool adds the statistics of the Postgres connection pool. stat is called on every scrape.
+func (m *Metrics) RegisterPool(stat func() *pgxpool.Stat) {
+	gauge := func(name, help string, value func(s *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(stat()) })
+	}
+
+	counter := func(name, help string, value func(s *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(stat()) })
+	}
+
+	m.registry.MustRegister(
+		gauge("acquired_conns", "Number of connections currently acquired from the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }),
+		gauge("idle_conns", "Number of idle connections in the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }),
+		gauge("total_conns", "Total number of connections in the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }),
+		counter("acquire_total", "Number of successful acquires from the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }),
+		counter("acquire_wait_seconds_total", "Total time spent waiting for a connection from the pool.",
+			func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }),
+	)
+}
@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// Publisher gets the events from the outbox. An error leaves the event unpublished, it is passed again later,
+// so Publish must tolerate the same event twice. services.Webhooks is the publisher of the webhook subscriptions.
+type Publisher interface {
+	Publish(ctx context.Context, event *models.Event) error
+}
+
+// LogPublisher writes the events to the log, it is used when nobody needs them outside the service
+type LogPublisher struct {
+	log *slog.Logger
+}
+
+func NewLogPublisher(log *slog.Logger) *LogPublisher {
+	return &LogPublisher{log: log}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, event *models.Event) error {
+	p.log.InfoContext(ctx, "outbox: event published", "id", event.ID, "type", event.Type, "data", event.Data)
+	return nil
+}
+
+// MemoryPublisher keeps the published events, it is used by the tests. If Err is set, Publish returns it
+// and keeps nothing.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []*models.Event
+	Err    error
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event *models.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Err != nil {
+		return p.Err
+	}
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns the published events in the order they were published
+func (p *MemoryPublisher) Events() []*models.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := make([]*models.Event, len(p.events))
+	copy(events, p.events)
+
+	return events
+}
@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+)
+
+// Relay moves the events from the outbox table to the Publisher. The storages write an event in the same database
+// transaction as the balance change, so an event is never lost and never published for a change that was rolled back.
+// The relay publishes it afterwards, at least once.
+type Relay struct {
+	log       *slog.Logger
+	db        storages.StoreOutbox
+	publisher Publisher
+	conf      *config.Outbox
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewRelay(log *slog.Logger, db storages.StoreOutbox, publisher Publisher, conf *config.Outbox) *Relay {
+	return &Relay{
+		log:       log,
+		db:        db,
+		publisher: publisher,
+		conf:      conf,
+	}
+}
+
+// Start launches the relay goroutine. The outbox is checked immediately and then every OUTBOX_INTERVAL until Stop is called.
+func (r *Relay) Start() {
+	r.log.Debug("outbox Relay: started")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.conf.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := r.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				r.log.ErrorContext(ctx, "outbox Relay: failed to publish the events", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	r.log.Info("outbox Relay: successfully started", "interval", r.conf.Interval, "publisher", r.conf.Publisher)
+}
+
+// Stop cancels the relay goroutine and waits until it is finished. The events that are not published yet stay
+// in the outbox and are published after the restart.
+func (r *Relay) Stop() error {
+	r.log.Debug("outbox Relay: stop started")
+
+	if r.cancel == nil {
+		return fmt.Errorf("outbox relay is not running")
+	}
+
+	r.cancel()
+	<-r.done
+
+	r.cancel = nil
+	r.done = nil
+
+	r.log.Info("outbox Relay: stop successful")
+	return nil
+}
+
+// Run publishes the unpublished events by batches of OUTBOX_BATCH_SIZE until the outbox is empty. The first error
+// of the Publisher stops it, the failed event is published on the next run.
+func (r *Relay) Run(ctx context.Context) error {
+	op := "outbox Relay: run"
+	log := r.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "Run func call")
+
+	total := 0
+	for {
+		published, err := r.db.OutboxProcess(ctx, r.conf.BatchSize, r.publisher.Publish)
+		total += published
+		if err != nil {
+			log.ErrorContext(ctx, "failed to publish the events", "published", total, "error", err)
+			return err
+		}
+
+		if published < r.conf.BatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.InfoContext(ctx, "events successfully published", "count", total)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages/memory"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deposits makes the deposits to a new user of db and returns their Idempotency-Keys in the order they were made
+func deposits(t *testing.T, db *memory.MemoryDB, count int) []string {
+	t.Helper()
+	ctx := context.Background()
+
+	user := db.AddUser("Amy", 0)
+
+	var keys []string
+	for range count {
+		key := uuid.NewString()
+		require.NoError(t, db.TransactionCreate(ctx, &models.Transaction{IdempotencyKey: key, SenderID: user, TypeOperation: "deposit", Amount: 1}))
+		require.NoError(t, db.Deposit(ctx, &models.DepositRequest{IdempotencyKey: key, UserID: user, Amount: 1}))
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func keysOf(events []*models.Event) []string {
+	var keys []string
+	for _, event := range events {
+		keys = append(keys, event.Data.IdempotencyKey)
+	}
+	return keys
+}
+
+func TestRelay_Run(t *testing.T) {
+	log := logs.NewDiscardLogger()
+	db := memory.New(log)
+	keys := deposits(t, db, 5)
+
+	publisher := NewMemoryPublisher()
+	relay := NewRelay(log, db, publisher, &config.Outbox{Interval: time.Hour, BatchSize: 2})
+
+	require.NoError(t, relay.Run(context.Background()))
+
+	assert.Equal(t, keys, keysOf(publisher.Events()), "all batches are published in order")
+	for _, event := range publisher.Events() {
+		assert.Equal(t, services.EventDepositCompleted, event.Type)
+	}
+
+	require.NoError(t, relay.Run(context.Background()))
+	assert.Len(t, publisher.Events(), len(keys), "published events are not passed again")
+}
+
+func TestRelay_PublishError(t *testing.T) {
+	log := logs.NewDiscardLogger()
+	db := memory.New(log)
+	keys := deposits(t, db, 2)
+
+	publisher := NewMemoryPublisher()
+	publisher.Err = errors.New("publisher is unavailable")
+	relay := NewRelay(log, db, publisher, &config.Outbox{Interval: time.Hour, BatchSize: 10})
+
+	assert.ErrorIs(t, relay.Run(context.Background()), publisher.Err)
+	assert.Empty(t, publisher.Events())
+
+	publisher.Err = nil
+	require.NoError(t, relay.Run(context.Background()))
+	assert.Equal(t, keys, keysOf(publisher.Events()), "the events stay in the outbox until they are published")
+}
+
+func TestRelay_StartStop(t *testing.T) {
+	log := logs.NewDiscardLogger()
+	db := memory.New(log)
+	publisher := NewMemoryPublisher()
+	relay := NewRelay(log, db, publisher, &config.Outbox{Interval: time.Millisecond * 10, BatchSize: 10})
+
+	relay.Start()
+	keys := deposits(t, db, 3)
+
+	require.Eventually(t, func() bool {
+		return len(publisher.Events()) == len(keys)
+	}, time.Second*2, time.Millisecond*10)
+	assert.Equal(t, keys, keysOf(publisher.Events()))
+
+	require.NoError(t, relay.Stop())
+	assert.Error(t, relay.Stop(), "the relay is already stopped")
+}
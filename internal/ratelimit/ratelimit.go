@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backends that can be selected with HTTP_RATE_LIMIT_BACKEND
+const BackendMemory = "memory"
+
+// sweepInterval is how often Memory removes the buckets that are full again, they are the same as no bucket
+const sweepInterval = time.Minute
+
+// Quota is Limit requests per Period. The bucket holds Limit tokens and is refilled at the rate Limit/Period,
+// so a client can make Limit requests at once and then one request every Period/Limit.
+type Quota struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseQuota parses a quota in the form <requests>/<period>, e.g. 20/1s or 100/1m
+func ParseQuota(s string) (Quota, error) {
+	limit, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Quota{}, fmt.Errorf("invalid quota %q, expected <requests>/<period>, e.g. 20/1s", s)
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return Quota{}, fmt.Errorf("invalid quota %q: number of requests must be a positive integer", s)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Quota{}, fmt.Errorf("invalid quota %q: period must be a positive duration", s)
+	}
+
+	return Quota{Limit: n, Period: d}, nil
+}
+
+func (q Quota) String() string {
+	return strconv.Itoa(q.Limit) + "/" + q.Period.String()
+}
+
+// rate is the number of tokens added per second
+func (q Quota) rate() float64 {
+	return float64(q.Limit) / q.Period.Seconds()
+}
+
+// Result is the decision for one request. Remaining is the number of requests left right now, Reset is the time
+// until the bucket is full again, RetryAfter is the time until the next request is allowed, it is set only when
+// the request is not allowed.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter keeps the buckets of the clients. Memory keeps them in the process, a shared backend (e.g. Redis)
+// implements the same interface, so all instances of the application count the requests together.
+type Limiter interface {
+	Allow(ctx context.Context, key string, quota Quota) (Result, error)
+}
+
+// AllowAll takes a token from the bucket of every key, in order, and stops at the first bucket that is empty.
+// The request is allowed only if all the buckets allow it, the result of the most exhausted bucket is returned
+// together with its key.
+func AllowAll(ctx context.Context, l Limiter, keys []string, quota Quota) (Result, string, error) {
+	var result Result
+	var decided string
+
+	for i, key := range keys {
+		res, err := l.Allow(ctx, key, quota)
+		if err != nil {
+			return Result{}, key, err
+		}
+
+		if i == 0 || !res.Allowed || res.Remaining < result.Remaining {
+			result, decided = res, key
+		}
+		if !res.Allowed {
+			break
+		}
+	}
+
+	return result, decided, nil
+}
+
+// New creates the Limiter of the backend
+func New(backend string) (Limiter, error) {
+	switch backend {
+	case BackendMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", backend)
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// Memory is the in-process token bucket Limiter, every instance of the application has its own buckets
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*bucket),
+		now:       time.Now,
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of key, the bucket of a new key is full
+func (m *Memory) Allow(ctx context.Context, key string, quota Quota) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	rate := quota.rate()
+	capacity := float64(quota.Limit)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now, period: quota.Period}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	result := Result{Limit: quota.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / rate)
+
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+		m.lastSweep = now
+	}
+
+	return result, nil
+}
+
+// sweep removes the buckets that have been refilled completely, so the map does not grow with every new client
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.last) >= b.period {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMemory returns the Memory limiter with a clock that is moved by the returned function
+func newTestMemory() (*Memory, func(d time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	m.lastSweep = now
+
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestParseQuota(t *testing.T) {
+	q, err := ParseQuota("20/1s")
+	require.NoError(t, err)
+	assert.Equal(t, Quota{Limit: 20, Period: time.Second}, q)
+	assert.Equal(t, "20/1s", q.String())
+
+	for _, s := range []string{"", "20", "0/1s", "-1/1s", "x/1s", "20/0s", "20/x"} {
+		_, err := ParseQuota(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMemory_Allow(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newTestMemory()
+	quota := Quota{Limit: 3, Period: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		res, err := m.Allow(ctx, "a", quota)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+		assert.Equal(t, time.Duration(3-i)*time.Second, res.Reset)
+	}
+
+	res, err := m.Allow(ctx, "a", quota)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	res, err = m.Allow(ctx, "b", quota)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "every key has its own bucket")
+
+	advance(500 * time.Millisecond)
+	res, err = m.Allow(ctx, "a", quota)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	advance(500 * time.Millisecond)
+	res, err = m.Allow(ctx, "a", quota)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "one token is refilled in a second")
+
+	advance(time.Hour)
+	res, err = m.Allow(ctx, "a", quota)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining, "the bucket holds no more than the limit")
+}
+
+func TestAllowAll(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newTestMemory()
+	quota := Quota{Limit: 2, Period: time.Minute}
+
+	res, key, err := AllowAll(ctx, m, []string{"ip:1", "user:1"}, quota)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+	assert.Equal(t, "ip:1", key)
+
+	res, key, err = AllowAll(ctx, m, []string{"ip:1", "user:2"}, quota)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining, "the most exhausted bucket is returned")
+	assert.Equal(t, "ip:1", key)
+
+	res, key, err = AllowAll(ctx, m, []string{"ip:1", "user:3"}, quota)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed, "a new user does not get around the bucket of the IP")
+	assert.Equal(t, "ip:1", key)
+
+	res, err = m.Allow(ctx, "user:3", quota)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Remaining, "the buckets after the empty one are not charged")
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newTestMemory()
+
+	_, err := m.Allow(ctx, "short", Quota{Limit: 1, Period: time.Second})
+	require.NoError(t, err)
+	_, err = m.Allow(ctx, "long", Quota{Limit: 1, Period: time.Hour})
+	require.NoError(t, err)
+
+	advance(sweepInterval)
+	_, err = m.Allow(ctx, "new", Quota{Limit: 1, Period: time.Second})
+	require.NoError(t, err)
+
+	assert.NotContains(t, m.buckets, "short", "the full bucket is removed")
+	assert.Contains(t, m.buckets, "long")
+	assert.Contains(t, m.buckets, "new")
+}
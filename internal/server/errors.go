@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"github.com/go-playground/validator/v10"
+)
+
+// retryAfterSeconds is sent with 503 responses, the storage errors of this kind are usually short-lived
+const retryAfterSeconds = "1"
+
+// retryAfterModes is sent instead of retryAfterSeconds while a mode turned on by an operator is on, it takes minutes
+const retryAfterModes = "30"
+
+const requestIDHeader = "X-Request-ID"
+
+const (
+	problemContentType = "application/problem+json"
+	// problemTypePrefix makes the problem type URI from the error code, e.g. urn:problem-type:insufficient-funds
+	problemTypePrefix = "urn:problem-type:"
+)
+
+// apiError is how an error is presented to the client
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+var (
+	errInvalidBody           = apiError{http.StatusBadRequest, transport.CodeInvalidBody, "invalid data in body"}
+	errBodyTooLarge          = apiError{http.StatusRequestEntityTooLarge, transport.CodeBodyTooLarge, "request body is too large"}
+	errInvalidParams         = apiError{http.StatusBadRequest, transport.CodeInvalidParams, "invalid data in params"}
+	errInvalidIdempotencyKey = apiError{http.StatusBadRequest, transport.CodeInvalidIdempotencyKey, "header 'Idempotency-Key' must be a UUID"}
+	errInternal              = apiError{transport.Internal.Status, transport.Internal.Code, transport.Internal.Message}
+	errMaintenance           = apiError{http.StatusServiceUnavailable, transport.CodeMaintenance, "service is under maintenance, retry later"}
+	errUnauthorized          = apiError{http.StatusUnauthorized, transport.CodeUnauthorized, "invalid or missing admin token"}
+	errRateLimited           = apiError{http.StatusTooManyRequests, transport.CodeRateLimited, "too many requests, retry later"}
+)
+
+// lookupError returns the API error for err from the table shared with the gRPC API, or the internal error
+func lookupError(err error) apiError {
+	e := transport.LookupError(err)
+	return apiError{e.Status, e.Code, e.Message}
+}
+
+// errorResponse writes the response for an error returned by a service. Only the code and the message from
+// the error table are sent, the text of the error itself stays in the log, so no SQL or other internal details
+// get to the client.
+func errorResponse(ctx *gin.Context, log *slog.Logger, err error) {
+	apiErr := lookupError(err)
+
+	if apiErr.status >= http.StatusInternalServerError {
+		log.ErrorContext(ctx, "request failed", "code", apiErr.code, "error", err)
+	} else {
+		log.WarnContext(ctx, "request failed", "code", apiErr.code, "error", err)
+	}
+
+	writeError(ctx, apiErr, nil)
+}
+
+// bindErrorResponse writes the response for a body that could not be decoded or did not pass the validation.
+// The fields that failed the validation are listed in details, with the rule they broke.
+func bindErrorResponse(ctx *gin.Context, log *slog.Logger, err error) {
+	log.WarnContext(ctx, "invalid request body", "error", err)
+
+	var tooLargeErr *http.MaxBytesError
+	if errors.As(err, &tooLargeErr) {
+		writeError(ctx, errBodyTooLarge, map[string]any{"limit": tooLargeErr.Limit})
+		return
+	}
+
+	var validationErrs validator.ValidationErrors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	var details map[string]any
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make(map[string]string, len(validationErrs))
+		for _, fe := range validationErrs {
+			rule := fe.Tag()
+			if fe.Param() != "" {
+				rule += "=" + fe.Param()
+			}
+			fields[fieldName(fe)] = rule
+		}
+		details = map[string]any{"fields": fields}
+	case errors.As(err, &typeErr):
+		details = map[string]any{"fields": map[string]string{typeErr.Field: "type=" + typeErr.Type.String()}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		details = map[string]any{"reason": "body is not a valid JSON"}
+	}
+
+	writeError(ctx, errInvalidBody, details)
+}
+
+// writeError writes the error envelope, or the problem details if the client accepts application/problem+json.
+// 503 responses get the Retry-After header.
+func writeError(ctx *gin.Context, apiErr apiError, details map[string]any) {
+	switch {
+	case apiErr.code == transport.CodeMaintenance || apiErr.code == transport.CodeReadOnly:
+		ctx.Header("Retry-After", retryAfterModes)
+	case apiErr.status == http.StatusServiceUnavailable:
+		ctx.Header("Retry-After", retryAfterSeconds)
+	}
+
+	if acceptsProblem(ctx) {
+		writeProblem(ctx, apiErr, details)
+		return
+	}
+
+	ctx.JSON(apiErr.status, models.HandlerResponse{
+		Status:    apiErr.status,
+		Code:      apiErr.code,
+		Message:   apiErr.message,
+		RequestID: requestID(ctx),
+		Details:   details,
+	})
+}
+
+// writeProblem writes the error in the RFC 7807 format. The type is derived from the error code, so it is the same
+// for all errors of one kind, the detail is the reason from details, if there is one.
+func writeProblem(ctx *gin.Context, apiErr apiError, details map[string]any) {
+	problem := models.ProblemDetails{
+		Type:      problemTypePrefix + strings.ToLower(strings.ReplaceAll(apiErr.code, "_", "-")),
+		Title:     apiErr.message,
+		Status:    apiErr.status,
+		Detail:    apiErr.message,
+		Instance:  ctx.Request.URL.Path,
+		Code:      apiErr.code,
+		RequestID: requestID(ctx),
+		Details:   details,
+	}
+
+	if reason, ok := details["reason"].(string); ok {
+		problem.Detail = reason
+	}
+
+	// render.JSON keeps the Content-Type that is already set
+	ctx.Header("Content-Type", problemContentType)
+	ctx.Render(apiErr.status, render.JSON{Data: problem})
+}
+
+// acceptsProblem reports whether application/problem+json is listed in the Accept header of the request
+func acceptsProblem(ctx *gin.Context) bool {
+	for _, accept := range ctx.Request.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), problemContentType) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// requestID returns the ID of the request set by the RequestID middleware
+func requestID(ctx *gin.Context) string {
+	return logs.RequestID(ctx.Request.Context())
+}
+
+// idempotencyKey reads the Idempotency-Key header and checks that it is a UUID.
+// If it is not, the error response is written and false is returned.
+func idempotencyKey(ctx *gin.Context, log *slog.Logger) (string, bool) {
+	key := ctx.GetHeader("Idempotency-Key")
+	if key == "" {
+		log.WarnContext(ctx, "'Idempotency-Key' was not passed in the headers")
+		writeError(ctx, errInvalidIdempotencyKey, map[string]any{"reason": "header is missing"})
+		return "", false
+	}
+
+	if !transport.ValidIdempotencyKey(key) {
+		log.WarnContext(ctx, "header 'Idempotency-Key' does not match the UUID format", "key", key)
+		writeError(ctx, errInvalidIdempotencyKey, map[string]any{"reason": "header does not match the UUID format"})
+		return "", false
+	}
+
+	return key, true
+}
+
+var registerJSONNames sync.Once
+
+// useJSONNames makes the validator report the fields by their names in JSON, the names the client sent
+func useJSONNames() {
+	registerJSONNames.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	})
+}
+
+// fieldName returns the path of the field in the body, e.g. items[0].amount
+func fieldName(fe validator.FieldError) string {
+	_, name, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+
+	return name
+}
+
+// paramsErrorResponse writes the response for invalid path or query parameters, reason says what is wrong with them
+func paramsErrorResponse(ctx *gin.Context, log *slog.Logger, reason string) {
+	log.WarnContext(ctx, "invalid request params", "reason", reason)
+	writeError(ctx, errInvalidParams, map[string]any{"reason": reason})
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	serv "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"sender not found wraps user not found", serv.ErrSenderNotFound, transport.CodeSenderNotFound},
+		{"receiver not found wraps user not found", serv.ErrReceiverNotFound, transport.CodeReceiverNotFound},
+		{"wrapped error", fmt.Errorf("deposit: %w", storages.ErrUserNotFound), transport.CodeUserNotFound},
+		{"storage error kind", storages.NewError(storages.ErrDuplicate, errors.New("unique violation")), transport.CodeDuplicate},
+		{"duplicate idempotency key", storages.NewError(storages.ErrIdempotencyKeyExists, errors.New("unique violation")), transport.CodeIdempotencyConflict},
+		{"timeout", fmt.Errorf("query: %w", context.DeadlineExceeded), transport.CodeTimeout},
+		{"client disconnected", fmt.Errorf("query: %w", context.Canceled), transport.CodeCanceled},
+		{"unknown error", errors.New("pq: relation \"users\" does not exist"), transport.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, lookupError(tt.err).code)
+		})
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	ts := newTestServer(t)
+
+	t.Run("validation details use JSON names", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPost, "/transfers/batch", withKey(),
+			`{"sender_id": 1, "mode": "atomic", "items": [{"receiver_id": 2, "amount": -1}]}`)
+
+		assertErrorEnvelope(t, resp, http.StatusBadRequest, transport.CodeInvalidBody)
+		assert.Equal(t, map[string]any{"fields": map[string]any{"items[0].amount": "gt=0"}}, resp.body["details"])
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPost, "/deposit", withKey(), `{"id": 2,`)
+
+		assertErrorEnvelope(t, resp, http.StatusBadRequest, transport.CodeInvalidBody)
+		assert.Equal(t, map[string]any{"reason": "body is not a valid JSON"}, resp.body["details"])
+	})
+
+	t.Run("request id is returned", func(t *testing.T) {
+		ts.wallet.DepositFunc = func(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error) {
+			return nil, errors.New("ERROR: deadlock detected (SQLSTATE 40P01)")
+		}
+
+		headers := withKey()
+		headers[requestIDHeader] = "req-42"
+		resp := ts.do(t, http.MethodPost, "/deposit", headers, `{"id": 2, "amount": 10}`)
+
+		assertErrorEnvelope(t, resp, http.StatusInternalServerError, transport.CodeInternal)
+		assert.Equal(t, "req-42", resp.body["request_id"])
+	})
+}
+
+func TestProblemDetails(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.wallet.TransferFunc = func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+		return nil, serv.ErrInsufficientFunds
+	}
+
+	body := `{"sender_id": 4, "receiver_id": 3, "amount": 100.55}`
+
+	t.Run("problem+json is returned when accepted", func(t *testing.T) {
+		headers := withKey()
+		headers["Accept"] = "application/json;q=0.5, application/problem+json"
+		headers[requestIDHeader] = "req-7"
+		resp := ts.do(t, http.MethodPost, "/transfer", headers, body)
+
+		assert.Equal(t, http.StatusPaymentRequired, resp.status)
+		assert.Equal(t, problemContentType, resp.header.Get("Content-Type"))
+		assert.Equal(t, "urn:problem-type:insufficient-funds", resp.body["type"])
+		assert.Equal(t, "insufficient funds", resp.body["title"])
+		assert.Equal(t, float64(http.StatusPaymentRequired), resp.body["status"])
+		assert.Equal(t, "insufficient funds", resp.body["detail"])
+		assert.Equal(t, "/transfer", resp.body["instance"])
+		assert.Equal(t, transport.CodeInsufficientFunds, resp.body["code"])
+		assert.Equal(t, "req-7", resp.body["request_id"])
+		assert.NotContains(t, resp.body, "message")
+	})
+
+	t.Run("detail is the reason of the error", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPost, "/transfer", map[string]string{"Accept": problemContentType}, body)
+
+		assert.Equal(t, http.StatusBadRequest, resp.status)
+		assert.Equal(t, "urn:problem-type:invalid-idempotency-key", resp.body["type"])
+		assert.Equal(t, "header is missing", resp.body["detail"])
+	})
+
+	t.Run("default format", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPost, "/transfer", withKey(), body)
+
+		assert.Contains(t, resp.header.Get("Content-Type"), "application/json")
+		assertErrorEnvelope(t, resp, http.StatusPaymentRequired, transport.CodeInsufficientFunds)
+		assert.NotContains(t, resp.body, "type")
+	})
+}
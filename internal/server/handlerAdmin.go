@@ -0,0 +1,78 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/gin-gonic/gin"
+)
+
+// InitAdminRouters registers the /admin routes, they need the admin token and are not turned off by the maintenance
+// mode. Without the token in the config the routes are not registered.
+func (s *HttpServer) InitAdminRouters(webhooks webhookService) {
+	if s.conf.AdminToken == "" {
+		s.log.Info("HTTP server: admin token is not set, the admin routes are turned off")
+		return
+	}
+
+	admin := s.router.Group("/admin", AdminAuth(s.conf.AdminToken))
+	admin.GET("/read-only", ReadOnlyGet(s.settings))
+	admin.PUT("/read-only", ReadOnlySet(s.log, s.settings))
+
+	admin.POST("/webhooks", WebhookCreate(s.log, webhooks, s.conf.HandlerTimeout))
+	admin.GET("/webhooks/:id", WebhookGet(s.log, webhooks, s.conf.HandlerTimeout))
+	admin.DELETE("/webhooks/:id", WebhookDelete(s.log, webhooks, s.conf.HandlerTimeout))
+	admin.GET("/webhooks/:id/deliveries", WebhookDeliveries(s.log, webhooks, s.conf.HandlerTimeout))
+}
+
+// example request
+//
+// Headers - required
+// Authorization Bearer <HTTP_ADMIN_TOKEN>
+func ReadOnlyGet(settings runtimeSettings) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, readOnlyState(settings))
+	}
+}
+
+// example request
+//
+// Headers - required
+// Authorization Bearer <HTTP_ADMIN_TOKEN>
+//
+// body - required
+// {
+// "enabled": true
+// }
+func ReadOnlySet(log *slog.Logger, settings runtimeSettings) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler ReadOnlySet: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		var reqData models.ReadOnlyRequest
+		if err := ctx.ShouldBindJSON(&reqData); err != nil {
+			bindErrorResponse(ctx, log, err)
+			return
+		}
+
+		settings.SetReadOnly(*reqData.Enabled)
+
+		state := readOnlyState(settings)
+		log.WarnContext(ctx, "read-only mode switched by the admin API", "admin", state.Admin, "read_only", state.ReadOnly)
+		ctx.JSON(http.StatusOK, state)
+	}
+}
+
+func readOnlyState(settings runtimeSettings) *models.ReadOnlyResponse {
+	return &models.ReadOnlyResponse{
+		ReadOnly: settings.ReadOnly(),
+		Config:   settings.Runtime().ReadOnly,
+		Admin:    settings.AdminReadOnly(),
+	}
+}
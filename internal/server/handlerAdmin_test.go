@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/EvansTrein/iqProgers/internal/server/mock"
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/storages/memory"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const adminTokenTest = "admin-secret"
+
+// TestReadOnly runs the real Wallet over the in-memory storage and switches the read-only mode by the admin API
+func TestReadOnly(t *testing.T) {
+	log := logs.NewDiscardLogger()
+	m := metrics.New()
+	settings := config.NewSettings(config.Runtime{})
+
+	conf := testConfig()
+	conf.AdminToken = adminTokenTest
+
+	s := New(log, conf, settings, m)
+	s.InitRouters(services.New(log, memory.New(log), m, settings, nil), &mock.MockScheduler{}, services.NewBroker(log), ratelimit.NewMemory())
+	s.InitHealthRouters(&mock.MockHealth{
+		PingFunc:          func(ctx context.Context) error { return nil },
+		SchemaVersionFunc: func(ctx context.Context) (uint, bool, error) { return storages.SchemaVersion, false, nil },
+	})
+	s.InitAdminRouters(&mock.MockWebhooks{})
+
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+	ts := &testServer{url: srv.URL}
+
+	admin := map[string]string{"Authorization": "Bearer " + adminTokenTest}
+
+	resp := ts.do(t, http.MethodPost, "/deposit", withKey(), `{"id": 2, "amount": 100}`)
+	require.Equal(t, http.StatusOK, resp.status)
+
+	t.Run("admin token is required", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPut, "/admin/read-only", nil, `{"enabled": true}`)
+		assertErrorEnvelope(t, resp, http.StatusUnauthorized, transport.CodeUnauthorized)
+
+		resp = ts.do(t, http.MethodPut, "/admin/read-only", map[string]string{"Authorization": "Bearer wrong"}, `{"enabled": true}`)
+		assertErrorEnvelope(t, resp, http.StatusUnauthorized, transport.CodeUnauthorized)
+		assert.False(t, settings.ReadOnly())
+	})
+
+	t.Run("turned on by the admin API", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPut, "/admin/read-only", admin, `{"enabled": true}`)
+		require.Equal(t, http.StatusOK, resp.status)
+		assert.Equal(t, map[string]any{"read_only": true, "config": false, "admin": true}, resp.body)
+
+		resp = ts.do(t, http.MethodPost, "/deposit", map[string]string{"Idempotency-Key": "5a4a3c1e-8f0b-4d2e-9c55-0b7f6e0f9a11"}, `{"id": 2, "amount": 100}`)
+		assertErrorEnvelope(t, resp, http.StatusServiceUnavailable, transport.CodeReadOnly)
+		assert.Equal(t, retryAfterModes, resp.header.Get("Retry-After"))
+
+		resp = ts.do(t, http.MethodPost, "/transfer", map[string]string{"Idempotency-Key": "9d7e1f7e-2b0c-4a55-8f43-1c2d3e4f5a6b"},
+			`{"sender_id": 2, "receiver_id": 3, "amount": 10}`)
+		assertErrorEnvelope(t, resp, http.StatusServiceUnavailable, transport.CodeReadOnly)
+
+		resp = ts.do(t, http.MethodGet, "/operations/2?limit=10", nil, "")
+		assert.Equal(t, http.StatusOK, resp.status, "the history stays readable")
+
+		resp = ts.do(t, http.MethodGet, "/readyz", nil, "")
+		assert.Equal(t, http.StatusOK, resp.status)
+		assert.Equal(t, modeReadOnly, resp.body["mode"])
+	})
+
+	t.Run("turned off by the admin API", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPut, "/admin/read-only", admin, `{"enabled": false}`)
+		require.Equal(t, http.StatusOK, resp.status)
+		assert.Equal(t, false, resp.body["read_only"])
+
+		resp = ts.do(t, http.MethodGet, "/readyz", nil, "")
+		assert.Equal(t, modeReadWrite, resp.body["mode"])
+	})
+
+	t.Run("config mode is not turned off by the admin API", func(t *testing.T) {
+		settings.Store(config.Runtime{ReadOnly: true})
+		t.Cleanup(func() { settings.Store(config.Runtime{}) })
+
+		resp := ts.do(t, http.MethodPut, "/admin/read-only", admin, `{"enabled": false}`)
+		require.Equal(t, http.StatusOK, resp.status)
+		assert.Equal(t, map[string]any{"read_only": true, "config": true, "admin": false}, resp.body)
+
+		resp = ts.do(t, http.MethodGet, "/admin/read-only", admin, "")
+		assert.Equal(t, true, resp.body["read_only"])
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPut, "/admin/read-only", admin, `{}`)
+		assertErrorEnvelope(t, resp, http.StatusBadRequest, transport.CodeInvalidBody)
+	})
+}
+
+func TestAdminRoutesWithoutToken(t *testing.T) {
+	ts := newTestServer(t)
+	ts.server.InitAdminRouters(&mock.MockWebhooks{})
+
+	resp, err := http.Get(ts.url + "/admin/read-only")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWebhookRoutes(t *testing.T) {
+	conf := testConfig()
+	conf.AdminToken = adminTokenTest
+	ts := newTestServerWithConfig(t, conf)
+
+	userID := uint(4)
+	webhooks := &mock.MockWebhooks{
+		WebhookCreateFunc: func(ctx context.Context, req *models.WebhookRequest) (*models.WebhookResponse, error) {
+			if *req.UserID != userID {
+				return nil, storages.ErrUserNotFound
+			}
+			return &models.WebhookResponse{
+				Message: "webhook successfully created",
+				Webhook: &models.Webhook{ID: 1, UserID: req.UserID, URL: req.URL, Secret: "generated-secret", CreatedAt: time.Now()},
+			}, nil
+		},
+		WebhookGetFunc: func(ctx context.Context, id uint) (*models.WebhookResponse, error) {
+			return nil, storages.ErrWebhookNotFound
+		},
+		WebhookDeleteFunc: func(ctx context.Context, id uint) error {
+			return nil
+		},
+		WebhookDeliveriesFunc: func(ctx context.Context, id uint) (*models.WebhookDeliveriesResponse, error) {
+			return &models.WebhookDeliveriesResponse{
+				Message:    "webhook deliveries successfully received",
+				Deliveries: []*models.WebhookDelivery{{ID: 7, WebhookID: id, EventType: "deposit.completed", Status: storages.DeliveryDead, Attempts: 8}},
+			}, nil
+		},
+	}
+	ts.server.InitAdminRouters(webhooks)
+
+	admin := map[string]string{"Authorization": "Bearer " + adminTokenTest}
+
+	resp := ts.do(t, http.MethodPost, "/admin/webhooks", nil, `{"url": "http://localhost:9000/hook"}`)
+	assertErrorEnvelope(t, resp, http.StatusUnauthorized, transport.CodeUnauthorized)
+
+	resp = ts.do(t, http.MethodPost, "/admin/webhooks", admin, `{"user_id": 4, "url": "http://localhost:9000/hook"}`)
+	require.Equal(t, http.StatusCreated, resp.status)
+	webhook := resp.body["webhook"].(map[string]any)
+	assert.Equal(t, "generated-secret", webhook["secret"])
+	assert.Equal(t, float64(userID), webhook["user_id"])
+
+	resp = ts.do(t, http.MethodPost, "/admin/webhooks", admin, `{"user_id": 5, "url": "http://localhost:9000/hook"}`)
+	assertErrorEnvelope(t, resp, http.StatusNotFound, transport.CodeUserNotFound)
+
+	resp = ts.do(t, http.MethodPost, "/admin/webhooks", admin, `{"url": "not a url"}`)
+	assertErrorEnvelope(t, resp, http.StatusBadRequest, transport.CodeInvalidBody)
+
+	resp = ts.do(t, http.MethodPost, "/admin/webhooks", admin, `{"url": "http://localhost:9000/hook", "secret": "short"}`)
+	assertErrorEnvelope(t, resp, http.StatusBadRequest, transport.CodeInvalidBody)
+
+	resp = ts.do(t, http.MethodGet, "/admin/webhooks/1", admin, "")
+	assertErrorEnvelope(t, resp, http.StatusNotFound, transport.CodeWebhookNotFound)
+
+	resp = ts.do(t, http.MethodGet, "/admin/webhooks/abc", admin, "")
+	assertErrorEnvelope(t, resp, http.StatusBadRequest, transport.CodeInvalidParams)
+
+	resp = ts.do(t, http.MethodGet, "/admin/webhooks/1/deliveries", admin, "")
+	require.Equal(t, http.StatusOK, resp.status)
+	deliveries := resp.body["deliveries"].([]any)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, storages.DeliveryDead, deliveries[0].(map[string]any)["status"])
+
+	resp = ts.do(t, http.MethodDelete, "/admin/webhooks/1", admin, "")
+	assert.Equal(t, http.StatusOK, resp.status)
+}
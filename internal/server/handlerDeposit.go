@@ -2,12 +2,10 @@ package server
 
 import (
 	"context"
-	"errors"
 	"log/slog"
-	"net/http"
+	"time"
 
 	"github.com/EvansTrein/iqProgers/models"
-	"github.com/EvansTrein/iqProgers/internal/storages"
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,91 +24,40 @@ type walletDeposit interface {
 // "id": 2,
 // "amount": 205.44
 // }
-func Deposit(log *slog.Logger, service walletDeposit) gin.HandlerFunc {
+func Deposit(log *slog.Logger, service walletDeposit, timeout time.Duration) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		op := "Handler Deposit: call"
-		log = log.With(
+		log := log.With(
 			slog.String("operation", op),
 			slog.String("apiPath", ctx.FullPath()),
 			slog.String("HTTP Method", ctx.Request.Method),
 		)
-		log.Debug("request received")
+		log.DebugContext(ctx, "request received")
 
 		var reqData models.DepositRequest
 		if err := ctx.ShouldBindJSON(&reqData); err != nil {
-			ctx.JSON(400, models.HandlerResponse{
-				Status:  http.StatusBadRequest,
-				Message: "invalid data in body",
-				Error:   err.Error(),
-			})
+			bindErrorResponse(ctx, log, err)
 			return
 		}
 
-		reqData.IdempotencyKey = ctx.GetHeader("Idempotency-Key")
-		if reqData.IdempotencyKey == "" {
-			ctx.JSON(400, models.HandlerResponse{
-				Status:  http.StatusBadRequest,
-				Message: "invalid data in headers",
-				Error:   "'Idempotency-Key' was not passed in the headers",
-			})
+		key, ok := idempotencyKey(ctx, log)
+		if !ok {
 			return
 		}
+		reqData.IdempotencyKey = key
 
-		isVaild, err := isGUID(reqData.IdempotencyKey)
-		if err != nil {
-			ctx.JSON(500, models.HandlerResponse{
-				Status:  http.StatusInternalServerError,
-				Message: "failed to verify the header format 'Idempotency-Key'",
-				Error:   err.Error(),
-			})
-			return
-		}
-
-		if !isVaild {
-			ctx.JSON(400, models.HandlerResponse{
-				Status:  http.StatusBadRequest,
-				Message: "invalid data in headers 'Idempotency-Key'",
-				Error:   "header 'Idempotency-Key' does not match the UUID format",
-			})
-			return
-		}
+		log.DebugContext(ctx, "request data has been successfully validated", "reqData", reqData)
 
-		log.Debug("request data has been successfully validated", "reqData", reqData)
-
-		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeoutHandlerResponce)
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
 		defer cancel()
 
 		result, err := service.Deposit(timeoutCtx, &reqData)
 		if err != nil {
-			switch {
-			case errors.Is(err, storages.ErrUserNotFound):
-				log.Warn("deposit failed, no user with this id", "error", err)
-				ctx.JSON(404, models.HandlerResponse{
-					Status:  http.StatusNotFound,
-					Message: "no user with this id",
-					Error:   err.Error(),
-				})
-				return
-			case errors.Is(err, context.DeadlineExceeded):
-				log.Error("deposit failed due to timeout", "error", err)
-				ctx.JSON(504, models.HandlerResponse{
-					Status:  http.StatusGatewayTimeout,
-					Message: "deposit failed due to timeout",
-					Error:   err.Error(),
-				})
-				return
-			default:
-				log.Error("deposit failed", "error", err)
-				ctx.JSON(500, models.HandlerResponse{
-					Status:  http.StatusInternalServerError,
-					Message: "deposit failed",
-					Error:   err.Error(),
-				})
-				return
-			}
+			errorResponse(ctx, log, err)
+			return
 		}
 
-		log.Info("deposit successfully")
+		log.InfoContext(ctx, "deposit successfully")
 		ctx.JSON(200, result)
 	}
 }
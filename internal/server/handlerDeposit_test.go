@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeposit(t *testing.T) {
+	ts := newTestServer(t)
+
+	validBody := `{"id": 2, "amount": 205.44}`
+	var received *models.DepositRequest
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		body           string
+		serviceErr     error
+		expectedStatus int
+		expectedMsg    string
+		expectedCode   string
+	}{
+		{
+			name:           "successful deposit",
+			headers:        withKey(),
+			body:           validBody,
+			expectedStatus: http.StatusOK,
+			expectedMsg:    "deposit successfully",
+		},
+		{
+			name:           "invalid json",
+			headers:        withKey(),
+			body:           `{"id": 2,`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidBody,
+		},
+		{
+			name:           "amount is not positive",
+			headers:        withKey(),
+			body:           `{"id": 2, "amount": -5}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidBody,
+		},
+		{
+			name:           "no Idempotency-Key",
+			body:           validBody,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidIdempotencyKey,
+		},
+		{
+			name:           "Idempotency-Key is not a UUID",
+			headers:        map[string]string{"Idempotency-Key": "not-a-uuid"},
+			body:           validBody,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidIdempotencyKey,
+		},
+		{
+			name:           "user not found",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     storages.ErrUserNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   transport.CodeUserNotFound,
+		},
+		{
+			name:           "timeout",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     fmt.Errorf("deposit: %w", context.DeadlineExceeded),
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedCode:   transport.CodeTimeout,
+		},
+		{
+			name:           "duplicate record",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     storages.NewError(storages.ErrIdempotencyKeyExists, errors.New("duplicate key value violates unique constraint")),
+			expectedStatus: http.StatusConflict,
+			expectedCode:   transport.CodeIdempotencyConflict,
+		},
+		{
+			name:           "referenced record not found",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     storages.NewError(storages.ErrReferenceNotFound, errors.New("violates foreign key constraint")),
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   transport.CodeReferenceNotFound,
+		},
+		{
+			name:           "constraint violation",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     storages.NewError(storages.ErrConstraint, errors.New("violates check constraint")),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   transport.CodeConstraintViolation,
+		},
+		{
+			name:           "storage unavailable",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     storages.NewError(storages.ErrUnavailable, errors.New("connection refused")),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   transport.CodeUnavailable,
+		},
+		{
+			name:           "unexpected error",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     errors.New("something went wrong"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   transport.CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			ts.wallet.DepositFunc = func(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error) {
+				received = req
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &models.DepositResponse{
+					Message:   "deposit successfully",
+					Operation: &models.Transaction{ID: 7, Success: true, TypeOperation: "deposit", Amount: req.Amount},
+				}, nil
+			}
+
+			resp := ts.do(t, http.MethodPost, "/deposit", tt.headers, tt.body)
+
+			assert.Equal(t, tt.expectedStatus, resp.status)
+			if tt.expectedCode == "" {
+				assert.Equal(t, tt.expectedMsg, resp.body["message"])
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				require.NotNil(t, received)
+				assert.Equal(t, idempotencyKeyTest, received.IdempotencyKey)
+				assert.Equal(t, uint(2), received.UserID)
+				assert.Equal(t, 205.44, received.Amount)
+
+				operation := resp.body["operation"].(map[string]any)
+				assert.Equal(t, float64(7), operation["transaction_id"])
+				assert.Equal(t, 205.44, operation["amount"])
+			} else {
+				assertErrorEnvelope(t, resp, tt.expectedStatus, tt.expectedCode)
+			}
+
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.Nil(t, received, "the service must not be called for an invalid request")
+			}
+
+			if tt.expectedStatus == http.StatusServiceUnavailable {
+				assert.Equal(t, retryAfterSeconds, resp.header.Get("Retry-After"))
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// keepAliveInterval is how often a comment is sent to an idle stream, so the proxies do not close the connection
+const keepAliveInterval = time.Second * 15
+
+// Names of the events of the stream
+const (
+	sseEventOperation = "operation"
+	sseEventReset     = "reset"
+)
+
+type eventsService interface {
+	Subscribe(userID uint, lastEventID string) (*services.Subscription, []*services.OperationEvent, bool)
+}
+
+// UserEvents streams the committed operations of the user as Server-Sent Events. The data of an "operation" event
+// is the same as an operation of GET /operations/:id. With Last-Event-ID the missed operations are sent first;
+// if they are not known any more, a "reset" event tells the client to reload the history. The stream ends when
+// done is closed (the server shuts down), the client disconnects or falls too far behind, then EventSource reconnects.
+//
+// example request
+//
+// path parameters - required
+// id 1
+//
+// headers
+// Last-Event-ID - the id of the last event the client got, it is sent by EventSource on a reconnect
+func UserEvents(log *slog.Logger, service eventsService, done <-chan struct{}) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler UserEvents: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		userID, err := eventsUserID(ctx)
+		if err != nil {
+			paramsErrorResponse(ctx, log, err.Error())
+			return
+		}
+
+		sub, missed, complete := service.Subscribe(userID, ctx.GetHeader("Last-Event-ID"))
+		defer sub.Close()
+
+		// the stream lives longer than HTTP_WRITE_TIMEOUT, the deadline of the connection is turned off for it
+		if err := http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{}); err != nil {
+			log.WarnContext(ctx, "failed to turn off the write deadline", "error", err)
+		}
+
+		header := ctx.Writer.Header()
+		header.Set("Content-Type", sse.ContentType)
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		ctx.Status(http.StatusOK)
+
+		if !complete {
+			log.InfoContext(ctx, "missed operations are not known, the client must reload them", "user id", userID)
+			ctx.Render(-1, sse.Event{Event: sseEventReset, Data: gin.H{"message": "missed operations are not known, reload them"}})
+		}
+		for _, event := range missed {
+			renderOperation(ctx, event)
+		}
+		ctx.Writer.Flush()
+
+		log.InfoContext(ctx, "stream started", "user id", userID, "missed", len(missed))
+
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case event, ok := <-sub.Events():
+				if !ok {
+					log.WarnContext(ctx, "stream is closed, the client is too slow")
+					return
+				}
+				renderOperation(ctx, event)
+			case <-keepAlive.C:
+				if _, err := ctx.Writer.WriteString(": keep-alive\n\n"); err != nil {
+					log.DebugContext(ctx, "failed to write to the stream", "error", err)
+					return
+				}
+			case <-ctx.Request.Context().Done():
+				log.InfoContext(ctx, "client disconnected")
+				return
+			case <-done:
+				log.InfoContext(ctx, "stream is closed, the server shuts down")
+				return
+			}
+
+			ctx.Writer.Flush()
+		}
+	}
+}
+
+func renderOperation(ctx *gin.Context, event *services.OperationEvent) {
+	ctx.Render(-1, sse.Event{Id: event.ID, Event: sseEventOperation, Data: event.Operation})
+}
+
+func eventsUserID(ctx *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, errors.New("user id must be a positive number")
+	}
+
+	return uint(id), nil
+}
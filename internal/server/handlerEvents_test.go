@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent is an event read from the stream
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// openStream opens the event stream of the user and returns its events, the channel is closed when the stream ends
+func openStream(t *testing.T, ts *testServer, userID, lastEventID string) <-chan sseEvent {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.url+"/users/"+userID+"/events", nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream;charset=utf-8", resp.Header.Get("Content-Type"))
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		var event sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event.event != "" {
+					events <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id:"):
+				event.id = line[len("id:"):]
+			case strings.HasPrefix(line, "event:"):
+				event.event = line[len("event:"):]
+			case strings.HasPrefix(line, "data:"):
+				event.data = line[len("data:"):]
+			}
+		}
+	}()
+
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "the stream is closed")
+		return event
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "no event in the stream")
+		return sseEvent{}
+	}
+}
+
+func TestUserEvents(t *testing.T) {
+	ts := newTestServer(t)
+	name := "Alice"
+
+	// the handler subscribes before it sends the headers, so the stream is watched once openStream returns
+	events := openStream(t, ts, "1", "")
+	require.True(t, ts.broker.Watched(1))
+
+	ts.broker.Publish(&models.Transaction{ID: 7, SenderID: 2, ReceiverID: 1, Success: true, SenderName: &name,
+		TypeOperation: "transfer", Amount: 10.5})
+	ts.broker.Publish(&models.Transaction{ID: 8, SenderID: 3, Success: true, TypeOperation: "deposit", Amount: 1})
+	ts.broker.Publish(&models.Transaction{ID: 9, SenderID: 1, Success: true, TypeOperation: "deposit", Amount: 20})
+
+	first := nextEvent(t, events)
+	assert.Equal(t, sseEventOperation, first.event)
+	assert.NotEmpty(t, first.id)
+
+	var operation map[string]any
+	require.NoError(t, json.Unmarshal([]byte(first.data), &operation))
+	assert.Equal(t, float64(7), operation["transaction_id"])
+	assert.Equal(t, name, operation["sender"])
+	assert.Equal(t, 10.5, operation["amount"])
+
+	second := nextEvent(t, events)
+	assert.Contains(t, second.data, `"transaction_id":9`, "the operations of the other users are not sent")
+
+	t.Run("resumed with Last-Event-ID", func(t *testing.T) {
+		resumed := openStream(t, ts, "1", first.id)
+
+		event := nextEvent(t, resumed)
+		assert.Equal(t, second.id, event.id)
+		assert.Equal(t, second.data, event.data)
+	})
+
+	t.Run("unknown Last-Event-ID", func(t *testing.T) {
+		resumed := openStream(t, ts, "1", "unknown-1")
+
+		event := nextEvent(t, resumed)
+		assert.Equal(t, sseEventReset, event.event)
+		assert.Empty(t, event.id, "the reset event does not move Last-Event-ID")
+	})
+
+	t.Run("invalid user id", func(t *testing.T) {
+		resp := ts.do(t, http.MethodGet, "/users/abc/events", nil, "")
+		assertErrorEnvelope(t, resp, http.StatusBadRequest, transport.CodeInvalidParams)
+
+		resp = ts.do(t, http.MethodGet, "/users/0/events", nil, "")
+		assertErrorEnvelope(t, resp, http.StatusBadRequest, transport.CodeInvalidParams)
+	})
+}
+
+func TestUserEventsShutdown(t *testing.T) {
+	ts := newTestServer(t)
+
+	events := openStream(t, ts, "1", "")
+	require.True(t, ts.broker.Watched(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, ts.server.server.Shutdown(ctx))
+
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok, "the stream ends without events")
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "the stream is not closed on shutdown")
+	}
+	require.Eventually(t, func() bool { return !ts.broker.Watched(1) }, time.Second*5, time.Millisecond*10)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperations(t *testing.T) {
+	ts := newTestServer(t)
+
+	var received *models.UserOperationsRequest
+
+	tests := []struct {
+		name           string
+		path           string
+		serviceErr     error
+		expectedStatus int
+		expectedMsg    string
+		expectedCode   string
+		expectedReq    *models.UserOperationsRequest
+	}{
+		{
+			name:           "successful request",
+			path:           "/operations/3?limit=10&offset=20",
+			expectedStatus: http.StatusOK,
+			expectedMsg:    "operations successfully",
+			expectedReq:    &models.UserOperationsRequest{UserID: 3, Limit: 10, Offset: 20},
+		},
+		{
+			name:           "default offset",
+			path:           "/operations/3?limit=10",
+			expectedStatus: http.StatusOK,
+			expectedMsg:    "operations successfully",
+			expectedReq:    &models.UserOperationsRequest{UserID: 3, Limit: 10, Offset: 0},
+		},
+		{
+			name:           "no limit",
+			path:           "/operations/3",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidParams,
+		},
+		{
+			name:           "user id is not a number",
+			path:           "/operations/abc?limit=10",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidParams,
+		},
+		{
+			name:           "limit is not a number",
+			path:           "/operations/3?limit=ten",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidParams,
+		},
+		{
+			name:           "offset is not a number",
+			path:           "/operations/3?limit=10&offset=x",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidParams,
+		},
+		{
+			name:           "user not found",
+			path:           "/operations/3?limit=10",
+			serviceErr:     storages.ErrUserNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   transport.CodeUserNotFound,
+		},
+		{
+			name:           "no operations",
+			path:           "/operations/3?limit=10",
+			serviceErr:     storages.ErrOperationsNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   transport.CodeOperationsNotFound,
+		},
+		{
+			name:           "timeout",
+			path:           "/operations/3?limit=10",
+			serviceErr:     context.DeadlineExceeded,
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedCode:   transport.CodeTimeout,
+		},
+		{
+			name:           "storage unavailable",
+			path:           "/operations/3?limit=10",
+			serviceErr:     storages.NewError(storages.ErrUnavailable, errors.New("connection refused")),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   transport.CodeUnavailable,
+		},
+		{
+			name:           "unexpected error",
+			path:           "/operations/3?limit=10",
+			serviceErr:     errors.New("something went wrong"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   transport.CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			ts.wallet.UserOperationsFunc = func(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+				received = req
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				return &models.UserOperationsResponse{
+					Message:   "operations successfully",
+					Operation: []*models.Transaction{{ID: 1, Success: true, TypeOperation: "deposit", Amount: 10}},
+				}, nil
+			}
+
+			resp := ts.do(t, http.MethodGet, tt.path, nil, "")
+
+			assert.Equal(t, tt.expectedStatus, resp.status)
+			switch tt.expectedStatus {
+			case http.StatusOK:
+				assert.Equal(t, tt.expectedMsg, resp.body["message"])
+				require.NotNil(t, received)
+				assert.Equal(t, tt.expectedReq, received)
+				assert.Len(t, resp.body["operation"], 1)
+			case http.StatusBadRequest:
+				assert.Nil(t, received, "the service must not be called for an invalid request")
+				fallthrough
+			default:
+				assertErrorEnvelope(t, resp, tt.expectedStatus, tt.expectedCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/gin-gonic/gin"
+)
+
+type scheduleService interface {
+	ScheduleCreate(ctx context.Context, req *models.ScheduledTransferRequest) (*models.ScheduledTransferResponse, error)
+	ScheduleGet(ctx context.Context, id uint) (*models.ScheduledTransferResponse, error)
+	ScheduleUpdate(ctx context.Context, req *models.ScheduledTransferUpdateRequest) (*models.ScheduledTransferResponse, error)
+	ScheduleDelete(ctx context.Context, id uint) error
+}
+
+// example request
+//
+// body - required
+//
+//	{
+//		"sender_id": 4,
+//		"receiver_id": 3,
+//		"amount": 100.55,
+//		"period": "monthly", // once, weekly, monthly
+//		"start_at": "2025-02-01T10:00:00Z"
+//	}
+func ScheduleCreate(log *slog.Logger, service scheduleService, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler ScheduleCreate: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		var reqData models.ScheduledTransferRequest
+		if err := ctx.ShouldBindJSON(&reqData); err != nil {
+			bindErrorResponse(ctx, log, err)
+			return
+		}
+
+		log.DebugContext(ctx, "request data has been successfully validated", "reqData", reqData)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		result, err := service.ScheduleCreate(timeoutCtx, &reqData)
+		if err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "scheduled transfer created successfully")
+		ctx.JSON(201, result)
+	}
+}
+
+// example request
+//
+// path parameters - required
+// id 1
+func ScheduleGet(log *slog.Logger, service scheduleService, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler ScheduleGet: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		id, err := scheduleID(ctx)
+		if err != nil {
+			paramsErrorResponse(ctx, log, err.Error())
+			return
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		result, err := service.ScheduleGet(timeoutCtx, id)
+		if err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "scheduled transfer received successfully")
+		ctx.JSON(200, result)
+	}
+}
+
+// example request
+//
+// path parameters - required
+// id 1
+//
+// body - required
+//
+//	{
+//		"amount": 150,
+//		"period": "weekly",
+//		"start_at": "2025-02-03T10:00:00Z",
+//		"active": true
+//	}
+func ScheduleUpdate(log *slog.Logger, service scheduleService, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler ScheduleUpdate: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		id, err := scheduleID(ctx)
+		if err != nil {
+			paramsErrorResponse(ctx, log, err.Error())
+			return
+		}
+
+		var reqData models.ScheduledTransferUpdateRequest
+		if err := ctx.ShouldBindJSON(&reqData); err != nil {
+			bindErrorResponse(ctx, log, err)
+			return
+		}
+		reqData.ID = id
+
+		log.DebugContext(ctx, "request data has been successfully validated", "reqData", reqData)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		result, err := service.ScheduleUpdate(timeoutCtx, &reqData)
+		if err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "scheduled transfer updated successfully")
+		ctx.JSON(200, result)
+	}
+}
+
+// example request
+//
+// path parameters - required
+// id 1
+func ScheduleDelete(log *slog.Logger, service scheduleService, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler ScheduleDelete: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		id, err := scheduleID(ctx)
+		if err != nil {
+			paramsErrorResponse(ctx, log, err.Error())
+			return
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		if err := service.ScheduleDelete(timeoutCtx, id); err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "scheduled transfer deleted successfully")
+		ctx.JSON(200, models.HandlerResponse{
+			Status:  http.StatusOK,
+			Message: "scheduled transfer successfully deleted",
+		})
+	}
+}
+
+func scheduleID(ctx *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return 0, errors.New("scheduled transfer id must be a positive number")
+	}
+
+	return uint(id), nil
+}
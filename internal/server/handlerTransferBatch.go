@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/gin-gonic/gin"
+)
+
+type walletTransferBatch interface {
+	TransferBatch(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error)
+}
+
+// example request
+//
+// Headers - required
+// Idempotency-Key UUID
+// 'f65616ca-8b51-4af2-8342-84157b55cbb7'
+//
+// body - required
+//
+//	{
+//		"sender_id": 1,
+//		"mode": "atomic", // atomic - all or nothing, best_effort - result for every item
+//		"items": [
+//			{"receiver_id": 2, "amount": 100.55},
+//			{"receiver_id": 3, "amount": 200}
+//		]
+//	}
+func TransferBatch(log *slog.Logger, service walletTransferBatch, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler TransferBatch: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		var reqData models.TransferBatchRequest
+		if err := ctx.ShouldBindJSON(&reqData); err != nil {
+			bindErrorResponse(ctx, log, err)
+			return
+		}
+
+		key, ok := idempotencyKey(ctx, log)
+		if !ok {
+			return
+		}
+		reqData.IdempotencyKey = key
+
+		log.DebugContext(ctx, "request data has been successfully validated", "items", len(reqData.Items))
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		result, err := service.TransferBatch(timeoutCtx, &reqData)
+		if err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "batch transfer completed", "success", result.Batch.Success)
+		ctx.JSON(200, result)
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	serv "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransfer(t *testing.T) {
+	ts := newTestServer(t)
+
+	validBody := `{"sender_id": 4, "receiver_id": 3, "amount": 100.55}`
+	var received *models.TransferRequest
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		body           string
+		serviceErr     error
+		expectedStatus int
+		expectedMsg    string
+		expectedCode   string
+	}{
+		{
+			name:           "successful transfer",
+			headers:        withKey(),
+			body:           validBody,
+			expectedStatus: http.StatusOK,
+			expectedMsg:    "transfer successfully",
+		},
+		{
+			name:           "no receiver in body",
+			headers:        withKey(),
+			body:           `{"sender_id": 4, "amount": 100.55}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidBody,
+		},
+		{
+			name:           "no Idempotency-Key",
+			body:           validBody,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidIdempotencyKey,
+		},
+		{
+			name:           "Idempotency-Key is not a UUID",
+			headers:        map[string]string{"Idempotency-Key": "42dd3893-9baf-43ac-8c2b"},
+			body:           validBody,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeInvalidIdempotencyKey,
+		},
+		{
+			name:           "insufficient funds",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     serv.ErrInsufficientFunds,
+			expectedStatus: http.StatusPaymentRequired,
+			expectedCode:   transport.CodeInsufficientFunds,
+		},
+		{
+			name:           "negative balance",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     serv.ErrNegaticeBalance,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   transport.CodeNegativeBalance,
+		},
+		{
+			name:           "self transfer",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     serv.ErrSelfTransfer,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   transport.CodeSelfTransfer,
+		},
+		{
+			name:           "sender not found",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     serv.ErrSenderNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   transport.CodeSenderNotFound,
+		},
+		{
+			name:           "receiver not found",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     serv.ErrReceiverNotFound,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   transport.CodeReceiverNotFound,
+		},
+		{
+			name:           "user not found",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     storages.ErrUserNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   transport.CodeUserNotFound,
+		},
+		{
+			name:           "timeout",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     context.DeadlineExceeded,
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedCode:   transport.CodeTimeout,
+		},
+		{
+			name:           "storage conflict",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     storages.NewError(storages.ErrRetryable, errors.New("could not serialize access")),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   transport.CodeUnavailable,
+		},
+		{
+			name:           "unexpected error",
+			headers:        withKey(),
+			body:           validBody,
+			serviceErr:     errors.New("something went wrong"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   transport.CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			ts.wallet.TransferFunc = func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+				received = req
+				if tt.serviceErr != nil {
+					return nil, tt.serviceErr
+				}
+				sender, receiver := "Howard", "Penny"
+				return &models.TransferResponse{
+					Message: "transfer successfully",
+					Operation: &models.Transaction{
+						ID:            8,
+						Success:       true,
+						SenderName:    &sender,
+						ReceiverName:  &receiver,
+						TypeOperation: "transfer",
+						Amount:        req.Amount,
+					},
+				}, nil
+			}
+
+			resp := ts.do(t, http.MethodPost, "/transfer", tt.headers, tt.body)
+
+			assert.Equal(t, tt.expectedStatus, resp.status)
+			switch tt.expectedStatus {
+			case http.StatusOK:
+				assert.Equal(t, tt.expectedMsg, resp.body["message"])
+				require.NotNil(t, received)
+				assert.Equal(t, idempotencyKeyTest, received.IdempotencyKey)
+				assert.Equal(t, uint(4), received.SenderID)
+				assert.Equal(t, uint(3), received.ReceiverID)
+
+				operation := resp.body["operation"].(map[string]any)
+				assert.Equal(t, "Howard", operation["sender"])
+				assert.Equal(t, "Penny", operation["receiver"])
+			case http.StatusBadRequest:
+				if tt.serviceErr == nil {
+					assert.Nil(t, received, "the service must not be called for an invalid request")
+				}
+				fallthrough
+			default:
+				assertErrorEnvelope(t, resp, tt.expectedStatus, tt.expectedCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/gin-gonic/gin"
+)
+
+type webhookService interface {
+	WebhookCreate(ctx context.Context, req *models.WebhookRequest) (*models.WebhookResponse, error)
+	WebhookGet(ctx context.Context, id uint) (*models.WebhookResponse, error)
+	WebhookDelete(ctx context.Context, id uint) error
+	WebhookDeliveries(ctx context.Context, id uint) (*models.WebhookDeliveriesResponse, error)
+}
+
+// example request
+//
+// Headers - required
+// Authorization Bearer <HTTP_ADMIN_TOKEN>
+//
+// body - required
+//
+//	{
+//		"user_id": 4, // optional, all users if not set
+//		"url": "https://example.com/hooks/wallet",
+//		"secret": "at-least-16-characters" // optional, generated if not set
+//	}
+func WebhookCreate(log *slog.Logger, service webhookService, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler WebhookCreate: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		var reqData models.WebhookRequest
+		if err := ctx.ShouldBindJSON(&reqData); err != nil {
+			bindErrorResponse(ctx, log, err)
+			return
+		}
+
+		log.DebugContext(ctx, "request data has been successfully validated", "user id", reqData.UserID, "url", reqData.URL)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		result, err := service.WebhookCreate(timeoutCtx, &reqData)
+		if err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "webhook created successfully")
+		ctx.JSON(201, result)
+	}
+}
+
+// example request
+//
+// Headers - required
+// Authorization Bearer <HTTP_ADMIN_TOKEN>
+//
+// path parameters - required
+// id 1
+func WebhookGet(log *slog.Logger, service webhookService, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler WebhookGet: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		id, err := webhookID(ctx)
+		if err != nil {
+			paramsErrorResponse(ctx, log, err.Error())
+			return
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		result, err := service.WebhookGet(timeoutCtx, id)
+		if err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "webhook received successfully")
+		ctx.JSON(200, result)
+	}
+}
+
+// example request
+//
+// Headers - required
+// Authorization Bearer <HTTP_ADMIN_TOKEN>
+//
+// path parameters - required
+// id 1
+func WebhookDelete(log *slog.Logger, service webhookService, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler WebhookDelete: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		id, err := webhookID(ctx)
+		if err != nil {
+			paramsErrorResponse(ctx, log, err.Error())
+			return
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		if err := service.WebhookDelete(timeoutCtx, id); err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "webhook deleted successfully")
+		ctx.JSON(200, models.HandlerResponse{
+			Status:  http.StatusOK,
+			Message: "webhook successfully deleted",
+		})
+	}
+}
+
+// example request
+//
+// Headers - required
+// Authorization Bearer <HTTP_ADMIN_TOKEN>
+//
+// path parameters - required
+// id 1
+func WebhookDeliveries(log *slog.Logger, service webhookService, timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler WebhookDeliveries: call"
+		log := log.With(
+			slog.String("operation", op),
+			slog.String("apiPath", ctx.FullPath()),
+			slog.String("HTTP Method", ctx.Request.Method),
+		)
+		log.DebugContext(ctx, "request received")
+
+		id, err := webhookID(ctx)
+		if err != nil {
+			paramsErrorResponse(ctx, log, err.Error())
+			return
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		result, err := service.WebhookDeliveries(timeoutCtx, id)
+		if err != nil {
+			errorResponse(ctx, log, err)
+			return
+		}
+
+		log.InfoContext(ctx, "webhook deliveries received successfully")
+		ctx.JSON(200, result)
+	}
+}
+
+func webhookID(ctx *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		return 0, errors.New("webhook id must be a positive number")
+	}
+
+	return uint(id), nil
+}
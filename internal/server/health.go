@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/gin-gonic/gin"
+)
+
+// readinessCheckTimeout limits all checks of one /readyz request
+const readinessCheckTimeout = time.Second * 2
+
+// Statuses of the health responses and their components
+const (
+	healthAlive        = "alive"
+	healthReady        = "ready"
+	healthNotReady     = "not_ready"
+	healthShuttingDown = "shutting_down"
+	componentUp        = "up"
+	componentDown      = "down"
+)
+
+// Modes reported by /readyz, the application is ready in all of them
+const (
+	modeReadWrite   = "read_write"
+	modeReadOnly    = "read_only"
+	modeMaintenance = "maintenance"
+)
+
+// InitHealthRouters registers /healthz and /readyz. db is checked by /readyz.
+func (s *HttpServer) InitHealthRouters(db storages.StoreHealth) {
+	s.router.GET("/healthz", Liveness())
+	s.router.GET("/readyz", Readiness(s.log, db, s.settings, s.isShuttingDown))
+}
+
+// Liveness only shows that the process is able to serve requests, it does not check the dependencies,
+// so a broken database does not make the orchestrator restart the application
+func Liveness() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, models.HealthResponse{Status: healthAlive})
+	}
+}
+
+// Readiness checks the database and the version of its migrations, 503 is returned if any of them is down.
+// After the shutdown has started it returns 503 without checks, so the load balancer stops sending requests.
+// The maintenance and the read-only modes are reported in mode, they do not make the application not ready:
+// the requests must still get to it, to be answered with 503 and Retry-After.
+func Readiness(log *slog.Logger, db storages.StoreHealth, settings runtimeSettings, shuttingDown func() bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		op := "Handler Readiness: call"
+		log := log.With(slog.String("operation", op))
+
+		if shuttingDown() {
+			ctx.JSON(http.StatusServiceUnavailable, models.HealthResponse{Status: healthShuttingDown})
+			return
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx.Request.Context(), readinessCheckTimeout)
+		defer cancel()
+
+		database := &models.ComponentHealth{Status: componentUp}
+		if err := db.Ping(timeoutCtx); err != nil {
+			log.ErrorContext(ctx, "database is not reachable", "error", err)
+			database.Status = componentDown
+			database.Message = "database is not reachable"
+		}
+
+		migrations := &models.ComponentHealth{Status: componentUp, Expected: storages.SchemaVersion}
+		version, dirty, err := db.SchemaVersion(timeoutCtx)
+		switch {
+		case err != nil:
+			log.ErrorContext(ctx, "failed to read the schema version", "error", err)
+			migrations.Status = componentDown
+			migrations.Message = "failed to read the schema version"
+		case dirty:
+			migrations.Status = componentDown
+			migrations.Message = "the last migration failed"
+		case version != storages.SchemaVersion:
+			migrations.Status = componentDown
+			migrations.Message = "migrations are not at the expected version"
+		}
+		migrations.Version = version
+
+		resp := models.HealthResponse{
+			Status: healthReady,
+			Mode:   mode(settings),
+			Components: map[string]*models.ComponentHealth{
+				"database":   database,
+				"migrations": migrations,
+			},
+		}
+
+		status := http.StatusOK
+		if database.Status != componentUp || migrations.Status != componentUp {
+			log.WarnContext(ctx, "application is not ready", "database", database.Status, "migrations", migrations.Status)
+			resp.Status = healthNotReady
+			status = http.StatusServiceUnavailable
+		}
+
+		ctx.JSON(status, resp)
+	}
+}
+
+func mode(settings runtimeSettings) string {
+	switch {
+	case settings.Runtime().Maintenance:
+		return modeMaintenance
+	case settings.ReadOnly():
+		return modeReadOnly
+	default:
+		return modeReadWrite
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name              string
+		pingErr           error
+		version           uint
+		dirty             bool
+		versionErr        error
+		expectedStatus    int
+		expectedDatabase  string
+		expectedMigration string
+	}{
+		{
+			name:              "ready",
+			version:           storages.SchemaVersion,
+			expectedStatus:    http.StatusOK,
+			expectedDatabase:  componentUp,
+			expectedMigration: componentUp,
+		},
+		{
+			name:              "database is down",
+			pingErr:           errors.New("dial tcp: connection refused"),
+			version:           storages.SchemaVersion,
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedDatabase:  componentDown,
+			expectedMigration: componentUp,
+		},
+		{
+			name:              "migrations are behind",
+			version:           storages.SchemaVersion - 1,
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedDatabase:  componentUp,
+			expectedMigration: componentDown,
+		},
+		{
+			name:              "dirty migration",
+			version:           storages.SchemaVersion,
+			dirty:             true,
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedDatabase:  componentUp,
+			expectedMigration: componentDown,
+		},
+		{
+			name:              "no migrations table",
+			versionErr:        errors.New(`relation "schema_migrations" does not exist`),
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedDatabase:  componentUp,
+			expectedMigration: componentDown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.health.PingFunc = func(ctx context.Context) error { return tt.pingErr }
+			ts.health.SchemaVersionFunc = func(ctx context.Context) (uint, bool, error) {
+				return tt.version, tt.dirty, tt.versionErr
+			}
+
+			resp := ts.do(t, http.MethodGet, "/readyz", nil, "")
+
+			assert.Equal(t, tt.expectedStatus, resp.status)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, healthReady, resp.body["status"])
+			} else {
+				assert.Equal(t, healthNotReady, resp.body["status"])
+			}
+
+			components := resp.body["components"].(map[string]any)
+			database := components["database"].(map[string]any)
+			migrations := components["migrations"].(map[string]any)
+
+			assert.Equal(t, tt.expectedDatabase, database["status"])
+			assert.Equal(t, tt.expectedMigration, migrations["status"])
+			assert.Equal(t, float64(storages.SchemaVersion), migrations["expected"])
+			if tt.pingErr != nil {
+				assert.Equal(t, "database is not reachable", database["message"], "internal errors must not be sent")
+			}
+		})
+	}
+}
+
+func TestShuttingDown(t *testing.T) {
+	ts := newTestServer(t)
+	ts.health.PingFunc = func(ctx context.Context) error { return nil }
+	ts.health.SchemaVersionFunc = func(ctx context.Context) (uint, bool, error) { return storages.SchemaVersion, false, nil }
+
+	resp := ts.do(t, http.MethodGet, "/readyz", nil, "")
+	assert.Equal(t, http.StatusOK, resp.status)
+
+	ts.server.SetShuttingDown()
+
+	resp = ts.do(t, http.MethodGet, "/readyz", nil, "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.status)
+	assert.Equal(t, healthShuttingDown, resp.body["status"])
+
+	resp = ts.do(t, http.MethodGet, "/healthz", nil, "")
+	assert.Equal(t, http.StatusOK, resp.status, "the application is still alive")
+	assert.Equal(t, healthAlive, resp.body["status"])
+}
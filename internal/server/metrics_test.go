@@ -0,0 +1,77 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/EvansTrein/iqProgers/internal/server/mock"
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages/memory"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMetrics runs the real Wallet over the in-memory storage and scrapes /metrics of the same server
+func TestMetrics(t *testing.T) {
+	log := logs.NewDiscardLogger()
+	m := metrics.New()
+
+	s := New(log, testConfig(), config.NewSettings(config.Runtime{}), m)
+	s.InitRouters(services.New(log, memory.New(log), m, config.NewSettings(config.Runtime{}), nil), &mock.MockScheduler{}, services.NewBroker(log), ratelimit.NewMemory())
+
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+	ts := &testServer{url: srv.URL}
+
+	resp := ts.do(t, http.MethodPost, "/deposit", withKey(), `{"id": 2, "amount": 205.44}`)
+	require.Equal(t, http.StatusOK, resp.status)
+
+	resp = ts.do(t, http.MethodPost, "/deposit", withKey(), `{"id": 2, "amount": 205.44}`)
+	require.Equal(t, http.StatusOK, resp.status, "replay")
+
+	resp = ts.do(t, http.MethodPost, "/transfer", map[string]string{"Idempotency-Key": "5a4a3c1e-8f0b-4d2e-9c55-0b7f6e0f9a11"},
+		`{"sender_id": 2, "receiver_id": 3, "amount": 100.5}`)
+	require.Equal(t, http.StatusOK, resp.status)
+
+	resp = ts.do(t, http.MethodPost, "/transfer", map[string]string{"Idempotency-Key": "9d7e1f7e-2b0c-4a55-8f43-1c2d3e4f5a6b"},
+		`{"sender_id": 2, "receiver_id": 3, "amount": 1000}`)
+	require.Equal(t, http.StatusPaymentRequired, resp.status)
+
+	resp = ts.do(t, http.MethodGet, "/operations/99?limit=10", nil, "")
+	require.Equal(t, http.StatusNotFound, resp.status)
+
+	unmatched, err := http.Get(srv.URL + "/no-such-route")
+	require.NoError(t, err)
+	unmatched.Body.Close()
+	require.Equal(t, http.StatusNotFound, unmatched.StatusCode)
+
+	scrape, err := http.Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	defer scrape.Body.Close()
+
+	data, err := io.ReadAll(scrape.Body)
+	require.NoError(t, err)
+	body := string(data)
+
+	for _, line := range []string{
+		`wallet_http_requests_total{method="POST",route="/deposit",status="200"} 2`,
+		`wallet_http_requests_total{method="POST",route="/transfer",status="402"} 1`,
+		`wallet_http_requests_total{method="GET",route="/operations/:id",status="404"} 1`,
+		`wallet_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`wallet_http_request_duration_seconds_count{method="POST",route="/transfer",status="200"} 1`,
+		`wallet_deposit_amount_cents_total 20544`,
+		`wallet_transfer_amount_cents_total 10050`,
+		`wallet_domain_errors_total{kind="idempotent_replay"} 1`,
+		`wallet_domain_errors_total{kind="insufficient_funds"} 1`,
+		`wallet_domain_errors_total{kind="user_not_found"} 1`,
+	} {
+		assert.True(t, strings.Contains(body, line+"\n"), "no %q in /metrics", line)
+	}
+}
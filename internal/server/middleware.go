@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestID takes the X-Request-ID of the request or generates a new one if it is not passed or invalid.
+// The ID is stored in the context of the request, so every log.*Context call down to the storage writes it,
+// is added to the span of the request and is returned to the client in the X-Request-ID header.
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(requestIDHeader)
+		if !transport.ValidRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		ctx.Request = ctx.Request.WithContext(logs.WithRequestID(ctx.Request.Context(), id))
+		trace.SpanFromContext(ctx.Request.Context()).SetAttributes(attribute.String("request_id", id))
+		ctx.Header(requestIDHeader, id)
+
+		ctx.Next()
+	}
+}
+
+// unmatchedRoute is the route label of the requests that did not match any route, so unknown paths do not create new series
+const unmatchedRoute = "unmatched"
+
+// Metrics counts the requests and their duration by the route pattern (e.g. /operations/:id), not by the path
+func Metrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		m.ObserveRequest(route, ctx.Request.Method, ctx.Writer.Status(), time.Since(start))
+	}
+}
+
+// BodyLimit limits the size of the request body, reading beyond the limit fails with *http.MaxBytesError,
+// which is returned to the client as 413
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Body != nil {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+		}
+
+		ctx.Next()
+	}
+}
+
+// Maintenance rejects the requests with 503 while the maintenance mode is on. The mode is read from the current
+// runtime settings on every request, so it is turned on and off by a config reload without a restart.
+func Maintenance(settings runtimeSettings) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if settings.Runtime().Maintenance {
+			writeError(ctx, errMaintenance, nil)
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// AdminAuth lets through only the requests with the admin token in the Authorization: Bearer header
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		got, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(ctx, errUnauthorized, nil)
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+const apiKeyHeader = "X-API-Key"
+
+// userFunc returns the user of the request, or an empty string if the request has none
+type userFunc func(ctx *gin.Context) string
+
+// paramUser takes the user from the path parameter
+func paramUser(name string) userFunc {
+	return func(ctx *gin.Context) string {
+		return validUser(ctx.Param(name))
+	}
+}
+
+// bodyUser takes the user from a field of the JSON body. The body is read before the handler, so it is given back
+// to the handler together with the read error, e.g. the body limit, and the handler responds as without the limiter.
+func bodyUser(field string) userFunc {
+	return func(ctx *gin.Context) string {
+		if ctx.Request.Body == nil {
+			return ""
+		}
+
+		data, err := io.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), errReader{err}))
+		if err != nil {
+			return ""
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return ""
+		}
+
+		return validUser(string(fields[field]))
+	}
+}
+
+// validUser accepts only the IDs the handler accepts too, so one user cannot get several buckets
+// by writing the ID differently
+func validUser(id string) string {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return ""
+	}
+
+	return id
+}
+
+// errReader returns err after the body that was read, or io.EOF if there was no error
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return 0, io.EOF
+}
+
+// clientKeys identifies the client by the first of conf.KeyBy found in the request, the IP is always found.
+// Only the API keys of conf.APIKeys are accepted. The user comes from the request and the client can change it,
+// so the IP is returned before the user: its bucket is charged too and stays the limit of the client.
+func clientKeys(ctx *gin.Context, conf *config.RateLimit, user userFunc) []string {
+	ip := config.RateLimitKeyIP + ":" + ctx.ClientIP()
+
+	for _, by := range conf.KeyBy {
+		switch by {
+		case config.RateLimitKeyAPIKey:
+			if key := ctx.GetHeader(apiKeyHeader); conf.KnownAPIKey(key) {
+				return []string{by + ":" + key}
+			}
+		case config.RateLimitKeyUser:
+			if user == nil {
+				continue
+			}
+			if id := user(ctx); id != "" {
+				return []string{ip, by + ":" + id}
+			}
+		case config.RateLimitKeyIP:
+			return []string{ip}
+		}
+	}
+
+	return []string{ip}
+}
+
+// RateLimit limits the requests of a route to quota per client, every client has its own token bucket in the limiter.
+// The state of the bucket is returned in the RateLimit-* headers, a request over the quota gets 429 with Retry-After.
+// If the limiter fails, the request is let through: the limiter protects the service, it must not stop it.
+func RateLimit(log *slog.Logger, limiter ratelimit.Limiter, route string, quota ratelimit.Quota, conf *config.RateLimit, user userFunc) gin.HandlerFunc {
+	policy := strconv.Itoa(quota.Limit) + ";w=" + strconv.Itoa(ceilSeconds(quota.Period))
+
+	return func(ctx *gin.Context) {
+		clients := clientKeys(ctx, conf, user)
+		keys := make([]string, len(clients))
+		for i, client := range clients {
+			keys[i] = route + "|" + client
+		}
+
+		res, key, err := ratelimit.AllowAll(ctx, limiter, keys, quota)
+		if err != nil {
+			log.ErrorContext(ctx, "rate limiter failed, the request is let through", "route", route, "error", err)
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("RateLimit-Policy", policy)
+		ctx.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		ctx.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		ctx.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			retryAfter := ceilSeconds(res.RetryAfter)
+			log.WarnContext(ctx, "rate limit exceeded", "route", route, "client", strings.TrimPrefix(key, route+"|"), "quota", quota.String())
+			ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+			writeError(ctx, errRateLimited, map[string]any{"retry_after": retryAfter})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, the headers cannot tell less than a second
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
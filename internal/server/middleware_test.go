@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	ts := newTestServer(t)
+
+	var received string
+	ts.wallet.UserOperationsFunc = func(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+		received = logs.RequestID(ctx)
+		return &models.UserOperationsResponse{Message: "operations successfully"}, nil
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		generated bool
+	}{
+		{name: "passed by the client", header: "req-0f3a"},
+		{name: "not passed", generated: true},
+		{name: "contains spaces", header: "req 0f3a", generated: true},
+		{name: "too long", header: strings.Repeat("a", transport.MaxRequestIDLength+1), generated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+
+			var headers map[string]string
+			if tt.header != "" {
+				headers = map[string]string{requestIDHeader: tt.header}
+			}
+
+			resp := ts.do(t, http.MethodGet, "/operations/3?limit=10", headers, "")
+			require.Equal(t, http.StatusOK, resp.status)
+
+			id := resp.header.Get(requestIDHeader)
+			assert.Equal(t, id, received, "the service must get the same ID in the context")
+
+			if tt.generated {
+				_, err := uuid.Parse(id)
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, tt.header, id)
+			}
+		})
+	}
+
+	t.Run("error response has the generated ID", func(t *testing.T) {
+		resp := ts.do(t, http.MethodGet, "/operations/3", nil, "")
+
+		assert.Equal(t, http.StatusBadRequest, resp.status)
+		assert.NotEmpty(t, resp.body["request_id"])
+		assert.Equal(t, resp.header.Get(requestIDHeader), resp.body["request_id"])
+	})
+}
+
+func TestBodyLimit(t *testing.T) {
+	conf := testConfig()
+	conf.MaxBodyBytes = 64
+	ts := newTestServerWithConfig(t, conf)
+
+	ts.wallet.DepositFunc = func(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error) {
+		return &models.DepositResponse{Message: "deposit successfully"}, nil
+	}
+	headers := map[string]string{"Idempotency-Key": idempotencyKeyTest}
+
+	resp := ts.do(t, http.MethodPost, "/deposit", headers, `{"id": 2, "amount": 205.44}`)
+	assert.Equal(t, http.StatusOK, resp.status)
+
+	body := `{"id": 2, "amount": 205.44, "padding": "` + strings.Repeat("a", 64) + `"}`
+	resp = ts.do(t, http.MethodPost, "/deposit", headers, body)
+	assertErrorEnvelope(t, resp, http.StatusRequestEntityTooLarge, transport.CodeBodyTooLarge)
+	assert.Equal(t, map[string]any{"limit": float64(64)}, resp.body["details"])
+}
+
+func TestHandlerTimeouts(t *testing.T) {
+	conf := testConfig()
+	conf.HandlerTimeouts = map[string]time.Duration{config.RouteDeposit: time.Second * 30}
+	ts := newTestServerWithConfig(t, conf)
+
+	var deadline time.Duration
+	ts.wallet.DepositFunc = func(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error) {
+		d, ok := ctx.Deadline()
+		require.True(t, ok)
+		deadline = time.Until(d)
+		return &models.DepositResponse{Message: "deposit successfully"}, nil
+	}
+	ts.wallet.UserOperationsFunc = func(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+		d, ok := ctx.Deadline()
+		require.True(t, ok)
+		deadline = time.Until(d)
+		return &models.UserOperationsResponse{Message: "operations successfully"}, nil
+	}
+
+	resp := ts.do(t, http.MethodPost, "/deposit", map[string]string{"Idempotency-Key": idempotencyKeyTest}, `{"id": 2, "amount": 10}`)
+	require.Equal(t, http.StatusOK, resp.status)
+	assert.Greater(t, deadline, conf.HandlerTimeout, "the route timeout must override the default one")
+
+	resp = ts.do(t, http.MethodGet, "/operations/3?limit=10", nil, "")
+	require.Equal(t, http.StatusOK, resp.status)
+	assert.LessOrEqual(t, deadline, conf.HandlerTimeout)
+}
+
+func TestMaintenance(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.wallet.UserOperationsFunc = func(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+		return &models.UserOperationsResponse{Message: "operations successfully"}, nil
+	}
+
+	ts.settings.Store(config.Runtime{Maintenance: true})
+
+	resp := ts.do(t, http.MethodGet, "/operations/3?limit=10", nil, "")
+	assertErrorEnvelope(t, resp, http.StatusServiceUnavailable, transport.CodeMaintenance)
+	assert.NotEmpty(t, resp.header.Get("Retry-After"))
+
+	resp = ts.do(t, http.MethodGet, "/healthz", nil, "")
+	assert.Equal(t, http.StatusOK, resp.status, "the health checks keep working")
+
+	ts.settings.Store(config.Runtime{})
+
+	resp = ts.do(t, http.MethodGet, "/operations/3?limit=10", nil, "")
+	assert.Equal(t, http.StatusOK, resp.status)
+}
+
+func TestRateLimit(t *testing.T) {
+	conf := testConfig()
+	conf.MaxBodyBytes = 64
+	conf.TrustedProxies = []string{"127.0.0.1"}
+	conf.RateLimit = config.RateLimit{
+		Routes:  map[string]string{config.RouteDeposit: "2/1m"},
+		KeyBy:   []string{config.RateLimitKeyAPIKey, config.RateLimitKeyUser, config.RateLimitKeyIP},
+		APIKeys: []string{"client-a"},
+	}
+	ts := newTestServerWithConfig(t, conf)
+
+	var deposited []uint
+	ts.wallet.DepositFunc = func(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error) {
+		deposited = append(deposited, req.UserID)
+		return &models.DepositResponse{Message: "deposit successfully"}, nil
+	}
+	ts.wallet.UserOperationsFunc = func(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+		return &models.UserOperationsResponse{Message: "operations successfully"}, nil
+	}
+
+	// fromIP returns the headers of a request that came through the trusted proxy from ip
+	fromIP := func(ip string) map[string]string {
+		return map[string]string{"Idempotency-Key": idempotencyKeyTest, "X-Forwarded-For": ip}
+	}
+
+	resp := ts.do(t, http.MethodPost, "/deposit", fromIP("10.0.0.1"), `{"id": 2, "amount": 10}`)
+	require.Equal(t, http.StatusOK, resp.status)
+	assert.Equal(t, "2", resp.header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", resp.header.Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", resp.header.Get("RateLimit-Policy"))
+
+	resp = ts.do(t, http.MethodPost, "/deposit", fromIP("10.0.0.1"), `{"id": 2, "amount": 10}`)
+	require.Equal(t, http.StatusOK, resp.status)
+	assert.Equal(t, "0", resp.header.Get("RateLimit-Remaining"))
+
+	resp = ts.do(t, http.MethodPost, "/deposit", fromIP("10.0.0.1"), `{"id": 2, "amount": 10}`)
+	assertErrorEnvelope(t, resp, http.StatusTooManyRequests, transport.CodeRateLimited)
+	assert.Equal(t, "30", resp.header.Get("Retry-After"))
+	assert.Equal(t, map[string]any{"retry_after": float64(30)}, resp.body["details"])
+	assert.Equal(t, []uint{2, 2}, deposited, "the limited request must not reach the wallet")
+
+	t.Run("other client has own bucket", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPost, "/deposit", fromIP("10.0.0.2"), `{"id": 3, "amount": 10}`)
+		assert.Equal(t, http.StatusOK, resp.status)
+	})
+
+	t.Run("user of the same IP is limited too", func(t *testing.T) {
+		resp := ts.do(t, http.MethodPost, "/deposit", fromIP("10.0.0.2"), `{"id": 4, "amount": 10}`)
+		require.Equal(t, http.StatusOK, resp.status)
+
+		resp = ts.do(t, http.MethodPost, "/deposit", fromIP("10.0.0.2"), `{"id": 5, "amount": 10}`)
+		assert.Equal(t, http.StatusTooManyRequests, resp.status, "a new user must not reset the quota of the IP")
+	})
+
+	t.Run("rotating an unknown API key does not reset the quota", func(t *testing.T) {
+		for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			headers := fromIP("10.0.0.3")
+			headers[apiKeyHeader] = "random-" + strconv.Itoa(i)
+
+			resp := ts.do(t, http.MethodPost, "/deposit", headers, `{"id": 6, "amount": 10}`)
+			assert.Equal(t, want, resp.status, "request %d", i)
+		}
+	})
+
+	t.Run("API key goes before the user and the IP", func(t *testing.T) {
+		headers := fromIP("10.0.0.1")
+		headers[apiKeyHeader] = "client-a"
+
+		for _, id := range []string{"7", "8"} {
+			resp := ts.do(t, http.MethodPost, "/deposit", headers, `{"id": `+id+`, "amount": 10}`)
+			require.Equal(t, http.StatusOK, resp.status, "the listed key has its own bucket")
+		}
+
+		resp := ts.do(t, http.MethodPost, "/deposit", headers, `{"id": 9, "amount": 10}`)
+		assert.Equal(t, http.StatusTooManyRequests, resp.status)
+	})
+
+	t.Run("body limit is kept", func(t *testing.T) {
+		body := `{"id": 10, "amount": 10, "padding": "` + strings.Repeat("a", 64) + `"}`
+		resp := ts.do(t, http.MethodPost, "/deposit", fromIP("10.0.0.4"), body)
+		assertErrorEnvelope(t, resp, http.StatusRequestEntityTooLarge, transport.CodeBodyTooLarge)
+	})
+
+	t.Run("route without quota", func(t *testing.T) {
+		resp := ts.do(t, http.MethodGet, "/operations/2?limit=10", nil, "")
+		assert.Equal(t, http.StatusOK, resp.status)
+		assert.Empty(t, resp.header.Get("RateLimit-Limit"))
+	})
+}
+
+// failingLimiter fails every call, the requests must go through
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, ratelimit.Quota) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("backend is down")
+}
+
+func TestRateLimit_LimiterFails(t *testing.T) {
+	router := gin.New()
+	router.GET("/", RateLimit(logs.NewDiscardLogger(), failingLimiter{}, config.RouteOperations,
+		ratelimit.Quota{Limit: 1, Period: time.Second}, &config.RateLimit{}, nil), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	for range 3 {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
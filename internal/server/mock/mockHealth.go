@@ -0,0 +1,16 @@
+package mock
+
+import "context"
+
+type MockHealth struct {
+	PingFunc          func(ctx context.Context) error
+	SchemaVersionFunc func(ctx context.Context) (uint, bool, error)
+}
+
+func (m *MockHealth) Ping(ctx context.Context) error {
+	return m.PingFunc(ctx)
+}
+
+func (m *MockHealth) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	return m.SchemaVersionFunc(ctx)
+}
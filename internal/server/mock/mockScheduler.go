@@ -0,0 +1,30 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+type MockScheduler struct {
+	ScheduleCreateFunc func(ctx context.Context, req *models.ScheduledTransferRequest) (*models.ScheduledTransferResponse, error)
+	ScheduleGetFunc    func(ctx context.Context, id uint) (*models.ScheduledTransferResponse, error)
+	ScheduleUpdateFunc func(ctx context.Context, req *models.ScheduledTransferUpdateRequest) (*models.ScheduledTransferResponse, error)
+	ScheduleDeleteFunc func(ctx context.Context, id uint) error
+}
+
+func (m *MockScheduler) ScheduleCreate(ctx context.Context, req *models.ScheduledTransferRequest) (*models.ScheduledTransferResponse, error) {
+	return m.ScheduleCreateFunc(ctx, req)
+}
+
+func (m *MockScheduler) ScheduleGet(ctx context.Context, id uint) (*models.ScheduledTransferResponse, error) {
+	return m.ScheduleGetFunc(ctx, id)
+}
+
+func (m *MockScheduler) ScheduleUpdate(ctx context.Context, req *models.ScheduledTransferUpdateRequest) (*models.ScheduledTransferResponse, error) {
+	return m.ScheduleUpdateFunc(ctx, req)
+}
+
+func (m *MockScheduler) ScheduleDelete(ctx context.Context, id uint) error {
+	return m.ScheduleDeleteFunc(ctx, id)
+}
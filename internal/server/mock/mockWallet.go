@@ -0,0 +1,30 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+type MockWallet struct {
+	DepositFunc        func(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error)
+	TransferFunc       func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error)
+	TransferBatchFunc  func(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error)
+	UserOperationsFunc func(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error)
+}
+
+func (m *MockWallet) Deposit(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error) {
+	return m.DepositFunc(ctx, req)
+}
+
+func (m *MockWallet) Transfer(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+	return m.TransferFunc(ctx, req)
+}
+
+func (m *MockWallet) TransferBatch(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error) {
+	return m.TransferBatchFunc(ctx, req)
+}
+
+func (m *MockWallet) UserOperations(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+	return m.UserOperationsFunc(ctx, req)
+}
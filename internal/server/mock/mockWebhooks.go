@@ -0,0 +1,30 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+type MockWebhooks struct {
+	WebhookCreateFunc     func(ctx context.Context, req *models.WebhookRequest) (*models.WebhookResponse, error)
+	WebhookGetFunc        func(ctx context.Context, id uint) (*models.WebhookResponse, error)
+	WebhookDeleteFunc     func(ctx context.Context, id uint) error
+	WebhookDeliveriesFunc func(ctx context.Context, id uint) (*models.WebhookDeliveriesResponse, error)
+}
+
+func (m *MockWebhooks) WebhookCreate(ctx context.Context, req *models.WebhookRequest) (*models.WebhookResponse, error) {
+	return m.WebhookCreateFunc(ctx, req)
+}
+
+func (m *MockWebhooks) WebhookGet(ctx context.Context, id uint) (*models.WebhookResponse, error) {
+	return m.WebhookGetFunc(ctx, id)
+}
+
+func (m *MockWebhooks) WebhookDelete(ctx context.Context, id uint) error {
+	return m.WebhookDeleteFunc(ctx, id)
+}
+
+func (m *MockWebhooks) WebhookDeliveries(ctx context.Context, id uint) (*models.WebhookDeliveriesResponse, error) {
+	return m.WebhookDeliveriesFunc(ctx, id)
+}
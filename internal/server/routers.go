@@ -1,10 +1,54 @@
 package server
 
-import services "github.com/EvansTrein/iqProgers/internal/service"
+import (
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
 
-func (s *HttpServer) InitRouters(wallet *services.Wallet) {
-	
-	s.router.POST("/deposit", Deposit(s.log, wallet))
-	s.router.POST("/transfer", Transfer(s.log, wallet))
-	s.router.GET("/operations/:id", Operations(s.log, wallet))
+// walletService is the part of the Wallet service used by the handlers
+type walletService interface {
+	walletDeposit
+	walletTransfer
+	walletTransferBatch
+	walletOperations
+}
+
+// InitRouters registers the API routes, they are turned off in the maintenance mode. The requests of every route
+// are limited by the limiter with the quota of the route from the config.
+func (s *HttpServer) InitRouters(wallet walletService, scheduler scheduleService, events eventsService, limiter ratelimit.Limiter) {
+	api := s.router.Group("/", Maintenance(s.settings))
+
+	limit := func(route string, user userFunc) gin.HandlerFunc {
+		return s.rateLimit(limiter, route, user)
+	}
+
+	api.POST("/deposit", limit(config.RouteDeposit, bodyUser("id")),
+		Deposit(s.log, wallet, s.conf.HandlerTimeoutFor(config.RouteDeposit)))
+	api.POST("/transfer", limit(config.RouteTransfer, bodyUser("sender_id")),
+		Transfer(s.log, wallet, s.conf.HandlerTimeoutFor(config.RouteTransfer)))
+	api.POST("/transfers/batch", limit(config.RouteTransferBatch, bodyUser("sender_id")),
+		TransferBatch(s.log, wallet, s.conf.HandlerTimeoutFor(config.RouteTransferBatch)))
+	api.GET("/operations/:id", limit(config.RouteOperations, paramUser("id")),
+		Operations(s.log, wallet, s.conf.HandlerTimeoutFor(config.RouteOperations)))
+	// the stream has no handler timeout, it lives until the client or the server closes it
+	api.GET("/users/:id/events", limit(config.RouteEvents, paramUser("id")), UserEvents(s.log, events, s.streams.Done()))
+
+	// the :id of a scheduled transfer is not a user, these routes are limited by the API key or the IP
+	scheduleTimeout := s.conf.HandlerTimeoutFor(config.RouteSchedules)
+	api.POST("/scheduled-transfers", limit(config.RouteSchedules, bodyUser("sender_id")), ScheduleCreate(s.log, scheduler, scheduleTimeout))
+	api.GET("/scheduled-transfers/:id", limit(config.RouteSchedules, nil), ScheduleGet(s.log, scheduler, scheduleTimeout))
+	api.PUT("/scheduled-transfers/:id", limit(config.RouteSchedules, nil), ScheduleUpdate(s.log, scheduler, scheduleTimeout))
+	api.DELETE("/scheduled-transfers/:id", limit(config.RouteSchedules, nil), ScheduleDelete(s.log, scheduler, scheduleTimeout))
+}
+
+// rateLimit returns the RateLimit middleware of the route, or a middleware that does nothing if the route has no quota
+func (s *HttpServer) rateLimit(limiter ratelimit.Limiter, route string, user userFunc) gin.HandlerFunc {
+	quota, err := ratelimit.ParseQuota(s.conf.RateLimit.QuotaFor(route))
+	if err != nil {
+		// the quotas are checked when the config is loaded, an empty quota is the only error left here
+		return func(ctx *gin.Context) { ctx.Next() }
+	}
+
+	return RateLimit(s.log, limiter, route, quota, &s.conf.RateLimit, user)
 }
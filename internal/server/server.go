@@ -2,67 +2,121 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
-	"time"
+	"sync/atomic"
 
 	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-const (
-	gracefulShutdownTimer  = time.Second * 10
-	timeoutHandlerResponce = time.Second * 5
-)
+// tracingServerName is the name of the HTTP server in the spans
+const tracingServerName = "wallet"
+
+// runtimeSettings gives the current runtime settings, they can change on a config reload. The read-only mode is
+// also switched by the admin API.
+type runtimeSettings interface {
+	Runtime() *config.Runtime
+	ReadOnly() bool
+	AdminReadOnly() bool
+	SetReadOnly(on bool)
+}
 
 type HttpServer struct {
-	router *gin.Engine
-	server *http.Server
-	log    *slog.Logger
-	conf   *config.HTTPServer
+	router       *gin.Engine
+	server       *http.Server
+	log          *slog.Logger
+	conf         *config.HTTPServer
+	settings     runtimeSettings
+	shuttingDown atomic.Bool
+	// listening is set once the server listens on its address, until then there are no requests to drain
+	listening atomic.Bool
+	// streams is canceled when the server shuts down, Shutdown does not wait for the endless SSE streams to end
+	streams context.Context
 }
 
-func New(log *slog.Logger, conf *config.HTTPServer) *HttpServer {
+func New(log *slog.Logger, conf *config.HTTPServer, settings runtimeSettings, metrics *metrics.Metrics) *HttpServer {
 	router := gin.Default()
+	// the handlers pass *gin.Context to log.*Context calls, with the fallback it gives the values of the request context
+	router.ContextWithFallback = true
+	// the addresses are checked when the config is loaded, without them X-Forwarded-For is not trusted at all
+	_ = router.SetTrustedProxies(conf.TrustedProxies)
+	router.Use(otelgin.Middleware(tracingServerName), RequestID(), Metrics(metrics), BodyLimit(conf.MaxBodyBytes))
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	useJSONNames()
+
+	// the http.Server is created here and not in Start, so Stop called before Start has something to shut down
+	server := &http.Server{
+		Addr:              conf.Address + ":" + conf.Port,
+		Handler:           router,
+		ReadTimeout:       conf.ReadTimeout,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
+	}
+
+	streams, cancelStreams := context.WithCancel(context.Background())
+	server.RegisterOnShutdown(cancelStreams)
 
 	return &HttpServer{
-		router: router,
-		conf:   conf,
-		log:    log,
+		router:   router,
+		server:   server,
+		conf:     conf,
+		settings: settings,
+		log:      log,
+		streams:  streams,
 	}
 }
 
+// Start serves the requests until Stop is called, an error is returned only if the server could not start or failed
 func (s *HttpServer) Start() error {
-	log := s.log.With(slog.String("Address", s.conf.Address+":"+s.conf.Port))
-
-	log.Debug("HTTP server: started creating")
+	log := s.log.With(slog.String("Address", s.server.Addr))
 
-	s.server = &http.Server{
-		Addr:    s.conf.Address + ":" + s.conf.Port,
-		Handler: s.router,
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("HTTP server: %w", err)
 	}
+	s.listening.Store(true)
 
 	log.Info("HTTP server: successfully started")
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		return err
+	if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("HTTP server: %w", err)
 	}
 
 	return nil
 }
 
-func (s *HttpServer) Stop() error {
-	s.log.Debug("HTTP server: stop started")
+// Listening reports whether the server has started listening on its address
+func (s *HttpServer) Listening() bool {
+	return s.listening.Load()
+}
+
+// SetShuttingDown makes /readyz return 503, it is called before Stop, while the server still accepts requests
+func (s *HttpServer) SetShuttingDown() {
+	s.log.Info("HTTP server: readiness is turned off")
+	s.shuttingDown.Store(true)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), gracefulShutdownTimer)
-	defer cancel()
+func (s *HttpServer) isShuttingDown() bool {
+	return s.shuttingDown.Load()
+}
+
+// Stop stops accepting the connections and waits for the requests in progress until ctx is done.
+// The SSE streams are closed at once, the clients reconnect to another instance with Last-Event-ID.
+func (s *HttpServer) Stop(ctx context.Context) error {
+	s.log.Debug("HTTP server: stop started")
 
 	if err := s.server.Shutdown(ctx); err != nil {
 		s.log.Error("Server shutdown failed", "error", err)
 		return err
 	}
 
-	s.server = nil
-
 	s.log.Info("HTTP server: stop successful")
 	return nil
 }
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/EvansTrein/iqProgers/internal/server/mock"
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/transport"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const idempotencyKeyTest = "42dd3893-9baf-43ac-8c2b-32231f486b87"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+
+	os.Exit(m.Run())
+}
+
+// testServer is the HttpServer with all routers, served by httptest around the mocks of the services
+type testServer struct {
+	url       string
+	server    *HttpServer
+	wallet    *mock.MockWallet
+	scheduler *mock.MockScheduler
+	health    *mock.MockHealth
+	broker    *services.Broker
+	settings  *config.Settings
+}
+
+// testConfig is the HTTP server config with the defaults of the env file
+func testConfig() *config.HTTPServer {
+	return &config.HTTPServer{
+		HandlerTimeout: time.Second * 5,
+		MaxBodyBytes:   1 << 20,
+	}
+}
+
+func newTestServer(t *testing.T) *testServer {
+	return newTestServerWithConfig(t, testConfig())
+}
+
+func newTestServerWithConfig(t *testing.T, conf *config.HTTPServer) *testServer {
+	t.Helper()
+
+	wallet := &mock.MockWallet{}
+	scheduler := &mock.MockScheduler{}
+	health := &mock.MockHealth{}
+	broker := services.NewBroker(logs.NewDiscardLogger())
+
+	settings := config.NewSettings(config.Runtime{})
+	s := New(logs.NewDiscardLogger(), conf, settings, metrics.New())
+	s.InitRouters(wallet, scheduler, broker, ratelimit.NewMemory())
+	s.InitHealthRouters(health)
+
+	ts := httptest.NewServer(s.router)
+	t.Cleanup(ts.Close)
+
+	return &testServer{url: ts.URL, server: s, wallet: wallet, scheduler: scheduler, health: health, broker: broker, settings: settings}
+}
+
+// testResponse is a response of the test server with the decoded JSON body
+type testResponse struct {
+	status int
+	header http.Header
+	body   map[string]any
+}
+
+// do sends a real HTTP request to the test server. An empty body is not sent.
+func (s *testServer) do(t *testing.T, method, path string, headers map[string]string, body string) *testResponse {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, s.url+path, reader)
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	result := testResponse{status: resp.StatusCode, header: resp.Header}
+	if len(data) > 0 {
+		require.NoError(t, json.Unmarshal(data, &result.body), string(data))
+	}
+
+	return &result
+}
+
+// withKey returns the headers with a valid Idempotency-Key
+func withKey() map[string]string {
+	return map[string]string{"Idempotency-Key": idempotencyKeyTest}
+}
+
+// assertErrorEnvelope checks that the response is the error envelope with the expected code,
+// and that an internal error is not sent to the client
+func assertErrorEnvelope(t *testing.T, resp *testResponse, status int, code string) {
+	t.Helper()
+
+	assert.Equal(t, float64(status), resp.body["status"])
+	assert.Equal(t, code, resp.body["code"])
+	assert.NotEmpty(t, resp.body["message"])
+	assert.NotContains(t, resp.body, "error")
+
+	if code == transport.CodeInternal {
+		assert.Equal(t, "internal server error", resp.body["message"])
+		assert.NotContains(t, resp.body, "details")
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/ratelimit"
+	"github.com/EvansTrein/iqProgers/internal/server/mock"
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages/memory"
+	"github.com/EvansTrein/iqProgers/internal/tracing"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// keepSpans does not clear the recorded spans on shutdown, the shutdown is the way to flush the batcher
+type keepSpans struct {
+	*tracetest.InMemoryExporter
+}
+
+func (keepSpans) Shutdown(context.Context) error { return nil }
+
+// TestTracing checks that the trace of the client is continued by the HTTP span and the span of the Wallet
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := tracing.Setup("wallet-test", keepSpans{exporter})
+
+	log := logs.NewDiscardLogger()
+	m := metrics.New()
+
+	s := New(log, testConfig(), config.NewSettings(config.Runtime{}), m)
+	s.InitRouters(services.New(log, memory.New(log), m, config.NewSettings(config.Runtime{}), nil), &mock.MockScheduler{}, services.NewBroker(log), ratelimit.NewMemory())
+
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+	ts := &testServer{url: srv.URL}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	headers := withKey()
+	headers["traceparent"] = "00-" + traceID + "-00f067aa0ba902b7-01"
+	headers[requestIDHeader] = "req-trace"
+
+	resp := ts.do(t, http.MethodPost, "/deposit", headers, `{"id": 2, "amount": 10}`)
+	require.Equal(t, http.StatusOK, resp.status)
+
+	require.NoError(t, shutdown(context.Background()))
+
+	spans := exporter.GetSpans().Snapshots()
+	byName := make(map[string]int)
+	for i, span := range spans {
+		byName[span.Name()] = i
+	}
+
+	require.Contains(t, byName, "/deposit")
+	require.Contains(t, byName, "Wallet.Deposit")
+
+	httpSpan := spans[byName["/deposit"]]
+	walletSpan := spans[byName["Wallet.Deposit"]]
+
+	assert.Equal(t, traceID, httpSpan.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", httpSpan.Parent().SpanID().String())
+	assert.Equal(t, httpSpan.SpanContext().SpanID(), walletSpan.Parent().SpanID())
+	assert.Contains(t, httpSpan.Attributes(), attribute.String("request_id", "req-trace"))
+}
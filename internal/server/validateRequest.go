@@ -2,22 +2,11 @@ package server
 
 import (
 	"errors"
-	"regexp"
 	"strconv"
 
 	"github.com/EvansTrein/iqProgers/models"
 )
 
-func isGUID(s string) (bool, error) {
-	guidRegex := `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
-	ok, err := regexp.MatchString(guidRegex, s)
-	if err != nil {
-		return false, err
-	}
-
-	return ok, nil
-}
-
 func validateRequestParams(params map[string]string, reqStruct interface{}) error {
 	switch req := reqStruct.(type) {
 	case *models.UserOperationsRequest:
@@ -45,17 +34,17 @@ func validateUserOperationsRequest(params map[string]string, req *models.UserOpe
 
 	userIdInt, err := strconv.Atoi(userId)
 	if err != nil {
-		return err
+		return errors.New("user id must be a number")
 	}
 
 	offsetInt, err := strconv.Atoi(offset)
 	if err != nil {
-		return err
+		return errors.New("offset must be a number")
 	}
 
 	limitInt, err := strconv.Atoi(limit)
 	if err != nil {
-		return err
+		return errors.New("limit must be a number")
 	}
 
 	req.UserID = uint(userIdInt)
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRequestParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      map[string]string
+		req         any
+		expected    *models.UserOperationsRequest
+		expectedErr string
+	}{
+		{
+			name:     "valid params",
+			params:   map[string]string{"userID": "5", "offset": "10", "limit": "20"},
+			req:      &models.UserOperationsRequest{},
+			expected: &models.UserOperationsRequest{UserID: 5, Offset: 10, Limit: 20},
+		},
+		{
+			name:        "unsupported request type",
+			params:      map[string]string{},
+			req:         &models.DepositRequest{},
+			expectedErr: "unsupported request type",
+		},
+		{
+			name:        "no user id",
+			params:      map[string]string{"offset": "10", "limit": "20"},
+			req:         &models.UserOperationsRequest{},
+			expectedErr: "no user id in params",
+		},
+		{
+			name:        "no offset",
+			params:      map[string]string{"userID": "5", "limit": "20"},
+			req:         &models.UserOperationsRequest{},
+			expectedErr: "no offset in params",
+		},
+		{
+			name:        "no limit",
+			params:      map[string]string{"userID": "5", "offset": "10"},
+			req:         &models.UserOperationsRequest{},
+			expectedErr: "no limit in params",
+		},
+		{
+			name:        "user id is not a number",
+			params:      map[string]string{"userID": "five", "offset": "10", "limit": "20"},
+			req:         &models.UserOperationsRequest{},
+			expectedErr: "user id must be a number",
+		},
+		{
+			name:        "offset is not a number",
+			params:      map[string]string{"userID": "5", "offset": "ten", "limit": "20"},
+			req:         &models.UserOperationsRequest{},
+			expectedErr: "offset must be a number",
+		},
+		{
+			name:        "limit is not a number",
+			params:      map[string]string{"userID": "5", "offset": "10", "limit": "twenty"},
+			req:         &models.UserOperationsRequest{},
+			expectedErr: "limit must be a number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRequestParams(tt.params, tt.req)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, tt.req)
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// Accounts reads the users and their balances. It moves no money, so it is not stopped by the read-only mode
+// and does not wait in Wallet.Stop.
+type Accounts struct {
+	log *slog.Logger
+	db  storages.StoreAccount
+}
+
+func NewAccounts(log *slog.Logger, db storages.StoreAccount) *Accounts {
+	log.Debug("service Accounts: started creating")
+
+	log.Info("service Accounts: successfully created")
+	return &Accounts{
+		log: log,
+		db:  db,
+	}
+}
+
+// Balance returns the user with the current balance, or storages.ErrUserNotFound
+func (a *Accounts) Balance(ctx context.Context, userID uint) (*models.User, error) {
+	ctx, span := tracer().Start(ctx, "Accounts.Balance")
+	defer span.End()
+
+	op := "service Accounts: balance request received"
+	log := a.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "Balance func call", "user id", userID)
+
+	user, err := a.db.UserGet(ctx, userID)
+	if errors.Is(err, storages.ErrUserNotFound) {
+		log.WarnContext(ctx, "user not found", "id", userID)
+		return nil, err
+	}
+	if err != nil {
+		log.ErrorContext(ctx, "failed to get the user from the database", "error", err)
+		return nil, err
+	}
+
+	log.InfoContext(ctx, "balance successfully received")
+	return user, nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+const (
+	// brokerHistorySize is the number of the last operations kept for the clients that reconnect with Last-Event-ID
+	brokerHistorySize = 1000
+	// brokerBufferSize is the number of operations a subscriber may fall behind, a slower one is disconnected
+	brokerBufferSize = 64
+)
+
+// OperationEvent is a committed operation of a user sent to the subscribers. The ID grows with every event,
+// it starts with the time the broker was created, so an ID given by the previous run is never taken for one of this run.
+type OperationEvent struct {
+	ID        string
+	UserID    uint
+	Operation *models.Transaction
+	seq       uint64
+}
+
+// Broker passes the committed operations from the Wallet to the subscribers of the users, e.g. the SSE streams.
+// It lives in the process, so a subscriber gets only the operations made by the same instance of the service.
+// The last brokerHistorySize events are kept, so a client that reconnects gets the events it missed.
+type Broker struct {
+	log   *slog.Logger
+	epoch string
+
+	mu      sync.Mutex
+	seq     uint64
+	history []*OperationEvent
+	subs    map[uint]map[*Subscription]struct{}
+}
+
+func NewBroker(log *slog.Logger) *Broker {
+	return &Broker{
+		log:   log,
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs:  make(map[uint]map[*Subscription]struct{}),
+	}
+}
+
+// Subscription gets the operations of one user until it is closed
+type Subscription struct {
+	broker *Broker
+	userID uint
+	events chan *OperationEvent
+}
+
+// Events returns the channel of the new operations. It is closed if the subscriber falls behind by more than
+// brokerBufferSize operations, then the client reconnects with Last-Event-ID and gets the rest from the history.
+func (s *Subscription) Events() <-chan *OperationEvent {
+	return s.events
+}
+
+// Close removes the subscription, it may be called more than once
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s)
+}
+
+// Watched reports whether any of the users has a subscriber, so the Wallet does not prepare operations nobody waits for
+func (b *Broker) Watched(userIDs ...uint) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, id := range userIDs {
+		if len(b.subs[id]) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Publish sends the operation to the subscribers of its users: the user of a deposit, the sender and the receiver
+// of a transfer. A subscriber whose buffer is full is disconnected instead of slowing down the Wallet.
+func (b *Broker) Publish(operation *models.Transaction) {
+	users := []uint{operation.SenderID}
+	if operation.ReceiverID != 0 && operation.ReceiverID != operation.SenderID {
+		users = append(users, operation.ReceiverID)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, userID := range users {
+		b.seq++
+		event := &OperationEvent{
+			ID:        b.epoch + "-" + strconv.FormatUint(b.seq, 10),
+			UserID:    userID,
+			Operation: operation,
+			seq:       b.seq,
+		}
+
+		b.history = append(b.history, event)
+		if len(b.history) > brokerHistorySize {
+			b.history = b.history[1:]
+		}
+
+		for sub := range b.subs[userID] {
+			select {
+			case sub.events <- event:
+			default:
+				b.log.Warn("broker: subscriber is too slow, it is disconnected", "user id", userID)
+				b.remove(sub)
+			}
+		}
+	}
+}
+
+// Subscribe subscribes to the operations of the user. If lastEventID is set, the operations of the user after it
+// are returned from the history. complete is false if the history does not reach lastEventID (it is too old or
+// given by the previous run), then the client has to reload the operations by GET /operations/:id.
+func (b *Broker) Subscribe(userID uint, lastEventID string) (sub *Subscription, missed []*OperationEvent, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastEventID != "" {
+		seq, ok := b.parseID(lastEventID)
+
+		first := b.seq + 1
+		if len(b.history) > 0 {
+			first = b.history[0].seq
+		}
+
+		complete = ok && seq <= b.seq && seq+1 >= first
+		if complete {
+			for _, event := range b.history {
+				if event.seq > seq && event.UserID == userID {
+					missed = append(missed, event)
+				}
+			}
+		}
+	}
+
+	sub = &Subscription{broker: b, userID: userID, events: make(chan *OperationEvent, brokerBufferSize)}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+
+	return sub, missed, complete
+}
+
+// parseID returns the number of the event ID given by this broker
+func (b *Broker) parseID(id string) (uint64, bool) {
+	epoch, num, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return seq, true
+}
+
+// remove deletes the subscription and closes its channel, the broker must already be locked
+func (b *Broker) remove(sub *Subscription) {
+	subs := b.subs[sub.userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subs, sub.userID)
+	}
+	close(sub.events)
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transferTest(id, sender, receiver uint) *models.Transaction {
+	return &models.Transaction{ID: id, SenderID: sender, ReceiverID: receiver, Success: true, TypeOperation: "transfer", Amount: 10}
+}
+
+// receive returns the events that are already in the channel of the subscription
+func receive(sub *Subscription) []*OperationEvent {
+	var events []*OperationEvent
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestBroker_Publish(t *testing.T) {
+	broker := NewBroker(logs.NewDiscardLogger())
+
+	sender, _, complete := broker.Subscribe(1, "")
+	require.True(t, complete)
+	defer sender.Close()
+	receiver, _, _ := broker.Subscribe(2, "")
+	defer receiver.Close()
+	other, _, _ := broker.Subscribe(3, "")
+	defer other.Close()
+
+	assert.True(t, broker.Watched(5, 2))
+	assert.False(t, broker.Watched(4, 5))
+
+	broker.Publish(transferTest(1, 1, 2))
+	broker.Publish(&models.Transaction{ID: 2, SenderID: 1, Success: true, TypeOperation: "deposit", Amount: 5})
+
+	senderEvents := receive(sender)
+	require.Len(t, senderEvents, 2)
+	assert.Equal(t, uint(1), senderEvents[0].Operation.ID)
+	assert.Equal(t, uint(2), senderEvents[1].Operation.ID)
+	assert.NotEqual(t, senderEvents[0].ID, senderEvents[1].ID)
+
+	receiverEvents := receive(receiver)
+	require.Len(t, receiverEvents, 1)
+	assert.Equal(t, uint(1), receiverEvents[0].Operation.ID)
+	assert.Equal(t, uint(2), receiverEvents[0].UserID)
+
+	assert.Empty(t, receive(other))
+
+	other.Close()
+	other.Close()
+	assert.False(t, broker.Watched(3))
+}
+
+func TestBroker_Resume(t *testing.T) {
+	broker := NewBroker(logs.NewDiscardLogger())
+
+	sub, _, _ := broker.Subscribe(1, "")
+	broker.Publish(transferTest(1, 1, 2))
+	first := receive(sub)
+	require.Len(t, first, 1)
+	sub.Close()
+
+	broker.Publish(transferTest(2, 2, 1))
+	broker.Publish(transferTest(3, 2, 3))
+	broker.Publish(transferTest(4, 1, 3))
+
+	t.Run("missed events", func(t *testing.T) {
+		sub, missed, complete := broker.Subscribe(1, first[0].ID)
+		defer sub.Close()
+
+		require.True(t, complete)
+		require.Len(t, missed, 2)
+		assert.Equal(t, uint(2), missed[0].Operation.ID)
+		assert.Equal(t, uint(4), missed[1].Operation.ID)
+	})
+
+	t.Run("nothing missed", func(t *testing.T) {
+		sub, _, _ := broker.Subscribe(1, "")
+		defer sub.Close()
+		broker.Publish(transferTest(5, 1, 3))
+		last := receive(sub)
+		require.Len(t, last, 1)
+
+		again, missed, complete := broker.Subscribe(1, last[0].ID)
+		defer again.Close()
+		assert.True(t, complete)
+		assert.Empty(t, missed)
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		for _, id := range []string{"abc", "0-1", first[0].ID + "999", "-"} {
+			sub, missed, complete := broker.Subscribe(1, id)
+			sub.Close()
+
+			assert.False(t, complete, id)
+			assert.Empty(t, missed, id)
+		}
+	})
+
+	t.Run("id of another run", func(t *testing.T) {
+		sub, _, complete := NewBroker(logs.NewDiscardLogger()).Subscribe(1, first[0].ID)
+		sub.Close()
+		assert.False(t, complete)
+	})
+}
+
+func TestBroker_HistoryLimit(t *testing.T) {
+	broker := NewBroker(logs.NewDiscardLogger())
+
+	sub, _, _ := broker.Subscribe(1, "")
+	broker.Publish(&models.Transaction{ID: 1, SenderID: 1, TypeOperation: "deposit"})
+	first := receive(sub)
+	require.Len(t, first, 1)
+	sub.Close()
+
+	// the history keeps the events after the first one, one more pushes out the first of them
+	for i := range brokerHistorySize + 1 {
+		broker.Publish(&models.Transaction{ID: uint(i + 2), SenderID: 2, TypeOperation: "deposit"})
+	}
+
+	sub, missed, complete := broker.Subscribe(1, first[0].ID)
+	defer sub.Close()
+	assert.False(t, complete, "the history does not reach the event")
+	assert.Empty(t, missed)
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	broker := NewBroker(logs.NewDiscardLogger())
+
+	slow, _, _ := broker.Subscribe(1, "")
+	fast, _, _ := broker.Subscribe(1, "")
+	defer fast.Close()
+
+	for i := range brokerBufferSize + 1 {
+		broker.Publish(&models.Transaction{ID: uint(i + 1), SenderID: 1, TypeOperation: "deposit"})
+		receive(fast)
+	}
+
+	events := receive(slow)
+	assert.Len(t, events, brokerBufferSize)
+	_, ok := <-slow.Events()
+	assert.False(t, ok, "the channel of the slow subscriber is closed")
+
+	assert.True(t, broker.Watched(1), "the fast subscriber stays")
+	slow.Close()
+}
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 
 	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
 	"github.com/EvansTrein/iqProgers/internal/storages"
 )
 
@@ -13,22 +14,32 @@ import (
 // If the transaction does not exist, it verifies the user's existence, creates a new transaction, updates the user's balance,
 // and marks the transaction as successful. The function returns a response indicating the success of the deposit operation.
 func (w *Wallet) Deposit(ctx context.Context, req *models.DepositRequest) (*models.DepositResponse, error) {
+	done, err := w.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	ctx, span := tracer().Start(ctx, "Wallet.Deposit")
+	defer span.End()
+
 	op := "service Wallet: deposit request received"
 	log := w.log.With(slog.String("operation", op))
-	log.Debug("Deposit func call", "requets data", req)
+	log.DebugContext(ctx, "Deposit func call", "requets data", req)
 
 	exsistTransaction, err := w.db.ExsistIdempotencyKey(ctx, req.IdempotencyKey)
 	if err != nil {
-		log.Error("failed to check if the transaction exists in the database", "error", err)
+		log.ErrorContext(ctx, "failed to check if the transaction exists in the database", "error", err)
 		return nil, err
 	}
 
 	if exsistTransaction {
-		log.Warn("transaction already exists")
+		log.WarnContext(ctx, "transaction already exists")
+		w.metrics.DomainError(metrics.ErrorIdempotentReplay)
 		
 		dataTran, err := w.db.TransactionGet(ctx, req.IdempotencyKey)
 		if err != nil {
-			log.Error("failed to retrieve existing transaction", "error", err)
+			log.ErrorContext(ctx, "failed to retrieve existing transaction", "error", err)
 			return nil, err
 		}
 
@@ -37,22 +48,33 @@ func (w *Wallet) Deposit(ctx context.Context, req *models.DepositRequest) (*mode
 			Operation: dataTran,
 		}
 
-		log.Warn("existing transaction successfully sent")
+		log.WarnContext(ctx, "existing transaction successfully sent")
 		return &resp, nil
 	}
 
+	if err := w.checkWritable(); err != nil {
+		log.WarnContext(ctx, "deposit rejected", "error", err)
+		return nil, err
+	}
+
+	if err := validateAmount(req.Amount, w.settings.Runtime().DepositLimit); err != nil {
+		log.WarnContext(ctx, "deposit amount exceeds the limit", "amount", req.Amount, "error", err)
+		return nil, err
+	}
+
 	exsistUser, err := w.db.ExsistUser(ctx, req.UserID)
 	if err != nil {
-		log.Error("failed to check if the user exists in the database", "error", err)
+		log.ErrorContext(ctx, "failed to check if the user exists in the database", "error", err)
 		return nil, err
 	}
 
 	if !exsistUser {
-		log.Warn("user not found", "id", req.UserID)
+		log.WarnContext(ctx, "user not found", "id", req.UserID)
+		w.countError(storages.ErrUserNotFound)
 		return nil, storages.ErrUserNotFound
 	}
 
-	log.Debug("request data successfully verified")
+	log.DebugContext(ctx, "request data successfully verified")
 
 	// data for transaction creation
 	dataTran := models.Transaction{
@@ -63,24 +85,29 @@ func (w *Wallet) Deposit(ctx context.Context, req *models.DepositRequest) (*mode
 	}
 
 	if err := w.db.TransactionCreate(ctx, &dataTran); err != nil {
-		log.Error("failed to create a transaction for user operation", "error", err)
+		log.ErrorContext(ctx, "failed to create a transaction for user operation", "error", err)
 		return nil, err
 	}
 
-	log.Info("transaction for the user operation was successfully created", "transaction ID", dataTran.ID)
+	log.InfoContext(ctx, "transaction for the user operation was successfully created", "transaction ID", dataTran.ID)
 
 	if err := w.db.Deposit(ctx, req); err != nil {
-		log.Error("failed to update the balance value in the database", "error", err)
+		log.ErrorContext(ctx, "failed to update the balance value in the database", "error", err)
+		w.countError(err)
 		return nil, err
 	}
 
 	dataTran.Success = true
+	// the amount is already stored, so it is in range
+	cents, _ := storages.ToCents(dataTran.Amount)
+	w.metrics.DepositAmount(cents)
+	w.notify(ctx, &dataTran)
 
 	resp := models.DepositResponse{
 		Message:   "deposit successfully",
 		Operation: &dataTran,
 	}
 
-	log.Info("deposit successfully")
+	log.InfoContext(ctx, "deposit successfully")
 	return &resp, nil
 }
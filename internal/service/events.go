@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/google/uuid"
+)
+
+// Types of the events of the operations
+const (
+	EventDepositCompleted  = "deposit.completed"
+	EventTransferCompleted = "transfer.completed"
+	EventTransferFailed    = "transfer.failed"
+)
+
+// Reasons of the transfer.failed events
+const (
+	ReasonInsufficientFunds = "insufficient_funds"
+	ReasonNegativeBalance   = "negative_balance"
+	ReasonSelfTransfer      = "self_transfer"
+	ReasonReceiverNotFound  = "receiver_not_found"
+	ReasonLimitExceeded     = "limit_exceeded"
+	ReasonError             = "error"
+)
+
+// eventNamespace is the namespace for the event IDs, it must never change, otherwise the receivers would get
+// the events published before the change again under new IDs
+var eventNamespace = uuid.MustParse("0b8e4a4e-2f5c-4b8a-9a57-3d6f1e2c7a90")
+
+// NewEvent creates an event of the operation with the Idempotency-Key. The ID is derived from the key and the type,
+// so the same operation always gives the same event and a receiver can drop the duplicates by the ID.
+func NewEvent(eventType string, data *models.EventData) *models.Event {
+	return &models.Event{
+		ID:        uuid.NewSHA1(eventNamespace, []byte(eventType+":"+data.IdempotencyKey)).String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+}
+
+// DepositEvent returns the deposit.completed event, the storages write it together with the balance change
+func DepositEvent(req *models.DepositRequest, transactionID uint) *models.Event {
+	return NewEvent(EventDepositCompleted, &models.EventData{
+		IdempotencyKey: req.IdempotencyKey,
+		TransactionID:  transactionID,
+		UserID:         req.UserID,
+		Amount:         req.Amount,
+	})
+}
+
+// TransferEvent returns the transfer.completed event if err is nil, otherwise the transfer.failed event with the reason of err
+func TransferEvent(data *models.Transaction, err error) *models.Event {
+	eventData := models.EventData{
+		IdempotencyKey: data.IdempotencyKey,
+		TransactionID:  data.ID,
+		SenderID:       data.SenderID,
+		ReceiverID:     data.ReceiverID,
+		Amount:         data.Amount,
+	}
+
+	if err == nil {
+		return NewEvent(EventTransferCompleted, &eventData)
+	}
+
+	eventData.Reason = failReason(err)
+	return NewEvent(EventTransferFailed, &eventData)
+}
+
+// BatchItemEvent returns the event of one item of a batch, the same as of a single transfer with the key of the item
+func BatchItemEvent(req *models.TransferBatchRequest, result *models.TransferBatchResult) *models.Event {
+	eventData := models.EventData{
+		IdempotencyKey: req.Items[result.Position].IdempotencyKey,
+		SenderID:       req.SenderID,
+		ReceiverID:     result.ReceiverID,
+		Amount:         result.Amount,
+	}
+	if result.Transaction != nil {
+		eventData.TransactionID = *result.Transaction
+	}
+
+	if result.Success {
+		return NewEvent(EventTransferCompleted, &eventData)
+	}
+
+	eventData.Reason = failReason(result.Err)
+	return NewEvent(EventTransferFailed, &eventData)
+}
+
+// rejectsTransfer reports whether err rejects the transfer itself before it is executed. A single transfer and
+// an item of a batch rejected with such an error get the transfer.failed event, a missing sender or a failed check
+// rejects the whole request and gives no event.
+func rejectsTransfer(err error) bool {
+	return errors.Is(err, ErrSelfTransfer) || errors.Is(err, ErrReceiverNotFound) || errors.Is(err, ErrLimitExceeded)
+}
+
+// failReason returns the reason of a failed transfer by the typed error, any other error gives ReasonError
+func failReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		return ReasonInsufficientFunds
+	case errors.Is(err, ErrNegaticeBalance):
+		return ReasonNegativeBalance
+	case errors.Is(err, ErrSelfTransfer):
+		return ReasonSelfTransfer
+	case errors.Is(err, ErrReceiverNotFound):
+		return ReasonReceiverNotFound
+	case errors.Is(err, ErrLimitExceeded):
+		return ReasonLimitExceeded
+	default:
+		return ReasonError
+	}
+}
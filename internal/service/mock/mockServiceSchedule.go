@@ -0,0 +1,46 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+type MockStoreSchedule struct {
+	ExsistUserFunc      func(ctx context.Context, id uint) (bool, error)
+	ScheduleCreateFunc  func(ctx context.Context, data *models.ScheduledTransfer) error
+	ScheduleGetFunc     func(ctx context.Context, id uint) (*models.ScheduledTransfer, error)
+	ScheduleUpdateFunc  func(ctx context.Context, data *models.ScheduledTransfer) error
+	ScheduleDeleteFunc  func(ctx context.Context, id uint) error
+	SchedulesDueFunc    func(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error)
+	ScheduleRunSaveFunc func(ctx context.Context, run *models.ScheduledTransferRun, data *models.ScheduledTransfer) error
+}
+
+func (m *MockStoreSchedule) ExsistUser(ctx context.Context, id uint) (bool, error) {
+	return m.ExsistUserFunc(ctx, id)
+}
+
+func (m *MockStoreSchedule) ScheduleCreate(ctx context.Context, data *models.ScheduledTransfer) error {
+	return m.ScheduleCreateFunc(ctx, data)
+}
+
+func (m *MockStoreSchedule) ScheduleGet(ctx context.Context, id uint) (*models.ScheduledTransfer, error) {
+	return m.ScheduleGetFunc(ctx, id)
+}
+
+func (m *MockStoreSchedule) ScheduleUpdate(ctx context.Context, data *models.ScheduledTransfer) error {
+	return m.ScheduleUpdateFunc(ctx, data)
+}
+
+func (m *MockStoreSchedule) ScheduleDelete(ctx context.Context, id uint) error {
+	return m.ScheduleDeleteFunc(ctx, id)
+}
+
+func (m *MockStoreSchedule) SchedulesDue(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error) {
+	return m.SchedulesDueFunc(ctx, now, claimUntil, limit)
+}
+
+func (m *MockStoreSchedule) ScheduleRunSave(ctx context.Context, run *models.ScheduledTransferRun, data *models.ScheduledTransfer) error {
+	return m.ScheduleRunSaveFunc(ctx, run, data)
+}
@@ -0,0 +1,56 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+type MockStoreWebhook struct {
+	ExsistUserFunc       func(ctx context.Context, id uint) (bool, error)
+	WebhookCreateFunc    func(ctx context.Context, data *models.Webhook) error
+	WebhookGetFunc       func(ctx context.Context, id uint) (*models.Webhook, error)
+	WebhookDeleteFunc    func(ctx context.Context, id uint) error
+	WebhooksForFunc      func(ctx context.Context, userIDs []uint) ([]*models.Webhook, error)
+	DeliveriesCreateFunc func(ctx context.Context, deliveries []*models.WebhookDelivery) error
+	DeliveriesDueFunc    func(ctx context.Context, now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	DeliverySaveFunc     func(ctx context.Context, data *models.WebhookDelivery) error
+	DeliveriesGetFunc    func(ctx context.Context, webhookID uint, limit int) ([]*models.WebhookDelivery, error)
+}
+
+func (m *MockStoreWebhook) ExsistUser(ctx context.Context, id uint) (bool, error) {
+	return m.ExsistUserFunc(ctx, id)
+}
+
+func (m *MockStoreWebhook) WebhookCreate(ctx context.Context, data *models.Webhook) error {
+	return m.WebhookCreateFunc(ctx, data)
+}
+
+func (m *MockStoreWebhook) WebhookGet(ctx context.Context, id uint) (*models.Webhook, error) {
+	return m.WebhookGetFunc(ctx, id)
+}
+
+func (m *MockStoreWebhook) WebhookDelete(ctx context.Context, id uint) error {
+	return m.WebhookDeleteFunc(ctx, id)
+}
+
+func (m *MockStoreWebhook) WebhooksFor(ctx context.Context, userIDs []uint) ([]*models.Webhook, error) {
+	return m.WebhooksForFunc(ctx, userIDs)
+}
+
+func (m *MockStoreWebhook) DeliveriesCreate(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	return m.DeliveriesCreateFunc(ctx, deliveries)
+}
+
+func (m *MockStoreWebhook) DeliveriesDue(ctx context.Context, now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	return m.DeliveriesDueFunc(ctx, now, limit)
+}
+
+func (m *MockStoreWebhook) DeliverySave(ctx context.Context, data *models.WebhookDelivery) error {
+	return m.DeliverySaveFunc(ctx, data)
+}
+
+func (m *MockStoreWebhook) DeliveriesGet(ctx context.Context, webhookID uint, limit int) ([]*models.WebhookDelivery, error) {
+	return m.DeliveriesGetFunc(ctx, webhookID, limit)
+}
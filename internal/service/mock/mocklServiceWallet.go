@@ -15,7 +15,10 @@ type MockStoreWallet struct {
 	TransactionGetFunc       func(ctx context.Context, idempotencyKey string) (*models.Transaction, error)
 	DepositFunc              func(ctx context.Context, req *models.DepositRequest) error
 	TransferFunc             func(ctx context.Context, req *models.Transaction) error
+	TransferBatchFunc        func(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error)
+	TransferBatchGetFunc     func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error)
 	OperationsGetFunc        func(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error)
+	OutboxAddFunc            func(ctx context.Context, event *models.Event) error
 }
 
 func (m *MockStoreWallet) ExsistUser(ctx context.Context, id uint) (bool, error) {
@@ -42,6 +45,18 @@ func (m *MockStoreWallet) Transfer(ctx context.Context, req *models.Transaction)
 	return m.TransferFunc(ctx, req)
 }
 
+func (m *MockStoreWallet) TransferBatch(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error) {
+	return m.TransferBatchFunc(ctx, req)
+}
+
+func (m *MockStoreWallet) TransferBatchGet(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+	return m.TransferBatchGetFunc(ctx, idempotencyKey)
+}
+
 func (m *MockStoreWallet) OperationsGet(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
 	return m.OperationsGetFunc(ctx, req)
 }
+
+func (m *MockStoreWallet) OutboxAdd(ctx context.Context, event *models.Event) error {
+	return m.OutboxAddFunc(ctx, event)
+}
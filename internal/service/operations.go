@@ -15,31 +15,41 @@ import (
 // from the database and returns them in a response. Errors during database access or user verification are logged and returned.
 // The response includes a success message and the list of transactions associated with the user.
 func (w *Wallet) UserOperations(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+	done, err := w.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	ctx, span := tracer().Start(ctx, "Wallet.UserOperations")
+	defer span.End()
+
 	op := "service Wallet: user operations request received"
 	log := w.log.With(slog.String("operation", op))
-	log.Debug("UserOperations func call", "requets data", req)
+	log.DebugContext(ctx, "UserOperations func call", "requets data", req)
 
 	exsistUser, err := w.db.ExsistUser(ctx, req.UserID)
 	if err != nil {
-		log.Error("failed to check if the user exists in the database", "error", err)
+		log.ErrorContext(ctx, "failed to check if the user exists in the database", "error", err)
 		return nil, err
 	}
 
 	if !exsistUser {
-		log.Warn("user not found", "id", req.UserID)
+		log.WarnContext(ctx, "user not found", "id", req.UserID)
+		w.countError(storages.ErrUserNotFound)
 		return nil, storages.ErrUserNotFound
 	}
 
-	log.Debug("request data successfully verified")
+	log.DebugContext(ctx, "request data successfully verified")
 
 	resp, err := w.db.OperationsGet(ctx, req)
 	if err != nil {
-		log.Error("failed to retrieve operations from the database", "error", err)
+		log.ErrorContext(ctx, "failed to retrieve operations from the database", "error", err)
 		return nil, err
 	}
 
 	resp.Message = "transactions have been successfully received"
 
-	log.Info("user operations successfully")
+	log.InfoContext(ctx, "user operations successfully")
 	return resp, nil
 }
@@ -7,6 +7,8 @@ import (
 
 	"github.com/EvansTrein/iqProgers/models"
 	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
 	"github.com/EvansTrein/iqProgers/internal/service/mock"
 	"github.com/EvansTrein/iqProgers/internal/storages"
 	"github.com/golang/mock/gomock"
@@ -20,7 +22,7 @@ func TestWallet_UserOperations(t *testing.T) {
 	log := logs.NewDiscardLogger()
 	mockStore := &mock.MockStoreWallet{}
 
-	wallet := New(log, mockStore)
+	wallet := New(log, mockStore, metrics.New(), config.NewSettings(config.Runtime{}), nil)
 
 	tests := []struct {
 		name         string
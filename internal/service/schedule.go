@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// ScheduleCreate creates a scheduled transfer. It validates the sender and the receiver the same way as Transfer, then saves
+// the schedule with the first run at the requested start date. The scheduler picks it up once that date has come.
+func (s *Scheduler) ScheduleCreate(ctx context.Context, req *models.ScheduledTransferRequest) (*models.ScheduledTransferResponse, error) {
+	op := "service Scheduler: schedule create request received"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleCreate func call", "requets data", req)
+
+	if err := validateTransfer(ctx, s.db, req.SenderID, req.ReceiverID); err != nil {
+		log.WarnContext(ctx, "scheduled transfer request is not valid", "SenderID", req.SenderID, "ReceiverID", req.ReceiverID, "error", err)
+		return nil, err
+	}
+
+	log.DebugContext(ctx, "request data successfully verified")
+
+	data := models.ScheduledTransfer{
+		SenderID:   req.SenderID,
+		ReceiverID: req.ReceiverID,
+		Amount:     req.Amount,
+		Period:     req.Period,
+		NextRun:    req.StartAt,
+		Active:     true,
+		AnchorDay:  req.StartAt.UTC().Day(),
+	}
+
+	if err := s.db.ScheduleCreate(ctx, &data); err != nil {
+		log.ErrorContext(ctx, "failed to create a scheduled transfer", "error", err)
+		return nil, err
+	}
+
+	resp := models.ScheduledTransferResponse{
+		Message:  "scheduled transfer successfully created",
+		Schedule: &data,
+	}
+
+	log.InfoContext(ctx, "scheduled transfer successfully created", "id", data.ID)
+	return &resp, nil
+}
+
+// ScheduleGet returns a scheduled transfer with its current state (next run date, failed attempts, last error).
+func (s *Scheduler) ScheduleGet(ctx context.Context, id uint) (*models.ScheduledTransferResponse, error) {
+	op := "service Scheduler: schedule get request received"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleGet func call", "id", id)
+
+	data, err := s.db.ScheduleGet(ctx, id)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve the scheduled transfer", "error", err)
+		return nil, err
+	}
+
+	resp := models.ScheduledTransferResponse{
+		Message:  "scheduled transfer successfully received",
+		Schedule: data,
+	}
+
+	log.InfoContext(ctx, "scheduled transfer successfully received")
+	return &resp, nil
+}
+
+// ScheduleUpdate changes the amount, period, next run date and activity of a scheduled transfer.
+// The sender and the receiver cannot be changed, a new schedule must be created for that.
+func (s *Scheduler) ScheduleUpdate(ctx context.Context, req *models.ScheduledTransferUpdateRequest) (*models.ScheduledTransferResponse, error) {
+	op := "service Scheduler: schedule update request received"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleUpdate func call", "requets data", req)
+
+	data, err := s.db.ScheduleGet(ctx, req.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve the scheduled transfer", "error", err)
+		return nil, err
+	}
+
+	data.Amount = req.Amount
+	data.Period = req.Period
+	data.NextRun = req.StartAt
+	data.AnchorDay = req.StartAt.UTC().Day()
+	data.Active = req.Active
+	data.Attempts = 0
+	data.RetryAt = nil
+	data.LastError = nil
+
+	if err := s.db.ScheduleUpdate(ctx, data); err != nil {
+		log.ErrorContext(ctx, "failed to update the scheduled transfer", "error", err)
+		return nil, err
+	}
+
+	resp := models.ScheduledTransferResponse{
+		Message:  "scheduled transfer successfully updated",
+		Schedule: data,
+	}
+
+	log.InfoContext(ctx, "scheduled transfer successfully updated")
+	return &resp, nil
+}
+
+// ScheduleDelete deletes a scheduled transfer. Transfers that have already been executed are not affected.
+func (s *Scheduler) ScheduleDelete(ctx context.Context, id uint) error {
+	op := "service Scheduler: schedule delete request received"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleDelete func call", "id", id)
+
+	if err := s.db.ScheduleDelete(ctx, id); err != nil {
+		log.ErrorContext(ctx, "failed to delete the scheduled transfer", "error", err)
+		return err
+	}
+
+	log.InfoContext(ctx, "scheduled transfer successfully deleted")
+	return nil
+}
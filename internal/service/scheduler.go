@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/google/uuid"
+)
+
+const (
+	schedulerInterval    = time.Second * 30
+	schedulerBatchSize   = 100
+	schedulerRunTimeout  = time.Second * 5
+	schedulerClaimLease  = time.Minute * 10 // longer than a full batch of runs
+	scheduleMaxAttempts  = 5
+	scheduleBackoffStart = time.Minute
+	scheduleBackoffMax   = time.Hour
+)
+
+const (
+	PeriodOnce    = "once"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
+var ErrScheduleRunFailed = errors.New("transfer with this run key has already failed")
+
+// scheduleNamespace is the namespace for the idempotency keys of scheduled runs, it must never change,
+// otherwise runs executed before the change would be paid again
+var scheduleNamespace = uuid.MustParse("6f1c1b9e-4a52-4d1b-9d57-0c5a3f0e8b21")
+
+type scheduleTransfer interface {
+	Transfer(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error)
+}
+
+// schedulerSettings tells whether the read-only mode is on, the due transfers wait until it is turned off
+type schedulerSettings interface {
+	ReadOnly() bool
+}
+
+type Scheduler struct {
+	log      *slog.Logger
+	db       storages.StoreSchedule
+	wallet   scheduleTransfer
+	settings schedulerSettings
+	now      func() time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewScheduler(log *slog.Logger, db storages.StoreSchedule, wallet scheduleTransfer, settings schedulerSettings) *Scheduler {
+	log.Debug("service Scheduler: started creating")
+
+	log.Info("service Scheduler: successfully created")
+	return &Scheduler{
+		log:      log,
+		db:       db,
+		wallet:   wallet,
+		settings: settings,
+		now:      time.Now,
+	}
+}
+
+// Start launches the scheduler goroutine. Due transfers are checked immediately and then every schedulerInterval
+// until Stop is called.
+func (s *Scheduler) Start() {
+	s.log.Debug("service Scheduler: started")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.RunDue(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				s.log.ErrorContext(ctx, "service Scheduler: failed to run due transfers", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	s.log.Info("service Scheduler: successfully started", "interval", schedulerInterval)
+}
+
+// Stop cancels the scheduler goroutine and waits until the run in progress is finished.
+func (s *Scheduler) Stop() error {
+	s.log.Debug("service Scheduler: stop started")
+
+	if s.cancel == nil {
+		return fmt.Errorf("scheduler is not running")
+	}
+
+	s.cancel()
+	<-s.done
+
+	s.cancel = nil
+	s.done = nil
+
+	s.log.Info("service Scheduler: stop successful")
+	return nil
+}
+
+// RunDue executes all scheduled transfers whose run date has come. An error of one transfer does not stop the others,
+// it is written to the history of the schedule runs and the transfer is retried later with backoff.
+func (s *Scheduler) RunDue(ctx context.Context) error {
+	op := "service Scheduler: run due transfers"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "RunDue func call")
+
+	// the transfers are not run at all, so they do not use up their attempts, and run on the first check after the mode is off
+	if s.settings.ReadOnly() {
+		log.InfoContext(ctx, "read-only mode is on, due transfers are postponed")
+		return nil
+	}
+
+	now := s.now()
+	claimUntil := now.Add(schedulerClaimLease)
+
+	due, err := s.db.SchedulesDue(ctx, now, claimUntil, schedulerBatchSize)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve due scheduled transfers", "error", err)
+		return err
+	}
+
+	for _, item := range due {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// after the claim expires another scheduler may run the same schedules, the rest are left to it
+		if !s.now().Add(schedulerRunTimeout).Before(claimUntil) {
+			log.WarnContext(ctx, "claim of the due scheduled transfers is over, the rest are left for the next check")
+			break
+		}
+
+		if err := s.runSchedule(ctx, item); err != nil {
+			log.ErrorContext(ctx, "failed to run scheduled transfer", "id", item.ID, "error", err)
+		}
+	}
+
+	log.InfoContext(ctx, "due scheduled transfers processed", "count", len(due))
+	return nil
+}
+
+// runSchedule executes one run of a scheduled transfer through Wallet.Transfer.
+//
+// The Idempotency-Key of the run is derived from the schedule ID and the run date, so every attempt of the run and every
+// restart send the same key, and Wallet returns the already paid transaction instead of paying twice. A failed transfer
+// stays recorded as unsuccessful under its key, so the request asks Wallet to execute it again (RetryFailed).
+func (s *Scheduler) runSchedule(ctx context.Context, item *models.ScheduledTransfer) error {
+	op := "service Scheduler: run scheduled transfer"
+	log := s.log.With(slog.String("operation", op), slog.Any("schedule id", item.ID))
+	log.DebugContext(ctx, "runSchedule func call", "data", item)
+
+	runDate := item.NextRun
+	key := scheduleRunKey(item.ID, runDate)
+
+	var success bool
+	var runErr error
+
+	runCtx, cancel := context.WithTimeout(ctx, schedulerRunTimeout)
+	resp, err := s.wallet.Transfer(runCtx, &models.TransferRequest{
+		IdempotencyKey: key,
+		SenderID:       item.SenderID,
+		ReceiverID:     item.ReceiverID,
+		Amount:         item.Amount,
+		RetryFailed:    true,
+	})
+	cancel()
+
+	switch {
+	case err != nil:
+		runErr = err
+	case !resp.Operation.Success:
+		runErr = ErrScheduleRunFailed
+	default:
+		success = true
+	}
+
+	run := models.ScheduledTransferRun{
+		ScheduleID:     item.ID,
+		RunDate:        runDate,
+		Attempt:        item.Attempts,
+		IdempotencyKey: key,
+		Success:        success,
+	}
+
+	if success {
+		nextRun(item)
+		log.InfoContext(ctx, "scheduled transfer successfully executed", "next run", item.NextRun, "active", item.Active)
+	} else {
+		msg := runErr.Error()
+		run.Error = &msg
+		item.Attempts++
+
+		if item.Attempts >= scheduleMaxAttempts {
+			log.ErrorContext(ctx, "scheduled transfer failed, attempts are over, the run is skipped", "error", runErr)
+			nextRun(item)
+		} else {
+			retryAt := s.now().Add(scheduleBackoff(item.Attempts))
+			item.RetryAt = &retryAt
+			log.WarnContext(ctx, "scheduled transfer failed, it will be retried", "retry at", retryAt, "error", runErr)
+		}
+
+		item.LastError = &msg
+	}
+
+	if err := s.db.ScheduleRunSave(ctx, &run, item); err != nil {
+		if errors.Is(err, storages.ErrScheduleChanged) {
+			// the schedule was updated or claimed by another scheduler, the same run is sent with the same key again
+			log.WarnContext(ctx, "scheduled transfer was changed during the run, the result is not saved", "error", err)
+			return nil
+		}
+		log.ErrorContext(ctx, "failed to save the scheduled transfer run", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// nextRun moves the schedule to its next run date and resets the retry state.
+// A one-time schedule is deactivated instead.
+func nextRun(item *models.ScheduledTransfer) {
+	switch item.Period {
+	case PeriodWeekly:
+		item.NextRun = item.NextRun.AddDate(0, 0, 7)
+	case PeriodMonthly:
+		item.NextRun = nextMonthlyRun(item.NextRun, item.AnchorDay)
+	default:
+		item.Active = false
+	}
+
+	item.Attempts = 0
+	item.RetryAt = nil
+	item.LastError = nil
+}
+
+// nextMonthlyRun returns the run of the next month on the anchor day, or on the last day of the month if it is shorter.
+// AddDate cannot be used: it moves Jan 31 to Mar 3 and the schedule would stay on the 3rd. The schedules created before
+// the anchor day was stored have none, their current day is kept.
+func nextMonthlyRun(run time.Time, anchorDay int) time.Time {
+	run = run.UTC()
+	if anchorDay == 0 {
+		anchorDay = run.Day()
+	}
+
+	year, month := run.Year(), run.Month()+1
+	// day 0 of the month after the next one is the last day of the next month
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	return time.Date(year, month, min(anchorDay, lastDay), run.Hour(), run.Minute(), run.Second(), run.Nanosecond(), time.UTC)
+}
+
+// scheduleBackoff returns the delay before the next attempt, it doubles with each failed attempt up to scheduleBackoffMax
+func scheduleBackoff(attempts int) time.Duration {
+	delay := scheduleBackoffStart
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= scheduleBackoffMax {
+			return scheduleBackoffMax
+		}
+	}
+
+	return delay
+}
+
+// scheduleRunKey returns the Idempotency-Key of the run of the schedule on the run date, the same for all its attempts
+func scheduleRunKey(id uint, runDate time.Time) string {
+	name := fmt.Sprintf("%d:%s", id, runDate.UTC().Format(time.RFC3339))
+	return uuid.NewSHA1(scheduleNamespace, []byte(name)).String()
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/service/mock"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+)
+
+type transferFunc func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error)
+
+func (f transferFunc) Transfer(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+	return f(ctx, req)
+}
+
+func TestScheduler_RunDue(t *testing.T) {
+	log := logs.NewDiscardLogger()
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	runDate := time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		schedule      models.ScheduledTransfer
+		transfer      transferFunc
+		expectedKey   string
+		expectedRun   bool
+		expectedState models.ScheduledTransfer
+	}{
+		{
+			name:     "successful weekly run",
+			schedule: models.ScheduledTransfer{ID: 1, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodWeekly, NextRun: runDate, Active: true},
+			transfer: func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+				return &models.TransferResponse{Operation: &models.Transaction{Success: true}}, nil
+			},
+			expectedKey:   scheduleRunKey(1, runDate),
+			expectedRun:   true,
+			expectedState: models.ScheduledTransfer{ID: 1, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodWeekly, NextRun: runDate.AddDate(0, 0, 7), Active: true},
+		},
+		{
+			name:     "successful one-time run deactivates the schedule",
+			schedule: models.ScheduledTransfer{ID: 2, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodOnce, NextRun: runDate, Active: true},
+			transfer: func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+				return &models.TransferResponse{Operation: &models.Transaction{Success: true}}, nil
+			},
+			expectedKey:   scheduleRunKey(2, runDate),
+			expectedRun:   true,
+			expectedState: models.ScheduledTransfer{ID: 2, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodOnce, NextRun: runDate, Active: false},
+		},
+		{
+			name:     "failed run is retried with backoff",
+			schedule: models.ScheduledTransfer{ID: 3, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodMonthly, NextRun: runDate, Active: true, Attempts: 1},
+			transfer: func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+				return nil, ErrInsufficientFunds
+			},
+			expectedKey: scheduleRunKey(3, runDate),
+			expectedRun: false,
+			expectedState: models.ScheduledTransfer{
+				ID: 3, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodMonthly, NextRun: runDate, Active: true, Attempts: 2,
+				RetryAt: ptr(now.Add(2 * time.Minute)), LastError: ptr(ErrInsufficientFunds.Error()),
+			},
+		},
+		{
+			name:     "replayed failed transaction is a failed run",
+			schedule: models.ScheduledTransfer{ID: 4, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodWeekly, NextRun: runDate, Active: true},
+			transfer: func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+				return &models.TransferResponse{Operation: &models.Transaction{Success: false}}, nil
+			},
+			expectedKey: scheduleRunKey(4, runDate),
+			expectedRun: false,
+			expectedState: models.ScheduledTransfer{
+				ID: 4, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodWeekly, NextRun: runDate, Active: true, Attempts: 1,
+				RetryAt: ptr(now.Add(time.Minute)), LastError: ptr(ErrScheduleRunFailed.Error()),
+			},
+		},
+		{
+			name:     "attempts are over, the run is skipped",
+			schedule: models.ScheduledTransfer{ID: 5, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodWeekly, NextRun: runDate, Active: true, Attempts: scheduleMaxAttempts - 1},
+			transfer: func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+				return nil, ErrInsufficientFunds
+			},
+			expectedKey: scheduleRunKey(5, runDate),
+			expectedRun: false,
+			expectedState: models.ScheduledTransfer{
+				ID: 5, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodWeekly, NextRun: runDate.AddDate(0, 0, 7), Active: true,
+				LastError: ptr(ErrInsufficientFunds.Error()),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var savedRun *models.ScheduledTransferRun
+			var savedState *models.ScheduledTransfer
+			var usedKey string
+
+			mockStore := &mock.MockStoreSchedule{
+				SchedulesDueFunc: func(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error) {
+					assert.Equal(t, now.Add(schedulerClaimLease), claimUntil)
+					item := tt.schedule
+					return []*models.ScheduledTransfer{&item}, nil
+				},
+				ScheduleRunSaveFunc: func(ctx context.Context, run *models.ScheduledTransferRun, data *models.ScheduledTransfer) error {
+					savedRun = run
+					savedState = data
+					return nil
+				},
+			}
+
+			transfer := func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+				usedKey = req.IdempotencyKey
+				assert.True(t, req.RetryFailed, "a failed attempt of the run must be executed again")
+				return tt.transfer(ctx, req)
+			}
+
+			scheduler := NewScheduler(log, mockStore, transferFunc(transfer), config.NewSettings(config.Runtime{}))
+			scheduler.now = func() time.Time { return now }
+
+			err := scheduler.RunDue(context.Background())
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedKey, usedKey)
+			assert.Equal(t, tt.expectedKey, savedRun.IdempotencyKey)
+			assert.Equal(t, tt.expectedRun, savedRun.Success)
+			assert.Equal(t, runDate, savedRun.RunDate)
+			assert.Equal(t, tt.expectedState, *savedState)
+		})
+	}
+}
+
+func TestScheduler_ReadOnly(t *testing.T) {
+	settings := config.NewSettings(config.Runtime{ReadOnly: true})
+
+	var checked bool
+	mockStore := &mock.MockStoreSchedule{
+		SchedulesDueFunc: func(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error) {
+			checked = true
+			return nil, nil
+		},
+	}
+	transfer := func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+		t.Fatal("no transfer must be run in the read-only mode")
+		return nil, nil
+	}
+
+	scheduler := NewScheduler(logs.NewDiscardLogger(), mockStore, transferFunc(transfer), settings)
+
+	assert.NoError(t, scheduler.RunDue(context.Background()))
+	assert.False(t, checked, "due transfers must not be even read")
+
+	settings.Store(config.Runtime{})
+	assert.NoError(t, scheduler.RunDue(context.Background()))
+	assert.True(t, checked)
+}
+
+func TestScheduleRunKey(t *testing.T) {
+	runDate := time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, scheduleRunKey(1, runDate), scheduleRunKey(1, runDate.In(time.FixedZone("UTC+3", 3*3600))))
+	assert.NotEqual(t, scheduleRunKey(1, runDate), scheduleRunKey(2, runDate))
+	assert.NotEqual(t, scheduleRunKey(1, runDate), scheduleRunKey(1, runDate.AddDate(0, 0, 7)))
+}
+
+// TestNextRun_Monthly checks that a monthly schedule keeps the day of its start date, the runs in the shorter months
+// are on their last day and do not move the next runs
+func TestNextRun_Monthly(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    time.Time
+		expected []time.Time
+	}{
+		{
+			name:  "day 31",
+			start: time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2025, 2, 28, 10, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 31, 10, 0, 0, 0, time.UTC),
+				time.Date(2025, 4, 30, 10, 0, 0, 0, time.UTC),
+				time.Date(2025, 5, 31, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "day 30",
+			start: time.Date(2025, 1, 30, 10, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2025, 2, 28, 10, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 30, 10, 0, 0, 0, time.UTC),
+				time.Date(2025, 4, 30, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "day 29 in a leap year",
+			start: time.Date(2024, 1, 29, 10, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2024, 2, 29, 10, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 29, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "day 29",
+			start: time.Date(2025, 1, 29, 10, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2025, 2, 28, 10, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 29, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "over the end of the year",
+			start: time.Date(2024, 12, 31, 10, 0, 0, 0, time.UTC),
+			expected: []time.Time{
+				time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC),
+				time.Date(2025, 2, 28, 10, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := models.ScheduledTransfer{Period: PeriodMonthly, NextRun: tt.start, Active: true, AnchorDay: tt.start.Day()}
+
+			for _, expected := range tt.expected {
+				nextRun(&item)
+				assert.Equal(t, expected, item.NextRun)
+				assert.True(t, item.Active)
+			}
+		})
+	}
+
+	t.Run("schedule without anchor day keeps its day", func(t *testing.T) {
+		item := models.ScheduledTransfer{Period: PeriodMonthly, NextRun: time.Date(2025, 3, 3, 10, 0, 0, 0, time.UTC), Active: true}
+
+		nextRun(&item)
+		assert.Equal(t, time.Date(2025, 4, 3, 10, 0, 0, 0, time.UTC), item.NextRun)
+	})
+}
+
+// TestScheduler_ScheduleChanged checks that a run whose schedule was updated or claimed again is not an error,
+// the run is sent again with the same key by the next check
+func TestScheduler_ScheduleChanged(t *testing.T) {
+	runDate := time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC)
+
+	mockStore := &mock.MockStoreSchedule{
+		SchedulesDueFunc: func(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error) {
+			return []*models.ScheduledTransfer{{ID: 1, SenderID: 1, ReceiverID: 2, Amount: 100, Period: PeriodWeekly, NextRun: runDate, Active: true, Version: 3}}, nil
+		},
+		ScheduleRunSaveFunc: func(ctx context.Context, run *models.ScheduledTransferRun, data *models.ScheduledTransfer) error {
+			assert.Equal(t, 3, data.Version, "the run is saved under the version of its claim")
+			return storages.ErrScheduleChanged
+		},
+	}
+	transfer := func(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+		return &models.TransferResponse{Operation: &models.Transaction{Success: true}}, nil
+	}
+
+	scheduler := NewScheduler(logs.NewDiscardLogger(), mockStore, transferFunc(transfer), config.NewSettings(config.Runtime{}))
+
+	assert.NoError(t, scheduler.RunDue(context.Background()))
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
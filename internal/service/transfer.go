@@ -4,91 +4,144 @@ import (
 	"context"
 	"log/slog"
 
-	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
 	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
 )
 
 // Transfer handles the transfer of funds between two users. It first checks if the transaction already exists using the idempotency key.
 // If the transaction exists, it retrieves and returns the existing transaction details. If the transaction does not exist, it verifies
-// the existence of both the sender and receiver users. If either user is not found, it returns an error. If both users exist,
+// that the sender and the receiver are different users and that both exist, returning ErrSelfTransfer, ErrSenderNotFound or
+// ErrReceiverNotFound otherwise. A transfer rejected for its amount, itself or its receiver gets the transfer.failed event,
+// the same as such an item of a batch. If the request is valid,
 // it creates a new transaction, processes the transfer, and updates the balances in the database. The function returns a response
-// indicating the success of the transfer operation.
+// indicating the success of the transfer operation. With req.RetryFailed an existing unsuccessful transaction is not returned,
+// the transfer is executed again under the same transaction.
 func (w *Wallet) Transfer(ctx context.Context, req *models.TransferRequest) (*models.TransferResponse, error) {
+	done, err := w.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	ctx, span := tracer().Start(ctx, "Wallet.Transfer")
+	defer span.End()
+
 	op := "service Wallet: transfer request received"
 	log := w.log.With(slog.String("operation", op))
-	log.Debug("Transfer func call", "requets data", req)
+	log.DebugContext(ctx, "Transfer func call", "requets data", req)
 
 	exsistTransaction, err := w.db.ExsistIdempotencyKey(ctx, req.IdempotencyKey)
 	if err != nil {
-		log.Error("failed to check if the transaction exists in the database", "error", err)
+		log.ErrorContext(ctx, "failed to check if the transaction exists in the database", "error", err)
 		return nil, err
 	}
 
+	var failed *models.Transaction
 	if exsistTransaction {
-		log.Warn("transaction already exists")
-
 		dataTran, err := w.db.TransactionGet(ctx, req.IdempotencyKey)
 		if err != nil {
-			log.Error("failed to retrieve existing transaction", "error", err)
+			log.ErrorContext(ctx, "failed to retrieve existing transaction", "error", err)
 			return nil, err
 		}
 
-		resp := models.TransferResponse{
-			Message:   "transfer successfully",
-			Operation: dataTran,
-		}
+		if dataTran.Success || !req.RetryFailed {
+			log.WarnContext(ctx, "transaction already exists")
+			w.metrics.DomainError(metrics.ErrorIdempotentReplay)
 
-		log.Warn("existing transaction successfully sent")
-		return &resp, nil
-	}
+			resp := models.TransferResponse{
+				Message:   "transfer successfully",
+				Operation: dataTran,
+			}
 
-	exsistUserSender, err := w.db.ExsistUser(ctx, req.SenderID)
-	if err != nil {
-		log.Error("failed to check if the UserSender exists in the database", "error", err)
-		return nil, err
+			log.WarnContext(ctx, "existing transaction successfully sent")
+			return &resp, nil
+		}
+
+		log.InfoContext(ctx, "failed transaction is executed again", "transaction ID", dataTran.ID)
+		failed = dataTran
 	}
 
-	exsistUserReceiver, err := w.db.ExsistUser(ctx, req.SenderID)
-	if err != nil {
-		log.Error("failed to check if the UserReceiver exists in the database", "error", err)
+	if err := w.checkWritable(); err != nil {
+		log.WarnContext(ctx, "transfer rejected", "error", err)
 		return nil, err
 	}
 
-	if !exsistUserSender || !exsistUserReceiver {
-		log.Warn("user not found", "SenderID", req.SenderID, "ReceiverID", req.ReceiverID)
-		return nil, storages.ErrUserNotFound
+	amount := req.Amount
+	if failed != nil {
+		// the transaction keeps the amount of its first attempt, it is paid as it was recorded
+		amount = failed.Amount
 	}
 
-	log.Debug("request data successfully verified")
-
 	// data for transaction creation
 	dataTran := models.Transaction{
 		IdempotencyKey: req.IdempotencyKey,
 		SenderID:       req.SenderID,
 		ReceiverID:     req.ReceiverID,
 		TypeOperation:  "transfer",
-		Amount:         req.Amount,
+		Amount:         amount,
+	}
+
+	if failed != nil {
+		dataTran.ID = failed.ID
+		dataTran.Date = failed.Date
+	}
+
+	if err := validateAmount(amount, w.settings.Runtime().TransferLimit); err != nil {
+		log.WarnContext(ctx, "transfer amount exceeds the limit", "amount", amount, "error", err)
+		w.addFailedEvent(ctx, &dataTran, err)
+		return nil, err
 	}
 
-	if err := w.db.TransactionCreate(ctx, &dataTran); err != nil {
-		log.Error("failed to create a transaction for user operation", "error", err)
+	if err := validateTransfer(ctx, w.db, req.SenderID, req.ReceiverID); err != nil {
+		log.WarnContext(ctx, "transfer request is not valid", "SenderID", req.SenderID, "ReceiverID", req.ReceiverID, "error", err)
+		w.countError(err)
+		if rejectsTransfer(err) {
+			w.addFailedEvent(ctx, &dataTran, err)
+		}
 		return nil, err
 	}
 
-	log.Info("transaction for the user operation was successfully created", "transaction ID", dataTran.ID)
+	log.DebugContext(ctx, "request data successfully verified")
+
+	if failed == nil {
+		if err := w.db.TransactionCreate(ctx, &dataTran); err != nil {
+			log.ErrorContext(ctx, "failed to create a transaction for user operation", "error", err)
+			return nil, err
+		}
+
+		log.InfoContext(ctx, "transaction for the user operation was successfully created", "transaction ID", dataTran.ID)
+	}
 
 	if err := w.db.Transfer(ctx, &dataTran); err != nil {
-		log.Error("failed to update the balance value in the database", "error", err)
+		log.ErrorContext(ctx, "failed to update the balance value in the database", "error", err)
+		w.countError(err)
+		w.addFailedEvent(ctx, &dataTran, err)
+		w.notify(ctx, &dataTran)
 		return nil, err
 	}
 
 	dataTran.Success = true
+	// the amount is already stored, so it is in range
+	cents, _ := storages.ToCents(dataTran.Amount)
+	w.metrics.TransferAmount(cents)
+	w.notify(ctx, &dataTran)
 
 	resp := models.TransferResponse{
 		Message:   "transfer successfully",
 		Operation: &dataTran,
 	}
 
-	log.Info("transfer successfully")
+	log.InfoContext(ctx, "transfer successfully")
 	return &resp, nil
 }
+
+// addFailedEvent writes the transfer.failed event to the outbox. A failed transfer changes no balance, so there is
+// no database transaction to write it in, the storage writes the event of a successful transfer itself. The transfer
+// has already failed, so an error here is only logged, and the event is written even if the client has gone away.
+func (w *Wallet) addFailedEvent(ctx context.Context, data *models.Transaction, transferErr error) {
+	event := TransferEvent(data, transferErr)
+	if err := w.db.OutboxAdd(context.WithoutCancel(ctx), event); err != nil {
+		w.log.ErrorContext(ctx, "service Wallet: failed to add the event to the outbox", "type", event.Type, "id", event.ID, "error", err)
+	}
+}
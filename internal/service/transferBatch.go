@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/google/uuid"
+)
+
+const (
+	BatchModeAtomic     = "atomic"
+	BatchModeBestEffort = "best_effort"
+)
+
+// TransferBatch handles the transfer of funds from one sender to many receivers under one Idempotency-Key.
+// If a batch with this key already exists, its saved results are returned. Otherwise the sender and every receiver are verified.
+// In the atomic mode any invalid item fails the whole request, in the best_effort mode the invalid item is only marked as failed.
+// Every item gets its own Idempotency-Key derived from the key of the batch and the item position, so the items appear
+// in the user operations as usual transfers. The transfer itself is executed by the storage in one database transaction.
+func (w *Wallet) TransferBatch(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error) {
+	done, err := w.track()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	ctx, span := tracer().Start(ctx, "Wallet.TransferBatch")
+	defer span.End()
+
+	op := "service Wallet: batch transfer request received"
+	log := w.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "TransferBatch func call", "sender id", req.SenderID, "mode", req.Mode, "items", len(req.Items))
+
+	existing, err := w.db.TransferBatchGet(ctx, req.IdempotencyKey)
+	if err == nil {
+		log.WarnContext(ctx, "batch already exists")
+		w.metrics.DomainError(metrics.ErrorIdempotentReplay)
+		existing.Message = batchMessage(existing.Batch)
+		return existing, nil
+	}
+
+	if !errors.Is(err, storages.ErrBatchNotFound) {
+		log.ErrorContext(ctx, "failed to check if the batch exists in the database", "error", err)
+		return nil, err
+	}
+
+	if err := w.checkWritable(); err != nil {
+		log.WarnContext(ctx, "batch transfer rejected", "error", err)
+		return nil, err
+	}
+
+	if err := validateSender(ctx, w.db, req.SenderID); err != nil {
+		log.WarnContext(ctx, "batch sender is not valid", "SenderID", req.SenderID, "error", err)
+		w.countError(err)
+		return nil, err
+	}
+
+	batchKey, err := uuid.Parse(req.IdempotencyKey)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to parse the Idempotency-Key of the batch", "error", err)
+		return nil, err
+	}
+
+	// one snapshot for the whole batch, so a reload in the middle does not apply different limits to the items
+	transferLimit := w.settings.Runtime().TransferLimit
+
+	receivers := make(map[uint]error)
+	for i, item := range req.Items {
+		item.IdempotencyKey = uuid.NewSHA1(batchKey, []byte(strconv.Itoa(i))).String()
+
+		var itemErr error
+		if item.ReceiverID == req.SenderID {
+			itemErr = ErrSelfTransfer
+		} else if err := validateAmount(item.Amount, transferLimit); err != nil {
+			itemErr = err
+		} else {
+			var ok bool
+			itemErr, ok = receivers[item.ReceiverID]
+			if !ok {
+				itemErr = validateReceiver(ctx, w.db, item.ReceiverID)
+				if itemErr != nil && !errors.Is(itemErr, ErrReceiverNotFound) {
+					log.ErrorContext(ctx, "failed to check if the UserReceiver exists in the database", "error", itemErr)
+					return nil, itemErr
+				}
+				receivers[item.ReceiverID] = itemErr
+			}
+		}
+
+		if itemErr != nil {
+			if req.Mode == BatchModeAtomic {
+				log.WarnContext(ctx, "invalid batch item", "position", i, "ReceiverID", item.ReceiverID, "error", itemErr)
+				w.countError(itemErr)
+				return nil, itemErr
+			}
+			item.Err = itemErr
+		}
+	}
+
+	log.DebugContext(ctx, "request data successfully verified")
+
+	resp, err := w.db.TransferBatch(ctx, req)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to execute the batch transfer in the database", "error", err)
+		w.countError(err)
+		return nil, err
+	}
+
+	for _, result := range resp.Results {
+		switch {
+		case result.Success:
+			cents, _ := storages.ToCents(result.Amount)
+			w.metrics.TransferAmount(cents)
+			w.notify(ctx, &models.Transaction{
+				ID:             *result.Transaction,
+				SenderID:       req.SenderID,
+				ReceiverID:     result.ReceiverID,
+				IdempotencyKey: req.Items[result.Position].IdempotencyKey,
+				Success:        true,
+				TypeOperation:  "transfer",
+				Amount:         result.Amount,
+				Date:           resp.Batch.Date,
+			})
+		case errors.Is(result.Err, ErrInsufficientFunds):
+			w.metrics.DomainError(metrics.ErrorInsufficientFunds)
+		case errors.Is(result.Err, ErrReceiverNotFound):
+			w.metrics.DomainError(metrics.ErrorUserNotFound)
+		}
+	}
+
+	resp.Message = batchMessage(resp.Batch)
+
+	log.InfoContext(ctx, "batch transfer completed", "batch id", resp.Batch.ID, "success", resp.Batch.Success)
+	return resp, nil
+}
+
+func batchMessage(batch *models.TransferBatch) string {
+	if batch.Success {
+		return "batch transfer successfully"
+	}
+
+	return "batch transfer completed with errors"
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/service/mock"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWallet_TransferBatch(t *testing.T) {
+	log := logs.NewDiscardLogger()
+	mockStore := &mock.MockStoreWallet{}
+
+	settings := config.NewSettings(config.Runtime{})
+	wallet := New(log, mockStore, metrics.New(), settings, nil)
+
+	users := map[uint]bool{1: true, 2: true, 3: true}
+	var storedReq *models.TransferBatchRequest
+
+	newReq := func(mode string, receivers ...uint) *models.TransferBatchRequest {
+		req := &models.TransferBatchRequest{
+			IdempotencyKey: mock.IdempotencyKeyTestDef,
+			SenderID:       1,
+			Mode:           mode,
+		}
+		for _, id := range receivers {
+			req.Items = append(req.Items, &models.TransferBatchItem{ReceiverID: id, Amount: 10})
+		}
+		return req
+	}
+
+	tests := []struct {
+		name          string
+		req           *models.TransferBatchRequest
+		mockSetup     func()
+		expectedErr   error
+		expectedMsg   string
+		expectedItems []error
+	}{
+		{
+			name: "successful atomic batch",
+			req:  newReq(BatchModeAtomic, 2, 3),
+			mockSetup: func() {
+				mockStore.TransferBatchGetFunc = func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+					return nil, storages.ErrBatchNotFound
+				}
+				mockStore.TransferBatchFunc = func(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error) {
+					storedReq = req
+					return &models.TransferBatchResponse{Batch: &models.TransferBatch{Success: true}}, nil
+				}
+			},
+			expectedMsg:   "batch transfer successfully",
+			expectedItems: []error{nil, nil},
+		},
+		{
+			name: "batch already exists",
+			req:  newReq(BatchModeAtomic, 2),
+			mockSetup: func() {
+				mockStore.TransferBatchGetFunc = func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+					return &models.TransferBatchResponse{Batch: &models.TransferBatch{Success: false}}, nil
+				}
+				mockStore.TransferBatchFunc = nil
+			},
+			expectedMsg: "batch transfer completed with errors",
+		},
+		{
+			name: "atomic batch with unknown receiver",
+			req:  newReq(BatchModeAtomic, 2, 9),
+			mockSetup: func() {
+				mockStore.TransferBatchGetFunc = func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+					return nil, storages.ErrBatchNotFound
+				}
+				mockStore.TransferBatchFunc = nil
+			},
+			expectedErr: ErrReceiverNotFound,
+		},
+		{
+			name: "sender not found",
+			req:  &models.TransferBatchRequest{IdempotencyKey: mock.IdempotencyKeyTestDef, SenderID: 9, Mode: BatchModeAtomic},
+			mockSetup: func() {
+				mockStore.TransferBatchGetFunc = func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+					return nil, storages.ErrBatchNotFound
+				}
+				mockStore.TransferBatchFunc = nil
+			},
+			expectedErr: ErrSenderNotFound,
+		},
+		{
+			name: "atomic batch with transfer to self",
+			req:  newReq(BatchModeAtomic, 1),
+			mockSetup: func() {
+				mockStore.TransferBatchGetFunc = func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+					return nil, storages.ErrBatchNotFound
+				}
+				mockStore.TransferBatchFunc = nil
+			},
+			expectedErr: ErrSelfTransfer,
+		},
+		{
+			name: "best effort batch marks invalid items",
+			req:  newReq(BatchModeBestEffort, 2, 9, 1),
+			mockSetup: func() {
+				mockStore.TransferBatchGetFunc = func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+					return nil, storages.ErrBatchNotFound
+				}
+				mockStore.TransferBatchFunc = func(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error) {
+					storedReq = req
+					return &models.TransferBatchResponse{Batch: &models.TransferBatch{Success: false}}, nil
+				}
+			},
+			expectedMsg:   "batch transfer completed with errors",
+			expectedItems: []error{nil, ErrReceiverNotFound, ErrSelfTransfer},
+		},
+		{
+			name: "atomic batch with an item over the transfer limit",
+			req:  newReq(BatchModeAtomic, 2, 3),
+			mockSetup: func() {
+				settings.Store(config.Runtime{TransferLimit: 5})
+				mockStore.TransferBatchGetFunc = func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+					return nil, storages.ErrBatchNotFound
+				}
+				mockStore.TransferBatchFunc = nil
+			},
+			expectedErr: ErrLimitExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storedReq = nil
+			settings.Store(config.Runtime{})
+			mockStore.ExsistUserFunc = func(ctx context.Context, id uint) (bool, error) {
+				return users[id], nil
+			}
+			tt.mockSetup()
+
+			resp, err := wallet.TransferBatch(context.Background(), tt.req)
+
+			assert.Equal(t, tt.expectedErr, err)
+			if tt.expectedErr != nil {
+				assert.Nil(t, resp)
+				return
+			}
+
+			assert.Equal(t, tt.expectedMsg, resp.Message)
+			if tt.expectedItems == nil {
+				assert.Nil(t, storedReq)
+				return
+			}
+
+			keys := make(map[string]bool)
+			for i, item := range storedReq.Items {
+				assert.Equal(t, tt.expectedItems[i], item.Err)
+				assert.NotEmpty(t, item.IdempotencyKey)
+				keys[item.IdempotencyKey] = true
+			}
+			assert.Len(t, keys, len(storedReq.Items))
+		})
+	}
+}
@@ -7,10 +7,13 @@ import (
 
 	"github.com/EvansTrein/iqProgers/models"
 	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
 	"github.com/EvansTrein/iqProgers/internal/service/mock"
 	"github.com/EvansTrein/iqProgers/internal/storages"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestWallet_Transfer(t *testing.T) {
@@ -18,9 +21,11 @@ func TestWallet_Transfer(t *testing.T) {
 	defer ctrl.Finish()
 
 	log := logs.NewDiscardLogger()
-	mockStore := &mock.MockStoreWallet{}
+	mockStore := &mock.MockStoreWallet{
+		OutboxAddFunc: func(ctx context.Context, event *models.Event) error { return nil },
+	}
 
-	wallet := New(log, mockStore)
+	wallet := New(log, mockStore, metrics.New(), config.NewSettings(config.Runtime{}), nil)
 
 	tests := []struct {
 		name         string
@@ -101,7 +106,7 @@ func TestWallet_Transfer(t *testing.T) {
 			expectedErr: nil,
 		},
 		{
-			name: "user not found",
+			name: "sender not found",
 			req: &models.TransferRequest{
 				SenderID:       1,
 				ReceiverID:     2,
@@ -113,11 +118,71 @@ func TestWallet_Transfer(t *testing.T) {
 					return false, nil
 				}
 				mockStore.ExsistUserFunc = func(ctx context.Context, id uint) (bool, error) {
+					return id != 1, nil
+				}
+			},
+			expectedResp: nil,
+			expectedErr:  ErrSenderNotFound,
+		},
+		{
+			name: "receiver not found",
+			req: &models.TransferRequest{
+				SenderID:       1,
+				ReceiverID:     2,
+				Amount:         100,
+				IdempotencyKey: mock.IdempotencyKeyTestDef,
+			},
+			mockSetup: func() {
+				mockStore.ExsistIdempotencyKeyFunc = func(ctx context.Context, uuid string) (bool, error) {
+					return false, nil
+				}
+				mockStore.ExsistUserFunc = func(ctx context.Context, id uint) (bool, error) {
+					return id != 2, nil
+				}
+			},
+			expectedResp: nil,
+			expectedErr:  ErrReceiverNotFound,
+		},
+		{
+			name: "transfer to self",
+			req: &models.TransferRequest{
+				SenderID:       1,
+				ReceiverID:     1,
+				Amount:         100,
+				IdempotencyKey: mock.IdempotencyKeyTestDef,
+			},
+			mockSetup: func() {
+				mockStore.ExsistIdempotencyKeyFunc = func(ctx context.Context, uuid string) (bool, error) {
+					return false, nil
+				}
+				mockStore.ExsistUserFunc = func(ctx context.Context, id uint) (bool, error) {
+					return true, nil
+				}
+			},
+			expectedResp: nil,
+			expectedErr:  ErrSelfTransfer,
+		},
+		{
+			name: "failed to check the receiver",
+			req: &models.TransferRequest{
+				SenderID:       1,
+				ReceiverID:     2,
+				Amount:         100,
+				IdempotencyKey: mock.IdempotencyKeyTestDef,
+			},
+			mockSetup: func() {
+				mockStore.ExsistIdempotencyKeyFunc = func(ctx context.Context, uuid string) (bool, error) {
 					return false, nil
 				}
+				mockStore.ExsistUserFunc = func(ctx context.Context, id uint) (bool, error) {
+					if id == 2 {
+						return false, errors.New("failed to check user")
+					}
+					return true, nil
+				}
 			},
 			expectedResp: nil,
-			expectedErr:  storages.ErrUserNotFound,
+			expectedErr:  errors.New("failed to check user"),
 		},
 		{
 			name: "failed to create transaction",
@@ -162,6 +227,9 @@ func TestWallet_Transfer(t *testing.T) {
 				mockStore.TransferFunc = func(ctx context.Context, req *models.Transaction) error {
 					return errors.New("failed to transfer")
 				}
+				mockStore.OutboxAddFunc = func(ctx context.Context, event *models.Event) error {
+					return nil
+				}
 			},
 			expectedResp: nil,
 			expectedErr:  errors.New("failed to transfer"),
@@ -179,3 +247,244 @@ func TestWallet_Transfer(t *testing.T) {
 		})
 	}
 }
+
+func TestWallet_TransferFailedEvent(t *testing.T) {
+	var added []*models.Event
+	mockStore := &mock.MockStoreWallet{
+		ExsistIdempotencyKeyFunc: func(ctx context.Context, uuid string) (bool, error) { return false, nil },
+		ExsistUserFunc:           func(ctx context.Context, id uint) (bool, error) { return true, nil },
+		TransactionCreateFunc: func(ctx context.Context, data *models.Transaction) error {
+			data.ID = 10
+			return nil
+		},
+		TransferFunc: func(ctx context.Context, req *models.Transaction) error {
+			return ErrInsufficientFunds
+		},
+		OutboxAddFunc: func(ctx context.Context, event *models.Event) error {
+			added = append(added, event)
+			return errors.New("outbox is unavailable")
+		},
+	}
+
+	wallet := New(logs.NewDiscardLogger(), mockStore, metrics.New(), config.NewSettings(config.Runtime{}), nil)
+
+	_, err := wallet.Transfer(context.Background(), &models.TransferRequest{SenderID: 1, ReceiverID: 2, Amount: 500, IdempotencyKey: mock.IdempotencyKeyTestDef})
+
+	assert.ErrorIs(t, err, ErrInsufficientFunds, "an error of the outbox does not replace the error of the transfer")
+	require.Len(t, added, 1)
+	assert.Equal(t, EventTransferFailed, added[0].Type)
+	assert.Equal(t, models.EventData{IdempotencyKey: mock.IdempotencyKeyTestDef, TransactionID: 10, SenderID: 1, ReceiverID: 2,
+		Amount: 500, Reason: ReasonInsufficientFunds}, *added[0].Data)
+}
+
+// TestWallet_TransferRejectedEvent checks that a transfer rejected before it is executed gets the same transfer.failed
+// event as such an item of a batch, and that a missing sender gives no event, as it rejects the whole batch
+func TestWallet_TransferRejectedEvent(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            models.TransferRequest
+		expectedErr    error
+		expectedReason string
+	}{
+		{
+			name:           "self transfer",
+			req:            models.TransferRequest{SenderID: 1, ReceiverID: 1, Amount: 50},
+			expectedErr:    ErrSelfTransfer,
+			expectedReason: ReasonSelfTransfer,
+		},
+		{
+			name:           "receiver not found",
+			req:            models.TransferRequest{SenderID: 1, ReceiverID: 3, Amount: 50},
+			expectedErr:    ErrReceiverNotFound,
+			expectedReason: ReasonReceiverNotFound,
+		},
+		{
+			name:           "limit exceeded",
+			req:            models.TransferRequest{SenderID: 1, ReceiverID: 2, Amount: 150},
+			expectedErr:    ErrLimitExceeded,
+			expectedReason: ReasonLimitExceeded,
+		},
+		{
+			name:        "sender not found",
+			req:         models.TransferRequest{SenderID: 4, ReceiverID: 2, Amount: 50},
+			expectedErr: ErrSenderNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added []*models.Event
+			mockStore := &mock.MockStoreWallet{
+				ExsistIdempotencyKeyFunc: func(ctx context.Context, uuid string) (bool, error) { return false, nil },
+				ExsistUserFunc:           func(ctx context.Context, id uint) (bool, error) { return id <= 2, nil },
+				TransactionCreateFunc: func(ctx context.Context, data *models.Transaction) error {
+					t.Fatal("a rejected transfer must not create a transaction")
+					return nil
+				},
+				OutboxAddFunc: func(ctx context.Context, event *models.Event) error {
+					added = append(added, event)
+					return nil
+				},
+			}
+
+			settings := config.NewSettings(config.Runtime{TransferLimit: 100})
+			wallet := New(logs.NewDiscardLogger(), mockStore, metrics.New(), settings, nil)
+
+			req := tt.req
+			req.IdempotencyKey = mock.IdempotencyKeyTestDef
+			_, err := wallet.Transfer(context.Background(), &req)
+			assert.ErrorIs(t, err, tt.expectedErr)
+
+			if tt.expectedReason == "" {
+				assert.Empty(t, added)
+				return
+			}
+
+			require.Len(t, added, 1)
+			assert.Equal(t, EventTransferFailed, added[0].Type)
+			assert.Equal(t, models.EventData{IdempotencyKey: mock.IdempotencyKeyTestDef, SenderID: req.SenderID, ReceiverID: req.ReceiverID,
+				Amount: req.Amount, Reason: tt.expectedReason}, *added[0].Data)
+		})
+	}
+}
+
+func TestWallet_TransferRetryFailed(t *testing.T) {
+	var transferred *models.Transaction
+	mockStore := &mock.MockStoreWallet{
+		ExsistIdempotencyKeyFunc: func(ctx context.Context, uuid string) (bool, error) { return true, nil },
+		ExsistUserFunc:           func(ctx context.Context, id uint) (bool, error) { return true, nil },
+		TransactionGetFunc: func(ctx context.Context, idempotencyKey string) (*models.Transaction, error) {
+			return &models.Transaction{ID: 10, IdempotencyKey: idempotencyKey, TypeOperation: "transfer", Amount: 100, Success: false}, nil
+		},
+		TransactionCreateFunc: func(ctx context.Context, data *models.Transaction) error {
+			t.Fatal("the failed transaction must be executed again, not created")
+			return nil
+		},
+		TransferFunc: func(ctx context.Context, req *models.Transaction) error {
+			transferred = req
+			return nil
+		},
+	}
+
+	wallet := New(logs.NewDiscardLogger(), mockStore, metrics.New(), config.NewSettings(config.Runtime{}), nil)
+	req := &models.TransferRequest{SenderID: 1, ReceiverID: 2, Amount: 150, IdempotencyKey: mock.IdempotencyKeyTestDef}
+
+	resp, err := wallet.Transfer(context.Background(), req)
+	require.NoError(t, err)
+	assert.False(t, resp.Operation.Success, "without RetryFailed the failed transaction is returned as it is")
+	assert.Nil(t, transferred)
+
+	req.RetryFailed = true
+	resp, err = wallet.Transfer(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, resp.Operation.Success)
+	require.NotNil(t, transferred)
+	assert.Equal(t, uint(10), transferred.ID)
+	assert.Equal(t, 100.0, transferred.Amount, "the amount recorded by the first attempt is paid")
+}
+
+func TestWallet_TransferNotify(t *testing.T) {
+	sender, receiver := "Alice", "Bob"
+	mockStore := &mock.MockStoreWallet{
+		ExsistIdempotencyKeyFunc: func(ctx context.Context, uuid string) (bool, error) { return false, nil },
+		ExsistUserFunc:           func(ctx context.Context, id uint) (bool, error) { return true, nil },
+		TransactionCreateFunc: func(ctx context.Context, data *models.Transaction) error {
+			data.ID = 10
+			return nil
+		},
+		TransferFunc: func(ctx context.Context, req *models.Transaction) error {
+			return ErrInsufficientFunds
+		},
+		OutboxAddFunc: func(ctx context.Context, event *models.Event) error { return nil },
+		TransactionGetFunc: func(ctx context.Context, idempotencyKey string) (*models.Transaction, error) {
+			return &models.Transaction{ID: 10, SenderName: &sender, ReceiverName: &receiver, TypeOperation: "transfer"}, nil
+		},
+	}
+
+	broker := NewBroker(logs.NewDiscardLogger())
+	sub, _, _ := broker.Subscribe(2, "")
+	defer sub.Close()
+
+	wallet := New(logs.NewDiscardLogger(), mockStore, metrics.New(), config.NewSettings(config.Runtime{}), broker)
+
+	_, err := wallet.Transfer(context.Background(), &models.TransferRequest{SenderID: 1, ReceiverID: 2, Amount: 500, IdempotencyKey: mock.IdempotencyKeyTestDef})
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+
+	events := receive(sub)
+	require.Len(t, events, 1, "the receiver is told about the failed transfer too")
+	operation := events[0].Operation
+	assert.Equal(t, uint(10), operation.ID)
+	assert.False(t, operation.Success)
+	assert.Equal(t, &sender, operation.SenderName)
+	assert.Equal(t, &receiver, operation.ReceiverName)
+}
+
+func TestWallet_Limits(t *testing.T) {
+	mockStore := &mock.MockStoreWallet{
+		ExsistIdempotencyKeyFunc: func(ctx context.Context, uuid string) (bool, error) { return false, nil },
+		ExsistUserFunc:           func(ctx context.Context, id uint) (bool, error) { return true, nil },
+		TransactionCreateFunc:    func(ctx context.Context, data *models.Transaction) error { return nil },
+		DepositFunc:              func(ctx context.Context, req *models.DepositRequest) error { return nil },
+		TransferFunc:             func(ctx context.Context, req *models.Transaction) error { return nil },
+		OutboxAddFunc:            func(ctx context.Context, event *models.Event) error { return nil },
+	}
+
+	settings := config.NewSettings(config.Runtime{DepositLimit: 1000, TransferLimit: 100})
+	wallet := New(logs.NewDiscardLogger(), mockStore, metrics.New(), settings, nil)
+
+	deposit := func(amount float64) error {
+		_, err := wallet.Deposit(context.Background(), &models.DepositRequest{UserID: 1, Amount: amount, IdempotencyKey: mock.IdempotencyKeyTestDef})
+		return err
+	}
+	transfer := func(amount float64) error {
+		_, err := wallet.Transfer(context.Background(), &models.TransferRequest{SenderID: 1, ReceiverID: 2, Amount: amount, IdempotencyKey: mock.IdempotencyKeyTestDef})
+		return err
+	}
+
+	assert.NoError(t, deposit(1000))
+	assert.ErrorIs(t, deposit(1000.01), ErrLimitExceeded)
+	assert.NoError(t, transfer(100))
+	assert.ErrorIs(t, transfer(150), ErrLimitExceeded)
+
+	// a reload replaces the settings, the next call uses the new limits
+	settings.Store(config.Runtime{TransferLimit: 200})
+	assert.NoError(t, transfer(150))
+	assert.NoError(t, deposit(5000), "zero limit means no limit")
+}
+
+func TestWallet_ReadOnly(t *testing.T) {
+	var replay bool
+	mockStore := &mock.MockStoreWallet{
+		ExsistIdempotencyKeyFunc: func(ctx context.Context, uuid string) (bool, error) { return replay, nil },
+		TransactionGetFunc: func(ctx context.Context, idempotencyKey string) (*models.Transaction, error) {
+			return &models.Transaction{IdempotencyKey: idempotencyKey, Success: true}, nil
+		},
+		TransferBatchGetFunc: func(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+			return nil, storages.ErrBatchNotFound
+		},
+	}
+
+	settings := config.NewSettings(config.Runtime{})
+	settings.SetReadOnly(true)
+	wallet := New(logs.NewDiscardLogger(), mockStore, metrics.New(), settings, nil)
+
+	_, err := wallet.Deposit(context.Background(), &models.DepositRequest{UserID: 1, Amount: 10, IdempotencyKey: mock.IdempotencyKeyTestDef})
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = wallet.Transfer(context.Background(), &models.TransferRequest{SenderID: 1, ReceiverID: 2, Amount: 10, IdempotencyKey: mock.IdempotencyKeyTestDef})
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	_, err = wallet.TransferBatch(context.Background(), &models.TransferBatchRequest{
+		IdempotencyKey: mock.IdempotencyKeyTestDef,
+		SenderID:       1,
+		Mode:           BatchModeAtomic,
+		Items:          []*models.TransferBatchItem{{ReceiverID: 2, Amount: 10}},
+	})
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	// the result of an operation made before the mode was turned on is still returned
+	replay = true
+	resp, err := wallet.Transfer(context.Background(), &models.TransferRequest{SenderID: 1, ReceiverID: 2, Amount: 10, IdempotencyKey: mock.IdempotencyKeyTestDef})
+	assert.NoError(t, err)
+	assert.True(t, resp.Operation.Success)
+}
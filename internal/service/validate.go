@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+)
+
+// The errors wrap storages.ErrUserNotFound, so the code that only needs to know that some user is missing keeps working
+var (
+	ErrSenderNotFound   = fmt.Errorf("sender: %w", storages.ErrUserNotFound)
+	ErrReceiverNotFound = fmt.Errorf("receiver: %w", storages.ErrUserNotFound)
+)
+
+type userChecker interface {
+	ExsistUser(ctx context.Context, id uint) (bool, error)
+}
+
+// validateTransfer checks the participants of a money transfer before anything is written to the database.
+// A transfer to self is rejected without a database query, then the existence of the sender and the receiver is checked.
+// The storage cannot give such errors on its own: a missing receiver would fail on the foreign key, and a transfer to self
+// on the check constraint, both as an internal error.
+func validateTransfer(ctx context.Context, db userChecker, senderID, receiverID uint) error {
+	if senderID == receiverID {
+		return ErrSelfTransfer
+	}
+
+	if err := validateSender(ctx, db, senderID); err != nil {
+		return err
+	}
+
+	return validateReceiver(ctx, db, receiverID)
+}
+
+func validateSender(ctx context.Context, db userChecker, senderID uint) error {
+	exsist, err := db.ExsistUser(ctx, senderID)
+	if err != nil {
+		return err
+	}
+
+	if !exsist {
+		return ErrSenderNotFound
+	}
+
+	return nil
+}
+
+func validateReceiver(ctx context.Context, db userChecker, receiverID uint) error {
+	exsist, err := db.ExsistUser(ctx, receiverID)
+	if err != nil {
+		return err
+	}
+
+	if !exsist {
+		return ErrReceiverNotFound
+	}
+
+	return nil
+}
+
+// validateAmount checks the amount of one operation against the limit from the runtime settings, zero limit means no limit
+func validateAmount(amount, limit float64) error {
+	if limit > 0 && amount > limit {
+		return ErrLimitExceeded
+	}
+
+	return nil
+}
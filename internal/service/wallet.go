@@ -1,36 +1,157 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
 
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
 	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	ErrInsufficientFunds = errors.New("insufficient account balance")
-	ErrNegaticeBalance = errors.New("negative balance")
+	ErrNegaticeBalance   = errors.New("negative balance")
+	ErrSelfTransfer      = errors.New("sender and receiver are the same user")
+	ErrLimitExceeded     = errors.New("amount exceeds the limit of one operation")
+	ErrReadOnly          = errors.New("money movement is stopped by the read-only mode")
+	ErrStopped           = errors.New("wallet service is stopped")
 )
 
+// tracer makes the spans of the Wallet methods. It takes the current global TracerProvider set up by the tracing
+// package on every call, so a provider replaced later (e.g. in tests) is used as well.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/EvansTrein/iqProgers/internal/service")
+}
+
+// walletMetrics receives the business events of the Wallet, amounts are in cents
+type walletMetrics interface {
+	DepositAmount(cents int64)
+	TransferAmount(cents int64)
+	DomainError(kind string)
+}
+
+// walletSettings gives the current runtime settings, they can change between two calls after a config reload
+type walletSettings interface {
+	Runtime() *config.Runtime
+	ReadOnly() bool
+}
+
+// walletOperations gets the committed operations of the users, e.g. the Broker of the SSE streams
+type walletOperations interface {
+	Watched(userIDs ...uint) bool
+	Publish(operation *models.Transaction)
+}
+
 type Wallet struct {
-	log *slog.Logger
-	db  storages.StoreWallet
+	log        *slog.Logger
+	db         storages.StoreWallet
+	metrics    walletMetrics
+	settings   walletSettings
+	operations walletOperations
+
+	// mu guards stopped, so no call is added to inflight after Stop started to wait for it
+	mu       sync.Mutex
+	stopped  bool
+	inflight sync.WaitGroup
 }
 
-func New(log *slog.Logger, db storages.StoreWallet) *Wallet {
+// New creates the Wallet. The committed operations are sent to operations, it may be nil if nobody needs them.
+func New(log *slog.Logger, db storages.StoreWallet, metrics walletMetrics, settings walletSettings, operations walletOperations) *Wallet {
 	log.Debug("service Wallet: started creating")
 
 	log.Info("service Wallet: successfully created")
 	return &Wallet{
-		log: log,
-		db:  db,
+		log:        log,
+		db:         db,
+		metrics:    metrics,
+		settings:   settings,
+		operations: operations,
+	}
+}
+
+// notify sends a copy of the committed operation to the subscribers of its users. If somebody is subscribed and
+// the names of the users are not known (a failed transfer or an item of a batch), they are read from the storage,
+// so the operation looks the same as in the history of the user.
+func (w *Wallet) notify(ctx context.Context, data *models.Transaction) {
+	if w.operations == nil || !w.operations.Watched(data.SenderID, data.ReceiverID) {
+		return
 	}
+
+	operation := *data
+	if operation.TypeOperation != "deposit" && operation.SenderName == nil {
+		saved, err := w.db.TransactionGet(context.WithoutCancel(ctx), operation.IdempotencyKey)
+		if err != nil {
+			w.log.ErrorContext(ctx, "service Wallet: failed to get the operation for the subscribers", "error", err)
+		} else {
+			operation.SenderName = saved.SenderName
+			operation.ReceiverName = saved.ReceiverName
+			operation.Date = saved.Date
+		}
+	}
+
+	w.operations.Publish(&operation)
 }
 
-func (w *Wallet) Stop() error {
+// checkWritable returns ErrReadOnly while the read-only mode is on. It is checked by every operation that moves
+// money before anything is written, the replay of an existing operation is still answered.
+func (w *Wallet) checkWritable() error {
+	if w.settings.ReadOnly() {
+		return ErrReadOnly
+	}
+
+	return nil
+}
+
+// countError counts the domain errors, the other errors are not counted
+func (w *Wallet) countError(err error) {
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		w.metrics.DomainError(metrics.ErrorInsufficientFunds)
+	case errors.Is(err, storages.ErrUserNotFound):
+		w.metrics.DomainError(metrics.ErrorUserNotFound)
+	}
+}
+
+// track registers a call in progress, Stop waits until done is called. After Stop the calls get ErrStopped.
+func (w *Wallet) track() (done func(), err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		return nil, ErrStopped
+	}
+
+	w.inflight.Add(1)
+	return w.inflight.Done, nil
+}
+
+// Stop rejects the new calls and waits until the calls in progress are finished, so the storage can be closed
+// after it. If ctx ends first, its error is returned and the calls are still running, the storage must stay open.
+func (w *Wallet) Stop(ctx context.Context) error {
 	w.log.Debug("service Wallet: stop started")
 
-	w.db = nil
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		w.inflight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return fmt.Errorf("calls in progress are not finished: %w", ctx.Err())
+	}
 
 	w.log.Info("service Wallet: stop successful")
 	return nil
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/metrics"
+	"github.com/EvansTrein/iqProgers/internal/service/mock"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWallet_Stop(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	mockStore := &mock.MockStoreWallet{
+		ExsistIdempotencyKeyFunc: func(ctx context.Context, uuid string) (bool, error) { return false, nil },
+		ExsistUserFunc:           func(ctx context.Context, id uint) (bool, error) { return true, nil },
+		TransactionCreateFunc:    func(ctx context.Context, data *models.Transaction) error { return nil },
+		TransferFunc: func(ctx context.Context, req *models.Transaction) error {
+			close(entered)
+			<-release
+			return nil
+		},
+	}
+
+	wallet := New(logs.NewDiscardLogger(), mockStore, metrics.New(), config.NewSettings(config.Runtime{}), nil)
+
+	transferErr := make(chan error, 1)
+	go func() {
+		_, err := wallet.Transfer(context.Background(), &models.TransferRequest{SenderID: 1, ReceiverID: 2, Amount: 10, IdempotencyKey: mock.IdempotencyKeyTestDef})
+		transferErr <- err
+	}()
+	<-entered
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- wallet.Stop(context.Background())
+	}()
+
+	// the new calls are rejected while the call in progress is still running
+	require.Eventually(t, func() bool {
+		_, err := wallet.Deposit(context.Background(), &models.DepositRequest{UserID: 1, Amount: 10, IdempotencyKey: mock.IdempotencyKeyTestDef})
+		return err == ErrStopped
+	}, time.Second, time.Millisecond*10)
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the transfer in progress finished")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(release)
+	require.NoError(t, <-transferErr)
+	require.NoError(t, <-stopped)
+
+	_, err := wallet.UserOperations(context.Background(), &models.UserOperationsRequest{UserID: 1})
+	assert.ErrorIs(t, err, ErrStopped)
+}
+
+func TestWallet_StopTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	entered := make(chan struct{})
+	mockStore := &mock.MockStoreWallet{
+		ExsistUserFunc: func(ctx context.Context, id uint) (bool, error) {
+			close(entered)
+			<-release
+			return false, nil
+		},
+	}
+
+	wallet := New(logs.NewDiscardLogger(), mockStore, metrics.New(), config.NewSettings(config.Runtime{}), nil)
+
+	go wallet.UserOperations(context.Background(), &models.UserOperationsRequest{UserID: 1})
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	assert.ErrorIs(t, wallet.Stop(ctx), context.DeadlineExceeded)
+}
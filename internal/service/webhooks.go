@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+const (
+	webhookBatchSize     = 100
+	webhookHistoryLimit  = 100
+	webhookSecretBytes   = 32
+	webhookMaxErrorBytes = 512
+)
+
+// Headers of the webhook requests. The signature is t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">,
+// the key is the secret of the subscription.
+const (
+	HeaderWebhookID        = "X-Webhook-ID"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookDelivery  = "X-Webhook-Delivery"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+// Webhooks keeps the subscriptions to the events and delivers the events to them. Publish saves a delivery for every
+// subscription of the event, the goroutine started by Start sends the due deliveries and retries the failed ones
+// with backoff, so an event is not lost if the receiver is down or the application is restarted.
+type Webhooks struct {
+	log    *slog.Logger
+	db     storages.StoreWebhook
+	conf   *config.Webhooks
+	client *http.Client
+	now    func() time.Time
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewWebhooks(log *slog.Logger, db storages.StoreWebhook, conf *config.Webhooks) *Webhooks {
+	log.Debug("service Webhooks: started creating")
+
+	log.Info("service Webhooks: successfully created")
+	return &Webhooks{
+		log:    log,
+		db:     db,
+		conf:   conf,
+		client: &http.Client{Timeout: conf.Timeout},
+		now:    time.Now,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// WebhookCreate subscribes the URL to the events of the user, or of all users if the user is not set.
+// If the secret is not given, a random one is generated. The secret is returned only here.
+func (s *Webhooks) WebhookCreate(ctx context.Context, req *models.WebhookRequest) (*models.WebhookResponse, error) {
+	op := "service Webhooks: webhook create request received"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookCreate func call", "user id", req.UserID, "url", req.URL)
+
+	if req.UserID != nil {
+		exsistUser, err := s.db.ExsistUser(ctx, *req.UserID)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to check if the user exists in the database", "error", err)
+			return nil, err
+		}
+
+		if !exsistUser {
+			log.WarnContext(ctx, "user not found", "id", *req.UserID)
+			return nil, storages.ErrUserNotFound
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(buf); err != nil {
+			log.ErrorContext(ctx, "failed to generate the secret", "error", err)
+			return nil, err
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	data := models.Webhook{
+		UserID: req.UserID,
+		URL:    req.URL,
+		Secret: secret,
+	}
+
+	if err := s.db.WebhookCreate(ctx, &data); err != nil {
+		log.ErrorContext(ctx, "failed to create a webhook", "error", err)
+		return nil, err
+	}
+
+	resp := models.WebhookResponse{
+		Message: "webhook successfully created",
+		Webhook: &data,
+	}
+
+	log.InfoContext(ctx, "webhook successfully created", "id", data.ID)
+	return &resp, nil
+}
+
+// WebhookGet returns a subscription without its secret.
+func (s *Webhooks) WebhookGet(ctx context.Context, id uint) (*models.WebhookResponse, error) {
+	op := "service Webhooks: webhook get request received"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookGet func call", "id", id)
+
+	data, err := s.db.WebhookGet(ctx, id)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve the webhook", "error", err)
+		return nil, err
+	}
+	data.Secret = ""
+
+	resp := models.WebhookResponse{
+		Message: "webhook successfully received",
+		Webhook: data,
+	}
+
+	log.InfoContext(ctx, "webhook successfully received")
+	return &resp, nil
+}
+
+// WebhookDelete deletes a subscription, its deliveries that are not sent yet are not sent anymore.
+func (s *Webhooks) WebhookDelete(ctx context.Context, id uint) error {
+	op := "service Webhooks: webhook delete request received"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookDelete func call", "id", id)
+
+	if err := s.db.WebhookDelete(ctx, id); err != nil {
+		log.ErrorContext(ctx, "failed to delete the webhook", "error", err)
+		return err
+	}
+
+	log.InfoContext(ctx, "webhook successfully deleted")
+	return nil
+}
+
+// WebhookDeliveries returns the last deliveries of a subscription, the newest first.
+func (s *Webhooks) WebhookDeliveries(ctx context.Context, id uint) (*models.WebhookDeliveriesResponse, error) {
+	op := "service Webhooks: webhook deliveries request received"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookDeliveries func call", "id", id)
+
+	if _, err := s.db.WebhookGet(ctx, id); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve the webhook", "error", err)
+		return nil, err
+	}
+
+	deliveries, err := s.db.DeliveriesGet(ctx, id, webhookHistoryLimit)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve the webhook deliveries", "error", err)
+		return nil, err
+	}
+
+	resp := models.WebhookDeliveriesResponse{
+		Message:    "webhook deliveries successfully received",
+		Deliveries: deliveries,
+	}
+
+	log.InfoContext(ctx, "webhook deliveries successfully received", "count", len(deliveries))
+	return &resp, nil
+}
+
+// Publish saves a delivery of the event for the subscriptions of its users and the global subscriptions.
+// The deliveries are sent by the goroutine started by Start, it is woken up at once.
+func (s *Webhooks) Publish(ctx context.Context, event *models.Event) error {
+	op := "service Webhooks: publish event"
+	log := s.log.With(slog.String("operation", op), slog.String("event id", event.ID))
+	log.DebugContext(ctx, "Publish func call", "type", event.Type)
+
+	var users []uint
+	for _, id := range []uint{event.Data.UserID, event.Data.SenderID, event.Data.ReceiverID} {
+		if id != 0 {
+			users = append(users, id)
+		}
+	}
+
+	hooks, err := s.db.WebhooksFor(ctx, users)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve the webhooks of the event", "error", err)
+		return err
+	}
+
+	if len(hooks) == 0 {
+		log.DebugContext(ctx, "no webhooks for the event")
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to encode the event", "error", err)
+		return err
+	}
+
+	now := s.now()
+	deliveries := make([]*models.WebhookDelivery, 0, len(hooks))
+	for _, hook := range hooks {
+		deliveries = append(deliveries, &models.WebhookDelivery{
+			WebhookID:   hook.ID,
+			EventID:     event.ID,
+			EventType:   event.Type,
+			Payload:     payload,
+			Status:      storages.DeliveryPending,
+			NextAttempt: now,
+		})
+	}
+
+	if err := s.db.DeliveriesCreate(ctx, deliveries); err != nil {
+		log.ErrorContext(ctx, "failed to save the webhook deliveries", "error", err)
+		return err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	log.InfoContext(ctx, "event published", "webhooks", len(hooks))
+	return nil
+}
+
+// Start launches the delivery goroutine. Due deliveries are sent immediately, then every WEBHOOK_INTERVAL and
+// after every published event until Stop is called.
+func (s *Webhooks) Start() {
+	s.log.Debug("service Webhooks: started")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.conf.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.RunDue(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				s.log.ErrorContext(ctx, "service Webhooks: failed to send due deliveries", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+
+	s.log.Info("service Webhooks: successfully started", "interval", s.conf.Interval)
+}
+
+// Stop cancels the delivery goroutine and waits until it is finished. A request in progress is cancelled,
+// it is not counted as an attempt and is sent again after the restart.
+func (s *Webhooks) Stop() error {
+	s.log.Debug("service Webhooks: stop started")
+
+	if s.cancel == nil {
+		return fmt.Errorf("webhooks delivery is not running")
+	}
+
+	s.cancel()
+	<-s.done
+
+	s.cancel = nil
+	s.done = nil
+
+	s.log.Info("service Webhooks: stop successful")
+	return nil
+}
+
+// RunDue sends all deliveries whose next attempt has come. A failed delivery does not stop the others.
+func (s *Webhooks) RunDue(ctx context.Context) error {
+	op := "service Webhooks: send due deliveries"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "RunDue func call")
+
+	due, err := s.db.DeliveriesDue(ctx, s.now(), webhookBatchSize)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve due webhook deliveries", "error", err)
+		return err
+	}
+
+	hooks := make(map[uint]*models.Webhook)
+	for _, item := range due {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hook, ok := hooks[item.WebhookID]
+		if !ok {
+			hook, err = s.db.WebhookGet(ctx, item.WebhookID)
+			if errors.Is(err, storages.ErrWebhookNotFound) {
+				log.WarnContext(ctx, "webhook of the delivery is deleted", "delivery id", item.ID)
+				continue
+			}
+			if err != nil {
+				log.ErrorContext(ctx, "failed to retrieve the webhook of the delivery", "error", err)
+				return err
+			}
+			hooks[item.WebhookID] = hook
+		}
+
+		if err := s.deliver(ctx, hook, item); err != nil {
+			log.ErrorContext(ctx, "failed to deliver the event", "delivery id", item.ID, "error", err)
+		}
+	}
+
+	log.InfoContext(ctx, "due webhook deliveries processed", "count", len(due))
+	return nil
+}
+
+// deliver makes one attempt to send the delivery and saves its result. A 2xx answer means the event is delivered,
+// otherwise the delivery is retried with backoff until WEBHOOK_MAX_ATTEMPTS attempts are made, then it is dead.
+func (s *Webhooks) deliver(ctx context.Context, hook *models.Webhook, item *models.WebhookDelivery) error {
+	op := "service Webhooks: deliver event"
+	log := s.log.With(slog.String("operation", op), slog.Any("delivery id", item.ID), slog.String("event id", item.EventID))
+	log.DebugContext(ctx, "deliver func call", "attempt", item.Attempts+1)
+
+	status, sendErr := s.send(ctx, hook, item)
+	if ctx.Err() != nil {
+		// the application is stopping, the attempt did not really happen
+		return ctx.Err()
+	}
+
+	item.Attempts++
+	if status != 0 {
+		item.ResponseStatus = &status
+	}
+
+	if sendErr == nil {
+		deliveredAt := s.now()
+		item.Status = storages.DeliveryDelivered
+		item.DeliveredAt = &deliveredAt
+		item.LastError = nil
+		log.InfoContext(ctx, "event delivered", "status", status)
+	} else {
+		msg := sendErr.Error()
+		item.LastError = &msg
+
+		if item.Attempts >= s.conf.MaxAttempts {
+			item.Status = storages.DeliveryDead
+			log.ErrorContext(ctx, "event is not delivered, attempts are over", "error", sendErr)
+		} else {
+			item.NextAttempt = s.now().Add(s.backoff(item.Attempts))
+			log.WarnContext(ctx, "event is not delivered, it will be retried", "next attempt", item.NextAttempt, "error", sendErr)
+		}
+	}
+
+	if err := s.db.DeliverySave(ctx, item); err != nil {
+		log.ErrorContext(ctx, "failed to save the webhook delivery", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// send posts the signed payload to the webhook and returns the status of the answer, 0 if there is no answer
+func (s *Webhooks) send(ctx context.Context, hook *models.Webhook, item *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(item.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := s.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookID, item.EventID)
+	req.Header.Set(HeaderWebhookEvent, item.EventType)
+	req.Header.Set(HeaderWebhookDelivery, strconv.FormatUint(uint64(item.ID), 10))
+	req.Header.Set(HeaderWebhookSignature, "t="+strconv.FormatInt(timestamp, 10)+",v1="+Signature(hook.Secret, timestamp, item.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxErrorBytes))
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+
+	// the body is read, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxErrorBytes))
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt, it doubles with each failed attempt up to WEBHOOK_BACKOFF_MAX
+func (s *Webhooks) backoff(attempts int) time.Duration {
+	delay := s.conf.BackoffStart
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= s.conf.BackoffMax {
+			return s.conf.BackoffMax
+		}
+	}
+
+	return min(delay, s.conf.BackoffMax)
+}
+
+// Signature returns the hex HMAC-SHA256 of "<timestamp>.<body>" with the secret, the v1 value of X-Webhook-Signature.
+// A receiver computes it the same way and compares, it also checks that the timestamp is recent.
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
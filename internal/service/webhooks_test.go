@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/service/mock"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	webhookSecretTest = "0123456789abcdef0123456789abcdef"
+	transferKeyTest   = "b8a1f1f4-3c4e-4f0a-9d1e-6a7b8c9d0e1f"
+)
+
+func testWebhooksConfig() *config.Webhooks {
+	return &config.Webhooks{
+		Interval:     time.Second * 5,
+		Timeout:      time.Second * 5,
+		MaxAttempts:  3,
+		BackoffStart: time.Second * 10,
+		BackoffMax:   time.Second * 30,
+	}
+}
+
+// receivedWebhook is a request that came to the test receiver
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver is a local receiver that answers with the statuses one by one, the last status is repeated
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	received []receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) (*webhookReceiver, *httptest.Server) {
+	t.Helper()
+
+	r := &webhookReceiver{statuses: statuses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.received = append(r.received, receivedWebhook{header: req.Header.Clone(), body: body})
+		status := r.statuses[0]
+		if len(r.statuses) > 1 {
+			r.statuses = r.statuses[1:]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte("answer of the receiver"))
+	}))
+	t.Cleanup(srv.Close)
+
+	return r, srv
+}
+
+// verifySignature checks X-Webhook-Signature the way a receiver does it
+func verifySignature(t *testing.T, secret string, got receivedWebhook) {
+	t.Helper()
+
+	parts := strings.Split(got.header.Get(HeaderWebhookSignature), ",")
+	require.Len(t, parts, 2)
+	require.True(t, strings.HasPrefix(parts[0], "t="))
+	require.True(t, strings.HasPrefix(parts[1], "v1="))
+
+	timestamp, err := strconv.ParseInt(strings.TrimPrefix(parts[0], "t="), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Signature(secret, timestamp, got.body), strings.TrimPrefix(parts[1], "v1="))
+}
+
+func TestWebhooks_Publish(t *testing.T) {
+	var created []*models.WebhookDelivery
+	var users []uint
+	mockStore := &mock.MockStoreWebhook{
+		WebhooksForFunc: func(ctx context.Context, userIDs []uint) ([]*models.Webhook, error) {
+			users = userIDs
+			return []*models.Webhook{{ID: 1}, {ID: 2}}, nil
+		},
+		DeliveriesCreateFunc: func(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+			created = deliveries
+			return nil
+		},
+	}
+
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	webhooks := NewWebhooks(logs.NewDiscardLogger(), mockStore, testWebhooksConfig())
+	webhooks.now = func() time.Time { return now }
+
+	event := NewEvent(EventTransferCompleted, &models.EventData{IdempotencyKey: mock.IdempotencyKeyTestDef, SenderID: 1, ReceiverID: 2, Amount: 10})
+	require.NoError(t, webhooks.Publish(context.Background(), event))
+
+	assert.Equal(t, []uint{1, 2}, users)
+	require.Len(t, created, 2)
+	for i, item := range created {
+		assert.Equal(t, uint(i+1), item.WebhookID)
+		assert.Equal(t, event.ID, item.EventID)
+		assert.Equal(t, EventTransferCompleted, item.EventType)
+		assert.Equal(t, storages.DeliveryPending, item.Status)
+		assert.Equal(t, now, item.NextAttempt)
+
+		var payload models.Event
+		require.NoError(t, json.Unmarshal(item.Payload, &payload))
+		assert.Equal(t, *event.Data, *payload.Data)
+	}
+
+	select {
+	case <-webhooks.wake:
+	default:
+		t.Fatal("the delivery goroutine is not woken up")
+	}
+
+	t.Run("same event has the same id", func(t *testing.T) {
+		again := NewEvent(EventTransferCompleted, &models.EventData{IdempotencyKey: mock.IdempotencyKeyTestDef})
+		assert.Equal(t, event.ID, again.ID)
+
+		failed := NewEvent(EventTransferFailed, &models.EventData{IdempotencyKey: mock.IdempotencyKeyTestDef})
+		assert.NotEqual(t, event.ID, failed.ID)
+	})
+
+	t.Run("no webhooks", func(t *testing.T) {
+		created = nil
+		mockStore.WebhooksForFunc = func(ctx context.Context, userIDs []uint) ([]*models.Webhook, error) {
+			return nil, nil
+		}
+
+		require.NoError(t, webhooks.Publish(context.Background(), event))
+		assert.Nil(t, created)
+	})
+}
+
+func TestWebhooks_RunDue(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		status        int
+		attempts      int
+		expectedState models.WebhookDelivery
+	}{
+		{
+			name:          "delivered",
+			status:        http.StatusNoContent,
+			expectedState: models.WebhookDelivery{Status: storages.DeliveryDelivered, Attempts: 1, NextAttempt: now},
+		},
+		{
+			name:          "failed delivery is retried with backoff",
+			status:        http.StatusInternalServerError,
+			attempts:      1,
+			expectedState: models.WebhookDelivery{Status: storages.DeliveryPending, Attempts: 2, NextAttempt: now.Add(time.Second * 20)},
+		},
+		{
+			name:          "dead after the last attempt",
+			status:        http.StatusGone,
+			attempts:      2,
+			expectedState: models.WebhookDelivery{Status: storages.DeliveryDead, Attempts: 3, NextAttempt: now},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver, srv := newWebhookReceiver(t, tt.status)
+			payload := []byte(`{"id":"event","type":"deposit.completed"}`)
+
+			var saved *models.WebhookDelivery
+			mockStore := &mock.MockStoreWebhook{
+				DeliveriesDueFunc: func(ctx context.Context, due time.Time, limit int) ([]*models.WebhookDelivery, error) {
+					assert.Equal(t, now, due)
+					return []*models.WebhookDelivery{{
+						ID: 9, WebhookID: 1, EventID: "event", EventType: EventDepositCompleted, Payload: payload,
+						Status: storages.DeliveryPending, Attempts: tt.attempts, NextAttempt: now,
+					}}, nil
+				},
+				WebhookGetFunc: func(ctx context.Context, id uint) (*models.Webhook, error) {
+					return &models.Webhook{ID: id, URL: srv.URL, Secret: webhookSecretTest}, nil
+				},
+				DeliverySaveFunc: func(ctx context.Context, data *models.WebhookDelivery) error {
+					saved = data
+					return nil
+				},
+			}
+
+			webhooks := NewWebhooks(logs.NewDiscardLogger(), mockStore, testWebhooksConfig())
+			webhooks.now = func() time.Time { return now }
+
+			require.NoError(t, webhooks.RunDue(context.Background()))
+
+			require.Len(t, receiver.received, 1)
+			got := receiver.received[0]
+			assert.Equal(t, payload, got.body)
+			assert.Equal(t, "application/json", got.header.Get("Content-Type"))
+			assert.Equal(t, "event", got.header.Get(HeaderWebhookID))
+			assert.Equal(t, EventDepositCompleted, got.header.Get(HeaderWebhookEvent))
+			assert.Equal(t, "9", got.header.Get(HeaderWebhookDelivery))
+			verifySignature(t, webhookSecretTest, got)
+
+			require.NotNil(t, saved)
+			assert.Equal(t, tt.expectedState.Status, saved.Status)
+			assert.Equal(t, tt.expectedState.Attempts, saved.Attempts)
+			assert.Equal(t, tt.expectedState.NextAttempt, saved.NextAttempt)
+			assert.Equal(t, &tt.status, saved.ResponseStatus)
+
+			if tt.expectedState.Status == storages.DeliveryDelivered {
+				assert.Nil(t, saved.LastError)
+				assert.Equal(t, &now, saved.DeliveredAt)
+			} else {
+				require.NotNil(t, saved.LastError)
+				assert.Contains(t, *saved.LastError, "unexpected status "+strconv.Itoa(tt.status))
+				assert.Nil(t, saved.DeliveredAt)
+			}
+		})
+	}
+}
+
+func TestWebhooks_RunDueErrors(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	t.Run("receiver is down", func(t *testing.T) {
+		_, srv := newWebhookReceiver(t, http.StatusOK)
+		srv.Close()
+
+		var saved *models.WebhookDelivery
+		mockStore := &mock.MockStoreWebhook{
+			DeliveriesDueFunc: func(ctx context.Context, due time.Time, limit int) ([]*models.WebhookDelivery, error) {
+				return []*models.WebhookDelivery{{ID: 1, WebhookID: 1, Status: storages.DeliveryPending}}, nil
+			},
+			WebhookGetFunc: func(ctx context.Context, id uint) (*models.Webhook, error) {
+				return &models.Webhook{ID: id, URL: srv.URL, Secret: webhookSecretTest}, nil
+			},
+			DeliverySaveFunc: func(ctx context.Context, data *models.WebhookDelivery) error {
+				saved = data
+				return nil
+			},
+		}
+
+		webhooks := NewWebhooks(logs.NewDiscardLogger(), mockStore, testWebhooksConfig())
+		webhooks.now = func() time.Time { return now }
+
+		require.NoError(t, webhooks.RunDue(context.Background()))
+		require.NotNil(t, saved)
+		assert.Equal(t, storages.DeliveryPending, saved.Status)
+		assert.Equal(t, 1, saved.Attempts)
+		assert.Equal(t, now.Add(time.Second*10), saved.NextAttempt)
+		assert.Nil(t, saved.ResponseStatus)
+		assert.NotNil(t, saved.LastError)
+	})
+
+	t.Run("deleted webhook is skipped", func(t *testing.T) {
+		receiver, srv := newWebhookReceiver(t, http.StatusOK)
+
+		var saved []uint
+		gets := 0
+		mockStore := &mock.MockStoreWebhook{
+			DeliveriesDueFunc: func(ctx context.Context, due time.Time, limit int) ([]*models.WebhookDelivery, error) {
+				return []*models.WebhookDelivery{{ID: 1, WebhookID: 1}, {ID: 2, WebhookID: 2}, {ID: 3, WebhookID: 2}}, nil
+			},
+			WebhookGetFunc: func(ctx context.Context, id uint) (*models.Webhook, error) {
+				gets++
+				if id == 1 {
+					return nil, storages.ErrWebhookNotFound
+				}
+				return &models.Webhook{ID: id, URL: srv.URL, Secret: webhookSecretTest}, nil
+			},
+			DeliverySaveFunc: func(ctx context.Context, data *models.WebhookDelivery) error {
+				saved = append(saved, data.ID)
+				return nil
+			},
+		}
+
+		webhooks := NewWebhooks(logs.NewDiscardLogger(), mockStore, testWebhooksConfig())
+		require.NoError(t, webhooks.RunDue(context.Background()))
+
+		assert.Equal(t, []uint{2, 3}, saved)
+		assert.Len(t, receiver.received, 2)
+		assert.Equal(t, 2, gets, "the webhook is retrieved once per run")
+	})
+}
+
+func TestWebhooks_Backoff(t *testing.T) {
+	webhooks := NewWebhooks(logs.NewDiscardLogger(), &mock.MockStoreWebhook{}, &config.Webhooks{BackoffStart: time.Second * 10, BackoffMax: time.Minute})
+
+	expected := []time.Duration{time.Second * 10, time.Second * 20, time.Second * 40, time.Minute, time.Minute}
+	for i, delay := range expected {
+		assert.Equal(t, delay, webhooks.backoff(i+1), "attempt %d", i+1)
+	}
+}
+
+// TestWebhooks_Delivery sends the events of the operations to a local receiver through the delivery goroutine
+func TestWebhooks_Delivery(t *testing.T) {
+	receiver, srv := newWebhookReceiver(t, http.StatusOK)
+
+	var mu sync.Mutex
+	var deliveries []*models.WebhookDelivery
+	hooks := []*models.Webhook{{ID: 1, URL: srv.URL, Secret: webhookSecretTest}}
+	webhookStore := &mock.MockStoreWebhook{
+		WebhooksForFunc: func(ctx context.Context, userIDs []uint) ([]*models.Webhook, error) {
+			return hooks, nil
+		},
+		WebhookGetFunc: func(ctx context.Context, id uint) (*models.Webhook, error) {
+			return hooks[0], nil
+		},
+		DeliveriesCreateFunc: func(ctx context.Context, items []*models.WebhookDelivery) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, item := range items {
+				item.ID = uint(len(deliveries) + 1)
+				deliveries = append(deliveries, item)
+			}
+			return nil
+		},
+		DeliveriesDueFunc: func(ctx context.Context, now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var due []*models.WebhookDelivery
+			for _, item := range deliveries {
+				if item.Status == storages.DeliveryPending && !item.NextAttempt.After(now) {
+					copied := *item
+					due = append(due, &copied)
+				}
+			}
+			return due, nil
+		},
+		DeliverySaveFunc: func(ctx context.Context, data *models.WebhookDelivery) error {
+			mu.Lock()
+			defer mu.Unlock()
+			deliveries[data.ID-1] = data
+			return nil
+		},
+	}
+
+	webhooks := NewWebhooks(logs.NewDiscardLogger(), webhookStore, &config.Webhooks{
+		Interval: time.Hour, Timeout: time.Second, MaxAttempts: 3, BackoffStart: time.Second, BackoffMax: time.Second,
+	})
+	webhooks.Start()
+	t.Cleanup(func() { require.NoError(t, webhooks.Stop()) })
+
+	deposit := DepositEvent(&models.DepositRequest{UserID: 1, Amount: 100, IdempotencyKey: mock.IdempotencyKeyTestDef}, 10)
+	transfer := TransferEvent(&models.Transaction{ID: 10, SenderID: 1, ReceiverID: 2, Amount: 500, IdempotencyKey: transferKeyTest}, ErrInsufficientFunds)
+	for _, event := range []*models.Event{deposit, transfer} {
+		require.NoError(t, webhooks.Publish(context.Background(), event))
+	}
+
+	require.Eventually(t, func() bool {
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		return len(receiver.received) == 2
+	}, time.Second*2, time.Millisecond*10)
+
+	events := make(map[string]models.Event)
+	for _, got := range receiver.received {
+		verifySignature(t, webhookSecretTest, got)
+
+		var event models.Event
+		require.NoError(t, json.Unmarshal(got.body, &event))
+		assert.Equal(t, event.ID, got.header.Get(HeaderWebhookID))
+		events[event.Type] = event
+	}
+
+	require.Contains(t, events, EventDepositCompleted)
+	assert.Equal(t, models.EventData{IdempotencyKey: mock.IdempotencyKeyTestDef, TransactionID: 10, UserID: 1, Amount: 100},
+		*events[EventDepositCompleted].Data)
+
+	require.Contains(t, events, EventTransferFailed)
+	assert.Equal(t, models.EventData{IdempotencyKey: transferKeyTest, TransactionID: 10, SenderID: 1, ReceiverID: 2,
+		Amount: 500, Reason: ReasonInsufficientFunds}, *events[EventTransferFailed].Data)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, item := range deliveries {
+			if item.Status != storages.DeliveryDelivered {
+				return false
+			}
+		}
+		return true
+	}, time.Second*2, time.Millisecond*10)
+}
+
+func TestFailReason(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{ErrInsufficientFunds, ReasonInsufficientFunds},
+		{fmt.Errorf("batch item: %w", ErrReceiverNotFound), ReasonReceiverNotFound},
+		{ErrSelfTransfer, ReasonSelfTransfer},
+		{ErrLimitExceeded, ReasonLimitExceeded},
+		{storages.ErrUnavailable, ReasonError},
+		{nil, ReasonError},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, failReason(tt.err), fmt.Sprint(tt.err))
+	}
+}
@@ -0,0 +1,39 @@
+package storages
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of storage errors. A driver translates its own errors into these, so the layers above
+// never have to know which database is used and never see the driver error text.
+var (
+	ErrDuplicate         = errors.New("record already exists")
+	ErrReferenceNotFound = errors.New("referenced record not found")
+	ErrConstraint        = errors.New("data violates a storage constraint")
+	ErrRetryable         = errors.New("storage conflict, the request can be retried")
+	ErrUnavailable       = errors.New("storage is unavailable")
+)
+
+// ErrIdempotencyKeyExists is the kind of a duplicate Idempotency-Key of an operation, errors.Is also reports it
+// as ErrDuplicate
+var ErrIdempotencyKeyExists = fmt.Errorf("idempotency key: %w", ErrDuplicate)
+
+// Error is a driver error classified into one of the kinds above. Its text is the text of the kind only,
+// while errors.Is and errors.As still see both the kind and the original driver error.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func NewError(kind, err error) *Error {
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
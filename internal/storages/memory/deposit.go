@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// Deposit adds the amount to the user's balance and marks the transaction with the request's Idempotency-Key as successful.
+// The deposit.completed event is written to the outbox as well. All changes are made under one lock, so they are seen together or not at all.
+func (s *MemoryDB) Deposit(ctx context.Context, req *models.DepositRequest) error {
+	op := "Database: account deposit"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "Deposit func call", "data", req)
+
+	amount, err := storages.ToCents(req.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", req.Amount)
+		return err
+	}
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return err
+	}
+	defer s.end()
+
+	u, ok := s.users[req.UserID]
+	if !ok {
+		log.WarnContext(ctx, "user not found", "id", req.UserID)
+		return storages.ErrUserNotFound
+	}
+
+	u.balance += amount
+	id := s.setResult(req.IdempotencyKey, true)
+	s.outboxAdd(services.DepositEvent(req, id))
+
+	log.InfoContext(ctx, "transaction successfully completed")
+	return nil
+}
+
+// setResult marks the transaction with the given Idempotency-Key and returns its ID, the storage must already be locked
+func (s *MemoryDB) setResult(idempotencyKey string, success bool) uint {
+	t, ok := s.byKey[idempotencyKey]
+	if !ok {
+		return 0
+	}
+
+	t.success = success
+	return t.id
+}
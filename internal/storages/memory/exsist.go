@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+)
+
+// ExsistIdempotencyKey checks if a transaction with the given idempotency key already exists.
+func (s *MemoryDB) ExsistIdempotencyKey(ctx context.Context, uuid string) (bool, error) {
+	op := "Database: Idempotency Key check"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ExsistIdempotencyKey func call", "uuid", uuid)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve data from the database", slog.Any("error", err))
+		return false, err
+	}
+	defer s.end()
+
+	_, exsist := s.byKey[uuid]
+
+	log.InfoContext(ctx, "Idempotency check of the key was successful")
+	return exsist, nil
+}
+
+// ExsistUser checks if a user with the specified ID exists.
+func (s *MemoryDB) ExsistUser(ctx context.Context, id uint) (bool, error) {
+	op := "Database: user check"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ExsistUser func call", "user id", id)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve data from the database", slog.Any("error", err))
+		return false, err
+	}
+	defer s.end()
+
+	_, exsist := s.users[id]
+
+	log.InfoContext(ctx, "user checked was successful")
+	return exsist, nil
+}
@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+)
+
+// Ping fails only after the storage is closed
+func (s *MemoryDB) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errClosed
+	}
+
+	return nil
+}
+
+// SchemaVersion is always the current one, the in-memory storage has no migrations
+func (s *MemoryDB) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	return storages.SchemaVersion, false, nil
+}
@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+var errClosed = storages.NewError(storages.ErrUnavailable, errors.New("in-memory storage is closed"))
+
+// seedUsers are the users created by the Postgres migrations, so the API behaves the same with both drivers
+var seedUsers = []string{"Sheldon", "Leonard", "Penny", "Howard", "Rajesh"}
+
+type user struct {
+	id      uint
+	name    string
+	balance int64
+}
+
+type transaction struct {
+	id             uint
+	senderID       uint
+	receiverID     uint
+	idempotencyKey string
+	success        bool
+	typeOperation  string
+	amount         int64
+	date           time.Time
+}
+
+type batch struct {
+	data  models.TransferBatch
+	items []*models.TransferBatchResult
+}
+
+// MemoryDB is an in-memory implementation of the storages. All data lives in maps guarded by one mutex, so every method
+// is atomic and isolated the same way a database transaction is. Money is kept in cents, as in Postgres.
+// The data is lost when the application stops, the driver is meant for tests and local development.
+type MemoryDB struct {
+	mu  sync.Mutex
+	log *slog.Logger
+
+	users        map[uint]*user
+	transactions []*transaction
+	byKey        map[string]*transaction
+	batches      map[string]*batch
+	schedules    map[uint]*models.ScheduledTransfer
+	runs         []*models.ScheduledTransferRun
+	claims       map[uint]time.Time
+	lastSchedule uint
+	webhooks     map[uint]*models.Webhook
+	lastWebhook  uint
+	deliveries   []*models.WebhookDelivery
+	lastDelivery uint
+	outbox       []*outboxEvent
+	outboxIDs    map[string]bool
+	closed       bool
+}
+
+func New(log *slog.Logger) *MemoryDB {
+	log.Debug("database: in-memory storage creation started")
+
+	db := &MemoryDB{
+		log:       log,
+		users:     make(map[uint]*user),
+		byKey:     make(map[string]*transaction),
+		batches:   make(map[string]*batch),
+		schedules: make(map[uint]*models.ScheduledTransfer),
+		claims:    make(map[uint]time.Time),
+		webhooks:  make(map[uint]*models.Webhook),
+		outboxIDs: make(map[string]bool),
+	}
+
+	for _, name := range seedUsers {
+		db.AddUser(name, 0)
+	}
+
+	log.Info("database: in-memory storage successfully created", "users", len(seedUsers))
+	return db
+}
+
+// AddUser creates a user with the given balance in cents and returns its ID.
+// There is no API for creating users, in Postgres they are created by the migrations.
+func (s *MemoryDB) AddUser(name string, balance int64) uint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := uint(len(s.users) + 1)
+	s.users[id] = &user{id: id, name: name, balance: balance}
+
+	return id
+}
+
+// Balance returns the balance of a user in cents
+func (s *MemoryDB) Balance(id uint) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return 0, false
+	}
+
+	return u.balance, true
+}
+
+func (s *MemoryDB) Close() error {
+	s.log.Debug("database: stop started")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("database is already closed")
+	}
+
+	s.closed = true
+
+	s.log.Info("database: stop successful")
+	return nil
+}
+
+// begin locks the storage for the duration of one operation. It fails if the context is already done
+// or the storage is closed, the same way a query to a closed pool fails.
+func (s *MemoryDB) begin(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errClosed
+	}
+
+	return nil
+}
+
+func (s *MemoryDB) end() {
+	s.mu.Unlock()
+}
+
+// toModel converts a stored transaction to the form returned by Postgres: the names of the users are filled in
+// only for transfers, the user IDs and the Idempotency-Key are not returned.
+func (s *MemoryDB) toModel(t *transaction) *models.Transaction {
+	result := models.Transaction{
+		ID:            t.id,
+		Success:       t.success,
+		TypeOperation: t.typeOperation,
+		Amount:        storages.FromCents(t.amount),
+		Date:          t.date,
+	}
+
+	if t.typeOperation != "deposit" {
+		if u, ok := s.users[t.senderID]; ok {
+			name := u.name
+			result.SenderName = &name
+		}
+		if u, ok := s.users[t.receiverID]; ok {
+			name := u.name
+			result.ReceiverName = &name
+		}
+	}
+
+	return &result
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/storages/storagetest"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStore struct {
+	*MemoryDB
+}
+
+func (s testStore) CreateUser(t *testing.T, balance int64) uint {
+	return s.AddUser("test", balance)
+}
+
+func (s testStore) Balance(t *testing.T, id uint) int64 {
+	t.Helper()
+
+	balance, ok := s.MemoryDB.Balance(id)
+	require.True(t, ok, "user %d not found", id)
+
+	return balance
+}
+
+func TestMemoryDB_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Store {
+		return testStore{New(logs.NewDiscardLogger())}
+	})
+}
+
+func TestMemoryDB_Transfer(t *testing.T) {
+	ctx := context.Background()
+	db := New(logs.NewDiscardLogger())
+	sender := db.AddUser("Amy", 1000)
+	receiver := db.AddUser("Bernadette", 0)
+
+	tests := []struct {
+		name        string
+		data        *models.Transaction
+		expectedErr error
+		sender      int64
+		receiver    int64
+	}{
+		{
+			name:     "successful transfer",
+			data:     &models.Transaction{IdempotencyKey: "k1", SenderID: sender, ReceiverID: receiver, TypeOperation: "transfer", Amount: 2.5},
+			sender:   750,
+			receiver: 250,
+		},
+		{
+			name:        "insufficient funds",
+			data:        &models.Transaction{IdempotencyKey: "k2", SenderID: sender, ReceiverID: receiver, TypeOperation: "transfer", Amount: 7.51},
+			expectedErr: services.ErrInsufficientFunds,
+			sender:      750,
+			receiver:    250,
+		},
+		{
+			name:        "self transfer",
+			data:        &models.Transaction{IdempotencyKey: "k3", SenderID: sender, ReceiverID: sender, TypeOperation: "transfer", Amount: 1},
+			expectedErr: storages.ErrConstraint,
+			sender:      750,
+			receiver:    250,
+		},
+		{
+			name:        "unknown receiver",
+			data:        &models.Transaction{IdempotencyKey: "k4", SenderID: sender, ReceiverID: 999, TypeOperation: "transfer", Amount: 1},
+			expectedErr: storages.ErrReferenceNotFound,
+			sender:      750,
+			receiver:    250,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.TransactionCreate(ctx, tt.data)
+			if err == nil {
+				err = db.Transfer(ctx, tt.data)
+			}
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, tt.data.SenderName)
+				assert.Equal(t, "Amy", *tt.data.SenderName)
+			}
+
+			balance, _ := db.Balance(sender)
+			assert.Equal(t, tt.sender, balance)
+			balance, _ = db.Balance(receiver)
+			assert.Equal(t, tt.receiver, balance)
+		})
+	}
+}
+
+func TestMemoryDB_TransferBatch(t *testing.T) {
+	ctx := context.Background()
+
+	newReq := func(key, mode string, amounts ...float64) *models.TransferBatchRequest {
+		req := &models.TransferBatchRequest{IdempotencyKey: key, SenderID: 1, Mode: mode}
+		for i, amount := range amounts {
+			req.Items = append(req.Items, &models.TransferBatchItem{
+				IdempotencyKey: fmt.Sprintf("%s-%d", key, i),
+				ReceiverID:     2,
+				Amount:         amount,
+			})
+		}
+		return req
+	}
+
+	t.Run("atomic batch is undone", func(t *testing.T) {
+		db := New(logs.NewDiscardLogger())
+		db.users[1].balance = 1000
+
+		_, err := db.TransferBatch(ctx, newReq("b1", services.BatchModeAtomic, 5, 6))
+		assert.ErrorIs(t, err, services.ErrInsufficientFunds)
+
+		balance, _ := db.Balance(1)
+		assert.Equal(t, int64(1000), balance)
+		assert.Empty(t, db.transactions)
+
+		_, err = db.TransferBatchGet(ctx, "b1")
+		assert.ErrorIs(t, err, storages.ErrBatchNotFound)
+	})
+
+	t.Run("best effort batch records failed items", func(t *testing.T) {
+		db := New(logs.NewDiscardLogger())
+		db.users[1].balance = 1000
+
+		resp, err := db.TransferBatch(ctx, newReq("b2", services.BatchModeBestEffort, 5, 6, 5))
+		require.NoError(t, err)
+		assert.False(t, resp.Batch.Success)
+		require.Len(t, resp.Results, 3)
+		assert.True(t, resp.Results[0].Success)
+		assert.False(t, resp.Results[1].Success)
+		assert.True(t, resp.Results[2].Success)
+
+		balance, _ := db.Balance(1)
+		assert.Equal(t, int64(0), balance)
+
+		replay, err := db.TransferBatchGet(ctx, "b2")
+		require.NoError(t, err)
+		assert.Equal(t, resp, replay)
+
+		_, err = db.TransferBatch(ctx, newReq("b2", services.BatchModeBestEffort, 1))
+		assert.True(t, errors.Is(err, storages.ErrDuplicate))
+	})
+}
+
+func TestMemoryDB_Closed(t *testing.T) {
+	db := New(logs.NewDiscardLogger())
+	require.NoError(t, db.Close())
+
+	_, err := db.ExsistUser(context.Background(), 1)
+	assert.ErrorIs(t, err, storages.ErrUnavailable)
+	assert.Error(t, db.Close())
+}
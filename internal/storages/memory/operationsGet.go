@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// OperationsGet returns the transactions where the user is the sender or the receiver, newest first, paginated with
+// the limit and offset of the request. If the page is empty, ErrOperationsNotFound is returned, as in Postgres.
+func (s *MemoryDB) OperationsGet(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+	op := "Database: get user operations "
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "OperationsGet func call", "data", req)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	var found []*transaction
+	for _, t := range s.transactions {
+		if t.senderID == req.UserID || t.receiverID == req.UserID {
+			found = append(found, t)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].date.Equal(found[j].date) {
+			return found[i].id > found[j].id
+		}
+		return found[i].date.After(found[j].date)
+	})
+
+	var resp models.UserOperationsResponse
+	for i := req.Offset; i < len(found) && i < req.Offset+req.Limit; i++ {
+		if i < 0 {
+			continue
+		}
+		resp.Operation = append(resp.Operation, s.toModel(found[i]))
+	}
+
+	if len(resp.Operation) == 0 {
+		log.WarnContext(ctx, "user has no operations")
+		return nil, storages.ErrOperationsNotFound
+	}
+
+	log.InfoContext(ctx, "transactions were successfully retrieved from the database")
+	return &resp, nil
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+type outboxEvent struct {
+	event       models.Event
+	publishedAt *time.Time
+}
+
+// OutboxAdd writes an event that is not a part of a balance change, e.g. transfer.failed. An event with the same ID
+// is written once.
+func (s *MemoryDB) OutboxAdd(ctx context.Context, event *models.Event) error {
+	op := "Database: outbox event creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "OutboxAdd func call", "type", event.Type, "id", event.ID)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to add the event to the outbox", "error", err)
+		return err
+	}
+	defer s.end()
+
+	s.outboxAdd(event)
+
+	log.InfoContext(ctx, "event successfully added to the outbox")
+	return nil
+}
+
+// outboxAdd saves a copy of the event, the storage must already be locked
+func (s *MemoryDB) outboxAdd(event *models.Event) {
+	if s.outboxIDs[event.ID] {
+		return
+	}
+
+	s.outbox = append(s.outbox, &outboxEvent{event: copyEvent(event)})
+	s.outboxIDs[event.ID] = true
+}
+
+// copyEvent copies the event with its data, so the caller and the publisher cannot change the saved one
+func copyEvent(event *models.Event) models.Event {
+	copied := *event
+	if event.Data != nil {
+		data := *event.Data
+		copied.Data = &data
+	}
+
+	return copied
+}
+
+// OutboxProcess passes the unpublished events to publish in the order they were written. The storage is not locked
+// while publish runs, because the publisher may write to the same storage (the webhook deliveries), so two concurrent
+// calls may pass the same event twice. The relay runs one call at a time and the receivers drop duplicates by the ID.
+func (s *MemoryDB) OutboxProcess(ctx context.Context, limit int, publish func(ctx context.Context, event *models.Event) error) (int, error) {
+	op := "Database: outbox processing"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "OutboxProcess func call", "limit", limit)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to read the outbox", "error", err)
+		return 0, err
+	}
+
+	var pending []*outboxEvent
+	for _, item := range s.outbox {
+		if len(pending) == limit {
+			break
+		}
+		if item.publishedAt == nil {
+			pending = append(pending, item)
+		}
+	}
+	s.end()
+
+	published := 0
+	for _, item := range pending {
+		event := copyEvent(&item.event)
+		if err := publish(ctx, &event); err != nil {
+			log.WarnContext(ctx, "failed to publish the event", "id", event.ID, "error", err)
+			return published, err
+		}
+
+		if err := s.begin(ctx); err != nil {
+			log.ErrorContext(ctx, "failed to mark the event as published", "id", event.ID, "error", err)
+			return published, err
+		}
+		date := time.Now()
+		item.publishedAt = &date
+		s.end()
+
+		published++
+	}
+
+	log.InfoContext(ctx, "outbox events successfully published", "count", published)
+	return published, nil
+}
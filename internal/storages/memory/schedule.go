@@ -0,0 +1,234 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// ScheduleCreate saves a new scheduled transfer. The sender and the receiver must exist, as with the foreign keys
+// in Postgres. The generated ID and creation date are written back into the provided structure.
+func (s *MemoryDB) ScheduleCreate(ctx context.Context, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleCreate func call", "data", data)
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to create scheduled transfer", "error", err)
+		return err
+	}
+	defer s.end()
+
+	_, senderOk := s.users[data.SenderID]
+	_, receiverOk := s.users[data.ReceiverID]
+	if !senderOk || !receiverOk {
+		err := storages.NewError(storages.ErrReferenceNotFound, errors.New("user does not exist"))
+		log.ErrorContext(ctx, "failed to create scheduled transfer", "error", err)
+		return err
+	}
+
+	s.lastSchedule++
+	data.ID = s.lastSchedule
+	data.CreatedAt = time.Now()
+	data.Amount = storages.FromCents(amount)
+
+	saved := *data
+	s.schedules[data.ID] = &saved
+
+	log.InfoContext(ctx, "scheduled transfer created successfully", "id", data.ID)
+	return nil
+}
+
+// ScheduleGet retrieves a scheduled transfer by its ID. If there is no such scheduled transfer, ErrScheduleNotFound is returned.
+func (s *MemoryDB) ScheduleGet(ctx context.Context, id uint) (*models.ScheduledTransfer, error) {
+	op := "Database: get scheduled transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleGet func call", "id", id)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to get the scheduled transfer", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	data, ok := s.schedules[id]
+	if !ok {
+		log.WarnContext(ctx, "scheduled transfer not found", "id", id)
+		return nil, storages.ErrScheduleNotFound
+	}
+
+	result := *data
+
+	log.InfoContext(ctx, "scheduled transfer is successfully retrieved from the database")
+	return &result, nil
+}
+
+// ScheduleUpdate overwrites the amount, period, next run date with its anchor day and activity flag of a scheduled transfer.
+// The retry state is reset, so the updated schedule starts from a clean slate. A claim of the schedule is dropped,
+// so a run in progress cannot overwrite the update with its result.
+func (s *MemoryDB) ScheduleUpdate(ctx context.Context, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer update"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleUpdate func call", "data", data)
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to update the scheduled transfer", "error", err)
+		return err
+	}
+	defer s.end()
+
+	saved, ok := s.schedules[data.ID]
+	if !ok {
+		log.WarnContext(ctx, "scheduled transfer not found", "id", data.ID)
+		return storages.ErrScheduleNotFound
+	}
+
+	saved.Amount = storages.FromCents(amount)
+	saved.Period = data.Period
+	saved.NextRun = data.NextRun
+	saved.AnchorDay = data.AnchorDay
+	saved.Active = data.Active
+	saved.Attempts = 0
+	saved.RetryAt = nil
+	saved.LastError = nil
+	saved.Version++
+	delete(s.claims, saved.ID)
+
+	log.InfoContext(ctx, "scheduled transfer successfully updated")
+	return nil
+}
+
+// ScheduleDelete removes a scheduled transfer together with the history of its runs.
+func (s *MemoryDB) ScheduleDelete(ctx context.Context, id uint) error {
+	op := "Database: scheduled transfer delete"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleDelete func call", "id", id)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to delete the scheduled transfer", "error", err)
+		return err
+	}
+	defer s.end()
+
+	if _, ok := s.schedules[id]; !ok {
+		log.WarnContext(ctx, "scheduled transfer not found", "id", id)
+		return storages.ErrScheduleNotFound
+	}
+
+	delete(s.schedules, id)
+	delete(s.claims, id)
+
+	runs := s.runs[:0]
+	for _, run := range s.runs {
+		if run.ScheduleID != id {
+			runs = append(runs, run)
+		}
+	}
+	s.runs = runs
+
+	log.InfoContext(ctx, "scheduled transfer successfully deleted")
+	return nil
+}
+
+// SchedulesDue claims active scheduled transfers whose run date (or retry date, if the last run failed) has come and
+// returns them. A claimed schedule is not due again until claimUntil or until its run is saved. The oldest runs
+// are returned first, no more than limit items.
+func (s *MemoryDB) SchedulesDue(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error) {
+	op := "Database: get due scheduled transfers"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "SchedulesDue func call", "now", now, "claim until", claimUntil, "limit", limit)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	var due []*models.ScheduledTransfer
+	for _, data := range s.schedules {
+		runAt := data.NextRun
+		if data.RetryAt != nil {
+			runAt = *data.RetryAt
+		}
+
+		claimed, ok := s.claims[data.ID]
+		if data.Active && !runAt.After(now) && (!ok || !claimed.After(now)) {
+			due = append(due, data)
+		}
+	}
+
+	storages.SortSchedules(due)
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	result := make([]*models.ScheduledTransfer, 0, len(due))
+	for _, data := range due {
+		data.Version++
+		s.claims[data.ID] = claimUntil
+
+		item := *data
+		result = append(result, &item)
+	}
+
+	log.InfoContext(ctx, "due scheduled transfers were successfully retrieved", "count", len(result))
+	return result, nil
+}
+
+// ScheduleRunSave records the result of a scheduled transfer run and saves the new state of the schedule
+// (next run date, retry date, attempts) under one lock, so the history and the state never diverge.
+// The claim is released. If the schedule is no longer under the claim of data.Version, ErrScheduleChanged is returned.
+func (s *MemoryDB) ScheduleRunSave(ctx context.Context, run *models.ScheduledTransferRun, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer run save"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleRunSave func call", "run", run, "data", data)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return err
+	}
+	defer s.end()
+
+	saved, ok := s.schedules[run.ScheduleID]
+	if !ok {
+		err := storages.NewError(storages.ErrReferenceNotFound, errors.New("scheduled transfer does not exist"))
+		log.ErrorContext(ctx, "failed to save the run", "error", err)
+		return err
+	}
+
+	if data.ID != saved.ID || data.Version != saved.Version {
+		log.WarnContext(ctx, "scheduled transfer was changed after it was claimed, the run is not saved", "id", saved.ID)
+		return storages.ErrScheduleChanged
+	}
+
+	r := *run
+	s.runs = append(s.runs, &r)
+
+	saved.NextRun = data.NextRun
+	saved.Active = data.Active
+	saved.Attempts = data.Attempts
+	saved.RetryAt = data.RetryAt
+	saved.LastError = data.LastError
+	saved.Version++
+	delete(s.claims, saved.ID)
+
+	log.InfoContext(ctx, "scheduled transfer run successfully saved")
+	return nil
+}
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// TransactionCreate saves a new transaction with success = false. It enforces the same constraints as the Postgres schema:
+// the Idempotency-Key is unique, the sender and the receiver must exist and must be different users.
+// The ID and the date of the new transaction are written back into data.
+func (s *MemoryDB) TransactionCreate(ctx context.Context, data *models.Transaction) error {
+	op := "Database: transaction creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "createTransaction func call", "data", data)
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to create transaction", "error", err)
+		return err
+	}
+	defer s.end()
+
+	t, err := s.transactionCreate(data.IdempotencyKey, data.TypeOperation, data.SenderID, data.ReceiverID, amount)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to create transaction", "error", err)
+		return err
+	}
+
+	data.ID = t.id
+	data.Date = t.date
+
+	log.InfoContext(ctx, "transaction created successfully", "id", t.id)
+	return nil
+}
+
+// transactionCreate checks the constraints and appends a transaction, the storage must already be locked
+func (s *MemoryDB) transactionCreate(key, typeOperation string, senderID, receiverID uint, amount int64) (*transaction, error) {
+	if _, ok := s.byKey[key]; ok {
+		return nil, storages.NewError(storages.ErrIdempotencyKeyExists, errors.New("duplicate idempotency key"))
+	}
+
+	if _, ok := s.users[senderID]; !ok {
+		return nil, storages.NewError(storages.ErrReferenceNotFound, errors.New("sender does not exist"))
+	}
+
+	if typeOperation != "deposit" {
+		if _, ok := s.users[receiverID]; !ok {
+			return nil, storages.NewError(storages.ErrReferenceNotFound, errors.New("receiver does not exist"))
+		}
+		if senderID == receiverID {
+			return nil, storages.NewError(storages.ErrConstraint, errors.New("sender is the receiver"))
+		}
+	} else {
+		receiverID = 0
+	}
+
+	t := &transaction{
+		id:             uint(len(s.transactions) + 1),
+		senderID:       senderID,
+		receiverID:     receiverID,
+		idempotencyKey: key,
+		typeOperation:  typeOperation,
+		amount:         amount,
+		date:           time.Now(),
+	}
+
+	s.transactions = append(s.transactions, t)
+	s.byKey[key] = t
+
+	return t, nil
+}
+
+// TransactionGet retrieves a transaction by its Idempotency-Key in the same form as Postgres returns it.
+// If there is no such transaction, ErrTransactionNotFound is returned.
+func (s *MemoryDB) TransactionGet(ctx context.Context, idempotencyKey string) (*models.Transaction, error) {
+	op := "Database: get transactions"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "TransactionGet func call", "idempotencyKey", idempotencyKey)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to get the transaction", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	t, ok := s.byKey[idempotencyKey]
+	if !ok {
+		log.WarnContext(ctx, "transaction not found")
+		return nil, storages.ErrTransactionNotFound
+	}
+
+	log.InfoContext(ctx, "transaction is successfully retrieved from the database")
+	return s.toModel(t), nil
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// Transfer moves the amount from the sender to the receiver with the same checks as the Postgres driver: the sender must
+// have enough funds, otherwise ErrInsufficientFunds is returned and nothing is changed. On success the transaction with
+// the Idempotency-Key is marked as successful, the transfer.completed event is written to the outbox and the names of the users are written into data.
+func (s *MemoryDB) Transfer(ctx context.Context, data *models.Transaction) error {
+	op := "Database: account transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "Transfer func call", "data", data)
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return err
+	}
+	defer s.end()
+
+	if err := s.transfer(data.SenderID, data.ReceiverID, amount); err != nil {
+		log.WarnContext(ctx, "transfer failed", "error", err)
+		return err
+	}
+
+	sender, receiver := s.users[data.SenderID].name, s.users[data.ReceiverID].name
+	data.SenderName = &sender
+	data.ReceiverName = &receiver
+
+	s.setResult(data.IdempotencyKey, true)
+	s.outboxAdd(services.TransferEvent(data, nil))
+
+	log.InfoContext(ctx, "transaction successfully completed")
+	return nil
+}
+
+// transfer checks the balance and moves the money, the storage must already be locked
+func (s *MemoryDB) transfer(senderID, receiverID uint, amount int64) error {
+	sender, ok := s.users[senderID]
+	if !ok {
+		return storages.ErrUserNotFound
+	}
+
+	receiver, ok := s.users[receiverID]
+	if !ok {
+		return storages.ErrUserNotFound
+	}
+
+	if sender.balance < amount {
+		return services.ErrInsufficientFunds
+	}
+
+	sender.balance -= amount
+	receiver.balance += amount
+
+	return nil
+}
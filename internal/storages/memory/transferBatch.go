@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// TransferBatch transfers funds from one sender to many receivers with the same semantics as the Postgres driver.
+// In the atomic mode the first failed item undoes the whole batch. In the best_effort mode an item that fails because
+// of insufficient funds or a failed pre-check from the service is recorded with its error, while the other items are
+// still executed. Any other error undoes the whole batch. The batch is saved, so a replay returns the same results,
+// and the event of every item is written to the outbox.
+func (s *MemoryDB) TransferBatch(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error) {
+	op := "Database: batch transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "TransferBatch func call", "sender id", req.SenderID, "mode", req.Mode, "items", len(req.Items))
+
+	amounts, err := storages.ItemsToCents(req.Items)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "error", err)
+		return nil, err
+	}
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	if _, ok := s.batches[req.IdempotencyKey]; ok {
+		err := storages.NewError(storages.ErrIdempotencyKeyExists, errors.New("duplicate batch idempotency key"))
+		log.ErrorContext(ctx, "failed to create batch", "error", err)
+		return nil, err
+	}
+
+	if _, ok := s.users[req.SenderID]; !ok {
+		err := storages.NewError(storages.ErrReferenceNotFound, errors.New("sender does not exist"))
+		log.ErrorContext(ctx, "failed to create batch", "error", err)
+		return nil, err
+	}
+
+	undo := s.savepoint()
+
+	b := &batch{
+		data: models.TransferBatch{
+			ID:             uint(len(s.batches) + 1),
+			IdempotencyKey: req.IdempotencyKey,
+			SenderID:       req.SenderID,
+			Mode:           req.Mode,
+			Success:        true,
+			Date:           time.Now(),
+		},
+		items: make([]*models.TransferBatchResult, 0, len(req.Items)),
+	}
+
+	for i, item := range req.Items {
+		result := models.TransferBatchResult{
+			Position:   i,
+			ReceiverID: item.ReceiverID,
+			Amount:     item.Amount,
+			Success:    true,
+		}
+
+		var itemErr error
+		if item.Err != nil {
+			itemErr = item.Err
+		} else if err := s.transferBatchItem(req.SenderID, item, amounts[i], &result); err != nil {
+			if req.Mode == services.BatchModeAtomic || !errors.Is(err, services.ErrInsufficientFunds) {
+				log.WarnContext(ctx, "batch transfer failed", "position", i, "error", err)
+				undo()
+				return nil, err
+			}
+			itemErr = err
+		}
+
+		if itemErr != nil {
+			msg := itemErr.Error()
+			result.Success = false
+			result.Error = &msg
+			result.Err = itemErr
+			b.data.Success = false
+		}
+
+		b.items = append(b.items, &result)
+	}
+
+	s.batches[req.IdempotencyKey] = b
+	for _, result := range b.items {
+		s.outboxAdd(services.BatchItemEvent(req, result))
+	}
+
+	log.InfoContext(ctx, "batch transfer successfully completed", "batch id", b.data.ID, "success", b.data.Success)
+	return b.response(), nil
+}
+
+// transferBatchItem executes one item of a batch. If the sender does not have enough funds, nothing is changed
+// and ErrInsufficientFunds is returned. The storage must already be locked.
+func (s *MemoryDB) transferBatchItem(senderID uint, item *models.TransferBatchItem, amount int64, result *models.TransferBatchResult) error {
+	if s.users[senderID].balance < amount {
+		return services.ErrInsufficientFunds
+	}
+
+	t, err := s.transactionCreate(item.IdempotencyKey, "transfer", senderID, item.ReceiverID, amount)
+	if err != nil {
+		return err
+	}
+
+	if err := s.transfer(senderID, item.ReceiverID, amount); err != nil {
+		return err
+	}
+
+	t.success = true
+	id := t.id
+	result.Transaction = &id
+
+	return nil
+}
+
+// savepoint remembers the balances and the number of transactions and returns a function that restores them,
+// the in-memory counterpart of rolling back a database transaction. The storage must already be locked.
+func (s *MemoryDB) savepoint() func() {
+	balances := make(map[uint]int64, len(s.users))
+	for id, u := range s.users {
+		balances[id] = u.balance
+	}
+	count := len(s.transactions)
+
+	return func() {
+		for id, balance := range balances {
+			s.users[id].balance = balance
+		}
+		for _, t := range s.transactions[count:] {
+			delete(s.byKey, t.idempotencyKey)
+		}
+		s.transactions = s.transactions[:count]
+	}
+}
+
+// TransferBatchGet retrieves a batch and the results of its items by the Idempotency-Key of the batch.
+// If there is no such batch, ErrBatchNotFound is returned.
+func (s *MemoryDB) TransferBatchGet(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+	op := "Database: get batch transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "TransferBatchGet func call", "idempotencyKey", idempotencyKey)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to get the batch", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	b, ok := s.batches[idempotencyKey]
+	if !ok {
+		log.DebugContext(ctx, "batch not found")
+		return nil, storages.ErrBatchNotFound
+	}
+
+	log.InfoContext(ctx, "batch is successfully retrieved from the database")
+	return b.response(), nil
+}
+
+// response returns copies of the stored batch, so the caller cannot change the saved results
+func (b *batch) response() *models.TransferBatchResponse {
+	data := b.data
+
+	results := make([]*models.TransferBatchResult, 0, len(b.items))
+	for _, item := range b.items {
+		r := *item
+		results = append(results, &r)
+	}
+
+	return &models.TransferBatchResponse{Batch: &data, Results: results}
+}
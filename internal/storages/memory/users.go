@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+func (s *MemoryDB) UserGet(ctx context.Context, id uint) (*models.User, error) {
+	op := "Database: get user"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "UserGet func call", "user id", id)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to get the user", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	u, ok := s.users[id]
+	if !ok {
+		log.WarnContext(ctx, "user not found")
+		return nil, storages.ErrUserNotFound
+	}
+
+	log.InfoContext(ctx, "user is successfully retrieved from the database")
+	return &models.User{ID: u.id, Name: u.name, Balance: storages.FromCents(u.balance)}, nil
+}
@@ -0,0 +1,263 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// WebhookCreate saves a new webhook subscription. The user must exist, as with the foreign key in Postgres.
+// The generated ID and creation date are written back into the provided structure.
+func (s *MemoryDB) WebhookCreate(ctx context.Context, data *models.Webhook) error {
+	op := "Database: webhook creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookCreate func call", "user id", data.UserID, "url", data.URL)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to create webhook", "error", err)
+		return err
+	}
+	defer s.end()
+
+	if data.UserID != nil {
+		if _, ok := s.users[*data.UserID]; !ok {
+			err := storages.NewError(storages.ErrReferenceNotFound, errors.New("user does not exist"))
+			log.ErrorContext(ctx, "failed to create webhook", "error", err)
+			return err
+		}
+	}
+
+	s.lastWebhook++
+	data.ID = s.lastWebhook
+	data.CreatedAt = time.Now()
+
+	saved := *data
+	s.webhooks[data.ID] = &saved
+
+	log.InfoContext(ctx, "webhook created successfully", "id", data.ID)
+	return nil
+}
+
+// WebhookGet retrieves a webhook subscription by its ID. If there is no such subscription, ErrWebhookNotFound is returned.
+func (s *MemoryDB) WebhookGet(ctx context.Context, id uint) (*models.Webhook, error) {
+	op := "Database: get webhook"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookGet func call", "id", id)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to get the webhook", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	data, ok := s.webhooks[id]
+	if !ok {
+		log.WarnContext(ctx, "webhook not found", "id", id)
+		return nil, storages.ErrWebhookNotFound
+	}
+
+	result := *data
+
+	log.InfoContext(ctx, "webhook is successfully retrieved from the database")
+	return &result, nil
+}
+
+// WebhookDelete removes a webhook subscription together with its deliveries.
+func (s *MemoryDB) WebhookDelete(ctx context.Context, id uint) error {
+	op := "Database: webhook delete"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookDelete func call", "id", id)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to delete the webhook", "error", err)
+		return err
+	}
+	defer s.end()
+
+	if _, ok := s.webhooks[id]; !ok {
+		log.WarnContext(ctx, "webhook not found", "id", id)
+		return storages.ErrWebhookNotFound
+	}
+
+	delete(s.webhooks, id)
+
+	deliveries := s.deliveries[:0]
+	for _, d := range s.deliveries {
+		if d.WebhookID != id {
+			deliveries = append(deliveries, d)
+		}
+	}
+	s.deliveries = deliveries
+
+	log.InfoContext(ctx, "webhook successfully deleted")
+	return nil
+}
+
+// WebhooksFor returns the global webhook subscriptions and the subscriptions of the given users, ordered by ID.
+func (s *MemoryDB) WebhooksFor(ctx context.Context, userIDs []uint) ([]*models.Webhook, error) {
+	op := "Database: get webhooks of users"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhooksFor func call", "user ids", userIDs)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	var result []*models.Webhook
+	for _, data := range s.webhooks {
+		if data.UserID == nil || slices.Contains(userIDs, *data.UserID) {
+			item := *data
+			result = append(result, &item)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	log.InfoContext(ctx, "webhooks were successfully retrieved", "count", len(result))
+	return result, nil
+}
+
+// DeliveriesCreate saves new deliveries under one lock. A delivery of an event that the subscription already has
+// is skipped, the generated ID is written back only into the saved deliveries.
+func (s *MemoryDB) DeliveriesCreate(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	op := "Database: webhook deliveries creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "DeliveriesCreate func call", "count", len(deliveries))
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to create webhook deliveries", "error", err)
+		return err
+	}
+	defer s.end()
+
+	for _, data := range deliveries {
+		if _, ok := s.webhooks[data.WebhookID]; !ok {
+			err := storages.NewError(storages.ErrReferenceNotFound, errors.New("webhook does not exist"))
+			log.ErrorContext(ctx, "failed to create webhook deliveries", "error", err)
+			return err
+		}
+	}
+
+	created := 0
+	for _, data := range deliveries {
+		if s.hasDelivery(data.WebhookID, data.EventID) {
+			continue
+		}
+
+		s.lastDelivery++
+		data.ID = s.lastDelivery
+		data.CreatedAt = time.Now()
+
+		saved := *data
+		s.deliveries = append(s.deliveries, &saved)
+		created++
+	}
+
+	log.InfoContext(ctx, "webhook deliveries created successfully", "count", created)
+	return nil
+}
+
+func (s *MemoryDB) hasDelivery(webhookID uint, eventID string) bool {
+	for _, d := range s.deliveries {
+		if d.WebhookID == webhookID && d.EventID == eventID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeliveriesDue returns the pending deliveries whose next attempt has come, the oldest first, no more than limit items.
+func (s *MemoryDB) DeliveriesDue(ctx context.Context, now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	op := "Database: get due webhook deliveries"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "DeliveriesDue func call", "now", now, "limit", limit)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	var result []*models.WebhookDelivery
+	for _, data := range s.deliveries {
+		if data.Status == storages.DeliveryPending && !data.NextAttempt.After(now) {
+			item := *data
+			result = append(result, &item)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].NextAttempt.Before(result[j].NextAttempt) })
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	log.InfoContext(ctx, "due webhook deliveries were successfully retrieved", "count", len(result))
+	return result, nil
+}
+
+// DeliverySave saves the result of a delivery attempt: the status, the attempts, the next attempt and the answer.
+func (s *MemoryDB) DeliverySave(ctx context.Context, data *models.WebhookDelivery) error {
+	op := "Database: webhook delivery save"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "DeliverySave func call", "id", data.ID, "status", data.Status)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to save the webhook delivery", "error", err)
+		return err
+	}
+	defer s.end()
+
+	for _, saved := range s.deliveries {
+		if saved.ID != data.ID {
+			continue
+		}
+
+		saved.Status = data.Status
+		saved.Attempts = data.Attempts
+		saved.NextAttempt = data.NextAttempt
+		saved.LastError = data.LastError
+		saved.ResponseStatus = data.ResponseStatus
+		saved.DeliveredAt = data.DeliveredAt
+
+		log.InfoContext(ctx, "webhook delivery successfully saved")
+		return nil
+	}
+
+	// the webhook was deleted together with its deliveries while the delivery was being sent
+	log.WarnContext(ctx, "webhook delivery not found", "id", data.ID)
+	return nil
+}
+
+// DeliveriesGet returns the deliveries of a webhook subscription, the newest first, no more than limit items.
+func (s *MemoryDB) DeliveriesGet(ctx context.Context, webhookID uint, limit int) ([]*models.WebhookDelivery, error) {
+	op := "Database: get webhook deliveries"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "DeliveriesGet func call", "webhook id", webhookID, "limit", limit)
+
+	if err := s.begin(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, err
+	}
+	defer s.end()
+
+	var result []*models.WebhookDelivery
+	for i := len(s.deliveries) - 1; i >= 0 && len(result) < limit; i-- {
+		if data := s.deliveries[i]; data.WebhookID == webhookID {
+			item := *data
+			result = append(result, &item)
+		}
+	}
+
+	log.InfoContext(ctx, "webhook deliveries were successfully retrieved", "count", len(result))
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package storages
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// MaxCents is the largest amount in cents the storages accept, 2^53. Up to it every number of cents is exact
+// as a float64, so FromCents gives back the same amount. A larger amount is rejected before it reaches a query,
+// as the cast of the database used to reject it, instead of wrapping around int64.
+const MaxCents = 1 << 53
+
+// ErrAmountOutOfRange is the cause of the ErrConstraint returned by ToCents for an amount that cannot be stored
+var ErrAmountOutOfRange = errors.New("amount is out of range")
+
+// ToCents converts an amount of money to cents, rounding half away from zero. All storage drivers store
+// money in cents converted by this function, so they agree on rounding. The float is first formatted as the shortest decimal that represents it, so 100.555 becomes 10056 cents
+// and not 10055, as a plain math.Round(amount * 100) would give. An amount beyond ±MaxCents, NaN or an infinity
+// gives ErrConstraint.
+func ToCents(amount float64) (int64, error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(amount, 'f', -1, 64))
+	if !ok {
+		return 0, NewError(ErrConstraint, ErrAmountOutOfRange)
+	}
+	r.Mul(r, big.NewRat(100, 1))
+
+	num, den := r.Num(), r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+
+	rem.Abs(rem).Lsh(rem, 1)
+	if rem.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+
+	if !quo.IsInt64() || quo.CmpAbs(big.NewInt(MaxCents)) > 0 {
+		return 0, NewError(ErrConstraint, ErrAmountOutOfRange)
+	}
+
+	return quo.Int64(), nil
+}
+
+// ItemsToCents converts the amounts of the batch items to cents, so a driver rejects a batch with an amount
+// out of range before any of its items touches the database
+func ItemsToCents(items []*models.TransferBatchItem) ([]int64, error) {
+	amounts := make([]int64, len(items))
+	for i, item := range items {
+		amount, err := ToCents(item.Amount)
+		if err != nil {
+			return nil, err
+		}
+		amounts[i] = amount
+	}
+
+	return amounts, nil
+}
+
+// FromCents converts cents back to an amount of money
+func FromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
@@ -0,0 +1,47 @@
+package storages
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToCents(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		expected int64
+	}{
+		{amount: 0, expected: 0},
+		{amount: 1, expected: 100},
+		{amount: 205.44, expected: 20544},
+		{amount: 100.555, expected: 10056},
+		{amount: 100.554, expected: 10055},
+		{amount: 0.005, expected: 1},
+		{amount: 0.004, expected: 0},
+		{amount: 1.015, expected: 102},
+		{amount: -1.015, expected: -102},
+		{amount: 90071992547409.92, expected: MaxCents},
+		{amount: -90071992547409.92, expected: -MaxCents},
+	}
+
+	for _, tt := range tests {
+		cents, err := ToCents(tt.amount)
+		require.NoError(t, err, "amount %v", tt.amount)
+		assert.Equal(t, tt.expected, cents, "amount %v", tt.amount)
+	}
+}
+
+func TestToCents_OutOfRange(t *testing.T) {
+	for _, amount := range []float64{1e17, -1e17, 92233720368547.75, 90071992547409.94, math.MaxFloat64, math.Inf(1), math.NaN()} {
+		_, err := ToCents(amount)
+		assert.ErrorIs(t, err, ErrConstraint, "amount %v", amount)
+		assert.ErrorIs(t, err, ErrAmountOutOfRange, "amount %v", amount)
+	}
+}
+
+func TestFromCents(t *testing.T) {
+	assert.Equal(t, 205.44, FromCents(20544))
+	assert.Equal(t, 0.01, FromCents(1))
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strconv"
 
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/exaring/otelpgx"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -13,10 +16,28 @@ type PostgresDB struct {
 	log *slog.Logger
 }
 
-func New(storagePath string, log *slog.Logger) (*PostgresDB, error) {
+func New(storagePath string, conf *config.Storage, log *slog.Logger) (*PostgresDB, error) {
 	log.Debug("database: connection to Postgres started")
 
-	db, err := pgxpool.New(context.Background(), storagePath)
+	poolConf, err := pgxpool.ParseConfig(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+	// every query gets a span, it takes the global TracerProvider set up by the tracing package
+	poolConf.ConnConfig.Tracer = otelpgx.NewTracer()
+
+	if conf.MaxConns > 0 {
+		poolConf.MaxConns = conf.MaxConns
+	}
+	poolConf.MinConns = conf.MinConns
+	poolConf.MaxConnLifetime = conf.ConnMaxLifetime
+	poolConf.MaxConnIdleTime = conf.ConnMaxIdleTime
+	// the server cancels a query running longer than this, the handler timeout only stops waiting for it
+	if conf.StatementTimeout > 0 {
+		poolConf.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(conf.StatementTimeout.Milliseconds(), 10)
+	}
+
+	db, err := pgxpool.NewWithConfig(context.Background(), poolConf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -43,3 +64,8 @@ func (s *PostgresDB) Close() error {
 	s.log.Info("database: stop successful")
 	return nil
 }
+
+// Stat returns the statistics of the connection pool
+func (s *PostgresDB) Stat() *pgxpool.Stat {
+	return s.db.Stat()
+}
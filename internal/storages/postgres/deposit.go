@@ -4,62 +4,89 @@ import (
 	"context"
 	"log/slog"
 
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
 	"github.com/EvansTrein/iqProgers/models"
 )
 
 // Deposit processes a deposit request for a user's account. It locks the user's row in the database to prevent concurrent updates,
-// updates the user's balance by adding the specified amount, and marks the transaction as successful. The function uses a database
-// transaction to ensure atomicity. If any step fails (e.g., SQL query execution, transaction commit), 
-// the transaction is rolled back, and the error is logged and returned. 
+// updates the user's balance by adding the specified amount, marks the transaction as successful and writes the deposit.completed
+// event to the outbox. The function uses a database transaction to ensure atomicity. If any step fails (e.g., SQL query
+// execution, transaction commit), the transaction is rolled back, and the error is logged and returned.
+// If the user does not exist, ErrUserNotFound is returned.
 func (s *PostgresDB) Deposit(ctx context.Context, req *models.DepositRequest) error {
 	op := "Database: account deposit"
 	log := s.log.With(slog.String("operation", op))
-	log.Debug("Deposit func call", "data", req)
+	log.DebugContext(ctx, "Deposit func call", "data", req)
+
+	amount, err := storages.ToCents(req.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", req.Amount)
+		return err
+	}
 
 	rollbackCtx := context.Background()
 
 	queryLock := `SELECT id FROM users WHERE id = $1 FOR UPDATE;`
 
 	updateQuery := `UPDATE users
-		SET balance = balance + (ROUND($1::numeric, 2) * 100)::bigint
+		SET balance = balance + $1
 		WHERE id = $2;`
 
 	// Start transaction
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		log.Error("failed to begin transaction", "error", err)
-		return err
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return classify(err)
 	}
 
 	if _, err := tx.Exec(ctx, queryLock, req.UserID); err != nil {
-		log.Error("failed to execute SQL query lock in the database", "error", err)
+		log.ErrorContext(ctx, "failed to execute SQL query lock in the database", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
 	}
 
-	if _, err := tx.Exec(ctx, updateQuery, req.Amount, req.UserID); err != nil {
-		log.Error("failed to execute SQL query to update the balance in the database", "error", err)
+	tag, err := tx.Exec(ctx, updateQuery, amount, req.UserID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query to update the balance in the database", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
 	}
 
-	if err := s.TransactionSetResult(ctx, req.IdempotencyKey, true); err != nil {
-		log.Error("failed to set the result of user transaction", "error", err)
+	if tag.RowsAffected() == 0 {
+		log.WarnContext(ctx, "user not found", "id", req.UserID)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return storages.ErrUserNotFound
+	}
+
+	transactionID, err := s.TransactionSetResult(ctx, tx, req.IdempotencyKey, true)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to set the result of user transaction", "error", err)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if err := s.outboxAdd(ctx, tx, services.DepositEvent(req, transactionID)); err != nil {
+		log.ErrorContext(ctx, "failed to add the event to the outbox", "error", err)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
 	}
-	
+
 	if err := tx.Commit(ctx); err != nil {
-		log.Error("!!!ATTENTION!!! failed to commit transaction", "error", err)
-		return err
+		log.ErrorContext(ctx, "!!!ATTENTION!!! failed to commit transaction", "error", err)
+		return classify(err)
 	}
 
-	log.Info("transaction successfully completed")
+	log.InfoContext(ctx, "transaction successfully completed")
 	return nil
 }
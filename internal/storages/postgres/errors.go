@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/puddle/v2"
+)
+
+const (
+	sqlStateUniqueViolation     = "23505"
+	sqlStateForeignKeyViolation = "23503"
+	sqlStateCheckViolation      = "23514"
+	sqlStateNotNullViolation    = "23502"
+	sqlStateOutOfRange          = "22003"
+	sqlStateTooManyConnections  = "53300"
+	sqlStateAdminShutdown       = "57P01"
+	sqlStateCrashShutdown       = "57P02"
+	sqlStateCannotConnectNow    = "57P03"
+
+	sqlClassConnectionException = "08"
+
+	// idempotencyKeySuffix ends the names Postgres gives to the UNIQUE constraints of the idempotency_key columns
+	idempotencyKeySuffix = "_idempotency_key_key"
+)
+
+// classify translates an error of pgx into one of the storage error kinds. Errors that are not driver errors
+// (domain errors, context cancellation, pgx.ErrNoRows that the methods handle themselves) are returned unchanged,
+// as well as the Postgres errors that do not belong to any kind.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *storages.Error
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == sqlStateUniqueViolation && strings.HasSuffix(pgErr.ConstraintName, idempotencyKeySuffix):
+			return storages.NewError(storages.ErrIdempotencyKeyExists, err)
+		case pgErr.Code == sqlStateUniqueViolation:
+			return storages.NewError(storages.ErrDuplicate, err)
+		case pgErr.Code == sqlStateForeignKeyViolation:
+			return storages.NewError(storages.ErrReferenceNotFound, err)
+		case pgErr.Code == sqlStateCheckViolation,
+			pgErr.Code == sqlStateNotNullViolation,
+			pgErr.Code == sqlStateOutOfRange:
+			return storages.NewError(storages.ErrConstraint, err)
+		case pgErr.Code == sqlStateSerializationFailure,
+			pgErr.Code == sqlStateDeadlockDetected:
+			return storages.NewError(storages.ErrRetryable, err)
+		case strings.HasPrefix(pgErr.Code, sqlClassConnectionException),
+			pgErr.Code == sqlStateTooManyConnections,
+			pgErr.Code == sqlStateAdminShutdown,
+			pgErr.Code == sqlStateCrashShutdown,
+			pgErr.Code == sqlStateCannotConnectNow:
+			return storages.NewError(storages.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connectErr) || errors.As(err, &netErr) || errors.Is(err, puddle.ErrClosedPool) {
+		return storages.NewError(storages.ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/puddle/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectedKind error
+	}{
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}, expectedKind: storages.ErrDuplicate},
+		{name: "duplicate idempotency key", err: &pgconn.PgError{Code: "23505", ConstraintName: "transactions_idempotency_key_key"},
+			expectedKind: storages.ErrIdempotencyKeyExists},
+		{name: "foreign key violation", err: &pgconn.PgError{Code: "23503"}, expectedKind: storages.ErrReferenceNotFound},
+		{name: "check violation", err: &pgconn.PgError{Code: "23514"}, expectedKind: storages.ErrConstraint},
+		{name: "serialization failure", err: &pgconn.PgError{Code: "40001"}, expectedKind: storages.ErrRetryable},
+		{name: "deadlock", err: fmt.Errorf("commit: %w", &pgconn.PgError{Code: "40P01"}), expectedKind: storages.ErrRetryable},
+		{name: "connection exception", err: &pgconn.PgError{Code: "08006"}, expectedKind: storages.ErrUnavailable},
+		{name: "admin shutdown", err: &pgconn.PgError{Code: "57P01"}, expectedKind: storages.ErrUnavailable},
+		{name: "closed pool", err: puddle.ErrClosedPool, expectedKind: storages.ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+
+			assert.ErrorIs(t, err, tt.expectedKind)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.expectedKind.Error(), err.Error())
+
+			var pgErr *pgconn.PgError
+			assert.Equal(t, errors.As(tt.err, &pgErr), errors.As(err, &pgErr))
+		})
+	}
+
+	unchanged := []error{
+		nil,
+		pgx.ErrNoRows,
+		context.DeadlineExceeded,
+		services.ErrInsufficientFunds,
+		&pgconn.PgError{Code: "42601"},
+	}
+	for _, err := range unchanged {
+		assert.Equal(t, err, classify(err))
+	}
+
+	classified := classify(&pgconn.PgError{Code: "23505"})
+	assert.Same(t, classified, classify(classified))
+}
@@ -13,18 +13,18 @@ import (
 func (s *PostgresDB) ExsistIdempotencyKey(ctx context.Context, uuid string) (bool, error) {
 	op := "Database: Idempotency Key check"
 	log := s.log.With(slog.String("operation", op))
-	log.Debug("ExsistIdempotencyKey func call", "uuid", uuid)
+	log.DebugContext(ctx, "ExsistIdempotencyKey func call", "uuid", uuid)
 
 	checkQuery := `SELECT EXISTS(SELECT 1 FROM transactions WHERE idempotency_key = $1);`
 
 	var exsist bool
 	row := s.db.QueryRow(ctx, checkQuery, uuid)
     if err := row.Scan(&exsist); err != nil {
-        log.Error("failed to retrieve data from the database", slog.Any("error", err))
-        return false, err
+        log.ErrorContext(ctx, "failed to retrieve data from the database", slog.Any("error", err))
+        return false, classify(err)
     }
 
-	log.Info("Idempotency check of the key was successful")
+	log.InfoContext(ctx, "Idempotency check of the key was successful")
 	return exsist, nil
 }
 
@@ -35,17 +35,17 @@ func (s *PostgresDB) ExsistIdempotencyKey(ctx context.Context, uuid string) (boo
 func (s *PostgresDB) ExsistUser(ctx context.Context, id uint) (bool, error) {
 	op := "Database: user check"
 	log := s.log.With(slog.String("operation", op))
-	log.Debug("ExsistUser func call", "user id", id)
+	log.DebugContext(ctx, "ExsistUser func call", "user id", id)
 
 	checkQuery := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1);`
 
 	var exsist bool
 	row := s.db.QueryRow(ctx, checkQuery, id)
 	if err := row.Scan(&exsist); err != nil {
-		log.Error("failed to retrieve data from the database", slog.Any("error", err))
-		return false, err
+		log.ErrorContext(ctx, "failed to retrieve data from the database", slog.Any("error", err))
+		return false, classify(err)
 	}
 
-	log.Info("user checked was successful")
+	log.InfoContext(ctx, "user checked was successful")
 	return exsist, nil
 }
\ No newline at end of file
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Ping checks that a connection to the database can be acquired and is alive
+func (s *PostgresDB) Ping(ctx context.Context) error {
+	op := "Database: ping"
+	log := s.log.With(slog.String("operation", op))
+
+	if err := s.db.Ping(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to ping the database", "error", err)
+		return classify(err)
+	}
+
+	return nil
+}
+
+// SchemaVersion reads the version of the applied migrations from the table of golang-migrate
+func (s *PostgresDB) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	op := "Database: schema version"
+	log := s.log.With(slog.String("operation", op))
+
+	var version int64
+	var dirty bool
+	err := s.db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1;`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, nil
+		}
+		log.ErrorContext(ctx, "failed to read the schema version", "error", err)
+		return 0, false, classify(err)
+	}
+
+	return uint(version), dirty, nil
+}
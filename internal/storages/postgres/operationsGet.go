@@ -17,14 +17,14 @@ import (
 func (s *PostgresDB) OperationsGet(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
 	op := "Database: get user operations "
 	log := s.log.With(slog.String("operation", op))
-	log.Debug("OperationsGet func call", "data", req)
+	log.DebugContext(ctx, "OperationsGet func call", "data", req)
 
 	queryGet := `
 		SELECT
 			t.id,
 			t.success,
 			t.type_operation,
-			CAST(t.amount AS FLOAT) / 100 AS amount,
+			t.amount,
 			t.date_operation,
 			CASE
 				WHEN t.type_operation != 'deposit' THEN u_sender.name
@@ -43,45 +43,48 @@ func (s *PostgresDB) OperationsGet(ctx context.Context, req *models.UserOperatio
 		WHERE
 			t.sender_id = $1 OR t.receiver_id = $1
 		ORDER BY
-			t.date_operation DESC
+			t.date_operation DESC,
+			t.id DESC
 		LIMIT $2 OFFSET $3;`
 
 	rows, err := s.db.Query(ctx, queryGet, req.UserID, req.Limit, req.Offset)
 	if err != nil {
-		log.Error("failed to retrieve records from the database", "error", err)
-		return nil, err
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, classify(err)
 	}
 	defer rows.Close()
 
 	var resp models.UserOperationsResponse
 	for rows.Next() {
 		var t models.Transaction
+		var amount int64
 		err := rows.Scan(
 			&t.ID,
 			&t.Success,
 			&t.TypeOperation,
-			&t.Amount,
+			&amount,
 			&t.Date,
 			&t.SenderName,
 			&t.ReceiverName,
 		)
 		if err != nil {
-			log.Error("failed to scan transaction", "error", err)
-			return nil, err
+			log.ErrorContext(ctx, "failed to scan transaction", "error", err)
+			return nil, classify(err)
 		}
+		t.Amount = storages.FromCents(amount)
 		resp.Operation = append(resp.Operation, &t)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Error("error after scanning rows", "error", err)
-		return nil, err
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return nil, classify(err)
 	}
 
 	if len(resp.Operation) == 0 {
-		log.Warn("user has no operations")
+		log.WarnContext(ctx, "user has no operations")
 		return nil, storages.ErrOperationsNotFound
 	}
 
-	log.Info("transactions were successfully retrieved from the database")
+	log.InfoContext(ctx, "transactions were successfully retrieved from the database")
 	return &resp, nil
 }
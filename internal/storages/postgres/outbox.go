@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// execer is implemented by both the pool and pgx.Tx, so an event is written either on its own or inside
+// the transaction of the balance change
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// OutboxAdd writes an event that is not a part of a balance change, e.g. transfer.failed. An event with the same ID
+// is written once.
+func (s *PostgresDB) OutboxAdd(ctx context.Context, event *models.Event) error {
+	op := "Database: outbox event creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "OutboxAdd func call", "type", event.Type, "id", event.ID)
+
+	if err := s.outboxAdd(ctx, s.db, event); err != nil {
+		log.ErrorContext(ctx, "failed to add the event to the outbox", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "event successfully added to the outbox")
+	return nil
+}
+
+// outboxAdd inserts the event into the outbox with db, the event that is already there is skipped
+func (s *PostgresDB) outboxAdd(ctx context.Context, db execer, event *models.Event) error {
+	queryCreate := `INSERT INTO outbox
+		(event_id, event_type, payload)
+		VALUES
+		($1, $2, $3)
+		ON CONFLICT (event_id) DO NOTHING;`
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(ctx, queryCreate, event.ID, event.Type, payload); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// outboxClaimLease is how long the events taken by a relay are hidden from the relays of the other instances. It is much
+// longer than publishing a batch, the events of a relay that stopped before marking them are taken again after it.
+const outboxClaimLease = time.Minute * 5
+
+// OutboxProcess claims up to limit unpublished events with one short statement and passes them to publish in the order
+// they were written outside of any database transaction, so a slow publisher holds no locks. The events are claimed
+// with FOR UPDATE SKIP LOCKED for outboxClaimLease, so the relays of several instances of the service take different
+// events and do not wait for each other. Every published event is marked at once. If publish fails, the claim of
+// the rest is released and they are passed again by the next call. An event that was published but not marked is
+// published again after the lease, so the delivery is at least once and the receivers drop duplicates by the ID.
+func (s *PostgresDB) OutboxProcess(ctx context.Context, limit int, publish func(ctx context.Context, event *models.Event) error) (int, error) {
+	op := "Database: outbox processing"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "OutboxProcess func call", "limit", limit)
+
+	releaseCtx := context.Background()
+
+	queryClaim := `UPDATE outbox
+		SET claimed_until = $2
+		WHERE id IN (
+			SELECT id
+			FROM outbox
+			WHERE published_at IS NULL
+				AND (claimed_until IS NULL OR claimed_until <= $1)
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, payload;`
+
+	queryPublished := `UPDATE outbox
+		SET published_at = now(), claimed_until = NULL
+		WHERE id = $1;`
+
+	queryRelease := `UPDATE outbox
+		SET claimed_until = NULL
+		WHERE id = ANY($1) AND published_at IS NULL;`
+
+	type pendingEvent struct {
+		id      int64
+		payload []byte
+	}
+
+	now := time.Now()
+	rows, err := s.db.Query(ctx, queryClaim, now, now.Add(outboxClaimLease), limit)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to claim records in the database", "error", err)
+		return 0, classify(err)
+	}
+
+	var pending []pendingEvent
+	for rows.Next() {
+		var item pendingEvent
+		if err := rows.Scan(&item.id, &item.payload); err != nil {
+			rows.Close()
+			log.ErrorContext(ctx, "failed to scan outbox event", "error", err)
+			return 0, classify(err)
+		}
+		pending = append(pending, item)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return 0, classify(err)
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(pending, func(i, j int) bool { return pending[i].id < pending[j].id })
+
+	// release gives the claimed events that were not published back to the next call
+	release := func(rest []pendingEvent) {
+		if len(rest) == 0 {
+			return
+		}
+		ids := make([]int64, 0, len(rest))
+		for _, item := range rest {
+			ids = append(ids, item.id)
+		}
+		if _, err := s.db.Exec(releaseCtx, queryRelease, ids); err != nil {
+			log.ErrorContext(ctx, "failed to release the claimed events, they are taken again after the lease", "error", err)
+		}
+	}
+
+	published := 0
+	for i, item := range pending {
+		var event models.Event
+		if err := json.Unmarshal(item.payload, &event); err != nil {
+			log.ErrorContext(ctx, "failed to decode the event", "outbox id", item.id, "error", err)
+			release(pending[i:])
+			return published, err
+		}
+
+		if err := publish(ctx, &event); err != nil {
+			log.WarnContext(ctx, "failed to publish the event", "id", event.ID, "error", err)
+			release(pending[i:])
+			return published, err
+		}
+
+		if _, err := s.db.Exec(ctx, queryPublished, item.id); err != nil {
+			log.ErrorContext(ctx, "failed to mark the event as published", "id", event.ID, "error", err)
+			release(pending[i+1:])
+			return published, classify(err)
+		}
+
+		published++
+	}
+
+	log.InfoContext(ctx, "outbox events successfully published", "count", published)
+	return published, nil
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	retryMaxAttempts = 5
+	retryBackoffBase = time.Millisecond * 20
+	retryBackoffMax  = time.Millisecond * 500
+)
+
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// isRetryable reports whether the error is a serialization failure or a deadlock, after which Postgres
+// has already rolled back the transaction and it is safe to execute it again from the beginning
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// withRetry executes fn and repeats it while it fails with a retryable error, but no more than retryMaxAttempts times.
+// The delay between attempts grows exponentially with a random jitter, so the competing transactions do not collide again.
+// fn must run the whole database transaction, from Begin to Commit.
+func withRetry(ctx context.Context, log *slog.Logger, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !isRetryable(err) || attempt >= retryMaxAttempts {
+			return err
+		}
+
+		delay := retryBackoffBase << (attempt - 1)
+		if delay > retryBackoffMax {
+			delay = retryBackoffMax
+		}
+		delay = delay/2 + rand.N(delay/2+1)
+
+		log.WarnContext(ctx, "transaction conflict, the transaction will be retried", "attempt", attempt, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const scheduleColumns = `
+	id,
+	sender_id,
+	receiver_id,
+	amount,
+	period,
+	next_run,
+	active,
+	attempts,
+	retry_at,
+	last_error,
+	created_at,
+	version,
+	anchor_day`
+
+func scanSchedule(row pgx.Row) (*models.ScheduledTransfer, error) {
+	var data models.ScheduledTransfer
+	var amount int64
+	if err := row.Scan(
+		&data.ID,
+		&data.SenderID,
+		&data.ReceiverID,
+		&amount,
+		&data.Period,
+		&data.NextRun,
+		&data.Active,
+		&data.Attempts,
+		&data.RetryAt,
+		&data.LastError,
+		&data.CreatedAt,
+		&data.Version,
+		&data.AnchorDay,
+	); err != nil {
+		return nil, classify(err)
+	}
+
+	data.Amount = storages.FromCents(amount)
+	return &data, nil
+}
+
+// ScheduleCreate inserts a new scheduled transfer into the database. The amount is converted to cents in the application,
+// the same way it is done for transactions. The generated ID and creation date are written back into the provided structure.
+func (s *PostgresDB) ScheduleCreate(ctx context.Context, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleCreate func call", "data", data)
+
+	createQuery := `INSERT INTO scheduled_transfers
+		(sender_id, receiver_id, amount, period, next_run, active, anchor_day)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at;`
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	row := s.db.QueryRow(ctx, createQuery, data.SenderID, data.ReceiverID, amount, data.Period, data.NextRun, data.Active, data.AnchorDay)
+	if err := row.Scan(&data.ID, &data.CreatedAt); err != nil {
+		log.ErrorContext(ctx, "failed to create scheduled transfer", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "scheduled transfer created successfully", "id", data.ID)
+	return nil
+}
+
+// ScheduleGet retrieves a scheduled transfer by its ID. If there is no such scheduled transfer, ErrScheduleNotFound is returned.
+func (s *PostgresDB) ScheduleGet(ctx context.Context, id uint) (*models.ScheduledTransfer, error) {
+	op := "Database: get scheduled transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleGet func call", "id", id)
+
+	queryGet := `SELECT` + scheduleColumns + ` FROM scheduled_transfers WHERE id = $1;`
+
+	data, err := scanSchedule(s.db.QueryRow(ctx, queryGet, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.WarnContext(ctx, "scheduled transfer not found", "id", id)
+			return nil, storages.ErrScheduleNotFound
+		}
+		log.ErrorContext(ctx, "failed to get the scheduled transfer", "error", err)
+		return nil, classify(err)
+	}
+
+	log.InfoContext(ctx, "scheduled transfer is successfully retrieved from the database")
+	return data, nil
+}
+
+// ScheduleUpdate overwrites the amount, period, next run date with its anchor day and activity flag of a scheduled transfer.
+// The retry state is reset, so the updated schedule starts from a clean slate. A claim of the schedule is dropped,
+// so a run in progress cannot overwrite the update with its result.
+func (s *PostgresDB) ScheduleUpdate(ctx context.Context, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer update"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleUpdate func call", "data", data)
+
+	updateQuery := `UPDATE scheduled_transfers
+		SET amount = $1,
+			period = $2,
+			next_run = $3,
+			anchor_day = $4,
+			active = $5,
+			attempts = 0,
+			retry_at = NULL,
+			last_error = NULL,
+			claimed_until = NULL,
+			version = version + 1
+		WHERE id = $6;`
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	tag, err := s.db.Exec(ctx, updateQuery, amount, data.Period, data.NextRun, data.AnchorDay, data.Active, data.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to update the scheduled transfer", "error", err)
+		return classify(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		log.WarnContext(ctx, "scheduled transfer not found", "id", data.ID)
+		return storages.ErrScheduleNotFound
+	}
+
+	log.InfoContext(ctx, "scheduled transfer successfully updated")
+	return nil
+}
+
+// ScheduleDelete removes a scheduled transfer together with the history of its runs.
+func (s *PostgresDB) ScheduleDelete(ctx context.Context, id uint) error {
+	op := "Database: scheduled transfer delete"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleDelete func call", "id", id)
+
+	deleteQuery := `DELETE FROM scheduled_transfers WHERE id = $1;`
+
+	tag, err := s.db.Exec(ctx, deleteQuery, id)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to delete the scheduled transfer", "error", err)
+		return classify(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		log.WarnContext(ctx, "scheduled transfer not found", "id", id)
+		return storages.ErrScheduleNotFound
+	}
+
+	log.InfoContext(ctx, "scheduled transfer successfully deleted")
+	return nil
+}
+
+// SchedulesDue claims active scheduled transfers whose run date (or retry date, if the last run failed) has come and
+// returns them. The claim is taken in one statement with FOR UPDATE SKIP LOCKED, so two instances never get the same
+// schedule: it is not due again until claimUntil or until its run is saved. The oldest runs are returned first,
+// no more than limit items.
+func (s *PostgresDB) SchedulesDue(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error) {
+	op := "Database: get due scheduled transfers"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "SchedulesDue func call", "now", now, "claim until", claimUntil, "limit", limit)
+
+	queryDue := `UPDATE scheduled_transfers
+		SET claimed_until = $2,
+			version = version + 1
+		WHERE id IN (
+			SELECT id
+			FROM scheduled_transfers
+			WHERE active
+				AND COALESCE(retry_at, next_run) <= $1
+				AND (claimed_until IS NULL OR claimed_until <= $1)
+			ORDER BY next_run
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING` + scheduleColumns + `;`
+
+	rows, err := s.db.Query(ctx, queryDue, now, claimUntil, limit)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, classify(err)
+	}
+	defer rows.Close()
+
+	var result []*models.ScheduledTransfer
+	for rows.Next() {
+		data, err := scanSchedule(rows)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to scan scheduled transfer", "error", err)
+			return nil, classify(err)
+		}
+		result = append(result, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return nil, classify(err)
+	}
+
+	// RETURNING does not keep the order of the subquery
+	storages.SortSchedules(result)
+
+	log.InfoContext(ctx, "due scheduled transfers were successfully retrieved", "count", len(result))
+	return result, nil
+}
+
+// ScheduleRunSave records the result of a scheduled transfer run and saves the new state of the schedule
+// (next run date, retry date, attempts) in one database transaction, so the history and the state never diverge.
+// The claim is released. If the schedule is no longer under the claim of data.Version, ErrScheduleChanged is returned.
+func (s *PostgresDB) ScheduleRunSave(ctx context.Context, run *models.ScheduledTransferRun, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer run save"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleRunSave func call", "run", run, "data", data)
+
+	rollbackCtx := context.Background()
+
+	insertRunQuery := `INSERT INTO scheduled_transfer_runs
+		(schedule_id, run_date, attempt, idempotency_key, success, error)
+		VALUES
+		($1, $2, $3, $4, $5, $6);`
+
+	updateScheduleQuery := `UPDATE scheduled_transfers
+		SET next_run = $1,
+			active = $2,
+			attempts = $3,
+			retry_at = $4,
+			last_error = $5,
+			claimed_until = NULL,
+			version = version + 1
+		WHERE id = $6 AND version = $7;`
+
+	// Start transaction
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return classify(err)
+	}
+
+	if _, err := tx.Exec(ctx, insertRunQuery, run.ScheduleID, run.RunDate, run.Attempt, run.IdempotencyKey, run.Success, run.Error); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query insert run in the database", "error", err)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	tag, err := tx.Exec(ctx, updateScheduleQuery, data.NextRun, data.Active, data.Attempts, data.RetryAt, data.LastError, data.ID, data.Version)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query update schedule in the database", "error", err)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		log.WarnContext(ctx, "scheduled transfer was changed after it was claimed, the run is not saved", "id", data.ID)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return storages.ErrScheduleChanged
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.ErrorContext(ctx, "!!!ATTENTION!!! failed to commit transaction", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "scheduled transfer run successfully saved")
+	return nil
+}
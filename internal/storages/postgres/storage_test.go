@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/storages/storagetest"
+)
+
+type testStore struct {
+	*PostgresDB
+}
+
+func (s testStore) CreateUser(t *testing.T, balance int64) uint {
+	return createTestUser(t, s.PostgresDB, balance)
+}
+
+func (s testStore) Balance(t *testing.T, id uint) int64 {
+	return userBalance(t, s.PostgresDB, id)
+}
+
+func TestPostgresDB_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Store {
+		return testStore{newTestDB(t)}
+	})
+}
@@ -2,10 +2,13 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"time"
 
+	"github.com/EvansTrein/iqProgers/internal/storages"
 	"github.com/EvansTrein/iqProgers/models"
+	"github.com/jackc/pgx/v5"
 )
 
 // TransactionCreate inserts a new transaction record into the database. Depending on the transaction type (deposit or transfer),
@@ -17,81 +20,92 @@ import (
 func (s *PostgresDB) TransactionCreate(ctx context.Context, data *models.Transaction) error {
 	op := "Database: transaction creation"
 	log := s.log.With(slog.String("operation", op))
-	log.Debug("createTransaction func call", "data", data)
+	log.DebugContext(ctx, "createTransaction func call", "data", data)
 
 	createDepositQuery := `INSERT INTO transactions
 		(sender_id, idempotency_key, type_operation, amount)
 		VALUES
-		($1, $2, $3, (ROUND($4::numeric, 2) * 100)::bigint)
+		($1, $2, $3, $4)
 		RETURNING id, date_operation;`
 
 	createTransferQuery := `INSERT INTO transactions
 		(sender_id, receiver_id, idempotency_key, type_operation, amount)
 		VALUES
-		($1, $2, $3, $4, (ROUND($5::numeric, 2) * 100)::bigint)
+		($1, $2, $3, $4, $5)
 		RETURNING id, date_operation;`
 
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
 	var id uint
 	var dateOperation time.Time
 
 	switch data.TypeOperation {
 	case "deposit":
-		row := s.db.QueryRow(ctx, createDepositQuery, data.SenderID, data.IdempotencyKey, data.TypeOperation, data.Amount)
+		row := s.db.QueryRow(ctx, createDepositQuery, data.SenderID, data.IdempotencyKey, data.TypeOperation, amount)
 		if err := row.Scan(&id, &dateOperation); err != nil {
-			log.Error("failed to create transaction", "error", err)
-			return err
+			log.ErrorContext(ctx, "failed to create transaction", "error", err)
+			return classify(err)
 		}
 	case "transfer":
-		row := s.db.QueryRow(ctx, createTransferQuery, data.SenderID, data.ReceiverID, data.IdempotencyKey, data.TypeOperation, data.Amount)
+		row := s.db.QueryRow(ctx, createTransferQuery, data.SenderID, data.ReceiverID, data.IdempotencyKey, data.TypeOperation, amount)
 		if err := row.Scan(&id, &dateOperation); err != nil {
-			log.Error("failed to create transaction", "error", err)
-			return err
+			log.ErrorContext(ctx, "failed to create transaction", "error", err)
+			return classify(err)
 		}
 	}
 
 	data.ID = id
 	data.Date = dateOperation
 
-	log.Info("transaction created successfully", "id", id)
+	log.InfoContext(ctx, "transaction created successfully", "id", id)
 	return nil
 }
 
 // TransactionSetResult updates the success status of a transaction in the database using the provided idempotency key.
-// It executes an SQL query to set the `success` field of the transaction record to the specified value (true or false).
-// If the update operation fails, the error is logged and returned. This function is used to mark the outcome of a transaction
-func (s *PostgresDB) TransactionSetResult(ctx context.Context, idempotencyKey string, success bool) error {
+// It executes an SQL query to set the `success` field of the transaction record to the specified value (true or false)
+// and returns the ID of the transaction. The query is executed within the given database transaction, so the result is
+// committed together with the balance change. If the update operation fails, the error is logged and returned.
+// This function is used to mark the outcome of a transaction
+func (s *PostgresDB) TransactionSetResult(ctx context.Context, tx pgx.Tx, idempotencyKey string, success bool) (uint, error) {
 	op := "Database: transaction result"
 	log := s.log.With(slog.String("operation", op))
-	log.Debug("TransactionSetResult func call", "success", success)
+	log.DebugContext(ctx, "TransactionSetResult func call", "success", success)
 
 	resultQuery := `UPDATE transactions
 		SET success = $1
-		WHERE idempotency_key = $2;`
+		WHERE idempotency_key = $2
+		RETURNING id;`
 
-	if _, err := s.db.Exec(ctx, resultQuery, success, idempotencyKey); err != nil {
-		log.Error("failed to update the user transaction result in the database", "error", err)
-		return err
+	var id uint
+	if err := tx.QueryRow(ctx, resultQuery, success, idempotencyKey).Scan(&id); err != nil {
+		log.ErrorContext(ctx, "failed to update the user transaction result in the database", "error", err)
+		return 0, classify(err)
 	}
 
-	log.Info("user transaction result in the database was successfully updated")
-	return nil
+	log.InfoContext(ctx, "user transaction result in the database was successfully updated")
+	return id, nil
 }
 
 // TransactionGet retrieves a transaction from the database using the provided idempotency key. It queries the database
 // to fetch details of the transaction, including its ID, success status, type, amount, date, and associated sender/receiver
 // names (if applicable). The function joins the `transactions` table with the `users` table to retrieve sender and receiver
-// names for non-deposit transactions. If the query fails or the transaction is not found, the error is logged and returned.
+// names for non-deposit transactions. If the transaction is not found, ErrTransactionNotFound is returned.
+// If the query fails, the error is logged and returned.
 func (s *PostgresDB) TransactionGet(ctx context.Context, idempotencyKey string) (*models.Transaction, error) {
 	op := "Database: get transactions"
 	log := s.log.With(slog.String("operation", op))
-	log.Debug("TransactionGet func call", "idempotencyKey", idempotencyKey)
+	log.DebugContext(ctx, "TransactionGet func call", "idempotencyKey", idempotencyKey)
 
 	queryGet := `
 		SELECT
 			t.id,
 			t.success,
 			t.type_operation,
-			CAST(t.amount AS FLOAT) / 100 AS amount,
+			t.amount,
 			t.date_operation,
 			CASE
 				WHEN t.type_operation != 'deposit' THEN u_sender.name
@@ -111,23 +125,30 @@ func (s *PostgresDB) TransactionGet(ctx context.Context, idempotencyKey string)
 			t.idempotency_key = $1;`
 
 	var transaction models.Transaction
+	var amount int64
 
 	row := s.db.QueryRow(ctx, queryGet, idempotencyKey)
 	if err := row.Scan(
 		&transaction.ID,
 		&transaction.Success,
 		&transaction.TypeOperation,
-		&transaction.Amount,
+		&amount,
 		&transaction.Date,
 		&transaction.SenderName,
 		&transaction.ReceiverName,
 	); err != nil {
-		log.Error("failed to get the transaction", "error", err)
-		return nil, err
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.WarnContext(ctx, "transaction not found")
+			return nil, storages.ErrTransactionNotFound
+		}
+		log.ErrorContext(ctx, "failed to get the transaction", "error", err)
+		return nil, classify(err)
 	}
 
-	log.Debug("data was retrieved from the database", "transaction", transaction)
+	transaction.Amount = storages.FromCents(amount)
+
+	log.DebugContext(ctx, "data was retrieved from the database", "transaction", transaction)
 
-	log.Info("transaction is successfully retrieved from the database")
+	log.InfoContext(ctx, "transaction is successfully retrieved from the database")
 	return &transaction, nil
 }
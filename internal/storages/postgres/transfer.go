@@ -4,38 +4,54 @@ import (
 	"context"
 	"log/slog"
 
-	"github.com/EvansTrein/iqProgers/models"
 	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
 )
 
 // Transfer handles the transfer of funds between two users within a database transaction. It locks the sender and receiver accounts
 // to prevent concurrent updates, checks the sender's balance to ensure sufficient funds, and updates the balances of both the sender
 // and receiver. It also verifies that the sender's balance does not become negative after the transfer. If any step fails (e.g.,
 // insufficient funds, negative balance, or database errors), the transaction is rolled back, and the error is logged and returned.
-// On success, it updates the transaction result and commits the transaction. This function ensures that the transfer operation is
+// On success, it updates the transaction result, writes the transfer.completed event to the outbox and commits the transaction. This function ensures that the transfer operation is
 // atomic, consistent, and secure.
+//
+// Both accounts are locked by one query in the order of their IDs, so the concurrent transfers A->B and B->A always take the locks
+// in the same order and cannot deadlock each other. If Postgres still aborts the transaction with a serialization failure or
+// a deadlock (e.g. a conflict with another kind of query), the whole transaction is retried with backoff.
 func (s *PostgresDB) Transfer(ctx context.Context, data *models.Transaction) error {
 	op := "Database: account transfer"
 	log := s.log.With(slog.String("operation", op))
-	log.Debug("Transfer func call", "data", data)
+	log.DebugContext(ctx, "Transfer func call", "data", data)
+
+	if err := withRetry(ctx, log, func() error {
+		return s.transfer(ctx, log, data)
+	}); err != nil {
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "transaction successfully completed")
+	return nil
+}
 
+func (s *PostgresDB) transfer(ctx context.Context, log *slog.Logger, data *models.Transaction) error {
 	rollbackCtx := context.Background()
 
-	queryLock := `SELECT id FROM users WHERE id = $1 FOR UPDATE;`
+	queryLock := `SELECT id FROM users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE;`
 
 	queryCheckBalance := `
 	WITH sender_balance AS (
 			SELECT balance FROM users WHERE id = $1
 		)
-	SELECT (balance >= (ROUND($2::numeric, 2) * 100)::bigint)
+	SELECT balance >= $2
 	FROM sender_balance;`
 
 	queryUpdateSender := `UPDATE users
-		SET balance = balance - (ROUND($1::numeric, 2) * 100)::bigint
+		SET balance = balance - $1
 		WHERE id = $2;`
 
 	queryUpdateReceiver := `UPDATE users
-		SET balance = balance + (ROUND($1::numeric, 2) * 100)::bigint
+		SET balance = balance + $1
 		WHERE id = $2;`
 
 	queryCheckNegativeBalance := `SELECT balance >= 0
@@ -52,103 +68,108 @@ func (s *PostgresDB) Transfer(ctx context.Context, data *models.Transaction) err
 	WHERE
 		u_sender.id = $1;`
 
-	// Start transaction
-	tx, err := s.db.Begin(ctx)
+	amount, err := storages.ToCents(data.Amount)
 	if err != nil {
-		log.Error("failed to begin transaction", "error", err)
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
 		return err
 	}
 
-	if _, err := tx.Exec(ctx, queryLock, data.SenderID); err != nil {
-		log.Error("failed to execute SQL query lock sender in the database", "error", err)
-		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
-		}
-		return err
+	// Start transaction
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return classify(err)
 	}
 
-	if _, err := tx.Exec(ctx, queryLock, data.ReceiverID); err != nil {
-		log.Error("failed to execute SQL query lock receiver in the database", "error", err)
+	if _, err := tx.Exec(ctx, queryLock, data.SenderID, data.ReceiverID); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query lock sender and receiver in the database", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
 	}
 
 	var checkBalance bool
-	row := tx.QueryRow(ctx, queryCheckBalance, data.SenderID, data.Amount)
-	if err != row.Scan(&checkBalance) {
-		log.Error("failed to execute SQL query check balance in the database", "error", err)
+	row := tx.QueryRow(ctx, queryCheckBalance, data.SenderID, amount)
+	if err := row.Scan(&checkBalance); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query check balance in the database", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
 	}
 
 	if !checkBalance {
-		log.Warn("insufficient account balance")
+		log.WarnContext(ctx, "insufficient account balance")
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
 		return services.ErrInsufficientFunds
 	}
 
-	if _, err := tx.Exec(ctx, queryUpdateSender, data.Amount, data.SenderID); err != nil {
-		log.Error("failed to execute SQL query update sender in the database", "error", err)
+	if _, err := tx.Exec(ctx, queryUpdateSender, amount, data.SenderID); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query update sender in the database", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
 	}
 
 	var isBalanceNonNegative bool
 	row = tx.QueryRow(ctx, queryCheckNegativeBalance, data.SenderID)
-	if err != row.Scan(&isBalanceNonNegative) {
-		log.Error("failed to execute SQL query check negative balance in the database", "error", err)
+	if err := row.Scan(&isBalanceNonNegative); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query check negative balance in the database", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
 	}
 
 	if !isBalanceNonNegative {
-		log.Warn("negative balance")
+		log.WarnContext(ctx, "negative balance")
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
 		return services.ErrNegaticeBalance
 	}
 
-	if _, err := tx.Exec(ctx, queryUpdateReceiver, data.Amount, data.ReceiverID); err != nil {
-		log.Error("failed to execute SQL query update receiver in the database", "error", err)
+	if _, err := tx.Exec(ctx, queryUpdateReceiver, amount, data.ReceiverID); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query update receiver in the database", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
 	}
 
 	row = tx.QueryRow(ctx, queryGetName, data.SenderID, data.ReceiverID)
 	if err := row.Scan(&data.SenderName, &data.ReceiverName); err != nil {
-		log.Error("failed to execute SQL query get name in the database", "error", err)
+		log.ErrorContext(ctx, "failed to execute SQL query get name in the database", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
 	}
 
-	if err := s.TransactionSetResult(ctx, data.IdempotencyKey, true); err != nil {
-		log.Error("failed to set the result of user transaction", "error", err)
+	if _, err := s.TransactionSetResult(ctx, tx, data.IdempotencyKey, true); err != nil {
+		log.ErrorContext(ctx, "failed to set the result of user transaction", "error", err)
 		if err := tx.Rollback(rollbackCtx); err != nil {
-			log.Error("!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
 		}
-		return err
+		return classify(err)
+	}
+
+	if err := s.outboxAdd(ctx, tx, services.TransferEvent(data, nil)); err != nil {
+		log.ErrorContext(ctx, "failed to add the event to the outbox", "error", err)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		log.Error("!!!ATTENTION!!! failed to commit transaction", "error", err)
-		return err
+		log.ErrorContext(ctx, "!!!ATTENTION!!! failed to commit transaction", "error", err)
+		return classify(err)
 	}
 
-	log.Info("transaction successfully completed")
 	return nil
 }
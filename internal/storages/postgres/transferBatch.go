@@ -0,0 +1,302 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// TransferBatch transfers funds from one sender to many receivers within a single database transaction. The sender and all
+// receivers are locked once, in the order of their IDs, before any balance is changed. Every item is executed in its own
+// savepoint with the same checks as Transfer. In the atomic mode the first failed item rolls back the whole batch. In the
+// best_effort mode a failed item (insufficient funds or a failed pre-check from the service) is rolled back to its savepoint
+// and recorded with its error, while the other items are still executed. Database errors always roll back the whole batch.
+// The batch, the result and the event of every item are saved, so a replay with the same Idempotency-Key returns the same
+// results. Like Transfer, the whole batch is retried with backoff on a serialization failure or a deadlock.
+func (s *PostgresDB) TransferBatch(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error) {
+	op := "Database: batch transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "TransferBatch func call", "sender id", req.SenderID, "mode", req.Mode, "items", len(req.Items))
+
+	amounts, err := storages.ItemsToCents(req.Items)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "error", err)
+		return nil, err
+	}
+
+	var resp *models.TransferBatchResponse
+	if err := withRetry(ctx, log, func() error {
+		var err error
+		resp, err = s.transferBatch(ctx, log, req, amounts)
+		return classify(err)
+	}); err != nil {
+		return nil, classify(err)
+	}
+
+	log.InfoContext(ctx, "batch transfer successfully completed", "batch id", resp.Batch.ID, "success", resp.Batch.Success)
+	return resp, nil
+}
+
+func (s *PostgresDB) transferBatch(ctx context.Context, log *slog.Logger, req *models.TransferBatchRequest, amounts []int64) (*models.TransferBatchResponse, error) {
+	rollbackCtx := context.Background()
+
+	queryCreateBatch := `INSERT INTO transfer_batches
+		(idempotency_key, sender_id, mode)
+		VALUES
+		($1, $2, $3)
+		RETURNING id, date_operation;`
+
+	queryLock := `SELECT id FROM users WHERE id = ANY($1) ORDER BY id FOR UPDATE;`
+
+	queryCreateItem := `INSERT INTO transfer_batch_items
+		(batch_id, position, receiver_id, amount, transaction_id, success, error)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7);`
+
+	querySetResult := `UPDATE transfer_batches
+		SET success = $1
+		WHERE id = $2;`
+
+	batch := models.TransferBatch{
+		IdempotencyKey: req.IdempotencyKey,
+		SenderID:       req.SenderID,
+		Mode:           req.Mode,
+	}
+
+	// Start transaction
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return nil, classify(err)
+	}
+
+	row := tx.QueryRow(ctx, queryCreateBatch, req.IdempotencyKey, req.SenderID, req.Mode)
+	if err := row.Scan(&batch.ID, &batch.Date); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query create batch in the database", "error", err)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return nil, classify(err)
+	}
+
+	ids := []int64{int64(req.SenderID)}
+	for _, item := range req.Items {
+		ids = append(ids, int64(item.ReceiverID))
+	}
+
+	if _, err := tx.Exec(ctx, queryLock, ids); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query lock users in the database", "error", err)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return nil, classify(err)
+	}
+
+	batch.Success = true
+	results := make([]*models.TransferBatchResult, 0, len(req.Items))
+
+	for i, item := range req.Items {
+		result := models.TransferBatchResult{
+			Position:   i,
+			ReceiverID: item.ReceiverID,
+			Amount:     item.Amount,
+			Success:    true,
+		}
+
+		var itemErr error
+		if item.Err != nil {
+			itemErr = item.Err
+		} else if err := s.transferBatchItem(ctx, tx, req.SenderID, item, amounts[i], &result); err != nil {
+			if req.Mode == services.BatchModeAtomic || !errors.Is(err, services.ErrInsufficientFunds) {
+				log.WarnContext(ctx, "batch transfer failed", "position", i, "error", err)
+				if err := tx.Rollback(rollbackCtx); err != nil {
+					log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+				}
+				return nil, classify(err)
+			}
+			itemErr = err
+		}
+
+		if itemErr != nil {
+			msg := itemErr.Error()
+			result.Success = false
+			result.Error = &msg
+			result.Err = itemErr
+			batch.Success = false
+		}
+
+		if _, err := tx.Exec(ctx, queryCreateItem, batch.ID, i, item.ReceiverID, amounts[i], result.Transaction, result.Success, result.Error); err != nil {
+			log.ErrorContext(ctx, "failed to execute SQL query create batch item in the database", "error", err)
+			if err := tx.Rollback(rollbackCtx); err != nil {
+				log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			}
+			return nil, classify(err)
+		}
+
+		if err := s.outboxAdd(ctx, tx, services.BatchItemEvent(req, &result)); err != nil {
+			log.ErrorContext(ctx, "failed to add the event to the outbox", "error", err)
+			if err := tx.Rollback(rollbackCtx); err != nil {
+				log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			}
+			return nil, classify(err)
+		}
+
+		results = append(results, &result)
+	}
+
+	if _, err := tx.Exec(ctx, querySetResult, batch.Success, batch.ID); err != nil {
+		log.ErrorContext(ctx, "failed to set the result of the batch", "error", err)
+		if err := tx.Rollback(rollbackCtx); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return nil, classify(err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.ErrorContext(ctx, "!!!ATTENTION!!! failed to commit transaction", "error", err)
+		return nil, classify(err)
+	}
+
+	return &models.TransferBatchResponse{Batch: &batch, Results: results}, nil
+}
+
+// transferBatchItem executes one item of a batch inside a savepoint of the batch transaction. The users are already locked
+// by TransferBatch. If the sender does not have enough funds, the savepoint is rolled back and ErrInsufficientFunds is returned.
+func (s *PostgresDB) transferBatchItem(ctx context.Context, tx pgx.Tx, senderID uint, item *models.TransferBatchItem, amount int64, result *models.TransferBatchResult) error {
+	rollbackCtx := context.Background()
+
+	queryCheckBalance := `SELECT balance >= $2
+		FROM users WHERE id = $1;`
+
+	queryCreateTransaction := `INSERT INTO transactions
+		(sender_id, receiver_id, idempotency_key, type_operation, amount, success)
+		VALUES
+		($1, $2, $3, 'transfer', $4, true)
+		RETURNING id;`
+
+	queryUpdateSender := `UPDATE users
+		SET balance = balance - $1
+		WHERE id = $2;`
+
+	queryUpdateReceiver := `UPDATE users
+		SET balance = balance + $1
+		WHERE id = $2;`
+
+	// Start savepoint
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return classify(err)
+	}
+
+	var checkBalance bool
+	if err := sp.QueryRow(ctx, queryCheckBalance, senderID, amount).Scan(&checkBalance); err != nil {
+		if err := sp.Rollback(rollbackCtx); err != nil {
+			s.log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback savepoint", "error", err)
+		}
+		return classify(err)
+	}
+
+	if !checkBalance {
+		if err := sp.Rollback(rollbackCtx); err != nil {
+			s.log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback savepoint", "error", err)
+			return classify(err)
+		}
+		return services.ErrInsufficientFunds
+	}
+
+	var transactionID uint
+	if err := sp.QueryRow(ctx, queryCreateTransaction, senderID, item.ReceiverID, item.IdempotencyKey, amount).Scan(&transactionID); err != nil {
+		if err := sp.Rollback(rollbackCtx); err != nil {
+			s.log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback savepoint", "error", err)
+		}
+		return classify(err)
+	}
+
+	if _, err := sp.Exec(ctx, queryUpdateSender, amount, senderID); err != nil {
+		if err := sp.Rollback(rollbackCtx); err != nil {
+			s.log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback savepoint", "error", err)
+		}
+		return classify(err)
+	}
+
+	if _, err := sp.Exec(ctx, queryUpdateReceiver, amount, item.ReceiverID); err != nil {
+		if err := sp.Rollback(rollbackCtx); err != nil {
+			s.log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback savepoint", "error", err)
+		}
+		return classify(err)
+	}
+
+	if err := sp.Commit(ctx); err != nil {
+		return classify(err)
+	}
+
+	result.Transaction = &transactionID
+	return nil
+}
+
+// TransferBatchGet retrieves a batch and the results of its items by the Idempotency-Key of the batch.
+// If there is no such batch, ErrBatchNotFound is returned.
+func (s *PostgresDB) TransferBatchGet(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error) {
+	op := "Database: get batch transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "TransferBatchGet func call", "idempotencyKey", idempotencyKey)
+
+	queryGetBatch := `SELECT id, sender_id, mode, success, date_operation
+		FROM transfer_batches
+		WHERE idempotency_key = $1;`
+
+	queryGetItems := `SELECT
+			position,
+			receiver_id,
+			amount,
+			success,
+			error,
+			transaction_id
+		FROM transfer_batch_items
+		WHERE batch_id = $1
+		ORDER BY position;`
+
+	batch := models.TransferBatch{IdempotencyKey: idempotencyKey}
+
+	row := s.db.QueryRow(ctx, queryGetBatch, idempotencyKey)
+	if err := row.Scan(&batch.ID, &batch.SenderID, &batch.Mode, &batch.Success, &batch.Date); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.DebugContext(ctx, "batch not found")
+			return nil, storages.ErrBatchNotFound
+		}
+		log.ErrorContext(ctx, "failed to get the batch", "error", err)
+		return nil, classify(err)
+	}
+
+	rows, err := s.db.Query(ctx, queryGetItems, batch.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, classify(err)
+	}
+	defer rows.Close()
+
+	var results []*models.TransferBatchResult
+	for rows.Next() {
+		var r models.TransferBatchResult
+		var amount int64
+		if err := rows.Scan(&r.Position, &r.ReceiverID, &amount, &r.Success, &r.Error, &r.Transaction); err != nil {
+			log.ErrorContext(ctx, "failed to scan batch item", "error", err)
+			return nil, classify(err)
+		}
+		r.Amount = storages.FromCents(amount)
+		results = append(results, &r)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return nil, classify(err)
+	}
+
+	log.InfoContext(ctx, "batch is successfully retrieved from the database")
+	return &models.TransferBatchResponse{Batch: &batch, Results: results}, nil
+}
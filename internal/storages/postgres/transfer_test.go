@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDB connects to the database from TEST_DATABASE_URL and applies the migrations.
+// The test is skipped if the variable is not set.
+func newTestDB(t *testing.T) *PostgresDB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	migrateDb, err := migrate.New("file://../../../migrations", url)
+	require.NoError(t, err)
+	if err := migrateDb.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		require.NoError(t, err)
+	}
+
+	db, err := New(url, &config.Storage{MaxConns: 4}, logs.NewDiscardLogger())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func createTestUser(t *testing.T, db *PostgresDB, balance int64) uint {
+	t.Helper()
+
+	var id uint
+	err := db.db.QueryRow(context.Background(), `INSERT INTO users (name, balance) VALUES ('test', $1) RETURNING id;`, balance).Scan(&id)
+	require.NoError(t, err)
+
+	return id
+}
+
+func userBalance(t *testing.T, db *PostgresDB, id uint) int64 {
+	t.Helper()
+
+	var balance int64
+	err := db.db.QueryRow(context.Background(), `SELECT balance FROM users WHERE id = $1;`, id).Scan(&balance)
+	require.NoError(t, err)
+
+	return balance
+}
+
+func TestPostgresDB_Transfer_OpposingConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	const startBalance = 100000 // 1000.00
+	const transfers = 50
+	const amount = 10.25
+
+	userA := createTestUser(t, db, startBalance)
+	userB := createTestUser(t, db, startBalance)
+
+	transfer := func(sender, receiver uint) error {
+		data := models.Transaction{
+			IdempotencyKey: uuid.NewString(),
+			SenderID:       sender,
+			ReceiverID:     receiver,
+			TypeOperation:  "transfer",
+			Amount:         amount,
+		}
+		if err := db.TransactionCreate(ctx, &data); err != nil {
+			return err
+		}
+		return db.Transfer(ctx, &data)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*transfers)
+	for i := 0; i < transfers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- transfer(userA, userB)
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- transfer(userB, userA)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, int64(startBalance), userBalance(t, db, userA))
+	assert.Equal(t, int64(startBalance), userBalance(t, db, userB))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(&pgconn.PgError{Code: sqlStateSerializationFailure}))
+	assert.True(t, isRetryable(fmt.Errorf("commit: %w", &pgconn.PgError{Code: sqlStateDeadlockDetected})))
+	assert.False(t, isRetryable(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, isRetryable(errors.New("some error")))
+	assert.False(t, isRetryable(nil))
+}
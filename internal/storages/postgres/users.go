@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *PostgresDB) UserGet(ctx context.Context, id uint) (*models.User, error) {
+	op := "Database: get user"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "UserGet func call", "user id", id)
+
+	queryGet := `SELECT id, name, balance FROM users WHERE id = $1;`
+
+	var user models.User
+	var balance int64
+
+	row := s.db.QueryRow(ctx, queryGet, id)
+	if err := row.Scan(&user.ID, &user.Name, &balance); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.WarnContext(ctx, "user not found")
+			return nil, storages.ErrUserNotFound
+		}
+		log.ErrorContext(ctx, "failed to get the user", "error", err)
+		return nil, classify(err)
+	}
+
+	user.Balance = storages.FromCents(balance)
+
+	log.InfoContext(ctx, "user is successfully retrieved from the database")
+	return &user, nil
+}
@@ -0,0 +1,77 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	_ "modernc.org/sqlite"
+)
+
+// pragmas are applied to every connection of the pool. Foreign keys are off in SQLite by default, busy_timeout makes a writer
+// wait for the lock instead of failing at once, WAL lets readers work while a write transaction is open. _txlock=immediate
+// makes every transaction start with BEGIN IMMEDIATE, so it takes the write lock before its first read. This is the SQLite
+// counterpart of the row locks in Postgres: the balance that was checked cannot change before the transaction commits.
+const pragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite"
+
+type SQLiteDB struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func New(storagePath string, conf *config.Storage, log *slog.Logger) (*SQLiteDB, error) {
+	log.Debug("database: connection to SQLite started")
+
+	sep := "?"
+	if strings.Contains(storagePath, "?") {
+		sep = "&"
+	}
+
+	db, err := sql.Open("sqlite", "file:"+storagePath+sep+pragmas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if conf.MaxConns > 0 {
+		db.SetMaxOpenConns(int(conf.MaxConns))
+	}
+	if conf.MinConns > 0 {
+		db.SetMaxIdleConns(int(conf.MinConns))
+	}
+	db.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
+
+	if err := db.PingContext(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	log.Info("database: connect to SQLite successfully")
+	return &SQLiteDB{db: db, log: log}, nil
+}
+
+func (s *SQLiteDB) Close() error {
+	s.log.Debug("database: stop started")
+
+	if s.db == nil {
+		return fmt.Errorf("database connection is already closed")
+	}
+
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+
+	s.db = nil
+
+	s.log.Info("database: stop successful")
+	return nil
+}
+
+// now returns the current time in UTC. SQLite keeps dates as text, all of them are written in UTC,
+// so that they are compared and sorted correctly.
+func now() time.Time {
+	return time.Now().UTC()
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"log/slog"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// Deposit adds the amount to the user's balance, marks the transaction as successful and writes the deposit.completed event
+// to the outbox within one database transaction.
+// The transaction starts with BEGIN IMMEDIATE, so concurrent writers wait for each other. If the user does not exist,
+// ErrUserNotFound is returned and nothing is changed.
+func (s *SQLiteDB) Deposit(ctx context.Context, req *models.DepositRequest) error {
+	op := "Database: account deposit"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "Deposit func call", "data", req)
+
+	amount, err := storages.ToCents(req.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", req.Amount)
+		return err
+	}
+
+	updateQuery := `UPDATE users
+		SET balance = balance + ?
+		WHERE id = ?;`
+
+	// Start transaction
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return classify(err)
+	}
+
+	res, err := tx.ExecContext(ctx, updateQuery, amount, req.UserID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query to update the balance in the database", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		log.WarnContext(ctx, "user not found", "id", req.UserID)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		if err != nil {
+			return classify(err)
+		}
+		return storages.ErrUserNotFound
+	}
+
+	transactionID, err := s.TransactionSetResult(ctx, tx, req.IdempotencyKey, true)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to set the result of user transaction", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if err := s.outboxAdd(ctx, tx, services.DepositEvent(req, transactionID)); err != nil {
+		log.ErrorContext(ctx, "failed to add the event to the outbox", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorContext(ctx, "!!!ATTENTION!!! failed to commit transaction", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "transaction successfully completed")
+	return nil
+}
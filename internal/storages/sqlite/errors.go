@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// classify translates an error of the SQLite driver into one of the storage error kinds. Errors that are not driver errors
+// (domain errors, context cancellation, sql.ErrNoRows that the methods handle themselves) are returned unchanged,
+// as well as the SQLite errors that do not belong to any kind.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *storages.Error
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch code := sqliteErr.Code(); {
+		// the text names the failed columns, e.g. UNIQUE constraint failed: transactions.idempotency_key
+		case code == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(sqliteErr.Error(), ".idempotency_key"):
+			return storages.NewError(storages.ErrIdempotencyKeyExists, err)
+		case code == sqlite3.SQLITE_CONSTRAINT_UNIQUE,
+			code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return storages.NewError(storages.ErrDuplicate, err)
+		case code == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return storages.NewError(storages.ErrReferenceNotFound, err)
+		case code&0xff == sqlite3.SQLITE_CONSTRAINT:
+			return storages.NewError(storages.ErrConstraint, err)
+		case code&0xff == sqlite3.SQLITE_BUSY,
+			code&0xff == sqlite3.SQLITE_LOCKED:
+			return storages.NewError(storages.ErrRetryable, err)
+		case code&0xff == sqlite3.SQLITE_CANTOPEN,
+			code&0xff == sqlite3.SQLITE_IOERR,
+			code&0xff == sqlite3.SQLITE_FULL:
+			return storages.NewError(storages.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	if errors.Is(err, sql.ErrConnDone) {
+		return storages.NewError(storages.ErrUnavailable, err)
+	}
+
+	return err
+}
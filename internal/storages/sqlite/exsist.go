@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"context"
+	"log/slog"
+)
+
+// ExsistIdempotencyKey checks if a transaction with the given idempotency key already exists in the database.
+func (s *SQLiteDB) ExsistIdempotencyKey(ctx context.Context, uuid string) (bool, error) {
+	op := "Database: Idempotency Key check"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ExsistIdempotencyKey func call", "uuid", uuid)
+
+	checkQuery := `SELECT EXISTS(SELECT 1 FROM transactions WHERE idempotency_key = ?);`
+
+	var exsist bool
+	row := s.db.QueryRowContext(ctx, checkQuery, uuid)
+	if err := row.Scan(&exsist); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve data from the database", slog.Any("error", err))
+		return false, classify(err)
+	}
+
+	log.InfoContext(ctx, "Idempotency check of the key was successful")
+	return exsist, nil
+}
+
+// ExsistUser checks if a user with the specified ID exists in the database.
+func (s *SQLiteDB) ExsistUser(ctx context.Context, id uint) (bool, error) {
+	op := "Database: user check"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ExsistUser func call", "user id", id)
+
+	checkQuery := `SELECT EXISTS(SELECT 1 FROM users WHERE id = ?);`
+
+	var exsist bool
+	row := s.db.QueryRowContext(ctx, checkQuery, id)
+	if err := row.Scan(&exsist); err != nil {
+		log.ErrorContext(ctx, "failed to retrieve data from the database", slog.Any("error", err))
+		return false, classify(err)
+	}
+
+	log.InfoContext(ctx, "user checked was successful")
+	return exsist, nil
+}
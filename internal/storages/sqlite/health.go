@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+)
+
+// Ping checks that the database file can be opened
+func (s *SQLiteDB) Ping(ctx context.Context) error {
+	op := "Database: ping"
+	log := s.log.With(slog.String("operation", op))
+
+	if err := s.db.PingContext(ctx); err != nil {
+		log.ErrorContext(ctx, "failed to ping the database", "error", err)
+		return classify(err)
+	}
+
+	return nil
+}
+
+// SchemaVersion reads the version of the applied migrations from the table of golang-migrate
+func (s *SQLiteDB) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	op := "Database: schema version"
+	log := s.log.With(slog.String("operation", op))
+
+	var version int64
+	var dirty bool
+	err := s.db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1;`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		log.ErrorContext(ctx, "failed to read the schema version", "error", err)
+		return 0, false, classify(err)
+	}
+
+	return uint(version), dirty, nil
+}
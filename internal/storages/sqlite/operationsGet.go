@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// OperationsGet returns the transactions where the user is the sender or the receiver, newest first, paginated with
+// the limit and offset of the request. If the page is empty, ErrOperationsNotFound is returned.
+func (s *SQLiteDB) OperationsGet(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error) {
+	op := "Database: get user operations "
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "OperationsGet func call", "data", req)
+
+	queryGet := `
+		SELECT
+			t.id,
+			t.success,
+			t.type_operation,
+			t.amount,
+			t.date_operation,
+			CASE
+				WHEN t.type_operation != 'deposit' THEN u_sender.name
+				ELSE NULL
+			END AS sender_name,
+			CASE
+				WHEN t.type_operation != 'deposit' THEN u_receiver.name
+				ELSE NULL
+			END AS receiver_name
+		FROM
+			transactions t
+		LEFT JOIN
+			users u_sender ON t.sender_id = u_sender.id
+		LEFT JOIN
+			users u_receiver ON t.receiver_id = u_receiver.id
+		WHERE
+			t.sender_id = ?1 OR t.receiver_id = ?1
+		ORDER BY
+			t.date_operation DESC,
+			t.id DESC
+		LIMIT ?2 OFFSET ?3;`
+
+	rows, err := s.db.QueryContext(ctx, queryGet, req.UserID, req.Limit, req.Offset)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, classify(err)
+	}
+	defer rows.Close()
+
+	var resp models.UserOperationsResponse
+	for rows.Next() {
+		var t models.Transaction
+		var amount int64
+		err := rows.Scan(
+			&t.ID,
+			&t.Success,
+			&t.TypeOperation,
+			&amount,
+			&t.Date,
+			&t.SenderName,
+			&t.ReceiverName,
+		)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to scan transaction", "error", err)
+			return nil, classify(err)
+		}
+		t.Amount = storages.FromCents(amount)
+		resp.Operation = append(resp.Operation, &t)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return nil, classify(err)
+	}
+
+	if len(resp.Operation) == 0 {
+		log.WarnContext(ctx, "user has no operations")
+		return nil, storages.ErrOperationsNotFound
+	}
+
+	log.InfoContext(ctx, "transactions were successfully retrieved from the database")
+	return &resp, nil
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx, so an event is written either on its own or inside
+// the transaction of the balance change
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// OutboxAdd writes an event that is not a part of a balance change, e.g. transfer.failed. An event with the same ID
+// is written once.
+func (s *SQLiteDB) OutboxAdd(ctx context.Context, event *models.Event) error {
+	op := "Database: outbox event creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "OutboxAdd func call", "type", event.Type, "id", event.ID)
+
+	if err := s.outboxAdd(ctx, s.db, event); err != nil {
+		log.ErrorContext(ctx, "failed to add the event to the outbox", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "event successfully added to the outbox")
+	return nil
+}
+
+// outboxAdd inserts the event into the outbox with db, the event that is already there is skipped
+func (s *SQLiteDB) outboxAdd(ctx context.Context, db execer, event *models.Event) error {
+	queryCreate := `INSERT INTO outbox
+		(event_id, event_type, payload, created_at)
+		VALUES
+		(?, ?, ?, ?)
+		ON CONFLICT (event_id) DO NOTHING;`
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, queryCreate, event.ID, event.Type, string(payload), now()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// OutboxProcess passes the unpublished events to publish in the order they were written and marks the published ones.
+// Unlike Postgres, the events are not locked while publish runs: a transaction of SQLite holds the write lock of
+// the whole database, and the publisher writes to the same database (the webhook deliveries). SQLite is used by one
+// instance of the service, whose relay runs one call at a time, and the receivers drop duplicates by the ID anyway.
+func (s *SQLiteDB) OutboxProcess(ctx context.Context, limit int, publish func(ctx context.Context, event *models.Event) error) (int, error) {
+	op := "Database: outbox processing"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "OutboxProcess func call", "limit", limit)
+
+	queryGet := `SELECT id, payload
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT ?;`
+
+	queryPublished := `UPDATE outbox
+		SET published_at = ?
+		WHERE id = ?;`
+
+	type pendingEvent struct {
+		id      int64
+		payload string
+	}
+
+	rows, err := s.db.QueryContext(ctx, queryGet, limit)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return 0, classify(err)
+	}
+	defer rows.Close()
+
+	var pending []pendingEvent
+	for rows.Next() {
+		var item pendingEvent
+		if err := rows.Scan(&item.id, &item.payload); err != nil {
+			log.ErrorContext(ctx, "failed to scan outbox event", "error", err)
+			return 0, classify(err)
+		}
+		pending = append(pending, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return 0, classify(err)
+	}
+	rows.Close()
+
+	published := 0
+	for _, item := range pending {
+		var event models.Event
+		if err := json.Unmarshal([]byte(item.payload), &event); err != nil {
+			log.ErrorContext(ctx, "failed to decode the event", "outbox id", item.id, "error", err)
+			return published, err
+		}
+
+		if err := publish(ctx, &event); err != nil {
+			log.WarnContext(ctx, "failed to publish the event", "id", event.ID, "error", err)
+			return published, err
+		}
+
+		if _, err := s.db.ExecContext(ctx, queryPublished, now(), item.id); err != nil {
+			log.ErrorContext(ctx, "failed to mark the event as published", "id", event.ID, "error", err)
+			return published, classify(err)
+		}
+
+		published++
+	}
+
+	log.InfoContext(ctx, "outbox events successfully published", "count", published)
+	return published, nil
+}
@@ -0,0 +1,322 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+const scheduleColumns = `
+	id,
+	sender_id,
+	receiver_id,
+	amount,
+	period,
+	next_run,
+	active,
+	attempts,
+	retry_at,
+	last_error,
+	created_at,
+	version,
+	anchor_day`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSchedule(row scanner) (*models.ScheduledTransfer, error) {
+	var data models.ScheduledTransfer
+	var amount int64
+	if err := row.Scan(
+		&data.ID,
+		&data.SenderID,
+		&data.ReceiverID,
+		&amount,
+		&data.Period,
+		&data.NextRun,
+		&data.Active,
+		&data.Attempts,
+		&data.RetryAt,
+		&data.LastError,
+		&data.CreatedAt,
+		&data.Version,
+		&data.AnchorDay,
+	); err != nil {
+		return nil, err
+	}
+
+	data.Amount = storages.FromCents(amount)
+	return &data, nil
+}
+
+// utc converts an optional date to UTC, the form in which all dates are kept in SQLite
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	u := t.UTC()
+	return &u
+}
+
+// ScheduleCreate inserts a new scheduled transfer into the database.
+// The generated ID and creation date are written back into the provided structure.
+func (s *SQLiteDB) ScheduleCreate(ctx context.Context, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleCreate func call", "data", data)
+
+	createQuery := `INSERT INTO scheduled_transfers
+		(sender_id, receiver_id, amount, period, next_run, active, anchor_day, created_at)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id;`
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	createdAt := now()
+
+	row := s.db.QueryRowContext(ctx, createQuery, data.SenderID, data.ReceiverID, amount, data.Period, data.NextRun.UTC(), data.Active, data.AnchorDay, createdAt)
+	if err := row.Scan(&data.ID); err != nil {
+		log.ErrorContext(ctx, "failed to create scheduled transfer", "error", err)
+		return classify(err)
+	}
+
+	data.CreatedAt = createdAt
+
+	log.InfoContext(ctx, "scheduled transfer created successfully", "id", data.ID)
+	return nil
+}
+
+// ScheduleGet retrieves a scheduled transfer by its ID. If there is no such scheduled transfer, ErrScheduleNotFound is returned.
+func (s *SQLiteDB) ScheduleGet(ctx context.Context, id uint) (*models.ScheduledTransfer, error) {
+	op := "Database: get scheduled transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleGet func call", "id", id)
+
+	queryGet := `SELECT` + scheduleColumns + ` FROM scheduled_transfers WHERE id = ?;`
+
+	data, err := scanSchedule(s.db.QueryRowContext(ctx, queryGet, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.WarnContext(ctx, "scheduled transfer not found", "id", id)
+			return nil, storages.ErrScheduleNotFound
+		}
+		log.ErrorContext(ctx, "failed to get the scheduled transfer", "error", err)
+		return nil, classify(err)
+	}
+
+	log.InfoContext(ctx, "scheduled transfer is successfully retrieved from the database")
+	return data, nil
+}
+
+// ScheduleUpdate overwrites the amount, period, next run date with its anchor day and activity flag of a scheduled transfer.
+// The retry state is reset, so the updated schedule starts from a clean slate. A claim of the schedule is dropped,
+// so a run in progress cannot overwrite the update with its result.
+func (s *SQLiteDB) ScheduleUpdate(ctx context.Context, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer update"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleUpdate func call", "data", data)
+
+	updateQuery := `UPDATE scheduled_transfers
+		SET amount = ?,
+			period = ?,
+			next_run = ?,
+			anchor_day = ?,
+			active = ?,
+			attempts = 0,
+			retry_at = NULL,
+			last_error = NULL,
+			claimed_until = NULL,
+			version = version + 1
+		WHERE id = ?;`
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, updateQuery, amount, data.Period, data.NextRun.UTC(), data.AnchorDay, data.Active, data.ID)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to update the scheduled transfer", "error", err)
+		return classify(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to update the scheduled transfer", "error", err)
+		return classify(err)
+	}
+
+	if affected == 0 {
+		log.WarnContext(ctx, "scheduled transfer not found", "id", data.ID)
+		return storages.ErrScheduleNotFound
+	}
+
+	log.InfoContext(ctx, "scheduled transfer successfully updated")
+	return nil
+}
+
+// ScheduleDelete removes a scheduled transfer together with the history of its runs.
+func (s *SQLiteDB) ScheduleDelete(ctx context.Context, id uint) error {
+	op := "Database: scheduled transfer delete"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleDelete func call", "id", id)
+
+	deleteQuery := `DELETE FROM scheduled_transfers WHERE id = ?;`
+
+	res, err := s.db.ExecContext(ctx, deleteQuery, id)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to delete the scheduled transfer", "error", err)
+		return classify(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to delete the scheduled transfer", "error", err)
+		return classify(err)
+	}
+
+	if affected == 0 {
+		log.WarnContext(ctx, "scheduled transfer not found", "id", id)
+		return storages.ErrScheduleNotFound
+	}
+
+	log.InfoContext(ctx, "scheduled transfer successfully deleted")
+	return nil
+}
+
+// SchedulesDue claims active scheduled transfers whose run date (or retry date, if the last run failed) has come and
+// returns them. The claim is taken in one UPDATE statement, which SQLite runs under the write lock, so two schedulers
+// never get the same schedule: it is not due again until claimUntil or until its run is saved. The oldest runs are
+// returned first, no more than limit items.
+func (s *SQLiteDB) SchedulesDue(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error) {
+	op := "Database: get due scheduled transfers"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "SchedulesDue func call", "now", now, "claim until", claimUntil, "limit", limit)
+
+	queryDue := `UPDATE scheduled_transfers
+		SET claimed_until = ?,
+			version = version + 1
+		WHERE id IN (
+			SELECT id
+			FROM scheduled_transfers
+			WHERE active
+				AND COALESCE(retry_at, next_run) <= ?
+				AND (claimed_until IS NULL OR claimed_until <= ?)
+			ORDER BY next_run
+			LIMIT ?)
+		RETURNING` + scheduleColumns + `;`
+
+	rows, err := s.db.QueryContext(ctx, queryDue, claimUntil.UTC(), now.UTC(), now.UTC(), limit)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, classify(err)
+	}
+	defer rows.Close()
+
+	var result []*models.ScheduledTransfer
+	for rows.Next() {
+		data, err := scanSchedule(rows)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to scan scheduled transfer", "error", err)
+			return nil, classify(err)
+		}
+		result = append(result, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return nil, classify(err)
+	}
+
+	// RETURNING does not keep the order of the subquery
+	storages.SortSchedules(result)
+
+	log.InfoContext(ctx, "due scheduled transfers were successfully retrieved", "count", len(result))
+	return result, nil
+}
+
+// ScheduleRunSave records the result of a scheduled transfer run and saves the new state of the schedule
+// (next run date, retry date, attempts) in one database transaction, so the history and the state never diverge.
+// The claim is released. If the schedule is no longer under the claim of data.Version, ErrScheduleChanged is returned.
+func (s *SQLiteDB) ScheduleRunSave(ctx context.Context, run *models.ScheduledTransferRun, data *models.ScheduledTransfer) error {
+	op := "Database: scheduled transfer run save"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "ScheduleRunSave func call", "run", run, "data", data)
+
+	insertRunQuery := `INSERT INTO scheduled_transfer_runs
+		(schedule_id, run_date, attempt, idempotency_key, success, error, date_run)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?);`
+
+	updateScheduleQuery := `UPDATE scheduled_transfers
+		SET next_run = ?,
+			active = ?,
+			attempts = ?,
+			retry_at = ?,
+			last_error = ?,
+			claimed_until = NULL,
+			version = version + 1
+		WHERE id = ? AND version = ?;`
+
+	// Start transaction
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return classify(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, insertRunQuery, run.ScheduleID, run.RunDate.UTC(), run.Attempt, run.IdempotencyKey, run.Success, run.Error, now()); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query insert run in the database", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	res, err := tx.ExecContext(ctx, updateScheduleQuery, data.NextRun.UTC(), data.Active, data.Attempts, utc(data.RetryAt), data.LastError, data.ID, data.Version)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query update schedule in the database", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query update schedule in the database", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if affected == 0 {
+		log.WarnContext(ctx, "scheduled transfer was changed after it was claimed, the run is not saved", "id", data.ID)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return storages.ErrScheduleChanged
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorContext(ctx, "!!!ATTENTION!!! failed to commit transaction", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "scheduled transfer run successfully saved")
+	return nil
+}
@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteDB_Schedule(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	moscow := time.FixedZone("MSK", 3*60*60)
+	start := time.Date(2025, 2, 1, 13, 0, 0, 0, moscow)
+
+	data := models.ScheduledTransfer{SenderID: 1, ReceiverID: 2, Amount: 100.555, Period: "monthly", NextRun: start, Active: true, AnchorDay: 1}
+	require.NoError(t, db.ScheduleCreate(ctx, &data))
+
+	saved, err := db.ScheduleGet(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 100.56, saved.Amount)
+	assert.True(t, saved.NextRun.Equal(start))
+	assert.Equal(t, 1, saved.AnchorDay)
+	assert.Nil(t, saved.RetryAt)
+
+	lease := 10 * time.Minute
+
+	due, err := db.SchedulesDue(ctx, start.Add(-time.Second), start.Add(lease), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	due, err = db.SchedulesDue(ctx, start, start.Add(lease), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+
+	// claimed rows are not due again until the lease expires
+	again, err := db.SchedulesDue(ctx, start.Add(time.Minute), start.Add(time.Minute+lease), 10)
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	retryAt := start.Add(time.Hour)
+	msg := "insufficient funds"
+	saved = due[0]
+	saved.Attempts = 1
+	saved.RetryAt = &retryAt
+	saved.LastError = &msg
+	run := models.ScheduledTransferRun{ScheduleID: saved.ID, RunDate: start, Attempt: 0, IdempotencyKey: "key", Error: &msg}
+	stale := *saved
+	stale.Version--
+	assert.ErrorIs(t, db.ScheduleRunSave(ctx, &run, &stale), storages.ErrScheduleChanged)
+	require.NoError(t, db.ScheduleRunSave(ctx, &run, saved))
+
+	due, err = db.SchedulesDue(ctx, start.Add(time.Minute), start.Add(time.Minute+lease), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	due, err = db.SchedulesDue(ctx, retryAt, retryAt.Add(lease), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 1, due[0].Attempts)
+	assert.Equal(t, &msg, due[0].LastError)
+
+	require.NoError(t, db.ScheduleDelete(ctx, saved.ID))
+	assert.ErrorIs(t, db.ScheduleDelete(ctx, saved.ID), storages.ErrScheduleNotFound)
+
+	err = db.ScheduleCreate(ctx, &models.ScheduledTransfer{SenderID: 1, ReceiverID: 1, Amount: 1, Period: "once", NextRun: start, Active: true})
+	assert.ErrorIs(t, err, storages.ErrConstraint)
+}
@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/EvansTrein/iqProgers/internal/config"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/internal/storages/storagetest"
+	"github.com/EvansTrein/iqProgers/pkg/logs"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDB creates a database in a temporary file and applies the migrations
+func newTestDB(t *testing.T) *SQLiteDB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "wallet.db")
+
+	migrateDb, err := migrate.New("file://../../../migrations/sqlite", "sqlite://"+path)
+	require.NoError(t, err)
+	require.NoError(t, migrateDb.Up())
+	srcErr, dbErr := migrateDb.Close()
+	require.NoError(t, srcErr)
+	require.NoError(t, dbErr)
+
+	db, err := New(path, &config.Storage{MaxConns: 4}, logs.NewDiscardLogger())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+type testStore struct {
+	*SQLiteDB
+}
+
+func (s testStore) CreateUser(t *testing.T, balance int64) uint {
+	t.Helper()
+
+	var id uint
+	err := s.db.QueryRowContext(context.Background(), `INSERT INTO users (name, balance) VALUES ('test', ?) RETURNING id;`, balance).Scan(&id)
+	require.NoError(t, err)
+
+	return id
+}
+
+func (s testStore) Balance(t *testing.T, id uint) int64 {
+	t.Helper()
+
+	var balance int64
+	err := s.db.QueryRowContext(context.Background(), `SELECT balance FROM users WHERE id = ?;`, id).Scan(&balance)
+	require.NoError(t, err)
+
+	return balance
+}
+
+func TestSQLiteDB_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Store {
+		return testStore{newTestDB(t)}
+	})
+}
+
+// TestSQLiteDB_SchemaVersion checks that storages.SchemaVersion is increased together with the migrations
+func TestSQLiteDB_SchemaVersion(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.Ping(ctx))
+
+	version, dirty, err := db.SchemaVersion(ctx)
+	require.NoError(t, err)
+	require.False(t, dirty)
+	require.Equal(t, uint(storages.SchemaVersion), version)
+}
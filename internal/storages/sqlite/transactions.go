@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// TransactionCreate inserts a new transaction with success = false. For a deposit only the sender is saved.
+// The ID and the date of the new transaction are written back into data.
+func (s *SQLiteDB) TransactionCreate(ctx context.Context, data *models.Transaction) error {
+	op := "Database: transaction creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "createTransaction func call", "data", data)
+
+	createQuery := `INSERT INTO transactions
+		(sender_id, receiver_id, idempotency_key, type_operation, amount, date_operation)
+		VALUES
+		(?, ?, ?, ?, ?, ?)
+		RETURNING id;`
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	var receiverID *uint
+	if data.TypeOperation != "deposit" {
+		receiverID = &data.ReceiverID
+	}
+
+	date := now()
+
+	var id uint
+	row := s.db.QueryRowContext(ctx, createQuery, data.SenderID, receiverID, data.IdempotencyKey, data.TypeOperation, amount, date)
+	if err := row.Scan(&id); err != nil {
+		log.ErrorContext(ctx, "failed to create transaction", "error", err)
+		return classify(err)
+	}
+
+	data.ID = id
+	data.Date = date
+
+	log.InfoContext(ctx, "transaction created successfully", "id", id)
+	return nil
+}
+
+// TransactionSetResult sets the success status of the transaction with the given Idempotency-Key and returns its ID.
+// It is executed inside tx, so the result is saved together with the balance changes.
+func (s *SQLiteDB) TransactionSetResult(ctx context.Context, tx *sql.Tx, idempotencyKey string, success bool) (uint, error) {
+	op := "Database: set transaction result"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "TransactionSetResult func call", "idempotencyKey", idempotencyKey, "success", success)
+
+	resultQuery := `UPDATE transactions
+		SET success = ?
+		WHERE idempotency_key = ?
+		RETURNING id;`
+
+	var id uint
+	if err := tx.QueryRowContext(ctx, resultQuery, success, idempotencyKey).Scan(&id); err != nil {
+		log.ErrorContext(ctx, "failed to set the transaction result", "error", err)
+		return 0, classify(err)
+	}
+
+	log.InfoContext(ctx, "transaction result is successfully set")
+	return id, nil
+}
+
+// TransactionGet retrieves a transaction by its Idempotency-Key. The names of the users are returned only for transfers.
+// If the transaction is not found, ErrTransactionNotFound is returned.
+func (s *SQLiteDB) TransactionGet(ctx context.Context, idempotencyKey string) (*models.Transaction, error) {
+	op := "Database: get transactions"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "TransactionGet func call", "idempotencyKey", idempotencyKey)
+
+	queryGet := `
+		SELECT
+			t.id,
+			t.success,
+			t.type_operation,
+			t.amount,
+			t.date_operation,
+			CASE
+				WHEN t.type_operation != 'deposit' THEN u_sender.name
+				ELSE NULL
+			END AS sender_name,
+			CASE
+				WHEN t.type_operation != 'deposit' THEN u_receiver.name
+				ELSE NULL
+			END AS receiver_name
+		FROM
+			transactions t
+		LEFT JOIN
+			users u_sender ON t.sender_id = u_sender.id
+		LEFT JOIN
+			users u_receiver ON t.receiver_id = u_receiver.id
+		WHERE
+			t.idempotency_key = ?;`
+
+	var transaction models.Transaction
+	var amount int64
+
+	row := s.db.QueryRowContext(ctx, queryGet, idempotencyKey)
+	if err := row.Scan(
+		&transaction.ID,
+		&transaction.Success,
+		&transaction.TypeOperation,
+		&amount,
+		&transaction.Date,
+		&transaction.SenderName,
+		&transaction.ReceiverName,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.WarnContext(ctx, "transaction not found")
+			return nil, storages.ErrTransactionNotFound
+		}
+		log.ErrorContext(ctx, "failed to get the transaction", "error", err)
+		return nil, classify(err)
+	}
+
+	transaction.Amount = storages.FromCents(amount)
+
+	log.InfoContext(ctx, "transaction is successfully retrieved from the database")
+	return &transaction, nil
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+// Transfer moves the amount from the sender to the receiver within one database transaction. The transaction starts with
+// BEGIN IMMEDIATE and holds the write lock of the database until it ends, so the checked balance of the sender cannot be
+// changed by a concurrent transfer and two transfers can never deadlock. If the sender does not have enough funds,
+// ErrInsufficientFunds is returned and nothing is changed. On success the transaction with the Idempotency-Key is marked
+// as successful, the transfer.completed event is written to the outbox and the names of the users are written into data.
+func (s *SQLiteDB) Transfer(ctx context.Context, data *models.Transaction) error {
+	op := "Database: account transfer"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "Transfer func call", "data", data)
+
+	queryCheckBalance := `SELECT balance >= ? FROM users WHERE id = ?;`
+
+	queryUpdateSender := `UPDATE users
+		SET balance = balance - ?
+		WHERE id = ?;`
+
+	queryUpdateReceiver := `UPDATE users
+		SET balance = balance + ?
+		WHERE id = ?;`
+
+	queryGetName := `
+	SELECT
+		u_sender.name AS sender_name,
+		u_receiver.name AS receiver_name
+	FROM
+		users u_sender
+	JOIN
+		users u_receiver ON u_receiver.id = ?
+	WHERE
+		u_sender.id = ?;`
+
+	amount, err := storages.ToCents(data.Amount)
+	if err != nil {
+		log.WarnContext(ctx, "amount is out of range", "amount", data.Amount)
+		return err
+	}
+
+	// Start transaction
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return classify(err)
+	}
+
+	var checkBalance bool
+	if err := tx.QueryRowContext(ctx, queryCheckBalance, amount, data.SenderID).Scan(&checkBalance); err != nil {
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			log.WarnContext(ctx, "sender not found", "id", data.SenderID)
+			return storages.ErrUserNotFound
+		}
+		log.ErrorContext(ctx, "failed to execute SQL query check balance in the database", "error", err)
+		return classify(err)
+	}
+
+	if !checkBalance {
+		log.WarnContext(ctx, "insufficient account balance")
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return services.ErrInsufficientFunds
+	}
+
+	if _, err := tx.ExecContext(ctx, queryUpdateSender, amount, data.SenderID); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query update sender in the database", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, queryUpdateReceiver, amount, data.ReceiverID); err != nil {
+		log.ErrorContext(ctx, "failed to execute SQL query update receiver in the database", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if err := tx.QueryRowContext(ctx, queryGetName, data.ReceiverID, data.SenderID).Scan(&data.SenderName, &data.ReceiverName); err != nil {
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			log.WarnContext(ctx, "receiver not found", "id", data.ReceiverID)
+			return storages.ErrUserNotFound
+		}
+		log.ErrorContext(ctx, "failed to execute SQL query get name in the database", "error", err)
+		return classify(err)
+	}
+
+	if _, err := s.TransactionSetResult(ctx, tx, data.IdempotencyKey, true); err != nil {
+		log.ErrorContext(ctx, "failed to set the result of user transaction", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if err := s.outboxAdd(ctx, tx, services.TransferEvent(data, nil)); err != nil {
+		log.ErrorContext(ctx, "failed to add the event to the outbox", "error", err)
+		if err := tx.Rollback(); err != nil {
+			log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+		}
+		return classify(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorContext(ctx, "!!!ATTENTION!!! failed to commit transaction", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "transaction successfully completed")
+	return nil
+}
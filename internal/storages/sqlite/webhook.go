@@ -0,0 +1,325 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+)
+
+const webhookColumns = `
+	id,
+	user_id,
+	url,
+	secret,
+	created_at`
+
+const deliveryColumns = `
+	id,
+	webhook_id,
+	event_id,
+	event_type,
+	payload,
+	status,
+	attempts,
+	next_attempt,
+	last_error,
+	response_status,
+	created_at,
+	delivered_at`
+
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	var data models.Webhook
+	if err := row.Scan(
+		&data.ID,
+		&data.UserID,
+		&data.URL,
+		&data.Secret,
+		&data.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+func scanDelivery(row scanner) (*models.WebhookDelivery, error) {
+	var data models.WebhookDelivery
+	var payload string
+	if err := row.Scan(
+		&data.ID,
+		&data.WebhookID,
+		&data.EventID,
+		&data.EventType,
+		&payload,
+		&data.Status,
+		&data.Attempts,
+		&data.NextAttempt,
+		&data.LastError,
+		&data.ResponseStatus,
+		&data.CreatedAt,
+		&data.DeliveredAt,
+	); err != nil {
+		return nil, err
+	}
+
+	data.Payload = []byte(payload)
+	return &data, nil
+}
+
+// WebhookCreate inserts a new webhook subscription into the database.
+// The generated ID and creation date are written back into the provided structure.
+func (s *SQLiteDB) WebhookCreate(ctx context.Context, data *models.Webhook) error {
+	op := "Database: webhook creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookCreate func call", "user id", data.UserID, "url", data.URL)
+
+	createQuery := `INSERT INTO webhooks
+		(user_id, url, secret, created_at)
+		VALUES
+		(?, ?, ?, ?)
+		RETURNING id;`
+
+	createdAt := now()
+
+	row := s.db.QueryRowContext(ctx, createQuery, data.UserID, data.URL, data.Secret, createdAt)
+	if err := row.Scan(&data.ID); err != nil {
+		log.ErrorContext(ctx, "failed to create webhook", "error", err)
+		return classify(err)
+	}
+
+	data.CreatedAt = createdAt
+
+	log.InfoContext(ctx, "webhook created successfully", "id", data.ID)
+	return nil
+}
+
+// WebhookGet retrieves a webhook subscription by its ID. If there is no such subscription, ErrWebhookNotFound is returned.
+func (s *SQLiteDB) WebhookGet(ctx context.Context, id uint) (*models.Webhook, error) {
+	op := "Database: get webhook"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookGet func call", "id", id)
+
+	queryGet := `SELECT` + webhookColumns + ` FROM webhooks WHERE id = ?;`
+
+	data, err := scanWebhook(s.db.QueryRowContext(ctx, queryGet, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.WarnContext(ctx, "webhook not found", "id", id)
+			return nil, storages.ErrWebhookNotFound
+		}
+		log.ErrorContext(ctx, "failed to get the webhook", "error", err)
+		return nil, classify(err)
+	}
+
+	log.InfoContext(ctx, "webhook is successfully retrieved from the database")
+	return data, nil
+}
+
+// WebhookDelete removes a webhook subscription together with its deliveries.
+func (s *SQLiteDB) WebhookDelete(ctx context.Context, id uint) error {
+	op := "Database: webhook delete"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhookDelete func call", "id", id)
+
+	deleteQuery := `DELETE FROM webhooks WHERE id = ?;`
+
+	res, err := s.db.ExecContext(ctx, deleteQuery, id)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to delete the webhook", "error", err)
+		return classify(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		log.ErrorContext(ctx, "failed to delete the webhook", "error", err)
+		return classify(err)
+	}
+
+	if affected == 0 {
+		log.WarnContext(ctx, "webhook not found", "id", id)
+		return storages.ErrWebhookNotFound
+	}
+
+	log.InfoContext(ctx, "webhook successfully deleted")
+	return nil
+}
+
+// WebhooksFor returns the global webhook subscriptions and the subscriptions of the given users, ordered by ID.
+func (s *SQLiteDB) WebhooksFor(ctx context.Context, userIDs []uint) ([]*models.Webhook, error) {
+	op := "Database: get webhooks of users"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "WebhooksFor func call", "user ids", userIDs)
+
+	args := make([]any, 0, len(userIDs))
+	for _, id := range userIDs {
+		args = append(args, id)
+	}
+
+	queryFor := `SELECT` + webhookColumns + ` FROM webhooks WHERE user_id IS NULL`
+	if len(userIDs) > 0 {
+		queryFor += ` OR user_id IN (?` + strings.Repeat(", ?", len(userIDs)-1) + `)`
+	}
+	queryFor += ` ORDER BY id;`
+
+	rows, err := s.db.QueryContext(ctx, queryFor, args...)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, classify(err)
+	}
+	defer rows.Close()
+
+	var result []*models.Webhook
+	for rows.Next() {
+		data, err := scanWebhook(rows)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to scan webhook", "error", err)
+			return nil, classify(err)
+		}
+		result = append(result, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return nil, classify(err)
+	}
+
+	log.InfoContext(ctx, "webhooks were successfully retrieved", "count", len(result))
+	return result, nil
+}
+
+// DeliveriesCreate inserts new deliveries in one database transaction. A delivery of an event that the subscription
+// already has is skipped, the generated ID is written back only into the inserted deliveries.
+func (s *SQLiteDB) DeliveriesCreate(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	op := "Database: webhook deliveries creation"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "DeliveriesCreate func call", "count", len(deliveries))
+
+	createQuery := `INSERT INTO webhook_deliveries
+		(webhook_id, event_id, event_type, payload, status, attempts, next_attempt, created_at)
+		VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (webhook_id, event_id) DO NOTHING
+		RETURNING id;`
+
+	// Start transaction
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return classify(err)
+	}
+
+	createdAt := now()
+	for _, data := range deliveries {
+		row := tx.QueryRowContext(ctx, createQuery, data.WebhookID, data.EventID, data.EventType, string(data.Payload),
+			data.Status, data.Attempts, data.NextAttempt.UTC(), createdAt)
+		err := row.Scan(&data.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.ErrorContext(ctx, "failed to execute SQL query insert delivery in the database", "error", err)
+			if err := tx.Rollback(); err != nil {
+				log.ErrorContext(ctx, "!!!ATTENTION!!! failed to rollback transaction", "error", err)
+			}
+			return classify(err)
+		}
+		data.CreatedAt = createdAt
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.ErrorContext(ctx, "!!!ATTENTION!!! failed to commit transaction", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "webhook deliveries created successfully")
+	return nil
+}
+
+// DeliveriesDue returns the pending deliveries whose next attempt has come, the oldest first, no more than limit items.
+func (s *SQLiteDB) DeliveriesDue(ctx context.Context, now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	op := "Database: get due webhook deliveries"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "DeliveriesDue func call", "now", now, "limit", limit)
+
+	queryDue := `SELECT` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE status = ? AND next_attempt <= ?
+		ORDER BY next_attempt, id
+		LIMIT ?;`
+
+	return s.deliveries(ctx, log, queryDue, storages.DeliveryPending, now.UTC(), limit)
+}
+
+// DeliveriesGet returns the deliveries of a webhook subscription, the newest first, no more than limit items.
+func (s *SQLiteDB) DeliveriesGet(ctx context.Context, webhookID uint, limit int) ([]*models.WebhookDelivery, error) {
+	op := "Database: get webhook deliveries"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "DeliveriesGet func call", "webhook id", webhookID, "limit", limit)
+
+	queryGet := `SELECT` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?;`
+
+	return s.deliveries(ctx, log, queryGet, webhookID, limit)
+}
+
+func (s *SQLiteDB) deliveries(ctx context.Context, log *slog.Logger, query string, args ...any) ([]*models.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to retrieve records from the database", "error", err)
+		return nil, classify(err)
+	}
+	defer rows.Close()
+
+	var result []*models.WebhookDelivery
+	for rows.Next() {
+		data, err := scanDelivery(rows)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to scan webhook delivery", "error", err)
+			return nil, classify(err)
+		}
+		result = append(result, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.ErrorContext(ctx, "error after scanning rows", "error", err)
+		return nil, classify(err)
+	}
+
+	log.InfoContext(ctx, "webhook deliveries were successfully retrieved", "count", len(result))
+	return result, nil
+}
+
+// DeliverySave saves the result of a delivery attempt: the status, the attempts, the next attempt and the answer.
+// A delivery deleted together with its webhook while it was being sent is not an error.
+func (s *SQLiteDB) DeliverySave(ctx context.Context, data *models.WebhookDelivery) error {
+	op := "Database: webhook delivery save"
+	log := s.log.With(slog.String("operation", op))
+	log.DebugContext(ctx, "DeliverySave func call", "id", data.ID, "status", data.Status)
+
+	updateQuery := `UPDATE webhook_deliveries
+		SET status = ?,
+			attempts = ?,
+			next_attempt = ?,
+			last_error = ?,
+			response_status = ?,
+			delivered_at = ?
+		WHERE id = ?;`
+
+	if _, err := s.db.ExecContext(ctx, updateQuery, data.Status, data.Attempts, data.NextAttempt.UTC(), data.LastError,
+		data.ResponseStatus, utc(data.DeliveredAt), data.ID); err != nil {
+		log.ErrorContext(ctx, "failed to save the webhook delivery", "error", err)
+		return classify(err)
+	}
+
+	log.InfoContext(ctx, "webhook delivery successfully saved")
+	return nil
+}
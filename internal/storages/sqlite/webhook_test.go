@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteDB_Webhook(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	store := testStore{db}
+
+	userID := store.CreateUser(t, 0)
+	otherID := store.CreateUser(t, 0)
+
+	global := models.Webhook{URL: "http://localhost/global", Secret: "global-secret"}
+	require.NoError(t, db.WebhookCreate(ctx, &global))
+	personal := models.Webhook{UserID: &userID, URL: "http://localhost/user", Secret: "user-secret"}
+	require.NoError(t, db.WebhookCreate(ctx, &personal))
+	other := models.Webhook{UserID: &otherID, URL: "http://localhost/other", Secret: "other-secret"}
+	require.NoError(t, db.WebhookCreate(ctx, &other))
+
+	saved, err := db.WebhookGet(ctx, personal.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &userID, saved.UserID)
+	assert.Equal(t, "user-secret", saved.Secret)
+	assert.False(t, saved.CreatedAt.IsZero())
+
+	hooks, err := db.WebhooksFor(ctx, []uint{userID})
+	require.NoError(t, err)
+	require.Len(t, hooks, 2)
+	assert.Equal(t, global.ID, hooks[0].ID)
+	assert.Equal(t, personal.ID, hooks[1].ID)
+
+	hooks, err = db.WebhooksFor(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+
+	moscow := time.FixedZone("MSK", 3*60*60)
+	start := time.Date(2025, 2, 1, 13, 0, 0, 0, moscow)
+	eventID := uuid.NewString()
+
+	deliveries := []*models.WebhookDelivery{
+		{WebhookID: global.ID, EventID: eventID, EventType: "deposit.completed", Payload: []byte(`{"id":1}`), Status: storages.DeliveryPending, NextAttempt: start},
+		{WebhookID: personal.ID, EventID: eventID, EventType: "deposit.completed", Payload: []byte(`{"id":1}`), Status: storages.DeliveryPending, NextAttempt: start},
+	}
+	require.NoError(t, db.DeliveriesCreate(ctx, deliveries))
+	assert.NotZero(t, deliveries[0].ID)
+
+	// the same event again is skipped
+	again := []*models.WebhookDelivery{
+		{WebhookID: global.ID, EventID: eventID, EventType: "deposit.completed", Payload: []byte(`{"id":1}`), Status: storages.DeliveryPending, NextAttempt: start},
+	}
+	require.NoError(t, db.DeliveriesCreate(ctx, again))
+	assert.Zero(t, again[0].ID)
+
+	due, err := db.DeliveriesDue(ctx, start.Add(-time.Second), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	due, err = db.DeliveriesDue(ctx, start, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, `{"id":1}`, string(due[0].Payload))
+	assert.True(t, due[0].NextAttempt.Equal(start))
+
+	retryAt := start.Add(time.Minute)
+	msg := "unexpected status 500"
+	code := 500
+	due[0].Attempts = 1
+	due[0].NextAttempt = retryAt
+	due[0].LastError = &msg
+	due[0].ResponseStatus = &code
+	require.NoError(t, db.DeliverySave(ctx, due[0]))
+
+	deliveredAt := start.Add(time.Second)
+	due[1].Status = storages.DeliveryDelivered
+	due[1].Attempts = 1
+	due[1].DeliveredAt = &deliveredAt
+	require.NoError(t, db.DeliverySave(ctx, due[1]))
+
+	due, err = db.DeliveriesDue(ctx, retryAt, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 1, due[0].Attempts)
+	assert.Equal(t, &msg, due[0].LastError)
+	assert.Equal(t, &code, due[0].ResponseStatus)
+
+	history, err := db.DeliveriesGet(ctx, personal.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, storages.DeliveryDelivered, history[0].Status)
+	require.NotNil(t, history[0].DeliveredAt)
+	assert.True(t, history[0].DeliveredAt.Equal(deliveredAt))
+
+	require.NoError(t, db.WebhookDelete(ctx, global.ID))
+	assert.ErrorIs(t, db.WebhookDelete(ctx, global.ID), storages.ErrWebhookNotFound)
+	_, err = db.WebhookGet(ctx, global.ID)
+	assert.ErrorIs(t, err, storages.ErrWebhookNotFound)
+
+	history, err = db.DeliveriesGet(ctx, global.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, history, "the deliveries are deleted with the webhook")
+}
@@ -3,16 +3,28 @@ package storages
 import (
 	"context"
 	"errors"
+	"sort"
+	"time"
 
 	"github.com/EvansTrein/iqProgers/models"
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrOperationsNotFound = errors.New("operations not found")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrOperationsNotFound  = errors.New("operations not found")
+	ErrScheduleNotFound    = errors.New("scheduled transfer not found")
+	ErrBatchNotFound       = errors.New("transfer batch not found")
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	// ErrScheduleChanged is returned by ScheduleRunSave if the schedule was claimed again or updated after it was claimed
+	ErrScheduleChanged = errors.New("scheduled transfer was changed after it was claimed")
 	// ErrIdempotencyKeyAlreadyExists = errors.New("Idempotency-Key already exists")
 )
 
+// SchemaVersion is the number of the last migration. The Postgres and SQLite migrations are numbered the same way,
+// it must be increased together with a new migration, otherwise the readiness check fails.
+const SchemaVersion = 9
+
 type StoreWallet interface {
 	ExsistUser(ctx context.Context, id uint) (bool, error)
 	ExsistIdempotencyKey(ctx context.Context, uuid string) (bool, error)
@@ -20,5 +32,75 @@ type StoreWallet interface {
 	TransactionGet(ctx context.Context, idempotencyKey string) (*models.Transaction, error)
 	Deposit(ctx context.Context, req *models.DepositRequest) error
 	Transfer(ctx context.Context, req *models.Transaction) error
+	TransferBatch(ctx context.Context, req *models.TransferBatchRequest) (*models.TransferBatchResponse, error)
+	TransferBatchGet(ctx context.Context, idempotencyKey string) (*models.TransferBatchResponse, error)
 	OperationsGet(ctx context.Context, req *models.UserOperationsRequest) (*models.UserOperationsResponse, error)
+	OutboxAdd(ctx context.Context, event *models.Event) error
+}
+
+// StoreAccount reads the users with their balances. UserGet returns ErrUserNotFound if there is no such user.
+type StoreAccount interface {
+	UserGet(ctx context.Context, id uint) (*models.User, error)
+}
+
+// StoreSchedule keeps the scheduled transfers. SchedulesDue claims the due schedules until the given time, so another
+// instance of the scheduler does not get them before the claim expires or the run is saved. ScheduleRunSave saves
+// the run only if the schedule is still under the same claim (models.ScheduledTransfer.Version), otherwise it returns
+// ErrScheduleChanged and changes nothing.
+type StoreSchedule interface {
+	ExsistUser(ctx context.Context, id uint) (bool, error)
+	ScheduleCreate(ctx context.Context, data *models.ScheduledTransfer) error
+	ScheduleGet(ctx context.Context, id uint) (*models.ScheduledTransfer, error)
+	ScheduleUpdate(ctx context.Context, data *models.ScheduledTransfer) error
+	ScheduleDelete(ctx context.Context, id uint) error
+	SchedulesDue(ctx context.Context, now, claimUntil time.Time, limit int) ([]*models.ScheduledTransfer, error)
+	ScheduleRunSave(ctx context.Context, run *models.ScheduledTransferRun, data *models.ScheduledTransfer) error
+}
+
+// SortSchedules puts the due schedules in the order they are run: the oldest run date first, then by ID
+func SortSchedules(items []*models.ScheduledTransfer) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].NextRun.Equal(items[j].NextRun) {
+			return items[i].ID < items[j].ID
+		}
+		return items[i].NextRun.Before(items[j].NextRun)
+	})
+}
+
+// Statuses of a webhook delivery. A pending delivery is sent when its next attempt has come, a delivered or a dead one
+// is not sent again.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// StoreWebhook keeps the webhook subscriptions and the deliveries of the events to them. WebhooksFor returns
+// the subscriptions of the given users and the global ones. DeliveriesCreate skips a delivery of an event that
+// the subscription already has, so an event published twice is sent once.
+type StoreWebhook interface {
+	ExsistUser(ctx context.Context, id uint) (bool, error)
+	WebhookCreate(ctx context.Context, data *models.Webhook) error
+	WebhookGet(ctx context.Context, id uint) (*models.Webhook, error)
+	WebhookDelete(ctx context.Context, id uint) error
+	WebhooksFor(ctx context.Context, userIDs []uint) ([]*models.Webhook, error)
+	DeliveriesCreate(ctx context.Context, deliveries []*models.WebhookDelivery) error
+	DeliveriesDue(ctx context.Context, now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	DeliverySave(ctx context.Context, data *models.WebhookDelivery) error
+	DeliveriesGet(ctx context.Context, webhookID uint, limit int) ([]*models.WebhookDelivery, error)
+}
+
+// StoreOutbox keeps the events written together with the balance changes until they are published. OutboxProcess
+// passes up to limit unpublished events to publish in the order they were written and marks the published ones.
+// It stops at the first error of publish, the event stays unpublished and is passed again by the next call.
+// The number of the published events is returned.
+type StoreOutbox interface {
+	OutboxProcess(ctx context.Context, limit int, publish func(ctx context.Context, event *models.Event) error) (int, error)
+}
+
+// StoreHealth is used by the readiness check. SchemaVersion returns the version of the applied migrations and
+// whether the last migration failed halfway (dirty), version 0 means no migrations were applied.
+type StoreHealth interface {
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (version uint, dirty bool, err error)
 }
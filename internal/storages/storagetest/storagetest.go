@@ -0,0 +1,530 @@
+// Package storagetest is a conformance suite shared by all StoreWallet drivers. Every driver runs the same
+// scenarios from its own tests, so the drivers behave the same way for the service layer.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	services "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+	"github.com/EvansTrein/iqProgers/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unknownUserID is an ID that no driver is expected to have
+const unknownUserID = 1 << 30
+
+// Store is a driver under test. Besides StoreWallet, StoreOutbox and StoreAccount it can create users with a known balance and read balances back,
+// which the API does not allow. Balances are in cents.
+type Store interface {
+	storages.StoreWallet
+	storages.StoreOutbox
+	storages.StoreAccount
+	CreateUser(t *testing.T, balance int64) uint
+	Balance(t *testing.T, id uint) int64
+}
+
+// Factory returns a ready to use driver. The suite creates its own users and keys, so the driver may be shared
+// with other tests and does not have to be empty.
+type Factory func(t *testing.T) Store
+
+// Run runs the whole suite against the driver returned by factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Store)
+	}{
+		{"ExsistUser", testExsistUser},
+		{"UserGet", testUserGet},
+		{"IdempotentReplay", testIdempotentReplay},
+		{"TransactionNotFound", testTransactionNotFound},
+		{"Deposit", testDeposit},
+		{"Transfer", testTransfer},
+		{"InsufficientFunds", testInsufficientFunds},
+		{"TransferRetry", testTransferRetry},
+		{"AmountOutOfRange", testAmountOutOfRange},
+		{"ConcurrentTransfers", testConcurrentTransfers},
+		{"Pagination", testPagination},
+		{"OperationsNotFound", testOperationsNotFound},
+		{"TransferBatchAtomic", testTransferBatchAtomic},
+		{"TransferBatchBestEffort", testTransferBatchBestEffort},
+		{"Outbox", testOutbox},
+		{"OutboxPublishError", testOutboxPublishError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, factory(t))
+		})
+	}
+}
+
+func deposit(t *testing.T, s Store, key string, userID uint, amount float64) *models.Transaction {
+	t.Helper()
+	ctx := context.Background()
+
+	data := models.Transaction{
+		IdempotencyKey: key,
+		SenderID:       userID,
+		TypeOperation:  "deposit",
+		Amount:         amount,
+	}
+	require.NoError(t, s.TransactionCreate(ctx, &data))
+	require.NoError(t, s.Deposit(ctx, &models.DepositRequest{IdempotencyKey: key, UserID: userID, Amount: amount}))
+
+	return &data
+}
+
+func transfer(s Store, key string, senderID, receiverID uint, amount float64) (*models.Transaction, error) {
+	ctx := context.Background()
+
+	data := models.Transaction{
+		IdempotencyKey: key,
+		SenderID:       senderID,
+		ReceiverID:     receiverID,
+		TypeOperation:  "transfer",
+		Amount:         amount,
+	}
+	if err := s.TransactionCreate(ctx, &data); err != nil {
+		return nil, err
+	}
+
+	return &data, s.Transfer(ctx, &data)
+}
+
+func testExsistUser(t *testing.T, s Store) {
+	ctx := context.Background()
+	id := s.CreateUser(t, 0)
+
+	exsist, err := s.ExsistUser(ctx, id)
+	require.NoError(t, err)
+	assert.True(t, exsist)
+
+	exsist, err = s.ExsistUser(ctx, unknownUserID)
+	require.NoError(t, err)
+	assert.False(t, exsist)
+}
+
+func testUserGet(t *testing.T, s Store) {
+	ctx := context.Background()
+	id := s.CreateUser(t, 1050)
+
+	user, err := s.UserGet(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, id, user.ID)
+	assert.NotEmpty(t, user.Name)
+	assert.Equal(t, 10.50, user.Balance)
+
+	_, err = s.UserGet(ctx, unknownUserID)
+	assert.ErrorIs(t, err, storages.ErrUserNotFound)
+}
+
+func testIdempotentReplay(t *testing.T, s Store) {
+	ctx := context.Background()
+	id := s.CreateUser(t, 0)
+	key := uuid.NewString()
+
+	exsist, err := s.ExsistIdempotencyKey(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, exsist)
+
+	created := deposit(t, s, key, id, 10.25)
+
+	exsist, err = s.ExsistIdempotencyKey(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, exsist)
+
+	replay, err := s.TransactionGet(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, replay.ID)
+	assert.True(t, replay.Success)
+	assert.Equal(t, "deposit", replay.TypeOperation)
+	assert.Equal(t, 10.25, replay.Amount)
+
+	err = s.TransactionCreate(ctx, &models.Transaction{IdempotencyKey: key, SenderID: id, TypeOperation: "deposit", Amount: 10.25})
+	assert.ErrorIs(t, err, storages.ErrDuplicate)
+	assert.ErrorIs(t, err, storages.ErrIdempotencyKeyExists)
+	assert.Equal(t, int64(1025), s.Balance(t, id))
+}
+
+func testTransactionNotFound(t *testing.T, s Store) {
+	_, err := s.TransactionGet(context.Background(), uuid.NewString())
+	assert.ErrorIs(t, err, storages.ErrTransactionNotFound)
+}
+
+func testDeposit(t *testing.T, s Store) {
+	ctx := context.Background()
+	id := s.CreateUser(t, 100)
+
+	deposit(t, s, uuid.NewString(), id, 0.01)
+	deposit(t, s, uuid.NewString(), id, 99.99)
+	assert.Equal(t, int64(10100), s.Balance(t, id))
+
+	err := s.TransactionCreate(ctx, &models.Transaction{IdempotencyKey: uuid.NewString(), SenderID: unknownUserID, TypeOperation: "deposit", Amount: 1})
+	assert.ErrorIs(t, err, storages.ErrReferenceNotFound)
+
+	err = s.Deposit(ctx, &models.DepositRequest{IdempotencyKey: uuid.NewString(), UserID: unknownUserID, Amount: 1})
+	assert.ErrorIs(t, err, storages.ErrUserNotFound)
+}
+
+func testTransfer(t *testing.T, s Store) {
+	ctx := context.Background()
+	sender := s.CreateUser(t, 1000)
+	receiver := s.CreateUser(t, 0)
+	key := uuid.NewString()
+
+	data, err := transfer(s, key, sender, receiver, 2.5)
+	require.NoError(t, err)
+	assert.NotNil(t, data.SenderName)
+	assert.NotNil(t, data.ReceiverName)
+
+	assert.Equal(t, int64(750), s.Balance(t, sender))
+	assert.Equal(t, int64(250), s.Balance(t, receiver))
+
+	saved, err := s.TransactionGet(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, saved.Success)
+	assert.Equal(t, data.SenderName, saved.SenderName)
+	assert.Equal(t, data.ReceiverName, saved.ReceiverName)
+
+	_, err = transfer(s, uuid.NewString(), sender, unknownUserID, 1)
+	assert.ErrorIs(t, err, storages.ErrReferenceNotFound)
+	assert.Equal(t, int64(750), s.Balance(t, sender))
+}
+
+func testInsufficientFunds(t *testing.T, s Store) {
+	ctx := context.Background()
+	sender := s.CreateUser(t, 1000)
+	receiver := s.CreateUser(t, 0)
+	key := uuid.NewString()
+
+	_, err := transfer(s, key, sender, receiver, 10.01)
+	assert.ErrorIs(t, err, services.ErrInsufficientFunds)
+
+	assert.Equal(t, int64(1000), s.Balance(t, sender))
+	assert.Equal(t, int64(0), s.Balance(t, receiver))
+
+	saved, err := s.TransactionGet(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, saved.Success)
+
+	_, err = transfer(s, uuid.NewString(), sender, receiver, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), s.Balance(t, sender))
+}
+
+// testTransferRetry checks that a failed transfer can be executed again with the same transaction, this is how the
+// scheduler retries a run under its Idempotency-Key
+func testTransferRetry(t *testing.T, s Store) {
+	ctx := context.Background()
+	sender := s.CreateUser(t, 500)
+	receiver := s.CreateUser(t, 0)
+	key := uuid.NewString()
+
+	data, err := transfer(s, key, sender, receiver, 10)
+	assert.ErrorIs(t, err, services.ErrInsufficientFunds)
+
+	deposit(t, s, uuid.NewString(), sender, 5)
+	require.NoError(t, s.Transfer(ctx, data))
+
+	saved, err := s.TransactionGet(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, saved.Success)
+	assert.Equal(t, data.ID, saved.ID)
+	assert.Equal(t, int64(0), s.Balance(t, sender))
+	assert.Equal(t, int64(1000), s.Balance(t, receiver))
+}
+
+// testAmountOutOfRange checks that an amount that does not fit in cents is rejected before it reaches the database
+// and changes nothing, a wrapped around amount would turn a deposit into a withdrawal
+func testAmountOutOfRange(t *testing.T, s Store) {
+	ctx := context.Background()
+	sender := s.CreateUser(t, 1000)
+	receiver := s.CreateUser(t, 0)
+	const amount = 1e17
+
+	key := uuid.NewString()
+	err := s.TransactionCreate(ctx, &models.Transaction{IdempotencyKey: key, SenderID: sender, TypeOperation: "deposit", Amount: amount})
+	assert.ErrorIs(t, err, storages.ErrConstraint)
+
+	exsist, err := s.ExsistIdempotencyKey(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, exsist)
+
+	err = s.Deposit(ctx, &models.DepositRequest{IdempotencyKey: uuid.NewString(), UserID: sender, Amount: amount})
+	assert.ErrorIs(t, err, storages.ErrConstraint)
+
+	err = s.Transfer(ctx, &models.Transaction{IdempotencyKey: uuid.NewString(), SenderID: sender, ReceiverID: receiver, TypeOperation: "transfer", Amount: amount})
+	assert.ErrorIs(t, err, storages.ErrConstraint)
+
+	req := newBatch(services.BatchModeBestEffort, sender, receiver, 1, amount)
+	_, err = s.TransferBatch(ctx, req)
+	assert.ErrorIs(t, err, storages.ErrConstraint)
+
+	_, err = s.TransferBatchGet(ctx, req.IdempotencyKey)
+	assert.ErrorIs(t, err, storages.ErrBatchNotFound)
+
+	assert.Equal(t, int64(1000), s.Balance(t, sender))
+	assert.Equal(t, int64(0), s.Balance(t, receiver))
+}
+
+// testConcurrentTransfers moves money around a ring of users in both directions at once.
+// Whatever the interleaving, no money may appear or disappear.
+func testConcurrentTransfers(t *testing.T, s Store) {
+	const startBalance = 10000
+	const rounds = 20
+
+	users := []uint{s.CreateUser(t, startBalance), s.CreateUser(t, startBalance), s.CreateUser(t, startBalance)}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*rounds*len(users))
+	for i := 0; i < rounds; i++ {
+		for j := range users {
+			next := users[(j+1)%len(users)]
+			for _, pair := range [][2]uint{{users[j], next}, {next, users[j]}} {
+				wg.Add(1)
+				go func(sender, receiver uint) {
+					defer wg.Done()
+					_, err := transfer(s, uuid.NewString(), sender, receiver, 1.25)
+					errs <- err
+				}(pair[0], pair[1])
+			}
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	var total int64
+	for _, id := range users {
+		total += s.Balance(t, id)
+	}
+	assert.Equal(t, int64(startBalance*len(users)), total)
+}
+
+func testPagination(t *testing.T, s Store) {
+	ctx := context.Background()
+	id := s.CreateUser(t, 0)
+	other := s.CreateUser(t, 0)
+
+	var created []*models.Transaction
+	for i := 1; i <= 4; i++ {
+		created = append(created, deposit(t, s, uuid.NewString(), id, float64(i)))
+	}
+	sent, err := transfer(s, uuid.NewString(), id, other, 1)
+	require.NoError(t, err)
+	created = append(created, sent)
+
+	resp, err := s.OperationsGet(ctx, &models.UserOperationsRequest{UserID: id, Offset: 0, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, resp.Operation, len(created))
+
+	for i, op := range resp.Operation {
+		want := created[len(created)-1-i]
+		assert.Equal(t, want.ID, op.ID, fmt.Sprintf("operation %d", i))
+	}
+
+	assert.Equal(t, "transfer", resp.Operation[0].TypeOperation)
+	assert.NotNil(t, resp.Operation[0].SenderName)
+	assert.Nil(t, resp.Operation[1].SenderName)
+	assert.Nil(t, resp.Operation[1].ReceiverName)
+
+	page, err := s.OperationsGet(ctx, &models.UserOperationsRequest{UserID: id, Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Operation, 2)
+	assert.Equal(t, created[3].ID, page.Operation[0].ID)
+	assert.Equal(t, created[2].ID, page.Operation[1].ID)
+
+	received, err := s.OperationsGet(ctx, &models.UserOperationsRequest{UserID: other, Offset: 0, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, received.Operation, 1)
+	assert.Equal(t, sent.ID, received.Operation[0].ID)
+
+	_, err = s.OperationsGet(ctx, &models.UserOperationsRequest{UserID: id, Offset: len(created), Limit: 10})
+	assert.ErrorIs(t, err, storages.ErrOperationsNotFound)
+}
+
+func testOperationsNotFound(t *testing.T, s Store) {
+	id := s.CreateUser(t, 0)
+
+	_, err := s.OperationsGet(context.Background(), &models.UserOperationsRequest{UserID: id, Offset: 0, Limit: 10})
+	assert.ErrorIs(t, err, storages.ErrOperationsNotFound)
+}
+
+func newBatch(mode string, senderID, receiverID uint, amounts ...float64) *models.TransferBatchRequest {
+	key := uuid.New()
+	req := &models.TransferBatchRequest{IdempotencyKey: key.String(), SenderID: senderID, Mode: mode}
+	for i, amount := range amounts {
+		req.Items = append(req.Items, &models.TransferBatchItem{
+			IdempotencyKey: uuid.NewSHA1(key, []byte(fmt.Sprint(i))).String(),
+			ReceiverID:     receiverID,
+			Amount:         amount,
+		})
+	}
+	return req
+}
+
+func testTransferBatchAtomic(t *testing.T, s Store) {
+	ctx := context.Background()
+	sender := s.CreateUser(t, 1000)
+	receiver := s.CreateUser(t, 0)
+
+	req := newBatch(services.BatchModeAtomic, sender, receiver, 5, 6)
+	_, err := s.TransferBatch(ctx, req)
+	assert.ErrorIs(t, err, services.ErrInsufficientFunds)
+
+	assert.Equal(t, int64(1000), s.Balance(t, sender))
+	assert.Equal(t, int64(0), s.Balance(t, receiver))
+
+	_, err = s.TransferBatchGet(ctx, req.IdempotencyKey)
+	assert.ErrorIs(t, err, storages.ErrBatchNotFound)
+
+	exsist, err := s.ExsistIdempotencyKey(ctx, req.Items[0].IdempotencyKey)
+	require.NoError(t, err)
+	assert.False(t, exsist)
+
+	req = newBatch(services.BatchModeAtomic, sender, receiver, 5, 5)
+	resp, err := s.TransferBatch(ctx, req)
+	require.NoError(t, err)
+	assert.True(t, resp.Batch.Success)
+	assert.Equal(t, int64(0), s.Balance(t, sender))
+	assert.Equal(t, int64(1000), s.Balance(t, receiver))
+}
+
+func testTransferBatchBestEffort(t *testing.T, s Store) {
+	ctx := context.Background()
+	sender := s.CreateUser(t, 1000)
+	receiver := s.CreateUser(t, 0)
+
+	req := newBatch(services.BatchModeBestEffort, sender, receiver, 5, 6, 5, 1)
+	req.Items[3].Err = services.ErrSelfTransfer
+
+	resp, err := s.TransferBatch(ctx, req)
+	require.NoError(t, err)
+	assert.False(t, resp.Batch.Success)
+	require.Len(t, resp.Results, 4)
+
+	for i, want := range []bool{true, false, true, false} {
+		result := resp.Results[i]
+		assert.Equal(t, i, result.Position)
+		assert.Equal(t, want, result.Success, fmt.Sprintf("item %d", i))
+		assert.Equal(t, want, result.Transaction != nil, fmt.Sprintf("item %d", i))
+		assert.Equal(t, !want, result.Error != nil, fmt.Sprintf("item %d", i))
+	}
+	assert.Equal(t, services.ErrInsufficientFunds.Error(), *resp.Results[1].Error)
+	assert.Equal(t, services.ErrSelfTransfer.Error(), *resp.Results[3].Error)
+	assert.ErrorIs(t, resp.Results[1].Err, services.ErrInsufficientFunds)
+	assert.ErrorIs(t, resp.Results[3].Err, services.ErrSelfTransfer)
+
+	assert.Equal(t, int64(0), s.Balance(t, sender))
+	assert.Equal(t, int64(1000), s.Balance(t, receiver))
+
+	replay, err := s.TransferBatchGet(ctx, req.IdempotencyKey)
+	require.NoError(t, err)
+	assert.Equal(t, resp.Batch.ID, replay.Batch.ID)
+	assert.Equal(t, resp.Batch.Success, replay.Batch.Success)
+	require.Len(t, replay.Results, len(resp.Results))
+	for i := range resp.Results {
+		assert.Equal(t, resp.Results[i].Success, replay.Results[i].Success)
+		assert.Equal(t, resp.Results[i].Amount, replay.Results[i].Amount)
+		assert.Equal(t, resp.Results[i].Transaction, replay.Results[i].Transaction)
+		assert.Equal(t, resp.Results[i].Error, replay.Results[i].Error)
+	}
+
+	_, err = s.TransferBatch(ctx, req)
+	assert.ErrorIs(t, err, storages.ErrIdempotencyKeyExists)
+}
+
+// publishAll processes the whole outbox by small batches and returns the published events with the given Idempotency-Keys
+// in the order they were published. The events of the other tests are published too.
+func publishAll(t *testing.T, s Store, keys ...string) []*models.Event {
+	t.Helper()
+
+	var published []*models.Event
+	collect := func(ctx context.Context, event *models.Event) error {
+		if slices.Contains(keys, event.Data.IdempotencyKey) {
+			published = append(published, event)
+		}
+		return nil
+	}
+
+	for {
+		count, err := s.OutboxProcess(context.Background(), 2, collect)
+		require.NoError(t, err)
+		if count == 0 {
+			return published
+		}
+	}
+}
+
+func testOutbox(t *testing.T, s Store) {
+	ctx := context.Background()
+	sender := s.CreateUser(t, 1000)
+	receiver := s.CreateUser(t, 0)
+
+	dep := deposit(t, s, uuid.NewString(), receiver, 2)
+
+	tr, err := transfer(s, uuid.NewString(), sender, receiver, 3)
+	require.NoError(t, err)
+
+	failed, err := transfer(s, uuid.NewString(), sender, receiver, 100)
+	require.ErrorIs(t, err, services.ErrInsufficientFunds)
+	failedEvent := services.TransferEvent(failed, err)
+	require.NoError(t, s.OutboxAdd(ctx, failedEvent))
+	require.NoError(t, s.OutboxAdd(ctx, failedEvent), "an event is written once")
+
+	batch := newBatch(services.BatchModeBestEffort, sender, receiver, 1, 100)
+	resp, err := s.TransferBatch(ctx, batch)
+	require.NoError(t, err)
+
+	expected := []*models.Event{
+		services.DepositEvent(&models.DepositRequest{IdempotencyKey: dep.IdempotencyKey, UserID: receiver, Amount: 2}, dep.ID),
+		services.TransferEvent(tr, nil),
+		failedEvent,
+		services.BatchItemEvent(batch, resp.Results[0]),
+		services.BatchItemEvent(batch, resp.Results[1]),
+	}
+
+	published := publishAll(t, s, dep.IdempotencyKey, tr.IdempotencyKey, failed.IdempotencyKey,
+		batch.Items[0].IdempotencyKey, batch.Items[1].IdempotencyKey)
+
+	require.Len(t, published, len(expected))
+	for i, want := range expected {
+		assert.Equal(t, want.ID, published[i].ID, fmt.Sprintf("event %d", i))
+		assert.Equal(t, want.Type, published[i].Type, fmt.Sprintf("event %d", i))
+		assert.Equal(t, *want.Data, *published[i].Data, fmt.Sprintf("event %d", i))
+	}
+	assert.Equal(t, services.EventTransferFailed, published[4].Type)
+	assert.Equal(t, services.ReasonInsufficientFunds, published[4].Data.Reason)
+
+	assert.Empty(t, publishAll(t, s, dep.IdempotencyKey), "published events are not passed again")
+}
+
+func testOutboxPublishError(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := s.CreateUser(t, 0)
+	dep := deposit(t, s, uuid.NewString(), user, 1)
+
+	errPublish := errors.New("publisher is unavailable")
+	_, err := s.OutboxProcess(ctx, 1<<20, func(ctx context.Context, event *models.Event) error {
+		if event.Data.IdempotencyKey == dep.IdempotencyKey {
+			return errPublish
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, errPublish)
+
+	published := publishAll(t, s, dep.IdempotencyKey)
+	require.Len(t, published, 1, "the failed event stays in the outbox")
+	assert.Equal(t, services.EventDepositCompleted, published[0].Type)
+}
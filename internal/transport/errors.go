@@ -0,0 +1,97 @@
+// Package transport holds what the HTTP and the gRPC APIs share, so the two transports cannot drift apart:
+// the error codes of the API contract with the errors they stand for, and the checks of the request metadata.
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	serv "github.com/EvansTrein/iqProgers/internal/service"
+	"github.com/EvansTrein/iqProgers/internal/storages"
+)
+
+// Error codes are a part of the API contract, clients can rely on them, unlike on the messages.
+// The gRPC API sends them as the reason of the google.rpc.ErrorInfo detail.
+const (
+	CodeInvalidBody           = "INVALID_BODY"
+	CodeBodyTooLarge          = "BODY_TOO_LARGE"
+	CodeInvalidParams         = "INVALID_PARAMS"
+	CodeInvalidIdempotencyKey = "INVALID_IDEMPOTENCY_KEY"
+	CodeIdempotencyConflict   = "IDEMPOTENCY_CONFLICT"
+	CodeDuplicate             = "DUPLICATE"
+	CodeInsufficientFunds     = "INSUFFICIENT_FUNDS"
+	CodeNegativeBalance       = "NEGATIVE_BALANCE"
+	CodeSelfTransfer          = "SELF_TRANSFER"
+	CodeLimitExceeded         = "LIMIT_EXCEEDED"
+	CodeSenderNotFound        = "SENDER_NOT_FOUND"
+	CodeReceiverNotFound      = "RECEIVER_NOT_FOUND"
+	CodeUserNotFound          = "USER_NOT_FOUND"
+	CodeOperationsNotFound    = "OPERATIONS_NOT_FOUND"
+	CodeScheduleNotFound      = "SCHEDULE_NOT_FOUND"
+	CodeWebhookNotFound       = "WEBHOOK_NOT_FOUND"
+	CodeReferenceNotFound     = "REFERENCE_NOT_FOUND"
+	CodeConstraintViolation   = "CONSTRAINT_VIOLATION"
+	CodeTimeout               = "TIMEOUT"
+	CodeCanceled              = "CANCELED"
+	CodeUnavailable           = "SERVICE_UNAVAILABLE"
+	CodeMaintenance           = "MAINTENANCE"
+	CodeReadOnly              = "READ_ONLY"
+	CodeUnauthorized          = "UNAUTHORIZED"
+	CodeRateLimited           = "RATE_LIMITED"
+	CodeInternal              = "INTERNAL_ERROR"
+)
+
+// StatusClientClosedRequest is the non-standard status of a request canceled by the client, the client never reads it,
+// but the access log and the metrics do not count it as a server error
+const StatusClientClosedRequest = 499
+
+// Error is how an error is presented to the client. Status is the HTTP status, the gRPC API derives its code from it.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+// Internal is the error of everything that is not in the errorTable
+var Internal = Error{http.StatusInternalServerError, CodeInternal, "internal server error"}
+
+// errorTable maps the errors of the services and the storages to the API errors. It is checked from top to bottom
+// with errors.Is, so the more specific errors (ErrSenderNotFound wraps ErrUserNotFound, ErrIdempotencyKeyExists
+// wraps ErrDuplicate) must come first.
+var errorTable = []struct {
+	err error
+	Error
+}{
+	{serv.ErrInsufficientFunds, Error{http.StatusPaymentRequired, CodeInsufficientFunds, "insufficient funds"}},
+	{serv.ErrNegaticeBalance, Error{http.StatusUnprocessableEntity, CodeNegativeBalance, "balance cannot be negative"}},
+	{serv.ErrSelfTransfer, Error{http.StatusBadRequest, CodeSelfTransfer, "sender and receiver must be different users"}},
+	{serv.ErrLimitExceeded, Error{http.StatusUnprocessableEntity, CodeLimitExceeded, "amount exceeds the limit of one operation"}},
+	{serv.ErrSenderNotFound, Error{http.StatusNotFound, CodeSenderNotFound, "no sender with this id"}},
+	{serv.ErrReceiverNotFound, Error{http.StatusUnprocessableEntity, CodeReceiverNotFound, "no receiver with this id"}},
+	{serv.ErrReadOnly, Error{http.StatusServiceUnavailable, CodeReadOnly, "money movement is stopped, history is available, retry later"}},
+	{serv.ErrStopped, Error{http.StatusServiceUnavailable, CodeUnavailable, "service is temporarily unavailable, retry the request"}},
+	{storages.ErrUserNotFound, Error{http.StatusNotFound, CodeUserNotFound, "no user with this id"}},
+	{storages.ErrOperationsNotFound, Error{http.StatusNotFound, CodeOperationsNotFound, "user has no operations"}},
+	{storages.ErrScheduleNotFound, Error{http.StatusNotFound, CodeScheduleNotFound, "no scheduled transfer with this id"}},
+	{storages.ErrWebhookNotFound, Error{http.StatusNotFound, CodeWebhookNotFound, "no webhook with this id"}},
+	{storages.ErrIdempotencyKeyExists, Error{http.StatusConflict, CodeIdempotencyConflict, "a record with this Idempotency-Key already exists"}},
+	{storages.ErrDuplicate, Error{http.StatusConflict, CodeDuplicate, "record already exists"}},
+	{storages.ErrReferenceNotFound, Error{http.StatusNotFound, CodeReferenceNotFound, "referenced record not found"}},
+	{storages.ErrConstraint, Error{http.StatusUnprocessableEntity, CodeConstraintViolation, "data violates a constraint"}},
+	{storages.ErrRetryable, Error{http.StatusServiceUnavailable, CodeUnavailable, "service is temporarily unavailable, retry the request"}},
+	{storages.ErrUnavailable, Error{http.StatusServiceUnavailable, CodeUnavailable, "service is temporarily unavailable, retry the request"}},
+	{context.DeadlineExceeded, Error{http.StatusGatewayTimeout, CodeTimeout, "request processing timed out"}},
+	{context.Canceled, Error{StatusClientClosedRequest, CodeCanceled, "request is canceled by the client"}},
+}
+
+// LookupError returns the API error for err from the errorTable, or Internal
+func LookupError(err error) Error {
+	for _, e := range errorTable {
+		if errors.Is(err, e.err) {
+			return e.Error
+		}
+	}
+
+	return Internal
+}
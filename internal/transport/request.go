@@ -0,0 +1,29 @@
+package transport
+
+import "regexp"
+
+// MaxRequestIDLength limits the request ID accepted from the client, so it cannot flood the logs
+const MaxRequestIDLength = 128
+
+// guidRegex is the format of the Idempotency-Key
+var guidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidRequestID allows only printable ASCII characters without spaces
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidIdempotencyKey reports whether key is a UUID, in any case of the letters
+func ValidIdempotencyKey(key string) bool {
+	return guidRegex.MatchString(key)
+}
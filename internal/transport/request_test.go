@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"42dd3893-9baf-43ac-8c2b-32231f486b87", true},
+		{"42DD3893-9BAF-43AC-8C2B-32231F486B87", true},
+		{"42dd3893-9baf-43ac-8c2b-32231f486b8", false},
+		{"42dd3893a9baf-43ac-8c2b-32231f486b87", false},
+		{"not-a-uuid", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, ValidIdempotencyKey(tt.value), tt.value)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"req-42", true},
+		{strings.Repeat("a", MaxRequestIDLength), true},
+		{strings.Repeat("a", MaxRequestIDLength+1), false},
+		{"with space", false},
+		{"line\nbreak", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, ValidRequestID(tt.value), tt.value)
+	}
+}
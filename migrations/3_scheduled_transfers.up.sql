@@ -0,0 +1,30 @@
+CREATE TABLE scheduled_transfers (
+    id SERIAL PRIMARY KEY,
+    sender_id INT NOT NULL REFERENCES users(id),
+    receiver_id INT NOT NULL REFERENCES users(id),
+    amount BIGINT NOT NULL,
+    period VARCHAR(20) NOT NULL,
+    next_run TIMESTAMP WITH TIME ZONE NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true,
+    attempts INT NOT NULL DEFAULT 0,
+    retry_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_schedule_sender_not_receiver CHECK (sender_id <> receiver_id),
+    CONSTRAINT chk_schedule_amount_positive CHECK (amount > 0),
+    CONSTRAINT chk_schedule_period CHECK (period IN ('once', 'weekly', 'monthly'))
+);
+
+CREATE TABLE scheduled_transfer_runs (
+    id SERIAL PRIMARY KEY,
+    schedule_id INT NOT NULL REFERENCES scheduled_transfers(id) ON DELETE CASCADE,
+    run_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    attempt INT NOT NULL,
+    idempotency_key UUID NOT NULL,
+    success BOOLEAN NOT NULL DEFAULT false,
+    error TEXT,
+    date_run TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_scheduled_transfers_due ON scheduled_transfers (active, next_run);
+CREATE INDEX idx_scheduled_transfer_runs_schedule_id ON scheduled_transfer_runs (schedule_id);
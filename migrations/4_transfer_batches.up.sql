@@ -0,0 +1,21 @@
+CREATE TABLE transfer_batches (
+    id SERIAL PRIMARY KEY,
+    idempotency_key UUID UNIQUE NOT NULL,
+    sender_id INT NOT NULL REFERENCES users(id),
+    mode VARCHAR(20) NOT NULL,
+    success BOOLEAN NOT NULL DEFAULT false,
+    date_operation TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_batch_mode CHECK (mode IN ('atomic', 'best_effort'))
+);
+
+CREATE TABLE transfer_batch_items (
+    id SERIAL PRIMARY KEY,
+    batch_id INT NOT NULL REFERENCES transfer_batches(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    receiver_id INT NOT NULL,
+    amount BIGINT NOT NULL,
+    transaction_id INT REFERENCES transactions(id),
+    success BOOLEAN NOT NULL DEFAULT false,
+    error TEXT,
+    CONSTRAINT uq_batch_item_position UNIQUE (batch_id, position)
+);
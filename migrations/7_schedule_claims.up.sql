@@ -0,0 +1,2 @@
+ALTER TABLE scheduled_transfers ADD COLUMN claimed_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE scheduled_transfers ADD COLUMN version INT NOT NULL DEFAULT 0;
\ No newline at end of file
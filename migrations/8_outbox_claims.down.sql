@@ -0,0 +1 @@
+ALTER TABLE outbox DROP COLUMN claimed_until;
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sender_id INTEGER REFERENCES users(id),
+    receiver_id INTEGER REFERENCES users(id),
+    idempotency_key TEXT UNIQUE NOT NULL,
+    success BOOLEAN NOT NULL DEFAULT false,
+    type_operation VARCHAR(80) NOT NULL,
+    amount BIGINT NOT NULL,
+    date_operation TIMESTAMP NOT NULL,
+    CONSTRAINT chk_sender_not_receiver CHECK (sender_id <> receiver_id)
+);
+
+CREATE INDEX idx_transactions_sender_id ON transactions (sender_id);
+CREATE INDEX idx_transactions_receiver_id ON transactions (receiver_id);
@@ -0,0 +1,2 @@
+DELETE FROM users
+WHERE name IN ('Sheldon', 'Leonard', 'Penny', 'Howard', 'Rajesh');
\ No newline at end of file
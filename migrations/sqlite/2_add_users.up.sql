@@ -0,0 +1,6 @@
+INSERT INTO users (name) VALUES
+('Sheldon'),
+('Leonard'),
+('Penny'),
+('Howard'),
+('Rajesh');
\ No newline at end of file
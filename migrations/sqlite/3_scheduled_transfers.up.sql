@@ -0,0 +1,30 @@
+CREATE TABLE scheduled_transfers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sender_id INTEGER NOT NULL REFERENCES users(id),
+    receiver_id INTEGER NOT NULL REFERENCES users(id),
+    amount BIGINT NOT NULL,
+    period VARCHAR(20) NOT NULL,
+    next_run TIMESTAMP NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    retry_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT chk_schedule_sender_not_receiver CHECK (sender_id <> receiver_id),
+    CONSTRAINT chk_schedule_amount_positive CHECK (amount > 0),
+    CONSTRAINT chk_schedule_period CHECK (period IN ('once', 'weekly', 'monthly'))
+);
+
+CREATE TABLE scheduled_transfer_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id INTEGER NOT NULL REFERENCES scheduled_transfers(id) ON DELETE CASCADE,
+    run_date TIMESTAMP NOT NULL,
+    attempt INTEGER NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    success BOOLEAN NOT NULL DEFAULT false,
+    error TEXT,
+    date_run TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_scheduled_transfers_due ON scheduled_transfers (active, next_run);
+CREATE INDEX idx_scheduled_transfer_runs_schedule_id ON scheduled_transfer_runs (schedule_id);
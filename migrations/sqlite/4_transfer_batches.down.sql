@@ -0,0 +1,2 @@
+DROP TABLE transfer_batch_items;
+DROP TABLE transfer_batches;
@@ -0,0 +1,21 @@
+CREATE TABLE transfer_batches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    idempotency_key TEXT UNIQUE NOT NULL,
+    sender_id INTEGER NOT NULL REFERENCES users(id),
+    mode VARCHAR(20) NOT NULL,
+    success BOOLEAN NOT NULL DEFAULT false,
+    date_operation TIMESTAMP NOT NULL,
+    CONSTRAINT chk_batch_mode CHECK (mode IN ('atomic', 'best_effort'))
+);
+
+CREATE TABLE transfer_batch_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    batch_id INTEGER NOT NULL REFERENCES transfer_batches(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    receiver_id INTEGER NOT NULL,
+    amount BIGINT NOT NULL,
+    transaction_id INTEGER REFERENCES transactions(id),
+    success BOOLEAN NOT NULL DEFAULT false,
+    error TEXT,
+    CONSTRAINT uq_batch_item_position UNIQUE (batch_id, position)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE scheduled_transfers DROP COLUMN version;
+ALTER TABLE scheduled_transfers DROP COLUMN claimed_until;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE scheduled_transfers ADD COLUMN claimed_until TIMESTAMP;
+ALTER TABLE scheduled_transfers ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
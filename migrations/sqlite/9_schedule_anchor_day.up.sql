@@ -0,0 +1 @@
+ALTER TABLE scheduled_transfers ADD COLUMN anchor_day INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
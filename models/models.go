@@ -2,10 +2,55 @@ package models
 
 import "time"
 
+// HandlerResponse is the body of error responses and of responses without data. Code is a stable machine-readable
+// error code, Details holds optional data about the error, e.g. the fields of the body that failed validation.
 type HandlerResponse struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-	Error   string `json:"error"`
+	Status    int            `json:"status"`
+	Code      string         `json:"code,omitempty"`
+	Message   string         `json:"message"`
+	RequestID string         `json:"request_id,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// ProblemDetails is the error body in the RFC 7807 format (application/problem+json), sent instead of HandlerResponse
+// when the client asks for it. Code, RequestID and Details are extension members with the same meaning as in HandlerResponse.
+type ProblemDetails struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"`
+	Code      string         `json:"code"`
+	RequestID string         `json:"request_id,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// HealthResponse is the body of /healthz and /readyz, Mode and Components are filled only by /readyz
+type HealthResponse struct {
+	Status     string                      `json:"status"`
+	Mode       string                      `json:"mode,omitempty"`
+	Components map[string]*ComponentHealth `json:"components,omitempty"`
+}
+
+// ComponentHealth is the state of one dependency checked by /readyz. Version and Expected are set for migrations.
+type ComponentHealth struct {
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+	Version  uint   `json:"version,omitempty"`
+	Expected uint   `json:"expected,omitempty"`
+}
+
+// ReadOnlyRequest turns the read-only mode of the admin API on or off
+type ReadOnlyRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// ReadOnlyResponse is the state of the read-only mode. ReadOnly is the effective mode, it is on if the config
+// (Config) or the admin API (Admin) turned it on.
+type ReadOnlyResponse struct {
+	ReadOnly bool `json:"read_only"`
+	Config   bool `json:"config"`
+	Admin    bool `json:"admin"`
 }
 
 type DepositRequest struct {
@@ -24,6 +69,9 @@ type TransferRequest struct {
 	SenderID       uint    `json:"sender_id" binding:"required"`
 	ReceiverID     uint    `json:"receiver_id" binding:"required"`
 	Amount         float64 `json:"amount" binding:"required,gt=0"`
+	// RetryFailed is set by the scheduler: a failed transfer with the same Idempotency-Key is executed again,
+	// instead of being returned as it is
+	RetryFailed bool `json:"-"`
 }
 
 type TransferResponse struct {
@@ -31,6 +79,45 @@ type TransferResponse struct {
 	Operation *Transaction `json:"operation"`
 }
 
+type TransferBatchRequest struct {
+	IdempotencyKey string               `json:"-"`
+	SenderID       uint                 `json:"sender_id" binding:"required"`
+	Mode           string               `json:"mode" binding:"required,oneof=atomic best_effort"`
+	Items          []*TransferBatchItem `json:"items" binding:"required,min=1,max=1000,dive"`
+}
+
+type TransferBatchItem struct {
+	IdempotencyKey string  `json:"-"`
+	ReceiverID     uint    `json:"receiver_id" binding:"required"`
+	Amount         float64 `json:"amount" binding:"required,gt=0"`
+	Err            error   `json:"-"` // set by the service for an item that failed the checks
+}
+
+type TransferBatchResponse struct {
+	Message string                 `json:"message"`
+	Batch   *TransferBatch         `json:"batch"`
+	Results []*TransferBatchResult `json:"results"`
+}
+
+type TransferBatch struct {
+	ID             uint      `json:"batch_id"`
+	IdempotencyKey string    `json:"-"`
+	SenderID       uint      `json:"sender_id"`
+	Mode           string    `json:"mode"`
+	Success        bool      `json:"success"`
+	Date           time.Time `json:"date"`
+}
+
+type TransferBatchResult struct {
+	Position    int     `json:"position"`
+	ReceiverID  uint    `json:"receiver_id"`
+	Amount      float64 `json:"amount"`
+	Success     bool    `json:"success"`
+	Error       *string `json:"error,omitempty"`
+	Transaction *uint   `json:"transaction_id,omitempty"`
+	Err         error   `json:"-"` // the typed cause of Error, nil for the results read back from the storage
+}
+
 type UserOperationsRequest struct {
 	UserID uint
 	Offset int
@@ -60,3 +147,114 @@ type User struct {
 	Name    string
 	Balance float64
 }
+
+type ScheduledTransferRequest struct {
+	SenderID   uint      `json:"sender_id" binding:"required"`
+	ReceiverID uint      `json:"receiver_id" binding:"required,nefield=SenderID"`
+	Amount     float64   `json:"amount" binding:"required,gt=0"`
+	Period     string    `json:"period" binding:"required,oneof=once weekly monthly"`
+	StartAt    time.Time `json:"start_at" binding:"required"`
+}
+
+type ScheduledTransferUpdateRequest struct {
+	ID      uint      `json:"-"`
+	Amount  float64   `json:"amount" binding:"required,gt=0"`
+	Period  string    `json:"period" binding:"required,oneof=once weekly monthly"`
+	StartAt time.Time `json:"start_at" binding:"required"`
+	Active  bool      `json:"active"`
+}
+
+type ScheduledTransferResponse struct {
+	Message  string             `json:"message"`
+	Schedule *ScheduledTransfer `json:"schedule"`
+}
+
+type ScheduledTransfer struct {
+	ID         uint       `json:"id"`
+	SenderID   uint       `json:"sender_id"`
+	ReceiverID uint       `json:"receiver_id"`
+	Amount     float64    `json:"amount"`
+	Period     string     `json:"period"`
+	NextRun    time.Time  `json:"next_run"`
+	Active     bool       `json:"active"`
+	Attempts   int        `json:"attempts"`
+	RetryAt    *time.Time `json:"retry_at,omitempty"`
+	LastError  *string    `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Version changes with every claim and update of the schedule, the scheduler passes it back with the result of the run
+	Version int `json:"-"`
+	// AnchorDay is the day of the month of the start date (UTC), the monthly runs keep it, in shorter months they
+	// are moved to the last day
+	AnchorDay int `json:"-"`
+}
+
+type ScheduledTransferRun struct {
+	ScheduleID     uint
+	RunDate        time.Time
+	Attempt        int
+	IdempotencyKey string
+	Success        bool
+	Error          *string
+}
+
+type WebhookRequest struct {
+	UserID *uint  `json:"user_id" binding:"omitempty,gt=0"`
+	URL    string `json:"url" binding:"required,http_url,max=2048"`
+	Secret string `json:"secret" binding:"omitempty,min=16,max=256"`
+}
+
+type WebhookResponse struct {
+	Message string   `json:"message"`
+	Webhook *Webhook `json:"webhook"`
+}
+
+// Webhook is a subscription to the events of one user, or of all users if UserID is nil.
+// The secret is returned only when the subscription is created.
+type Webhook struct {
+	ID        uint      `json:"id"`
+	UserID    *uint     `json:"user_id,omitempty"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Message    string             `json:"message"`
+	Deliveries []*WebhookDelivery `json:"deliveries"`
+}
+
+// WebhookDelivery is one event sent to one subscription, Payload is the body of the request
+type WebhookDelivery struct {
+	ID             uint       `json:"id"`
+	WebhookID      uint       `json:"webhook_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        []byte     `json:"-"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttempt    time.Time  `json:"next_attempt"`
+	LastError      *string    `json:"last_error,omitempty"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Event is a change of the balances that happened, it is the body of the webhook requests
+type Event struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	CreatedAt time.Time  `json:"created_at"`
+	Data      *EventData `json:"data"`
+}
+
+// EventData describes the operation of the event. UserID is set for deposits, SenderID and ReceiverID for transfers,
+// Reason tells why a transfer failed.
+type EventData struct {
+	IdempotencyKey string  `json:"idempotency_key"`
+	TransactionID  uint    `json:"transaction_id,omitempty"`
+	UserID         uint    `json:"user_id,omitempty"`
+	SenderID       uint    `json:"sender_id,omitempty"`
+	ReceiverID     uint    `json:"receiver_id,omitempty"`
+	Amount         float64 `json:"amount"`
+	Reason         string  `json:"reason,omitempty"`
+}
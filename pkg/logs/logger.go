@@ -104,16 +104,18 @@ func (h *CustomHandler) WithGroup(name string) slog.Handler {
 	}
 }
 
-func InitLog(env string) *slog.Logger {
+// InitLog creates the logger of the environment. level is checked on every record, so a *slog.LevelVar
+// changes the level of the running application.
+func InitLog(env string, level slog.Leveler) *slog.Logger {
 	var log *slog.Logger
 
 	switch env {
 	case "local":
-		log = slog.New(NewCustomHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true}))
+		log = slog.New(NewContextHandler(NewCustomHandler(os.Stdout, &slog.HandlerOptions{Level: level, AddSource: true})))
 	case "dev":
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true}))
+		log = slog.New(NewContextHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level, AddSource: true})))
 	case "prod":
-		log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		log = slog.New(NewContextHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
 	}
 
 	return log